@@ -0,0 +1,60 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"strings"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdValidateCatalog() *cobra.Command {
+	var catalogFile, dripCampaignsFile, mailTemplatesDir string
+	cmd := &cobra.Command{
+		Use:               "validate",
+		Short:             "Validate plan catalog, drip campaigns and mail templates",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := server.LoadCatalog(catalogFile)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("catalog %s is valid: %d plans, %d aliases, %d quotation templates\n",
+				c.Version, len(c.Plans), len(c.Aliases), len(c.QuotationTemplates))
+
+			d, err := server.LoadDripCampaigns(dripCampaignsFile, c)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("drip campaigns %s are valid: %d campaigns\n", d.Version, len(d.Campaigns))
+
+			t, err := server.LoadMailTemplates(mailTemplatesDir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("mail templates are valid: locales %s\n", strings.Join(t.Locales(), ", "))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is validated")
+	cmd.Flags().StringVar(&dripCampaignsFile, "drip-campaigns-file", dripCampaignsFile, "Path to drip campaigns file. If empty, the embedded campaigns are validated")
+	cmd.Flags().StringVar(&mailTemplatesDir, "mail-templates-dir", mailTemplatesDir, "Path to a directory of mail templates that override the embedded templates")
+	return cmd
+}
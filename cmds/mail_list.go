@@ -0,0 +1,61 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdListMailPreviews() *cobra.Command {
+	var catalogFile, dripCampaignsFile, mailTemplatesDir string
+	cmd := &cobra.Command{
+		Use:               "list",
+		Short:             `List mailers and drip campaign steps that can be previewed`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := useMailPreviewFiles(catalogFile, dripCampaignsFile, mailTemplatesDir); err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tDESCRIPTION")
+			for _, p := range server.MailPreviews() {
+				fmt.Fprintf(w, "%s\t%s\n", p.Name, p.Description)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	cmd.Flags().StringVar(&dripCampaignsFile, "drip-campaigns-file", dripCampaignsFile, "Path to drip campaigns file. If empty, the embedded campaigns are used")
+	cmd.Flags().StringVar(&mailTemplatesDir, "mail-templates-dir", mailTemplatesDir, "Path to a directory of mail templates that override the embedded templates")
+	return cmd
+}
+
+func useMailPreviewFiles(catalogFile, dripCampaignsFile, mailTemplatesDir string) error {
+	if err := server.UseCatalogFile(catalogFile); err != nil {
+		return err
+	}
+	if err := server.UseDripCampaignsFile(dripCampaignsFile); err != nil {
+		return err
+	}
+	return server.UseMailTemplatesDir(mailTemplatesDir)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdPreviewMail() *cobra.Command {
+	var (
+		catalogFile       string
+		dripCampaignsFile string
+		mailTemplatesDir  string
+		locale            = server.DefaultMailLocale
+		format            = "html"
+		outDir            string
+		sendTo            string
+	)
+	cmd := &cobra.Command{
+		Use:               "preview [name]...",
+		Short:             `Render mailers or drip campaign steps with fixture data`,
+		Long:              `Render mailers or drip campaign steps with fixture data. Drip campaign steps are named drip/<campaign>/<step>. Run "mail list" to see the available names.`,
+		Args:              cobra.MinimumNArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := useMailPreviewFiles(catalogFile, dripCampaignsFile, mailTemplatesDir); err != nil {
+				return err
+			}
+
+			var mt mailtransport.Interface
+			if sendTo != "" {
+				var err error
+				mt, err = mailtransport.New(mailtransport.ConfigFromEnv())
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, name := range args {
+				p, err := server.PreviewMail(name, locale)
+				if err != nil {
+					return err
+				}
+				if outDir != "" {
+					if err := writeMailPreview(outDir, p); err != nil {
+						return err
+					}
+				} else if err := printMailPreview(p, format); err != nil {
+					return err
+				}
+				if mt != nil {
+					if err := p.Send(mt, sendTo); err != nil {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "sent %s to %s\n", name, sendTo)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	cmd.Flags().StringVar(&dripCampaignsFile, "drip-campaigns-file", dripCampaignsFile, "Path to drip campaigns file. If empty, the embedded campaigns are used")
+	cmd.Flags().StringVar(&mailTemplatesDir, "mail-templates-dir", mailTemplatesDir, "Path to a directory of mail templates that override the embedded templates")
+	cmd.Flags().StringVar(&locale, "locale", locale, "Locale of the localized mailers and drip campaign steps, like de")
+	cmd.Flags().StringVar(&format, "format", format, "Output format printed to stdout: html, text or eml")
+	cmd.Flags().StringVar(&outDir, "out-dir", outDir, "Write the html, text and eml renderings to this directory instead of stdout")
+	cmd.Flags().StringVar(&sendTo, "send-to", sendTo, "Send the preview to this test address using the mail transport configured in the environment")
+	return cmd
+}
+
+func printMailPreview(p *server.MailPreview, format string) error {
+	switch format {
+	case "html":
+		fmt.Println(p.HTML)
+	case "text":
+		fmt.Printf("Subject: %s\n\n%s\n", p.Subject, p.Text)
+		if len(p.Attachments) > 0 {
+			fmt.Printf("Attachments: %s\n", strings.Join(p.Attachments, ", "))
+		}
+	case "eml":
+		data, err := p.EML()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown format %q, use html, text or eml", format)
+	}
+	return nil
+}
+
+func writeMailPreview(dir string, p *server.MailPreview) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	eml, err := p.EML()
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		server.MailPreviewFilename(p.Name, "html"): []byte(p.HTML),
+		server.MailPreviewFilename(p.Name, "txt"):  []byte(p.Text),
+		server.MailPreviewFilename(p.Name, "eml"):  eml,
+	}
+	for filename, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, filename), data, 0o644); err != nil {
+			return err
+		}
+		fmt.Println(filepath.Join(dir, filename))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+	gdrive "gomodules.xyz/gdrive-utils"
+)
+
+func NewCmdGenerateOfferLetters() *cobra.Command {
+	var csvFile string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:               "generate",
+		Short:             "Generate offer letters for candidates listed in a CSV file",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(csvFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			candidates, err := server.ReadCandidates(f)
+			if err != nil {
+				return err
+			}
+
+			results := server.ValidateCandidates(candidates)
+			if !dryRun {
+				dir, err := os.Getwd()
+				if err != nil {
+					return err
+				}
+				client, err := gdrive.DefaultClient(dir)
+				if err != nil {
+					return err
+				}
+				mt, err := mailtransport.New(mailtransport.ConfigFromEnv())
+				if err != nil {
+					return err
+				}
+				gen, err := server.NewOfferLetterGenerator(client, mt)
+				if err != nil {
+					return err
+				}
+				results = gen.GenerateAll(candidates, results)
+			}
+
+			fmt.Print(server.FormatOfferLetterReport(results))
+			for _, r := range results {
+				if !r.Succeeded() {
+					return errors.New("failed to generate offer letters for some candidates")
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&csvFile, "csv", csvFile, "Path to CSV file with candidate details. Columns match the offer letter sheet")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", dryRun, "Validate the CSV file without generating offer letters")
+	_ = cmd.MarkFlagRequired("csv")
+
+	return cmd
+}
@@ -0,0 +1,60 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+	"gomodules.xyz/blobfs"
+)
+
+func NewCmdListOutbox() *cobra.Command {
+	bucket := server.LicenseBucket
+	var open bool
+	cmd := &cobra.Command{
+		Use:               "list",
+		Short:             `List dead or undelivered outbox entries`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// only the bucket is opened, the scheduler db is locked by the running server
+			store := server.NewOutboxStore(blobfs.New(bucket))
+
+			list := store.DeadEntries
+			if open {
+				list = store.OpenEntries
+			}
+			entries, err := list()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tKIND\tSTATUS\tATTEMPTS\tDESCRIPTION\tLAST ERROR")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Kind, e.Status, e.Attempts, e.Description, e.LastError)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&open, "open", open, "List pending and retrying entries instead of dead ones")
+	cmd.Flags().StringVar(&bucket, "bucket", bucket, "URL of S3/GCS bucket used to store licenses")
+	return cmd
+}
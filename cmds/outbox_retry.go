@@ -0,0 +1,51 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gomodules.xyz/blobfs"
+)
+
+func NewCmdRetryOutbox() *cobra.Command {
+	bucket := server.LicenseBucket
+	cmd := &cobra.Command{
+		Use:               "retry [id]...",
+		Short:             `Retry dead outbox entries`,
+		Args:              cobra.MinimumNArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// only the bucket is opened, the scheduler db is locked by the running server
+			store := server.NewOutboxStore(blobfs.New(bucket))
+
+			for _, id := range args {
+				if _, err := store.Requeue(id); err != nil {
+					return errors.Wrapf(err, "failed to retry outbox entry %s", id)
+				}
+				fmt.Println("queued", id, "for retry on the next outbox sweep")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&bucket, "bucket", bucket, "URL of S3/GCS bucket used to store licenses")
+	return cmd
+}
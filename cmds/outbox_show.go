@@ -0,0 +1,54 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+	"gomodules.xyz/blobfs"
+)
+
+func NewCmdShowOutbox() *cobra.Command {
+	bucket := server.LicenseBucket
+	cmd := &cobra.Command{
+		Use:               "show [id]",
+		Short:             `Show an outbox entry`,
+		Args:              cobra.ExactArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// only the bucket is opened, the scheduler db is locked by the running server
+			store := server.NewOutboxStore(blobfs.New(bucket))
+
+			e, err := store.Get(args[0])
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(e, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&bucket, "bucket", bucket, "URL of S3/GCS bucket used to store licenses")
+	return cmd
+}
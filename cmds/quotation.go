@@ -28,5 +28,6 @@ func NewCmdQuotation() *cobra.Command {
 	}
 	cmd.AddCommand(NewCmdGenerateQuotation())
 	cmd.AddCommand(NewCmdEmailQuotation())
+	cmd.AddCommand(NewCmdPriceQuotation())
 	return cmd
 }
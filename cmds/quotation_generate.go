@@ -34,11 +34,15 @@ func NewCmdGenerateQuotation() *cobra.Command {
 		LicenseSpreadsheetId: server.LicenseSpreadsheetId,
 	}
 	outDir := filepath.Join("/personal", "AppsCode", "quotes")
+	var catalogFile string
 	cmd := &cobra.Command{
 		Use:               "generate",
 		Short:             "Generate Quotation",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := server.UseCatalogFile(catalogFile); err != nil {
+				return err
+			}
 			if err := opts.Validate(); err != nil {
 				return err
 			}
@@ -52,7 +56,11 @@ func NewCmdGenerateQuotation() *cobra.Command {
 				return err
 			}
 
-			for _, product := range opts.Contact.Product {
+			products := opts.Contact.Product
+			if opts.Contact.IsCombined() {
+				products = []string{server.CombinedQuotationTemplate}
+			}
+			for _, product := range products {
 				gen := server.NewQuotationGenerator(client, opts.Complete())
 				gen.Contact = server.ProductQuotation{
 					Name:      opts.Contact.Name,
@@ -63,6 +71,12 @@ func NewCmdGenerateQuotation() *cobra.Command {
 					Product:   product,
 					Company:   opts.Contact.Company,
 				}
+				if opts.Contact.IsCombined() {
+					gen.Products = opts.Contact.Product
+				}
+				if err := gen.ApplyPricing(opts.Pricing); err != nil {
+					return err
+				}
 				quote, docId, err := gen.Generate()
 				if err != nil {
 					return err
@@ -82,6 +96,8 @@ func NewCmdGenerateQuotation() *cobra.Command {
 	cmd.Flags().StringVar(&opts.TemplateDocId, "template-doc-id", opts.TemplateDocId, "Template document id")
 	cmd.Flags().StringVar(&outDir, "out-dir", outDir, "Path to directory where output files are stored")
 	cmd.Flags().StringVar(&opts.LicenseSpreadsheetId, "spreadsheet-id", opts.LicenseSpreadsheetId, "Google Spreadsheet Id used to store quotation log")
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	opts.Pricing.AddFlags(cmd.Flags())
 
 	cmd.Flags().StringVar(&opts.Contact.Name, "contact.name", opts.Contact.Name, "Name of contact")
 	cmd.Flags().StringVar(&opts.Contact.Email, "contact.email", opts.Contact.Email, "Email of contact")
@@ -89,6 +105,7 @@ func NewCmdGenerateQuotation() *cobra.Command {
 	cmd.Flags().StringVar(&opts.Contact.Telephone, "contact.telephone", opts.Contact.Telephone, "Telephone number of contact")
 	cmd.Flags().StringSliceVar(&opts.Contact.Product, "contact.product", opts.Contact.Product, "Name of product for which quotation is requested")
 	cmd.Flags().StringVar(&opts.Contact.Company, "contact.company", opts.Contact.Company, "Name of company of the contact")
+	cmd.Flags().BoolVar(&opts.Contact.Combined, "contact.combined", opts.Contact.Combined, "Quote all products in a single document. Products must be names of quotation templates")
 
 	return cmd
 }
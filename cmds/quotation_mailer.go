@@ -20,11 +20,11 @@ import (
 	"os"
 	"path/filepath"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
 	"go.bytebuilders.dev/offline-license-server/pkg/server"
 
 	"github.com/spf13/cobra"
 	gdrive "gomodules.xyz/gdrive-utils"
-	"gomodules.xyz/mailer"
 )
 
 func NewCmdEmailQuotation() *cobra.Command {
@@ -34,11 +34,15 @@ func NewCmdEmailQuotation() *cobra.Command {
 		LicenseSpreadsheetId: server.LicenseSpreadsheetId,
 	}
 	outDir := filepath.Join("/personal", "AppsCode", "quotes")
+	var catalogFile string
 	cmd := &cobra.Command{
 		Use:               "mail",
 		Short:             "Email Quotation",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := server.UseCatalogFile(catalogFile); err != nil {
+				return err
+			}
 			if err := opts.Validate(); err != nil {
 				return err
 			}
@@ -52,7 +56,11 @@ func NewCmdEmailQuotation() *cobra.Command {
 				return err
 			}
 
-			for _, product := range opts.Contact.Product {
+			products := opts.Contact.Product
+			if opts.Contact.IsCombined() {
+				products = []string{server.CombinedQuotationTemplate}
+			}
+			for _, product := range products {
 				gen := server.NewQuotationGenerator(client, opts.Complete())
 				gen.Contact = server.ProductQuotation{
 					Name:      opts.Contact.Name,
@@ -63,21 +71,30 @@ func NewCmdEmailQuotation() *cobra.Command {
 					Product:   product,
 					Company:   opts.Contact.Company,
 				}
+				if opts.Contact.IsCombined() {
+					gen.Products = opts.Contact.Product
+				}
+				if err := gen.ApplyPricing(opts.Pricing); err != nil {
+					return err
+				}
 				quote, docId, err := gen.Generate()
 				if err != nil {
 					return err
 				}
 
-				mm := gen.GetMailer()
+				mm, err := gen.GetMailer()
+				if err != nil {
+					return err
+				}
 				mm.GoogleDocIds = map[string]string{
 					gen.DocName(quote) + ".pdf": docId,
 				}
 
-				mg, err := mailer.NewSMTPServiceFromEnv()
+				mt, err := mailtransport.New(mailtransport.ConfigFromEnv())
 				if err != nil {
 					return err
 				}
-				err = mm.SendMail(mg, opts.Contact.Email, opts.Contact.CC, gen.DriveService)
+				err = server.SendMail(mt, mm, opts.Contact.Email, opts.Contact.CC, gen.DriveService)
 				if err != nil {
 					return err
 				}
@@ -90,6 +107,8 @@ func NewCmdEmailQuotation() *cobra.Command {
 	cmd.Flags().StringVar(&opts.TemplateDocId, "template-doc-id", opts.TemplateDocId, "Template document id")
 	cmd.Flags().StringVar(&outDir, "out-dir", outDir, "Path to directory where output files are stored")
 	cmd.Flags().StringVar(&opts.LicenseSpreadsheetId, "spreadsheet-id", opts.LicenseSpreadsheetId, "Google Spreadsheet Id used to store quotation log")
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	opts.Pricing.AddFlags(cmd.Flags())
 
 	cmd.Flags().StringVar(&opts.Contact.Name, "contact.name", opts.Contact.Name, "Name of contact")
 	cmd.Flags().StringVar(&opts.Contact.Email, "contact.email", opts.Contact.Email, "Email of contact")
@@ -98,6 +117,7 @@ func NewCmdEmailQuotation() *cobra.Command {
 	cmd.Flags().StringVar(&opts.Contact.Telephone, "contact.telephone", opts.Contact.Telephone, "Telephone number of contact")
 	cmd.Flags().StringSliceVar(&opts.Contact.Product, "contact.product", opts.Contact.Product, "Name of product for which quotation is requested")
 	cmd.Flags().StringVar(&opts.Contact.Company, "contact.company", opts.Contact.Company, "Name of company of the contact")
+	cmd.Flags().BoolVar(&opts.Contact.Combined, "contact.combined", opts.Contact.Combined, "Quote all products in a single document. Products must be names of quotation templates")
 
 	return cmd
 }
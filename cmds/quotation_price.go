@@ -0,0 +1,70 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdPriceQuotation() *cobra.Command {
+	var (
+		catalogFile string
+		template    string
+		req         server.PricingRequest
+	)
+	cmd := &cobra.Command{
+		Use:               "price",
+		Short:             "Print line items and totals of a quotation without generating docs",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := server.UseCatalogFile(catalogFile); err != nil {
+				return err
+			}
+			price, err := server.CurrentCatalog().PriceQuotation(template, req)
+			if err != nil {
+				return err
+			}
+
+			replacements := price.Replacements()
+			keys := make([]string, 0, len(replacements))
+			for k := range replacements {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, k := range keys {
+				if k == "{{line-items}}" {
+					continue
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", k, replacements[k])
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&catalogFile, "catalog-file", catalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	cmd.Flags().StringVar(&template, "template-doc-id", template, "Name of quotation template with a price list")
+	req.AddFlags(cmd.Flags())
+	return cmd
+}
@@ -33,6 +33,7 @@ func NewRootCmd() *cobra.Command {
 	flags := rootCmd.PersistentFlags()
 	flags.AddGoFlagSet(flag.CommandLine)
 
+	rootCmd.AddCommand(NewCmdCatalog())
 	rootCmd.AddCommand(NewCmdQuotation())
 	rootCmd.AddCommand(NewCmdCreate())
 	rootCmd.AddCommand(NewCmdGet())
@@ -40,6 +41,9 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewCmdIssueFullLicense())
 	rootCmd.AddCommand(NewCmdGenerateAccessLogCSV())
 	rootCmd.AddCommand(NewCmdQA())
+	rootCmd.AddCommand(NewCmdOfferLetter())
+	rootCmd.AddCommand(NewCmdOutbox())
+	rootCmd.AddCommand(NewCmdMail())
 	rootCmd.AddCommand(v.NewCmdVersion())
 	return rootCmd
 }
@@ -30,6 +30,7 @@ require (
 	golang.org/x/text v0.37.0
 	gomodules.xyz/blobfs v0.2.2
 	gomodules.xyz/cert v1.6.0
+	gomodules.xyz/email v0.1.0
 	gomodules.xyz/email-providers v0.1.5
 	gomodules.xyz/encoding v0.0.9
 	gomodules.xyz/freshsales-client-go v0.1.2-0.20260406172435-c51feb728fd6
@@ -148,7 +149,6 @@ require (
 	golang.org/x/time v0.13.0 // indirect
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da // indirect
 	gomodules.xyz/clock v0.0.0-20200817085942-06523dba733f // indirect
-	gomodules.xyz/email v0.1.0 // indirect
 	gomodules.xyz/flags v0.1.3 // indirect
 	gomodules.xyz/jsonpath v0.0.2 // indirect
 	gomodules.xyz/mergo v0.3.13 // indirect
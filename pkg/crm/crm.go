@@ -0,0 +1,166 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	ProviderFreshsales = "freshsales"
+	ProviderHubSpot    = "hubspot"
+	ProviderLocal      = "local"
+)
+
+// Contact is a person in the CRM. IDs are opaque strings, since CRMs disagree on their type.
+type Contact struct {
+	ID        string `json:"id,omitempty"`
+	Email     string `json:"email"`
+	Name      string `json:"name,omitempty"`
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	JobTitle  string `json:"jobTitle,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Country   string `json:"country,omitempty"`
+	AccountID string `json:"accountId,omitempty"`
+	// LeadScore is left unchanged by updates when nil.
+	LeadScore *int `json:"leadScore,omitempty"`
+}
+
+// Account is a company in the CRM.
+type Account struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	Country string `json:"country,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+}
+
+type Deal struct {
+	ID        string  `json:"id,omitempty"`
+	Name      string  `json:"name"`
+	AccountID string  `json:"accountId,omitempty"`
+	Amount    float64 `json:"amount,omitempty"`
+}
+
+type Note struct {
+	ID        string `json:"id,omitempty"`
+	ContactID string `json:"contactId"`
+	Body      string `json:"body"`
+}
+
+// Interface is implemented by the CRMs the license server records sales events in.
+// Find methods return nil, nil when nothing matches.
+type Interface interface {
+	FindContactByEmail(email string) (*Contact, error)
+	CreateContact(c *Contact) (*Contact, error)
+	UpdateContact(c *Contact) (*Contact, error)
+
+	FindAccountByName(name string) (*Account, error)
+	CreateAccount(a *Account) (*Account, error)
+
+	CreateDeal(d *Deal) (*Deal, error)
+
+	AddNote(contactID string, body string) error
+}
+
+// New returns the CRM client for the provider. Freshsales and HubSpot credentials are
+// read from the environment. The local CRM stores records in localFile.
+func New(provider, localFile string) (Interface, error) {
+	switch provider {
+	case ProviderFreshsales, "":
+		return NewFreshsalesFromEnv(), nil
+	case ProviderHubSpot:
+		return NewHubSpot(HubSpotURL, os.Getenv("HUBSPOT_ACCESS_TOKEN")), nil
+	case ProviderLocal:
+		return NewLocal(localFile)
+	}
+	return nil, fmt.Errorf("unknown crm provider %q", provider)
+}
+
+// SplitName splits a full name into first and last names.
+func SplitName(name string) (string, string) {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return strings.Join(fields[0:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+// UpsertContact creates the contact or updates the non-empty fields of an existing
+// contact with the same email.
+func UpsertContact(c Interface, contact *Contact) (*Contact, error) {
+	existing, err := c.FindContactByEmail(contact.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		if contact.FirstName == "" && contact.LastName == "" {
+			contact.FirstName, contact.LastName = SplitName(contact.Name)
+		}
+		return c.CreateContact(contact)
+	}
+
+	var changed bool
+	update := func(dst *string, v string) {
+		if v != "" && *dst != v {
+			*dst = v
+			changed = true
+		}
+	}
+	update(&existing.Name, contact.Name)
+	update(&existing.JobTitle, contact.JobTitle)
+	update(&existing.Phone, contact.Phone)
+	update(&existing.Address, contact.Address)
+	update(&existing.Country, contact.Country)
+	if existing.AccountID == "" {
+		update(&existing.AccountID, contact.AccountID)
+	}
+	if contact.LeadScore != nil && (existing.LeadScore == nil || *existing.LeadScore != *contact.LeadScore) {
+		score := *contact.LeadScore
+		existing.LeadScore = &score
+		changed = true
+	}
+	if !changed {
+		return existing, nil
+	}
+	return c.UpdateContact(existing)
+}
+
+// EnsureContact returns the contact with the same email, creating it if needed.
+func EnsureContact(c Interface, contact *Contact) (*Contact, error) {
+	existing, err := c.FindContactByEmail(contact.Email)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	if contact.FirstName == "" && contact.LastName == "" {
+		contact.FirstName, contact.LastName = SplitName(contact.Name)
+	}
+	return c.CreateContact(contact)
+}
+
+// EnsureAccount returns the account with the same name, creating it if needed.
+func EnsureAccount(c Interface, account *Account) (*Account, error) {
+	existing, err := c.FindAccountByName(account.Name)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	return c.CreateAccount(account)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+)
+
+func TestLocalSalesFlow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crm.json")
+	c, err := crm.NewLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := crm.EnsureAccount(c, &crm.Account{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact, err := crm.UpsertContact(c, &crm.Contact{Email: "jane@acme.com", Name: "Jane van Doe", AccountID: account.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.FirstName != "Jane van" || contact.LastName != "Doe" {
+		t.Errorf("unexpected name split %+v", contact)
+	}
+	if _, err := c.CreateDeal(&crm.Deal{Name: "Acme - KubeDB", AccountID: account.ID, Amount: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddNote(contact.ID, "event: quotation_generated"); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload from disk and update the same contact
+	c, err = crm.NewLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := crm.EnsureAccount(c, &crm.Account{Name: "acme"}); err != nil || again.ID != account.ID {
+		t.Errorf("expected existing account %s, found %+v, err %v", account.ID, again, err)
+	}
+	updated, err := crm.UpsertContact(c, &crm.Contact{Email: "JANE@acme.com", JobTitle: "CTO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != contact.ID || updated.JobTitle != "CTO" || updated.Name != "Jane van Doe" {
+		t.Errorf("unexpected updated contact %+v", updated)
+	}
+
+	db := c.DB()
+	if len(db.Contacts) != 1 || len(db.Accounts) != 1 || len(db.Deals) != 1 || len(db.Notes) != 1 {
+		t.Errorf("unexpected records %+v", db)
+	}
+}
+
+func TestHubSpot(t *testing.T) {
+	var notes []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch {
+		case r.URL.Path == "/crm/v3/objects/contacts/search":
+			_, _ = w.Write([]byte(`{"results":[]}`))
+		case r.URL.Path == "/crm/v3/objects/contacts" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"id":"101","properties":{"email":"jane@acme.com","firstname":"Jane","lastname":"Doe"}}`))
+		case r.URL.Path == "/crm/v3/objects/notes":
+			notes = append(notes, in)
+			_, _ = w.Write([]byte(`{"id":"201"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := crm.NewHubSpot(srv.URL, "token")
+	contact, err := crm.UpsertContact(c, &crm.Contact{Email: "jane@acme.com", Name: "Jane Doe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.ID != "101" || contact.Name != "Jane Doe" {
+		t.Errorf("unexpected contact %+v", contact)
+	}
+	if err := c.AddNote(contact.ID, "event: license_issued"); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 note, found %d", len(notes))
+	}
+	data, _ := json.Marshal(notes[0])
+	if !strings.Contains(string(data), `"hs_note_body":"event: license_issued"`) || !strings.Contains(string(data), `"id":"101"`) {
+		t.Errorf("unexpected note request %s", data)
+	}
+}
+
+func TestUpsertLeadScore(t *testing.T) {
+	c, err := crm.NewLocal(filepath.Join(t.TempDir(), "crm.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := 30
+	if _, err := crm.UpsertContact(c, &crm.Contact{Email: "jane@acme.com", Name: "Jane Doe", LeadScore: &score}); err != nil {
+		t.Fatal(err)
+	}
+	// a nil score leaves the stored score alone, a zero score replaces it
+	contact, err := crm.UpsertContact(c, &crm.Contact{Email: "jane@acme.com", JobTitle: "CTO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.LeadScore == nil || *contact.LeadScore != 30 {
+		t.Errorf("expected lead score 30, found %v", contact.LeadScore)
+	}
+	zero := 0
+	contact, err = crm.UpsertContact(c, &crm.Contact{Email: "jane@acme.com", LeadScore: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.LeadScore == nil || *contact.LeadScore != 0 {
+		t.Errorf("expected lead score 0, found %v", contact.LeadScore)
+	}
+}
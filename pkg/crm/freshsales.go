@@ -0,0 +1,213 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crm
+
+import (
+	"fmt"
+	"strconv"
+
+	freshsalesclient "gomodules.xyz/freshsales-client-go"
+)
+
+type Freshsales struct {
+	client *freshsalesclient.Client
+}
+
+var _ Interface = &Freshsales{}
+
+func NewFreshsales(client *freshsalesclient.Client) *Freshsales {
+	return &Freshsales{client: client}
+}
+
+// NewFreshsalesFromEnv uses CRM_BUNDLE_ALIAS and CRM_API_TOKEN.
+func NewFreshsalesFromEnv() *Freshsales {
+	return NewFreshsales(freshsalesclient.DefaultFromEnv())
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func parseID(id string) (int64, error) {
+	if id == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid freshsales id %q: %v", id, err)
+	}
+	return v, nil
+}
+
+func fromFreshsalesContact(c *freshsalesclient.Contact) *Contact {
+	score := c.LeadScore
+	return &Contact{
+		ID:        formatID(c.ID),
+		Email:     c.Email,
+		Name:      c.DisplayName,
+		FirstName: c.FirstName,
+		LastName:  c.LastName,
+		JobTitle:  c.JobTitle,
+		Phone:     c.WorkNumber,
+		Address:   c.Address,
+		Country:   c.Country,
+		AccountID: formatID(c.SalesAccountID),
+		LeadScore: &score,
+	}
+}
+
+// toFreshsalesContact copies c on top of the fields of an existing Freshsales contact,
+// so that an update does not clear fields the CRM interface does not know about.
+func toFreshsalesContact(c *Contact, out *freshsalesclient.Contact) error {
+	id, err := parseID(c.ID)
+	if err != nil {
+		return err
+	}
+	accountID, err := parseID(c.AccountID)
+	if err != nil {
+		return err
+	}
+	out.ID = id
+	out.Email = c.Email
+	out.DisplayName = c.Name
+	out.FirstName = c.FirstName
+	out.LastName = c.LastName
+	out.JobTitle = c.JobTitle
+	out.WorkNumber = c.Phone
+	out.Address = c.Address
+	out.Country = c.Country
+	out.SalesAccountID = accountID
+	if c.LeadScore != nil {
+		out.LeadScore = *c.LeadScore
+	}
+	return nil
+}
+
+func (f *Freshsales) lookupContact(email string) (*freshsalesclient.Contact, error) {
+	result, err := f.client.LookupByEmail(email, freshsalesclient.EntityContact)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Contacts.Contacts) == 0 {
+		return nil, nil
+	}
+	return &result.Contacts.Contacts[0], nil
+}
+
+func (f *Freshsales) FindContactByEmail(email string) (*Contact, error) {
+	c, err := f.lookupContact(email)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return fromFreshsalesContact(c), nil
+}
+
+func (f *Freshsales) CreateContact(c *Contact) (*Contact, error) {
+	var in freshsalesclient.Contact
+	if err := toFreshsalesContact(c, &in); err != nil {
+		return nil, err
+	}
+	out, err := f.client.CreateContact(&in)
+	if err != nil {
+		return nil, err
+	}
+	return fromFreshsalesContact(out), nil
+}
+
+func (f *Freshsales) UpdateContact(c *Contact) (*Contact, error) {
+	existing, err := f.lookupContact(c.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("contact %s not found", c.Email)
+	}
+	if err := toFreshsalesContact(c, existing); err != nil {
+		return nil, err
+	}
+	out, err := f.client.UpdateContact(existing)
+	if err != nil {
+		return nil, err
+	}
+	return fromFreshsalesContact(out), nil
+}
+
+func (f *Freshsales) FindAccountByName(name string) (*Account, error) {
+	results, err := f.client.Search(name, freshsalesclient.EntitySalesAccount)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &Account{
+		ID:   results[0].ID,
+		Name: results[0].Name,
+	}, nil
+}
+
+func (f *Freshsales) CreateAccount(a *Account) (*Account, error) {
+	out, err := f.client.CreateAccount(&freshsalesclient.SalesAccount{
+		Name:    a.Name,
+		Address: a.Address,
+		Country: a.Country,
+		Phone:   a.Phone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		ID:      formatID(out.ID),
+		Name:    out.Name,
+		Address: out.Address,
+		Country: out.Country,
+		Phone:   out.Phone,
+	}, nil
+}
+
+func (f *Freshsales) CreateDeal(d *Deal) (*Deal, error) {
+	accountID, err := parseID(d.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.client.CreateDeal(&freshsalesclient.Deal{
+		Name:           d.Name,
+		Amount:         d.Amount,
+		SalesAccountID: accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Deal{
+		ID:        formatID(out.ID),
+		Name:      out.Name,
+		AccountID: formatID(out.SalesAccountID),
+		Amount:    out.Amount,
+	}, nil
+}
+
+func (f *Freshsales) AddNote(contactID string, body string) error {
+	id, err := parseID(contactID)
+	if err != nil {
+		return err
+	}
+	_, err = f.client.AddNote(id, freshsalesclient.EntityContact, body)
+	return err
+}
@@ -0,0 +1,298 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const HubSpotURL = "https://api.hubapi.com"
+
+// HubSpot default association type ids
+// ref: https://developers.hubspot.com/docs/api/crm/associations
+const (
+	hubSpotContactToCompany = 1
+	hubSpotDealToCompany    = 5
+	hubSpotNoteToContact    = 202
+)
+
+// HubSpot talks to the HubSpot CRM v3 objects API, or any server compatible with it.
+type HubSpot struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+var _ Interface = &HubSpot{}
+
+func NewHubSpot(baseURL, token string) *HubSpot {
+	return &HubSpot{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type hubSpotObject struct {
+	ID           string              `json:"id,omitempty"`
+	Properties   map[string]string   `json:"properties"`
+	Associations []hubSpotAssociated `json:"associations,omitempty"`
+}
+
+type hubSpotAssociated struct {
+	To    hubSpotID                `json:"to"`
+	Types []hubSpotAssociationType `json:"types"`
+}
+
+type hubSpotID struct {
+	ID string `json:"id"`
+}
+
+type hubSpotAssociationType struct {
+	Category string `json:"associationCategory"`
+	TypeID   int    `json:"associationTypeId"`
+}
+
+func associate(id string, typeID int) []hubSpotAssociated {
+	if id == "" {
+		return nil
+	}
+	return []hubSpotAssociated{{
+		To:    hubSpotID{ID: id},
+		Types: []hubSpotAssociationType{{Category: "HUBSPOT_DEFINED", TypeID: typeID}},
+	}}
+}
+
+func (h *HubSpot) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, h.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+h.token)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s %s failed with status code = %d: %s", method, path, resp.StatusCode, string(data))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// search returns the first object whose property equals value.
+func (h *HubSpot) search(objectType, property, value string, properties []string) (*hubSpotObject, error) {
+	in := map[string]any{
+		"filterGroups": []any{
+			map[string]any{
+				"filters": []any{
+					map[string]string{
+						"propertyName": property,
+						"operator":     "EQ",
+						"value":        value,
+					},
+				},
+			},
+		},
+		"properties": properties,
+		"limit":      1,
+	}
+	var out struct {
+		Results []hubSpotObject `json:"results"`
+	}
+	if err := h.do(http.MethodPost, "/crm/v3/objects/"+objectType+"/search", in, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Results) == 0 {
+		return nil, nil
+	}
+	return &out.Results[0], nil
+}
+
+// hubSpotLeadScoreProperty is a custom number property on contacts. HubSpot's own
+// hubspotscore is computed by HubSpot and can't be written through the API.
+const hubSpotLeadScoreProperty = "lead_score"
+
+var hubSpotContactProperties = []string{"email", "firstname", "lastname", "jobtitle", "phone", "address", "country", "associatedcompanyid", hubSpotLeadScoreProperty}
+
+func fromHubSpotContact(o *hubSpotObject) *Contact {
+	p := o.Properties
+	var score *int
+	if v, err := strconv.Atoi(p[hubSpotLeadScoreProperty]); err == nil {
+		score = &v
+	}
+	return &Contact{
+		ID:        o.ID,
+		Email:     p["email"],
+		Name:      strings.TrimSpace(p["firstname"] + " " + p["lastname"]),
+		FirstName: p["firstname"],
+		LastName:  p["lastname"],
+		JobTitle:  p["jobtitle"],
+		Phone:     p["phone"],
+		Address:   p["address"],
+		Country:   p["country"],
+		AccountID: p["associatedcompanyid"],
+		LeadScore: score,
+	}
+}
+
+func toHubSpotContact(c *Contact) map[string]string {
+	first, last := c.FirstName, c.LastName
+	if first == "" && last == "" {
+		first, last = SplitName(c.Name)
+	}
+	p := map[string]string{
+		"email":     c.Email,
+		"firstname": first,
+		"lastname":  last,
+		"jobtitle":  c.JobTitle,
+		"phone":     c.Phone,
+		"address":   c.Address,
+		"country":   c.Country,
+	}
+	for k, v := range p {
+		if v == "" {
+			delete(p, k)
+		}
+	}
+	if c.LeadScore != nil {
+		p[hubSpotLeadScoreProperty] = strconv.Itoa(*c.LeadScore)
+	}
+	return p
+}
+
+func (h *HubSpot) FindContactByEmail(email string) (*Contact, error) {
+	o, err := h.search("contacts", "email", email, hubSpotContactProperties)
+	if err != nil || o == nil {
+		return nil, err
+	}
+	return fromHubSpotContact(o), nil
+}
+
+func (h *HubSpot) CreateContact(c *Contact) (*Contact, error) {
+	in := hubSpotObject{
+		Properties:   toHubSpotContact(c),
+		Associations: associate(c.AccountID, hubSpotContactToCompany),
+	}
+	var out hubSpotObject
+	if err := h.do(http.MethodPost, "/crm/v3/objects/contacts", in, &out); err != nil {
+		return nil, err
+	}
+	result := fromHubSpotContact(&out)
+	result.AccountID = c.AccountID
+	return result, nil
+}
+
+func (h *HubSpot) UpdateContact(c *Contact) (*Contact, error) {
+	in := hubSpotObject{
+		Properties: toHubSpotContact(c),
+	}
+	var out hubSpotObject
+	if err := h.do(http.MethodPatch, "/crm/v3/objects/contacts/"+c.ID, in, &out); err != nil {
+		return nil, err
+	}
+	return fromHubSpotContact(&out), nil
+}
+
+func (h *HubSpot) FindAccountByName(name string) (*Account, error) {
+	o, err := h.search("companies", "name", name, []string{"name", "address", "country", "phone"})
+	if err != nil || o == nil {
+		return nil, err
+	}
+	return &Account{
+		ID:      o.ID,
+		Name:    o.Properties["name"],
+		Address: o.Properties["address"],
+		Country: o.Properties["country"],
+		Phone:   o.Properties["phone"],
+	}, nil
+}
+
+func (h *HubSpot) CreateAccount(a *Account) (*Account, error) {
+	in := hubSpotObject{
+		Properties: map[string]string{
+			"name":    a.Name,
+			"address": a.Address,
+			"country": a.Country,
+			"phone":   a.Phone,
+		},
+	}
+	var out hubSpotObject
+	if err := h.do(http.MethodPost, "/crm/v3/objects/companies", in, &out); err != nil {
+		return nil, err
+	}
+	result := *a
+	result.ID = out.ID
+	return &result, nil
+}
+
+func (h *HubSpot) CreateDeal(d *Deal) (*Deal, error) {
+	props := map[string]string{
+		"dealname": d.Name,
+	}
+	if d.Amount != 0 {
+		props["amount"] = strconv.FormatFloat(d.Amount, 'f', -1, 64)
+	}
+	in := hubSpotObject{
+		Properties:   props,
+		Associations: associate(d.AccountID, hubSpotDealToCompany),
+	}
+	var out hubSpotObject
+	if err := h.do(http.MethodPost, "/crm/v3/objects/deals", in, &out); err != nil {
+		return nil, err
+	}
+	result := *d
+	result.ID = out.ID
+	return &result, nil
+}
+
+func (h *HubSpot) AddNote(contactID string, body string) error {
+	in := hubSpotObject{
+		Properties: map[string]string{
+			"hs_note_body": body,
+			"hs_timestamp": time.Now().UTC().Format(time.RFC3339),
+		},
+		Associations: associate(contactID, hubSpotNoteToContact),
+	}
+	return h.do(http.MethodPost, "/crm/v3/objects/notes", in, nil)
+}
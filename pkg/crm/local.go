@@ -0,0 +1,202 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Local is a CRM backed by a JSON file. It is meant for development and tests, where
+// the sales flow must run without a live CRM account.
+type Local struct {
+	mu   sync.Mutex
+	path string
+	db   LocalDB
+}
+
+// LocalDB is the content of the local CRM file.
+type LocalDB struct {
+	NextID   int        `json:"nextId"`
+	Contacts []*Contact `json:"contacts"`
+	Accounts []*Account `json:"accounts"`
+	Deals    []*Deal    `json:"deals"`
+	Notes    []*Note    `json:"notes"`
+}
+
+var _ Interface = &Local{}
+
+// NewLocal loads the CRM from path. If path is empty, records are only kept in memory.
+func NewLocal(path string) (*Local, error) {
+	l := &Local{path: path}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.db); err != nil {
+		return nil, fmt.Errorf("failed to parse local crm file %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// DB returns a copy of the stored records.
+func (l *Local) DB() LocalDB {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, _ := json.Marshal(l.db)
+	var out LocalDB
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+func (l *Local) nextID() string {
+	l.db.NextID++
+	return strconv.Itoa(l.db.NextID)
+}
+
+func (l *Local) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (l *Local) FindContactByEmail(email string) (*Contact, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range l.db.Contacts {
+		if strings.EqualFold(c.Email, email) {
+			out := *c
+			return &out, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *Local) CreateContact(c *Contact) (*Contact, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, existing := range l.db.Contacts {
+		if strings.EqualFold(existing.Email, c.Email) {
+			return nil, fmt.Errorf("contact %s already exists", c.Email)
+		}
+	}
+	out := *c
+	out.ID = l.nextID()
+	l.db.Contacts = append(l.db.Contacts, &out)
+	if err := l.save(); err != nil {
+		return nil, err
+	}
+	result := out
+	return &result, nil
+}
+
+func (l *Local) UpdateContact(c *Contact) (*Contact, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, existing := range l.db.Contacts {
+		if existing.ID == c.ID {
+			out := *c
+			l.db.Contacts[i] = &out
+			if err := l.save(); err != nil {
+				return nil, err
+			}
+			result := out
+			return &result, nil
+		}
+	}
+	return nil, fmt.Errorf("contact %s not found", c.ID)
+}
+
+func (l *Local) FindAccountByName(name string) (*Account, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, a := range l.db.Accounts {
+		if strings.EqualFold(a.Name, name) {
+			out := *a
+			return &out, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *Local) CreateAccount(a *Account) (*Account, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := *a
+	out.ID = l.nextID()
+	l.db.Accounts = append(l.db.Accounts, &out)
+	if err := l.save(); err != nil {
+		return nil, err
+	}
+	result := out
+	return &result, nil
+}
+
+func (l *Local) CreateDeal(d *Deal) (*Deal, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := *d
+	out.ID = l.nextID()
+	l.db.Deals = append(l.db.Deals, &out)
+	if err := l.save(); err != nil {
+		return nil, err
+	}
+	result := out
+	return &result, nil
+}
+
+func (l *Local) AddNote(contactID string, body string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.db.Notes = append(l.db.Notes, &Note{
+		ID:        l.nextID(),
+		ContactID: contactID,
+		Body:      body,
+	})
+	return l.save()
+}
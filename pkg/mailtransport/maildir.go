@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailtransport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gomodules.xyz/email"
+)
+
+// EnvelopeHeader records the envelope recipients of a captured message, since Bcc
+// recipients are not part of the message itself.
+const EnvelopeHeader = "X-Envelope-To"
+
+// Maildir writes every message to a maildir instead of sending it. It lets dev and
+// CI runs capture the emails the server sends and assert on them.
+// ref: https://cr.yp.to/proto/maildir.html
+type Maildir struct {
+	path string
+}
+
+var _ Interface = &Maildir{}
+
+var maildirSeq atomic.Int64
+
+func NewMaildir(path string) (*Maildir, error) {
+	if path == "" {
+		return nil, errors.New("maildir transport requires a path")
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(path, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Maildir{path: path}, nil
+}
+
+func (t *Maildir) Send(msg *email.Email) error {
+	if msg.From == "" || len(recipients(msg)) == 0 {
+		return errors.New("must specify at least one From address and one To address")
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: %s\r\n", EnvelopeHeader, strings.Join(recipients(msg), ", "))
+	buf.Write(data)
+
+	// messages are written to tmp and moved to new, so readers never see partial files
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().UnixNano(), os.Getpid(), maildirSeq.Add(1), strings.ReplaceAll(host, "/", "_"))
+	tmp := filepath.Join(t.path, "tmp", name)
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.path, "new", name))
+}
+
+// ReadMaildir returns the messages delivered to the maildir, oldest first.
+func ReadMaildir(path string) ([]*email.Email, error) {
+	var files []string
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(path, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, sub, e.Name()))
+			}
+		}
+	}
+	// names start with the delivery time in nanoseconds
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+
+	out := make([]*email.Email, 0, len(files))
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := email.NewEmailFromReader(f)
+		f.Close() // nolint:errcheck
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailtransport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"gomodules.xyz/email"
+)
+
+const (
+	MailgunAPIBaseUS = "https://api.mailgun.net"
+	MailgunAPIBaseEU = "https://api.eu.mailgun.net"
+)
+
+// Mailgun sends email with the Mailgun messages API. The message is sent in MIME
+// format, so it is delivered exactly as rendered.
+// ref: https://documentation.mailgun.com/docs/mailgun/api-reference/openapi-final/tag/Messages/
+type Mailgun struct {
+	base   string
+	domain string
+	apiKey string
+	client *http.Client
+}
+
+var _ Interface = &Mailgun{}
+
+func NewMailgun(base, domain, apiKey string) (*Mailgun, error) {
+	if domain == "" || apiKey == "" {
+		return nil, errors.New("mailgun transport requires a domain and an api key")
+	}
+	if base == "" {
+		base = MailgunAPIBaseUS
+	}
+	return &Mailgun{
+		base:   strings.TrimSuffix(base, "/"),
+		domain: domain,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (t *Mailgun) Send(msg *email.Email) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	// Bcc recipients are not part of the MIME message
+	for _, to := range recipients(msg) {
+		if err := w.WriteField("to", to); err != nil {
+			return err
+		}
+	}
+	fw, err := w.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v3/%s/messages.mime", t.base, t.domain), &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", t.apiKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mailgun send failed with status code = %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailtransport
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+
+	"gomodules.xyz/email"
+)
+
+const (
+	SMTPSecurityAuto     = "auto"
+	SMTPSecuritySTARTTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+
+	SMTPAuthPlain   = "plain"
+	SMTPAuthXOAUTH2 = "xoauth2"
+	SMTPAuthNone    = "none"
+)
+
+// SMTP sends email through an SMTP server.
+type SMTP struct {
+	addr     string
+	host     string
+	security string
+	auth     smtp.Auth
+}
+
+var _ Interface = &SMTP{}
+
+func NewSMTP(cfg Config) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(cfg.SMTPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address %q: %w", cfg.SMTPAddress, err)
+	}
+
+	t := &SMTP{
+		addr:     cfg.SMTPAddress,
+		host:     host,
+		security: cfg.SMTPSecurity,
+	}
+	switch t.security {
+	case SMTPSecurityAuto, "":
+		t.security = SMTPSecurityAuto
+	case SMTPSecuritySTARTTLS, SMTPSecurityTLS:
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q", cfg.SMTPSecurity)
+	}
+
+	switch cfg.SMTPAuth {
+	case SMTPAuthPlain, "":
+		t.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+	case SMTPAuthXOAUTH2:
+		if cfg.SMTPOAuth2TokenFile == "" {
+			return nil, errors.New("xoauth2 requires an oauth2 token file")
+		}
+		t.auth = &XOAUTH2Auth{Username: cfg.SMTPUsername, TokenFile: cfg.SMTPOAuth2TokenFile}
+	case SMTPAuthNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp auth %q", cfg.SMTPAuth)
+	}
+	return t, nil
+}
+
+func (t *SMTP) Send(msg *email.Email) error {
+	switch t.security {
+	case SMTPSecurityTLS:
+		return msg.SendWithTLS(t.addr, t.auth, &tls.Config{ServerName: t.host})
+	case SMTPSecuritySTARTTLS:
+		return msg.SendWithStartTLS(t.addr, t.auth, &tls.Config{ServerName: t.host})
+	default:
+		return msg.Send(t.addr, t.auth)
+	}
+}
+
+// XOAUTH2Auth implements the SASL XOAUTH2 mechanism used by Gmail and Microsoft 365.
+// ref: https://developers.google.com/gmail/imap/xoauth2-protocol
+type XOAUTH2Auth struct {
+	Username  string
+	TokenFile string
+}
+
+var _ smtp.Auth = &XOAUTH2Auth{}
+
+func (a *XOAUTH2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// like smtp.PlainAuth, never send the token over an unencrypted connection
+	if !server.TLS {
+		return "", nil, errors.New("xoauth2 requires an encrypted connection")
+	}
+	token, err := os.ReadFile(a.TokenFile)
+	if err != nil {
+		return "", nil, err
+	}
+	return "XOAUTH2", []byte("user=" + a.Username + "\x01auth=Bearer " + strings.TrimSpace(string(token)) + "\x01\x01"), nil
+}
+
+func (a *XOAUTH2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends a JSON error as a challenge. An empty response ends the
+		// exchange, so the server reports the failure.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailtransport
+
+import (
+	"fmt"
+	"os"
+
+	"gomodules.xyz/email"
+)
+
+const (
+	TransportSMTP    = "smtp"
+	TransportMailgun = "mailgun"
+	TransportMaildir = "maildir"
+)
+
+// Interface is implemented by the transports the license server sends email with.
+// Send delivers the message to its To, Cc and Bcc recipients.
+type Interface interface {
+	Send(msg *email.Email) error
+}
+
+// Config selects and configures a transport. Only the fields of the selected
+// transport are used.
+type Config struct {
+	Transport string
+
+	SMTPAddress  string
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPSecurity is one of auto, starttls or tls. auto upgrades the connection
+	// with STARTTLS when the server offers it.
+	SMTPSecurity string
+	// SMTPAuth is one of plain, xoauth2 or none.
+	SMTPAuth string
+	// SMTPOAuth2TokenFile holds the OAuth2 access token used by xoauth2. It is read
+	// before every connection, so it can be refreshed by another process.
+	SMTPOAuth2TokenFile string
+
+	MailgunDomain  string
+	MailgunAPIKey  string
+	MailgunAPIBase string
+
+	// MaildirPath is the maildir every message is written to.
+	MaildirPath string
+}
+
+// ConfigFromEnv returns the config set by the MAIL_TRANSPORT, SMTP_*, MAILGUN_* and
+// MAILDIR environment variables. The transport defaults to smtp.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Transport:           os.Getenv("MAIL_TRANSPORT"),
+		SMTPAddress:         os.Getenv("SMTP_ADDRESS"),
+		SMTPUsername:        os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:        os.Getenv("SMTP_PASSWORD"),
+		SMTPSecurity:        os.Getenv("SMTP_SECURITY"),
+		SMTPAuth:            os.Getenv("SMTP_AUTH"),
+		SMTPOAuth2TokenFile: os.Getenv("SMTP_OAUTH2_TOKEN_FILE"),
+		MailgunDomain:       os.Getenv("MAILGUN_DOMAIN"),
+		MailgunAPIKey:       os.Getenv("MAILGUN_API_KEY"),
+		MailgunAPIBase:      os.Getenv("MAILGUN_API_BASE"),
+		MaildirPath:         os.Getenv("MAILDIR"),
+	}
+	if cfg.Transport == "" {
+		cfg.Transport = TransportSMTP
+	}
+	if cfg.SMTPSecurity == "" {
+		cfg.SMTPSecurity = SMTPSecurityAuto
+	}
+	if cfg.SMTPAuth == "" {
+		cfg.SMTPAuth = SMTPAuthPlain
+	}
+	if cfg.MailgunAPIBase == "" {
+		cfg.MailgunAPIBase = MailgunAPIBaseUS
+	}
+	return cfg
+}
+
+// New returns the transport selected by cfg.
+func New(cfg Config) (Interface, error) {
+	switch cfg.Transport {
+	case TransportSMTP, "":
+		return NewSMTP(cfg)
+	case TransportMailgun:
+		return NewMailgun(cfg.MailgunAPIBase, cfg.MailgunDomain, cfg.MailgunAPIKey)
+	case TransportMaildir:
+		return NewMaildir(cfg.MaildirPath)
+	}
+	return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+}
+
+// recipients returns the envelope recipients of the message.
+func recipients(msg *email.Email) []string {
+	out := make([]string, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	return append(append(append(out, msg.To...), msg.Cc...), msg.Bcc...)
+}
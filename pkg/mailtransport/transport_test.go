@@ -0,0 +1,145 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mailtransport_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+
+	"gomodules.xyz/email"
+)
+
+func newTestEmail(subject string) *email.Email {
+	msg := email.NewEmail()
+	msg.From = "license-issuer@appscode.com"
+	msg.To = []string{"jane@example.com"}
+	msg.Bcc = []string{"tracker@appscode.com"}
+	msg.Subject = subject
+	msg.Text = []byte("Hi Jane,")
+	return msg
+}
+
+func TestMaildir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mt, err := mailtransport.New(mailtransport.Config{Transport: mailtransport.TransportMaildir, MaildirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subject := range []string{"first", "second"} {
+		if err := mt.Send(newTestEmail(subject)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err := mailtransport.ReadMaildir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Subject != "first" || msgs[1].Subject != "second" {
+		t.Fatalf("expected 2 messages in order, found %d", len(msgs))
+	}
+	if to := msgs[0].Headers.Get(mailtransport.EnvelopeHeader); to != "jane@example.com, tracker@appscode.com" {
+		t.Errorf("expected bcc in the envelope header, found %q", to)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(entries) != 0 {
+		t.Errorf("expected tmp to be empty, found %d files", len(entries))
+	}
+}
+
+func TestMailgun(t *testing.T) {
+	var to []string
+	var message string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mg.example.com/messages.mime" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "api" || pass != "key" {
+			t.Errorf("unexpected basic auth %s:%s", user, pass)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		to = r.MultipartForm.Value["to"]
+		f, _, err := r.FormFile("message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close() // nolint:errcheck
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message = string(data)
+	}))
+	defer srv.Close()
+
+	mt, err := mailtransport.NewMailgun(srv.URL, "mg.example.com", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mt.Send(newTestEmail("License")); err != nil {
+		t.Fatal(err)
+	}
+	if len(to) != 2 || to[1] != "tracker@appscode.com" {
+		t.Errorf("expected bcc among the recipients, found %v", to)
+	}
+	if !strings.Contains(message, "Subject: License") {
+		t.Errorf("expected the mime message to be uploaded, found %q", message)
+	}
+}
+
+func TestXOAUTH2Auth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ya29.token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := &mailtransport.XOAUTH2Auth{Username: "sales@appscode.com", TokenFile: tokenFile}
+
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: false}); err == nil {
+		t.Error("expected xoauth2 to refuse an unencrypted connection")
+	}
+	mech, resp, err := a.Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mech != "XOAUTH2" || string(resp) != "user=sales@appscode.com\x01auth=Bearer ya29.token\x01\x01" {
+		t.Errorf("unexpected xoauth2 response %s %q", mech, resp)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]mailtransport.Config{
+		"unknown transport": {Transport: "pigeon"},
+		"missing port":      {Transport: mailtransport.TransportSMTP, SMTPAddress: "smtp.example.com"},
+		"unknown security":  {Transport: mailtransport.TransportSMTP, SMTPAddress: "smtp.example.com:587", SMTPSecurity: "ssl"},
+		"missing token":     {Transport: mailtransport.TransportSMTP, SMTPAddress: "smtp.example.com:587", SMTPAuth: mailtransport.SMTPAuthXOAUTH2},
+		"missing api key":   {Transport: mailtransport.TransportMailgun, MailgunDomain: "mg.example.com"},
+		"missing maildir":   {Transport: mailtransport.TransportMaildir},
+	} {
+		if _, err := mailtransport.New(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
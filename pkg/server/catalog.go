@@ -0,0 +1,360 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	catalogfs "go.bytebuilders.dev/offline-license-server/catalog"
+
+	"gomodules.xyz/sets"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const CatalogVersion = "v1"
+
+type PlanInfo struct {
+	DisplayName    string   `json:"displayName"`
+	ProductLine    string   `json:"productLine"`
+	TierName       string   `json:"tierName"`
+	TwitterHandle  string   `json:"twitterHandle,omitempty"`
+	QuickstartLink string   `json:"quickstartLink,omitempty"`
+	Features       []string `json:"features"`
+	MailingLists   []string `json:"mailingLists,omitempty"`
+}
+
+type QuoteInfo struct {
+	TemplateDocId string   `json:"templateDocId"`
+	Mailer        string   `json:"mailer"`
+	MailingLists  []string `json:"mailingLists,omitempty"`
+	PriceList     string   `json:"priceList,omitempty"`
+}
+
+// CombinedQuotationInfo is the template used when several plans are quoted in one
+// document. The template gets a {{plans}} placeholder with a section per plan.
+type CombinedQuotationInfo struct {
+	TemplateDocId string `json:"templateDocId"`
+}
+
+type QuotationMailerInfo struct {
+	Offer    string `json:"offer"`    // KubeDB, Stash
+	FullPlan string `json:"fullPlan"` // Pay-As-You-Go (PAYG), Enterprise
+	Plan     string `json:"plan"`     // PAYG, Enterprise
+}
+
+// Catalog lists the plans, product aliases, quotation templates and mailing lists
+// known to the license server. Mailing lists are referred to by name everywhere
+// in the catalog and resolved to listmonk uuids by Complete.
+type Catalog struct {
+	Version            string                         `json:"version"`
+	MailingLists       map[string]string              `json:"mailingLists"`
+	Features           []string                       `json:"features"`
+	PaidFeatures       []string                       `json:"paidFeatures"`
+	Plans              map[string]PlanInfo            `json:"plans"`
+	Aliases            map[string]string              `json:"aliases"`
+	Pricing            Pricing                        `json:"pricing"`
+	Mailers            map[string]QuotationMailerInfo `json:"mailers"`
+	QuotationTemplates map[string]QuoteInfo           `json:"quotationTemplates"`
+	CombinedQuotation  CombinedQuotationInfo          `json:"combinedQuotation"`
+	EULATemplates      []EULATemplate                 `json:"eulaTemplates"`
+	InquirySizing      *InquirySizing                 `json:"inquirySizing,omitempty"`
+
+	paidFeatures sets.String
+}
+
+// catalog is replaced by UseCatalog when the server is started with a custom catalog file.
+var catalog = MustLoadDefaultCatalog()
+
+func UseCatalog(c *Catalog) {
+	catalog = c
+}
+
+// UseCatalogFile loads and validates filename and makes it the current catalog.
+// An empty filename keeps the embedded catalog.
+func UseCatalogFile(filename string) error {
+	if filename == "" {
+		return nil
+	}
+	c, err := LoadCatalog(filename)
+	if err != nil {
+		return err
+	}
+	UseCatalog(c)
+	return nil
+}
+
+func CurrentCatalog() *Catalog {
+	return catalog
+}
+
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c.Complete()
+	return &c, nil
+}
+
+func LoadCatalog(filename string) (*Catalog, error) {
+	if filename == "" {
+		data, err := catalogfs.FS.ReadFile("catalog.yaml")
+		if err != nil {
+			return nil, err
+		}
+		return ParseCatalog(data)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %w", filename, err)
+	}
+	return c, nil
+}
+
+func MustLoadDefaultCatalog() *Catalog {
+	c, err := LoadCatalog("")
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Validate checks the cross-references between plans, aliases, quotation templates,
+// mailers, features and mailing lists.
+func (c *Catalog) Validate() error {
+	var errs []error
+
+	if c.Version != CatalogVersion {
+		errs = append(errs, fmt.Errorf("unsupported catalog version %q, expected %q", c.Version, CatalogVersion))
+	}
+
+	for name, id := range c.MailingLists {
+		if strings.TrimSpace(id) == "" {
+			errs = append(errs, fmt.Errorf("mailing list %s: missing uuid", name))
+		}
+	}
+	checkLists := func(owner string, lists []string) {
+		for _, l := range lists {
+			if _, ok := c.MailingLists[l]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown mailing list %s", owner, l))
+			}
+		}
+	}
+
+	features := sets.NewString(c.Features...)
+	planFeatures := sets.NewString()
+	for _, name := range sortedKeys(c.Plans) {
+		plan := c.Plans[name]
+		owner := "plan " + name
+		if plan.DisplayName == "" {
+			errs = append(errs, fmt.Errorf("%s: missing displayName", owner))
+		}
+		if plan.ProductLine == "" {
+			errs = append(errs, fmt.Errorf("%s: missing productLine", owner))
+		}
+		if plan.TierName == "" {
+			errs = append(errs, fmt.Errorf("%s: missing tierName", owner))
+		}
+		if len(plan.Features) == 0 {
+			errs = append(errs, fmt.Errorf("%s: missing features", owner))
+		}
+		for _, f := range plan.Features {
+			if !features.Has(f) {
+				errs = append(errs, fmt.Errorf("%s: unknown feature %s", owner, f))
+			}
+		}
+		planFeatures.Insert(plan.Features...)
+		checkLists(owner, plan.MailingLists)
+	}
+
+	for _, f := range c.PaidFeatures {
+		if !features.Has(f) {
+			errs = append(errs, fmt.Errorf("paid feature %s: unknown feature", f))
+		} else if !planFeatures.Has(f) {
+			errs = append(errs, fmt.Errorf("paid feature %s: not included in any plan", f))
+		}
+	}
+
+	for _, alias := range sortedKeys(c.Aliases) {
+		if _, ok := c.Plans[c.Aliases[alias]]; !ok {
+			errs = append(errs, fmt.Errorf("alias %s: unknown plan %s", alias, c.Aliases[alias]))
+		}
+	}
+	for _, name := range sortedKeys(c.Plans) {
+		if c.Aliases[name] != name {
+			errs = append(errs, fmt.Errorf("plan %s: missing alias to itself", name))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Mailers) {
+		m := c.Mailers[name]
+		if m.Offer == "" || m.FullPlan == "" || m.Plan == "" {
+			errs = append(errs, fmt.Errorf("mailer %s: offer, fullPlan and plan are required", name))
+		}
+	}
+
+	usedMailers := sets.NewString()
+	for _, name := range sortedKeys(c.QuotationTemplates) {
+		t := c.QuotationTemplates[name]
+		owner := "quotation template " + name
+		if name != strings.ToLower(name) {
+			errs = append(errs, fmt.Errorf("%s: name must be lowercase", owner))
+		}
+		if name == CombinedQuotationTemplate {
+			errs = append(errs, fmt.Errorf("%s: name is reserved for combined quotations", owner))
+		}
+		if t.TemplateDocId == "" {
+			errs = append(errs, fmt.Errorf("%s: missing templateDocId", owner))
+		}
+		if _, ok := c.Mailers[t.Mailer]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown mailer %q", owner, t.Mailer))
+		}
+		usedMailers.Insert(t.Mailer)
+		checkLists(owner, t.MailingLists)
+		if t.PriceList != "" {
+			if _, ok := c.Pricing.PriceLists[t.PriceList]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown price list %s", owner, t.PriceList))
+			}
+		}
+	}
+	for _, name := range sortedKeys(c.Mailers) {
+		if !usedMailers.Has(name) {
+			errs = append(errs, fmt.Errorf("mailer %s: not used by any quotation template", name))
+		}
+	}
+
+	errs = append(errs, c.Pricing.Validate(c.Plans)...)
+	errs = append(errs, validateEULATemplates(c.EULATemplates)...)
+	errs = append(errs, c.validateInquirySizing()...)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// Complete resolves mailing list names to listmonk uuids. Validate must be called first.
+func (c *Catalog) Complete() {
+	resolve := func(lists []string) []string {
+		if len(lists) == 0 {
+			return nil
+		}
+		out := make([]string, 0, len(lists))
+		for _, l := range lists {
+			out = append(out, c.MailingLists[l])
+		}
+		return out
+	}
+	for name, plan := range c.Plans {
+		plan.MailingLists = resolve(plan.MailingLists)
+		c.Plans[name] = plan
+	}
+	for name, t := range c.QuotationTemplates {
+		t.MailingLists = resolve(t.MailingLists)
+		c.QuotationTemplates[name] = t
+	}
+	c.paidFeatures = sets.NewString(c.PaidFeatures...)
+}
+
+// Plan returns the plan for a plan name. Unknown plans return an empty PlanInfo.
+func (c *Catalog) Plan(name string) PlanInfo {
+	return c.Plans[name]
+}
+
+// PlanForAlias returns the plan name for a product alias, or "" if the alias is unknown.
+func (c *Catalog) PlanForAlias(alias string) string {
+	return c.Aliases[alias]
+}
+
+func (c *Catalog) QuotationTemplate(name string) (QuoteInfo, bool) {
+	t, ok := c.QuotationTemplates[strings.ToLower(name)]
+	return t, ok
+}
+
+func (c *Catalog) QuotationMailer(template string) (QuotationMailerInfo, error) {
+	t, ok := c.QuotationTemplate(template)
+	if !ok {
+		return QuotationMailerInfo{}, fmt.Errorf("unknown template doc %s", template)
+	}
+	m, ok := c.Mailers[t.Mailer]
+	if !ok {
+		return QuotationMailerInfo{}, fmt.Errorf("unknown mailer %s for template doc %s", t.Mailer, template)
+	}
+	return m, nil
+}
+
+// PriceQuotation computes the line items for a quotation template that has a price list.
+func (c *Catalog) PriceQuotation(template string, req PricingRequest) (*PriceBreakdown, error) {
+	t, ok := c.QuotationTemplate(template)
+	if !ok {
+		return nil, fmt.Errorf("unknown template doc %s", template)
+	}
+	if t.PriceList == "" {
+		return nil, fmt.Errorf("template doc %s does not support line-item pricing", template)
+	}
+	return c.Pricing.Price(t.PriceList, req)
+}
+
+// PlanSection returns the text describing a quotation template in a combined quotation.
+// Plans priced from the requested quantities list their line items and total, and
+// other templates with a price list include their list prices.
+func (c *Catalog) PlanSection(template string, price *PriceBreakdown) (string, error) {
+	m, err := c.QuotationMailer(template)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{fmt.Sprintf("%s %s", m.Offer, m.FullPlan)}
+
+	if price != nil {
+		for _, item := range price.LineItems {
+			lines = append(lines, fmt.Sprintf("  - %s x %d: %s", item.Description, item.Quantity, formatMoney(item.Amount, price.Currency)))
+		}
+		lines = append(lines, fmt.Sprintf("  Total for %s: %s", pluralize(price.TermYears, "year"), formatMoney(price.Total, price.Currency)))
+		return strings.Join(lines, "\n"), nil
+	}
+
+	t, _ := c.QuotationTemplate(template)
+	if pl, ok := c.Pricing.PriceLists[t.PriceList]; ok {
+		for _, unit := range sortedKeys(pl.Units) {
+			price := pl.Units[unit]
+			lines = append(lines, fmt.Sprintf("  - %s: %s / month", price.Description, formatMoney(toCents(price.MonthlyPrice), c.Pricing.Currency)))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (c *Catalog) IsPaidFeature(feature string) bool {
+	return c.paidFeatures.Has(feature)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
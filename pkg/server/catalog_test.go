@@ -0,0 +1,150 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range c.QuotationTemplates {
+		if _, err := c.QuotationMailer(name); err != nil {
+			t.Errorf("quotation template %s: %v", name, err)
+		}
+	}
+	for alias, plan := range c.Aliases {
+		if c.Plan(plan).ProductLine == "" {
+			t.Errorf("alias %s: unknown plan %s", alias, plan)
+		}
+	}
+}
+
+func TestParseCatalogInvalid(t *testing.T) {
+	data := []byte(`
+version: v1
+mailingLists: {}
+features: [a]
+plans:
+  a-enterprise:
+    displayName: A
+    productLine: a
+    tierName: enterprise
+    features: [a, b]
+aliases:
+  a: a-enterprise
+mailers: {}
+quotationTemplates:
+  a-enterprise:
+    templateDocId: doc
+    mailer: missing
+`)
+	if _, err := server.ParseCatalog(data); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestPlanSection(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := c.PlanSection("stash-enterprise", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Stash Enterprise\n  - Stash Enterprise (per cluster): $100.00 / month"
+	if section != expected {
+		t.Errorf("expected section %q, found %q", expected, section)
+	}
+	if section, _ := c.PlanSection("guard-enterprise", nil); section != "Guard Enterprise" {
+		t.Errorf("unexpected section %q for template without price list", section)
+	}
+}
+
+func TestEULATemplate(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.EULATemplate(server.EULATerms{
+		PaymentTerm:      server.PaymentTermAnnual,
+		SupportPlan:      server.SupportPlanPremium,
+		TermYears:        1,
+		BillingFrequency: server.BillingFrequencyAnnual,
+	}); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.EULATemplate(server.EULATerms{
+		PaymentTerm:      server.PaymentTermAnnual,
+		SupportPlan:      server.SupportPlanPremium,
+		TermYears:        3,
+		BillingFrequency: server.BillingFrequencyQuarterly,
+	}); err == nil {
+		t.Error("expected 3 year contract to be rejected until a template covers it")
+	}
+	if _, err := c.EULATemplate(server.EULATerms{
+		PaymentTerm:      server.PaymentTermPAYG,
+		SupportPlan:      server.SupportPlanStandard,
+		TermYears:        2,
+		BillingFrequency: server.BillingFrequencyMonthly,
+	}); err == nil {
+		t.Error("expected multi-year PAYG contract to be rejected")
+	}
+}
+
+func TestEULATemplateMissingPlaceholders(t *testing.T) {
+	tmpl := server.EULATemplate{
+		TermYears:          []int{1, 2, 3},
+		BillingFrequencies: []string{server.BillingFrequencyAnnual, server.BillingFrequencyQuarterly},
+	}
+	if missing := tmpl.MissingPlaceholders("a {{term-years}} year term billed {{billing-frequency}}"); len(missing) > 0 {
+		t.Errorf("unexpected missing placeholders %v", missing)
+	}
+	missing := tmpl.MissingPlaceholders("a 1 year term billed {{billing-frequency}}")
+	if len(missing) != 1 || missing[0] != "{{term}}" {
+		t.Errorf("expected missing term placeholder, found %v", missing)
+	}
+	// a template for a single combination can spell out the terms
+	tmpl.TermYears = []int{1}
+	tmpl.BillingFrequencies = []string{server.BillingFrequencyAnnual}
+	if missing := tmpl.MissingPlaceholders("a 1 year term billed annually"); len(missing) > 0 {
+		t.Errorf("unexpected missing placeholders %v", missing)
+	}
+}
+
+func TestEULATemplateOverlap(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.EULATemplates = append(c.EULATemplates, server.EULATemplate{
+		PaymentTerm:        server.PaymentTermAnnual,
+		SupportPlan:        server.SupportPlanStandard,
+		TermYears:          []int{2},
+		BillingFrequencies: []string{server.BillingFrequencyAnnual},
+		TemplateDocId:      "duplicate",
+	})
+	if err := c.Validate(); err == nil {
+		t.Error("expected overlapping eula templates to fail validation")
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/auth"
+	ep "gomodules.xyz/email-providers"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+// Sources of contact interactions.
+const (
+	ContactSourceLicense          = "license"
+	ContactSourceQuotation        = "quotation"
+	ContactSourceWebinar          = "webinar"
+	ContactSourceDealRegistration = "deal-registration"
+	ContactSourceKubeDBInquiry    = "kubedb-inquiry"
+	ContactSourceKubeDBSalesQA    = "kubedb-sales-qa"
+)
+
+// Profile fields merged from every source.
+const (
+	ContactFieldName    = "name"
+	ContactFieldCompany = "company"
+	ContactFieldTitle   = "title"
+	ContactFieldPhone   = "phone"
+	ContactFieldCountry = "country"
+	ContactFieldAddress = "address"
+)
+
+// ContactUpdate is what a form handler knows about a person, plus the interaction
+// that brought them in.
+type ContactUpdate struct {
+	Email   string
+	Name    string
+	Company string
+	Title   string
+	Phone   string
+	Country string
+	Address string
+
+	Source  string
+	Event   string
+	Summary string
+	Ref     string
+}
+
+// ContactField is the current value of a profile field and where it came from.
+type ContactField struct {
+	Value     string    `json:"value"`
+	Source    string    `json:"source"`
+	UpdatedOn time.Time `json:"updatedOn"`
+}
+
+type ContactSource struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+}
+
+type ContactInteraction struct {
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	Event     string    `json:"event"`
+	Summary   string    `json:"summary,omitempty"`
+	Ref       string    `json:"ref,omitempty"`
+}
+
+// ContactProfile is the deduplicated record of a person across all forms, keyed by
+// the normalized email.
+type ContactProfile struct {
+	Email     string                   `json:"email"`
+	Emails    []string                 `json:"emails"`
+	Fields    map[string]ContactField  `json:"fields"`
+	Sources   map[string]ContactSource `json:"sources"`
+	Timeline  []ContactInteraction     `json:"timeline"`
+	CreatedOn time.Time                `json:"createdOn"`
+	UpdatedOn time.Time                `json:"updatedOn"`
+
+	// Undeliverable is not stored, it is filled in by lookups.
+	Undeliverable *EmailSuppression `json:"undeliverable,omitempty"`
+}
+
+// NormalizeEmail returns the key used to deduplicate contacts. Emails are lowercased.
+// For Gmail addresses, "+tag" suffixes are dropped and dots are ignored. Other providers
+// may treat them as distinct mailboxes, so they are kept.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	idx := strings.LastIndex(email, "@")
+	if idx <= 0 {
+		return email
+	}
+	local, domain := email[:idx], email[idx+1:]
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		if i := strings.Index(local, "+"); i > 0 {
+			local = local[:i]
+		}
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+func NewContactProfile(email string, now time.Time) *ContactProfile {
+	return &ContactProfile{
+		Email:     NormalizeEmail(email),
+		Fields:    map[string]ContactField{},
+		Sources:   map[string]ContactSource{},
+		CreatedOn: now,
+	}
+}
+
+// sameValue reports whether two values only differ in case, spacing or punctuation,
+// eg, "Jane  Doe" and "jane doe".
+func sameValue(a, b string) bool {
+	return strings.Join(strings.Fields(nonAlphanumeric.ReplaceAllString(strings.ToLower(a), " ")), " ") ==
+		strings.Join(strings.Fields(nonAlphanumeric.ReplaceAllString(strings.ToLower(b), " ")), " ")
+}
+
+// Merge adds the update to the profile. Non-empty fields replace older values, unless
+// they only differ in spelling from the current value.
+func (p *ContactProfile) Merge(u ContactUpdate, now time.Time) {
+	if email := strings.TrimSpace(u.Email); email != "" {
+		var found bool
+		for _, e := range p.Emails {
+			if strings.EqualFold(e, email) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.Emails = append(p.Emails, email)
+		}
+	}
+
+	for field, v := range map[string]string{
+		ContactFieldName:    u.Name,
+		ContactFieldCompany: u.Company,
+		ContactFieldTitle:   u.Title,
+		ContactFieldPhone:   u.Phone,
+		ContactFieldCountry: u.Country,
+		ContactFieldAddress: u.Address,
+	} {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if cur, ok := p.Fields[field]; ok && sameValue(cur.Value, v) {
+			continue
+		}
+		p.Fields[field] = ContactField{Value: v, Source: u.Source, UpdatedOn: now}
+	}
+
+	src := p.Sources[u.Source]
+	if src.Count == 0 {
+		src.FirstSeen = now
+	}
+	src.LastSeen = now
+	src.Count++
+	p.Sources[u.Source] = src
+
+	p.Timeline = append(p.Timeline, ContactInteraction{
+		Timestamp: now,
+		Source:    u.Source,
+		Event:     u.Event,
+		Summary:   u.Summary,
+		Ref:       u.Ref,
+	})
+	p.UpdatedOn = now
+}
+
+func (p *ContactProfile) Field(name string) string {
+	return p.Fields[name].Value
+}
+
+func (p *ContactProfile) Domain() string {
+	if ep.IsPublicEmail(p.Email) {
+		return ""
+	}
+	return ep.Domain(p.Email)
+}
+
+func (p *ContactProfile) indexPaths() []string {
+	var paths []string
+	if domain := p.Domain(); domain != "" {
+		paths = append(paths, ContactIndexPath("domains", domain))
+	}
+	if company := NormalizeCompanyName(p.Field(ContactFieldCompany)); company != "" {
+		paths = append(paths, ContactIndexPath("companies", strings.ReplaceAll(company, " ", "-")))
+	}
+	return paths
+}
+
+var contactMu sync.Mutex
+
+func (s *Server) GetContact(email string) (*ContactProfile, error) {
+	data, err := s.fs.ReadFile(context.TODO(), ContactPath(NormalizeEmail(email)))
+	if err != nil {
+		return nil, err
+	}
+	var p ContactProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// RecordContact merges the update into the contact store and indexes the contact by
+// email domain and company. A contact that changed company is removed from the old
+// company's index.
+func (s *Server) RecordContact(u ContactUpdate) error {
+	if !strings.Contains(u.Email, "@") {
+		return fmt.Errorf("invalid contact email %q", u.Email)
+	}
+
+	contactMu.Lock()
+	defer contactMu.Unlock()
+
+	now := time.Now()
+	key := NormalizeEmail(u.Email)
+	p := NewContactProfile(key, now)
+	if ok, err := s.fs.Exists(context.TODO(), ContactPath(key)); err != nil {
+		return err
+	} else if ok {
+		if p, err = s.GetContact(key); err != nil {
+			return err
+		}
+	}
+	before := p.indexPaths()
+	p.Merge(u, now)
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.WriteFile(context.TODO(), ContactPath(key), data); err != nil {
+		return err
+	}
+	after := p.indexPaths()
+	for _, path := range after {
+		if err := s.appendIndex(path, key); err != nil {
+			return err
+		}
+	}
+	for _, path := range before {
+		if !slices.Contains(after, path) {
+			if err := s.removeIndex(path, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordContact is used by form handlers, where the contact store must not fail the request.
+func (s *Server) recordContact(u ContactUpdate) {
+	if err := s.RecordContact(u); err != nil {
+		klog.Warningln(err)
+	}
+}
+
+// FindContacts returns the contacts with a work email at domain or working for company.
+func (s *Server) FindContacts(domain, company string) ([]*ContactProfile, error) {
+	var paths []string
+	if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+		paths = append(paths, ContactIndexPath("domains", domain))
+	}
+	if company = NormalizeCompanyName(company); company != "" {
+		paths = append(paths, ContactIndexPath("companies", strings.ReplaceAll(company, " ", "-")))
+	}
+
+	seen := map[string]bool{}
+	var out []*ContactProfile
+	for _, path := range paths {
+		keys, err := s.readIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			p, err := s.GetContact(key)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Email < out[j].Email
+	})
+	return out, nil
+}
+
+func (s *Server) RegisterContactAPI(m *macaron.Macaron) {
+	salesAuth := auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD"))
+
+	m.Get("/_/contacts/", salesAuth, func(ctx *macaron.Context) {
+		domain, company := ctx.Query("domain"), ctx.Query("company")
+		if domain == "" && company == "" {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte("domain or company is required"))
+			return
+		}
+		contacts, err := s.FindContacts(domain, company)
+		if err == nil {
+			for _, p := range contacts {
+				if p.Undeliverable, err = s.GetEmailSuppression(p.Email); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, contacts)
+	})
+
+	m.Get("/_/contacts/:email", salesAuth, func(ctx *macaron.Context) {
+		p, err := s.GetContact(ctx.Params("email"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		if p.Undeliverable, err = s.GetEmailSuppression(p.Email); err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, p)
+	})
+}
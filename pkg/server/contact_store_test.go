@@ -0,0 +1,89 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := map[string]string{
+		" Jane.Doe@Acme.com ":       "jane.doe@acme.com",
+		"jane+webinar@acme.com":     "jane+webinar@acme.com",
+		"Jane.Doe+x@googlemail.com": "janedoe@gmail.com",
+		"not-an-email":              "not-an-email",
+	}
+	for in, expected := range cases {
+		if found := server.NormalizeEmail(in); found != expected {
+			t.Errorf("%q: expected %q, found %q", in, expected, found)
+		}
+	}
+}
+
+func TestContactProfileMerge(t *testing.T) {
+	t1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+
+	p := server.NewContactProfile("Jane.Doe+license@Gmail.com", t1)
+	p.Merge(server.ContactUpdate{
+		Email:   "Jane.Doe+license@Gmail.com",
+		Name:    "Jane Doe",
+		Source:  server.ContactSourceLicense,
+		Event:   "license_issued",
+		Country: "US",
+	}, t1)
+	p.Merge(server.ContactUpdate{
+		Email:   "janedoe@gmail.com",
+		Name:    "jane  doe",
+		Company: "Acme, Inc.",
+		Title:   "CTO",
+		Source:  server.ContactSourceQuotation,
+		Event:   "quotation_generated",
+		Ref:     "AC2610001",
+	}, t2)
+
+	if p.Email != "janedoe@gmail.com" || len(p.Emails) != 2 {
+		t.Errorf("unexpected emails %q %v", p.Email, p.Emails)
+	}
+	// a spelling variant keeps the first value and its provenance
+	if f := p.Fields[server.ContactFieldName]; f.Value != "Jane Doe" || f.Source != server.ContactSourceLicense {
+		t.Errorf("unexpected name %+v", f)
+	}
+	if f := p.Fields[server.ContactFieldCompany]; f.Value != "Acme, Inc." || f.Source != server.ContactSourceQuotation || !f.UpdatedOn.Equal(t2) {
+		t.Errorf("unexpected company %+v", f)
+	}
+	if len(p.Timeline) != 2 || p.Timeline[1].Ref != "AC2610001" {
+		t.Errorf("unexpected timeline %+v", p.Timeline)
+	}
+	if len(p.Sources) != 2 || p.Sources[server.ContactSourceLicense].Count != 1 {
+		t.Errorf("unexpected sources %+v", p.Sources)
+	}
+	if p.Domain() != "" {
+		t.Errorf("expected no domain for a public email, found %q", p.Domain())
+	}
+	if d := server.NewContactProfile("jane@acme.com", t1).Domain(); d != "acme.com" {
+		t.Errorf("unexpected domain %q", d)
+	}
+
+	p.Merge(server.ContactUpdate{Email: "janedoe@gmail.com", Name: "Janet Doe", Source: server.ContactSourceWebinar, Event: "webinar_registration"}, t2)
+	if f := p.Fields[server.ContactFieldName]; f.Value != "Janet Doe" || f.Source != server.ContactSourceWebinar {
+		t.Errorf("expected a different name to replace the old one, found %+v", f)
+	}
+}
@@ -19,43 +19,35 @@ package server
 import (
 	"strings"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+
 	"github.com/gobuffalo/flect"
 	freshsalesclient "gomodules.xyz/freshsales-client-go"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
 )
 
-func (s *Server) ensureCRMEntity(contact *freshsalesclient.Contact) (freshsalesclient.EntityType, int64, error) {
-	result, err := s.freshsales.LookupByEmail(contact.Email, freshsalesclient.EntityContact)
-	if err != nil {
-		return "", 0, err
-	}
-
-	if len(result.Contacts.Contacts) > 0 {
-		// contact found
-		return freshsalesclient.EntityContact, result.Contacts.Contacts[0].ID, nil
-	}
+// noteEvent records the event as a YAML note on the contact, creating the contact if needed.
+// The note is sent through the outbox, so an error means it was not queued.
+func (s *Server) noteEvent(contact *crm.Contact, e any) error {
+	return s.enqueueCRMNote(contact, e, false)
+}
 
-	// create contact
-	contact, err = s.freshsales.CreateContact(contact)
-	if err != nil {
-		return "", 0, err
-	}
-	return freshsalesclient.EntityContact, contact.ID, nil
+// noteEventUpsert is like noteEvent, but also updates the contact details.
+func (s *Server) noteEventUpsert(contact *crm.Contact, e any) error {
+	return s.enqueueCRMNote(contact, e, true)
 }
 
-func (s *Server) createContact(email string, name string) *freshsalesclient.Contact {
-	fields := strings.Fields(name)
-	var firstname, lastname string
-	if len(fields) > 0 {
-		firstname = strings.Join(fields[0:len(fields)-1], " ")
-		lastname = fields[len(fields)-1]
-	}
-	return &freshsalesclient.Contact{
-		Email:       email,
-		DisplayName: name,
-		FirstName:   firstname,
-		LastName:    lastname,
+func (s *Server) enqueueCRMNote(contact *crm.Contact, e any, upsert bool) error {
+	desc, err := yaml.Marshal(e)
+	if err != nil {
+		return err
 	}
+	return s.enqueueOutbox(OutboxCRMNote, "crm note for "+contact.Email, CRMNoteArgs{
+		Contact: *contact,
+		Upsert:  upsert,
+		Body:    string(desc),
+	})
 }
 
 type LicenseEventType string
@@ -66,12 +58,6 @@ const (
 )
 
 func (s *Server) noteEventLicenseIssued(info LogEntry, event LicenseEventType) error {
-	et, id, err := s.ensureCRMEntity(s.createContact(info.Email, info.Name))
-	if err != nil {
-		return err
-	}
-
-	// add note
 	e := EventLicenseIssued{
 		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
 			Event: string(event),
@@ -92,81 +78,18 @@ func (s *Server) noteEventLicenseIssued(info LogEntry, event LicenseEventType) e
 			Cluster: info.Cluster,
 		},
 	}
-	desc, err := yaml.Marshal(e)
-	if err != nil {
-		return err
-	}
-	_, err = s.freshsales.AddNote(id, et, string(desc))
-	return err
+	return s.noteEvent(&crm.Contact{Email: info.Email, Name: info.Name}, e)
 }
 
-func (s *Server) noteEventQuotation(form ProductQuotation, e EventQuotationGenerated) error {
-	result, err := s.freshsales.LookupByEmail(form.Email, freshsalesclient.EntityContact)
-	if err != nil {
-		return err
-	}
-
-	var et freshsalesclient.EntityType
-	var id int64
-	if len(result.Contacts.Contacts) > 0 {
-		// contact found
-		et = freshsalesclient.EntityContact
-		contact := result.Contacts.Contacts[0]
-		id = contact.ID
-
-		var changed bool
-		if contact.DisplayName != form.Name {
-			contact.DisplayName = form.Name
-			changed = true
-		}
-		if contact.JobTitle != form.Title {
-			contact.JobTitle = form.Title
-			changed = true
-		}
-		if contact.WorkNumber != form.Telephone {
-			contact.WorkNumber = form.Telephone
-			changed = true
-		}
-		//if contact.com.Company.Name == "" {
-		//	contact.Company.Name = form.Company
-		//	changed = true
-		//}
-
-		if changed {
-			_, err = s.freshsales.UpdateContact(&contact)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// create contact
-		fields := strings.Fields(form.Name)
-		contact := &freshsalesclient.Contact{
-			Email:       form.Email,
-			DisplayName: form.Name,
-			FirstName:   strings.Join(fields[0:len(fields)-1], " "),
-			LastName:    fields[len(fields)-1],
-			JobTitle:    form.Title,
-			WorkNumber:  form.Telephone,
-		}
-		contact, err := s.freshsales.CreateContact(contact)
-		if err != nil {
-			return err
-		}
-		et = freshsalesclient.EntityContact
-		id = contact.ID
-	}
-
-	// add note
-	desc, err := yaml.Marshal(e)
-	if err != nil {
-		return err
-	}
-	_, err = s.freshsales.AddNote(id, et, string(desc))
-	return err
+func (s *Server) noteEventQuotation(form ProductQuotation, e any) error {
+	return s.noteEventUpsert(&crm.Contact{
+		Email:    form.Email,
+		Name:     form.Name,
+		JobTitle: form.Title,
+		Phone:    form.Telephone,
+	}, e)
 }
 
-// nolint:unused
 func (s *Server) noteEventMailgun(email string, e EventMailgun) error {
 	name := email
 	idx := strings.LastIndex(email, "@")
@@ -179,82 +102,27 @@ func (s *Server) noteEventMailgun(email string, e EventMailgun) error {
 	name = strings.ReplaceAll(name, "-", " ")
 	name = flect.Titleize(name)
 
-	et, id, err := s.ensureCRMEntity(s.createContact(email, name))
-	if err != nil {
-		return err
-	}
-
-	// add note
-	desc, err := yaml.Marshal(e)
-	if err != nil {
-		return err
-	}
-	_, err = s.freshsales.AddNote(id, et, string(desc))
-	return err
+	return s.noteEvent(&crm.Contact{Email: email, Name: name}, e)
 }
 
 func (s *Server) noteEventWebinarRegistration(form WebinarRegistrationForm, e EventWebinarRegistration) error {
-	result, err := s.freshsales.LookupByEmail(form.WorkEmail, freshsalesclient.EntityContact)
-	if err != nil {
-		return err
-	}
-
-	var et freshsalesclient.EntityType
-	var id int64
-	if len(result.Contacts.Contacts) > 0 {
-		// contact found
-		et = freshsalesclient.EntityContact
-		contact := result.Contacts.Contacts[0]
-		id = contact.ID
-
-		var changed bool
-		name := form.FirstName + " " + form.LastName
-		if contact.DisplayName != name {
-			contact.DisplayName = name
-			changed = true
-		}
-		if contact.JobTitle != form.JobTitle {
-			contact.JobTitle = form.JobTitle
-			changed = true
-		}
-		if contact.WorkNumber != form.Phone {
-			contact.WorkNumber = form.Phone
-			changed = true
-		}
-		//if contact.Company.Name == "" {
-		//	contact.Company.Name = form.Company
-		//	changed = true
-		//}
-
-		if changed {
-			_, err = s.freshsales.UpdateContact(&contact)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// create contact
-		contact := &freshsalesclient.Contact{
-			Email:       form.WorkEmail,
-			DisplayName: form.FirstName + " " + form.LastName,
-			FirstName:   form.FirstName,
-			LastName:    form.LastName,
-			JobTitle:    form.JobTitle,
-			WorkNumber:  form.Phone,
-		}
-		contact, err := s.freshsales.CreateContact(contact)
-		if err != nil {
-			return err
-		}
-		et = freshsalesclient.EntityContact
-		id = contact.ID
-	}
+	return s.noteEventUpsert(&crm.Contact{
+		Email:     form.WorkEmail,
+		Name:      form.FirstName + " " + form.LastName,
+		FirstName: form.FirstName,
+		LastName:  form.LastName,
+		JobTitle:  form.JobTitle,
+		Phone:     form.Phone,
+	}, e)
+}
 
-	// add note
-	desc, err := yaml.Marshal(e)
+// ensureCRMAccount returns the id of the customer's account, creating it if needed.
+// Notes are still recorded on the contact if the account can't be created.
+func (s *Server) ensureCRMAccount(account *crm.Account) string {
+	a, err := crm.EnsureAccount(s.crm, account)
 	if err != nil {
-		return err
+		klog.Warningln(err)
+		return ""
 	}
-	_, err = s.freshsales.AddNote(id, et, string(desc))
-	return err
+	return a.ID
 }
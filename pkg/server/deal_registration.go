@@ -22,11 +22,12 @@ import (
 	"strings"
 	"time"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+
 	"github.com/gocarina/gocsv"
 	freshsalesclient "gomodules.xyz/freshsales-client-go"
 	gdrive "gomodules.xyz/gdrive-utils"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -60,7 +61,8 @@ type DealRegistrationInfo struct {
 	Notes                       string `form:"notes" json:"notes" csv:"notes"`
 
 	// Internal fields
-	RegisteredOn OfferDate `form:"-" json:"-" csv:"registered-on"`
+	RegisteredOn   OfferDate `form:"-" json:"-" csv:"registered-on"`
+	RegistrationId string    `form:"-" json:"-" csv:"registration-id"`
 }
 
 func (form *DealRegistrationInfo) Complete() {
@@ -85,32 +87,59 @@ func (form DealRegistrationInfo) Validate() error {
 	return nil
 }
 
-func (s *Server) HandleDealRegistration(info *DealRegistrationInfo) error {
+func (s *Server) HandleDealRegistration(info *DealRegistrationInfo) (*DealRegistration, error) {
+	r, err := s.RegisterDeal(*info)
+	if err != nil {
+		return nil, err
+	}
+	info = &r.Info
+
 	go func() {
+		s.recordContact(ContactUpdate{
+			Email:   info.CustomerEmail,
+			Name:    info.CustomerName,
+			Company: info.CustomerCompany,
+			Phone:   info.CustomerPhone,
+			Country: info.CustomerCountry,
+			Address: info.CustomerAddress,
+			Source:  ContactSourceDealRegistration,
+			Event:   "deal_registration",
+			Summary: fmt.Sprintf("%s registered by %s", info.Product, info.PartnerCompany),
+			Ref:     r.ID,
+		})
+		s.recordContact(ContactUpdate{
+			Email:   info.PartnerEmail,
+			Name:    info.PartnerName,
+			Company: info.PartnerCompany,
+			Source:  ContactSourceDealRegistration,
+			Event:   "deal_registration_submitted",
+			Summary: fmt.Sprintf("%s for %s", info.Product, info.CustomerCompany),
+			Ref:     r.ID,
+		})
+
+		// the registration is stored in the bucket, so the sheet is only a copy for sales
 		clients := []*DealRegistrationInfo{info}
 		writer := gdrive.NewWriter(s.srvSheets, DealSpreadsheetId, "Deal Registration")
 		err := gocsv.MarshalCSV(clients, writer)
 		if err != nil {
 			klog.Warningln(err)
-			return
 		}
 
 		err = s.noteEventDealRegistration(info)
 		if err != nil {
 			klog.Warningln(err)
-			return
 		}
 
-		mailer := NewDealRegistrationMailer(info)
+		mailer := NewDealRegistrationMailer(r, s.DealRegistrationReviewLink(r.ID))
 		fmt.Println("sending email for deal registration", info.CustomerCompany)
-		err = mailer.SendMail(s.mg, MailIncomingDeals, "", nil)
+		err = s.sendMail(mailer, MailIncomingDeals, "")
 		if err != nil {
 			klog.Warningln(err)
 			return
 		}
 	}()
 
-	return nil
+	return r, nil
 }
 
 type EventDealRegistration struct {
@@ -119,93 +148,23 @@ type EventDealRegistration struct {
 }
 
 func (s *Server) noteEventDealRegistration(info *DealRegistrationInfo) error {
-	fields := strings.Fields(info.CustomerName)
-	var firstName, lastName string
-	if len(fields) > 0 {
-		firstName = strings.Join(fields[0:len(fields)-1], " ")
-		lastName = fields[len(fields)-1]
-	}
-
-	var companyID int64
-	companyResults, err := s.freshsales.Search(info.CustomerCompany, freshsalesclient.EntitySalesAccount)
-	if err == nil && len(companyResults) > 0 {
-		id, _ := strconv.ParseInt(companyResults[0].ID, 10, 64)
-		companyID = id
-	} else {
-		account := &freshsalesclient.SalesAccount{
-			Name:    info.CustomerCompany,
-			Address: info.CustomerAddress,
-			Country: info.CustomerCountry,
-			Phone:   info.CustomerPhone,
-		}
-		newAccount, err := s.freshsales.CreateAccount(account)
-		if err != nil {
-			klog.Warningln(err)
-		} else if newAccount != nil {
-			companyID = newAccount.ID
-		}
-	}
-
-	var contactID int64
-	contactResult, err := s.freshsales.LookupByEmail(info.CustomerEmail, freshsalesclient.EntityContact)
-	if err == nil && len(contactResult.Contacts.Contacts) > 0 {
-		contact := contactResult.Contacts.Contacts[0]
-		contactID = contact.ID
-
-		var changed bool
-		if contact.DisplayName != info.CustomerName {
-			contact.DisplayName = info.CustomerName
-			changed = true
-		}
-		if contact.WorkNumber != info.CustomerPhone {
-			contact.WorkNumber = info.CustomerPhone
-			changed = true
-		}
-		if contact.Address != info.CustomerAddress {
-			contact.Address = info.CustomerAddress
-			changed = true
-		}
-		if contact.Country != info.CustomerCountry {
-			contact.Country = info.CustomerCountry
-			changed = true
-		}
-
-		if changed {
-			_, err = s.freshsales.UpdateContact(&contact)
-			if err != nil {
-				klog.Warningln(err)
-			}
-		}
-	} else {
-		contact := &freshsalesclient.Contact{
-			Email:          info.CustomerEmail,
-			DisplayName:    info.CustomerName,
-			FirstName:      firstName,
-			LastName:       lastName,
-			WorkNumber:     info.CustomerPhone,
-			Address:        info.CustomerAddress,
-			Country:        info.CustomerCountry,
-			SalesAccountID: companyID,
-		}
-		newContact, err := s.freshsales.CreateContact(contact)
-		if err != nil {
-			klog.Warningln(err)
-		} else if newContact != nil {
-			contactID = newContact.ID
-		}
-	}
-
-	deal := &freshsalesclient.Deal{
-		Name:           fmt.Sprintf("%s - %s", info.CustomerCompany, info.Product),
-		SalesAccountID: companyID,
+	accountID := s.ensureCRMAccount(&crm.Account{
+		Name:    info.CustomerCompany,
+		Address: info.CustomerAddress,
+		Country: info.CustomerCountry,
+		Phone:   info.CustomerPhone,
+	})
+
+	deal := &crm.Deal{
+		Name:      fmt.Sprintf("%s - %s", info.CustomerCompany, info.Product),
+		AccountID: accountID,
 	}
 	if info.EstimatedDealSize != "" {
 		if amount, err := strconv.ParseFloat(info.EstimatedDealSize, 64); err == nil {
 			deal.Amount = amount
 		}
 	}
-	_, err = s.freshsales.CreateDeal(deal)
-	if err != nil {
+	if _, err := s.crm.CreateDeal(deal); err != nil {
 		klog.Warningln(err)
 	}
 
@@ -215,10 +174,12 @@ func (s *Server) noteEventDealRegistration(info *DealRegistrationInfo) error {
 		},
 		DealRegistrationInfo: *info,
 	}
-	desc, err := yaml.Marshal(e)
-	if err != nil {
-		return err
-	}
-	_, err = s.freshsales.AddNote(contactID, freshsalesclient.EntityContact, string(desc))
-	return err
+	return s.noteEventUpsert(&crm.Contact{
+		Email:     info.CustomerEmail,
+		Name:      info.CustomerName,
+		Phone:     info.CustomerPhone,
+		Address:   info.CustomerAddress,
+		Country:   info.CustomerCountry,
+		AccountID: accountID,
+	}, e)
 }
@@ -0,0 +1,411 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/auth"
+	"github.com/go-macaron/binding"
+	"github.com/rs/xid"
+	ep "gomodules.xyz/email-providers"
+	"gopkg.in/macaron.v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+type DealStatus string
+
+const (
+	DealPending  DealStatus = "pending"
+	DealApproved DealStatus = "approved"
+	DealRejected DealStatus = "rejected"
+	DealExpired  DealStatus = "expired"
+)
+
+const (
+	// DealReviewWindow is how long a registration waits for review before it expires.
+	DealReviewWindow = 30 * 24 * time.Hour
+	// DealProtectionWindow is how long an approved registration protects the partner's deal.
+	DealProtectionWindow = 90 * 24 * time.Hour
+)
+
+const TaskDealRegistrationExpiry = "deal-registration-expiry"
+
+type DealEvent struct {
+	Status    DealStatus `json:"status"`
+	Timestamp time.Time  `json:"timestamp"`
+	Note      string     `json:"note,omitempty"`
+}
+
+type DealRegistration struct {
+	ID           string               `json:"id"`
+	Info         DealRegistrationInfo `json:"info"`
+	Status       DealStatus           `json:"status"`
+	RegisteredAt time.Time            `json:"registeredAt"`
+	ExpiresOn    time.Time            `json:"expiresOn"`
+	// Conflicts are the ids of active registrations for the same customer by other partners.
+	Conflicts []string    `json:"conflicts,omitempty"`
+	History   []DealEvent `json:"history"`
+}
+
+func NewDealRegistration(info DealRegistrationInfo, now time.Time) *DealRegistration {
+	r := &DealRegistration{
+		ID:           xid.New().String(),
+		Info:         info,
+		Status:       DealPending,
+		RegisteredAt: now,
+		ExpiresOn:    now.Add(DealReviewWindow),
+	}
+	r.History = append(r.History, DealEvent{Status: DealPending, Timestamp: now})
+	return r
+}
+
+var dealTransitions = map[DealStatus][]DealStatus{
+	DealPending:  {DealApproved, DealRejected, DealExpired},
+	DealApproved: {DealExpired},
+}
+
+func (r *DealRegistration) SetStatus(status DealStatus, note string, now time.Time) error {
+	for _, next := range dealTransitions[r.Status] {
+		if next == status {
+			r.Status = status
+			r.History = append(r.History, DealEvent{Status: status, Timestamp: now, Note: note})
+			if status == DealApproved {
+				r.ExpiresOn = now.Add(DealProtectionWindow)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("deal registration %s can't be marked %s, current status is %s", r.ID, status, r.Status)
+}
+
+// Active reports whether the registration still holds the customer.
+func (r *DealRegistration) Active(now time.Time) bool {
+	return (r.Status == DealPending || r.Status == DealApproved) && now.Before(r.ExpiresOn)
+}
+
+// CustomerDomain returns the customer email domain, or "" for public email providers.
+func (r *DealRegistration) CustomerDomain() string {
+	if ep.IsPublicEmail(r.Info.CustomerEmail) {
+		return ""
+	}
+	return strings.ToLower(ep.Domain(r.Info.CustomerEmail))
+}
+
+func (r *DealRegistration) partner() string {
+	if ep.IsPublicEmail(r.Info.PartnerEmail) {
+		return strings.ToLower(r.Info.PartnerEmail)
+	}
+	return strings.ToLower(ep.Domain(r.Info.PartnerEmail))
+}
+
+var (
+	nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+	companySuffixes = sets.NewString("inc", "incorporated", "llc", "ltd", "limited", "corp", "corporation", "co", "company", "gmbh", "ag", "sa", "plc", "pvt", "pte", "bv")
+)
+
+// NormalizeCompanyName lowercases the company name and drops punctuation and legal
+// suffixes, so that "Acme, Inc." and "ACME Inc" match.
+func NormalizeCompanyName(name string) string {
+	words := strings.Fields(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), " "))
+	for len(words) > 1 && companySuffixes.Has(words[len(words)-1]) {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// DealConflicts returns the active registrations by other partners for the same customer,
+// matched by customer email domain or company name.
+func DealConflicts(r *DealRegistration, existing []*DealRegistration, now time.Time) []*DealRegistration {
+	domain := r.CustomerDomain()
+	company := NormalizeCompanyName(r.Info.CustomerCompany)
+
+	var conflicts []*DealRegistration
+	for _, o := range existing {
+		if o.ID == r.ID || !o.Active(now) || o.partner() == r.partner() {
+			continue
+		}
+		if (domain != "" && o.CustomerDomain() == domain) ||
+			(company != "" && NormalizeCompanyName(o.Info.CustomerCompany) == company) {
+			conflicts = append(conflicts, o)
+		}
+	}
+	return conflicts
+}
+
+func dealIndexPaths(r *DealRegistration) []string {
+	var paths []string
+	if domain := r.CustomerDomain(); domain != "" {
+		paths = append(paths, DealIndexPath("domains", domain))
+	}
+	if company := NormalizeCompanyName(r.Info.CustomerCompany); company != "" {
+		paths = append(paths, DealIndexPath("companies", strings.ReplaceAll(company, " ", "-")))
+	}
+	return paths
+}
+
+// dealMu serializes registrations and decisions, so that conflict checks see a consistent index.
+var dealMu sync.Mutex
+
+func (s *Server) GetDealRegistration(id string) (*DealRegistration, error) {
+	data, err := s.fs.ReadFile(context.TODO(), DealRegistrationPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var r DealRegistration
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Server) saveDealRegistration(r *DealRegistration) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), DealRegistrationPath(r.ID), data)
+}
+
+// relatedDealRegistrations returns the registrations indexed under the same customer domain or company.
+func (s *Server) relatedDealRegistrations(r *DealRegistration) ([]*DealRegistration, error) {
+	ids := sets.NewString()
+	for _, path := range dealIndexPaths(r) {
+		found, err := s.readIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		ids.Insert(found...)
+	}
+	ids.Delete(r.ID)
+
+	related := make([]*DealRegistration, 0, ids.Len())
+	for _, id := range ids.List() {
+		o, err := s.GetDealRegistration(id)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, o)
+	}
+	return related, nil
+}
+
+func (s *Server) indexDealRegistration(r *DealRegistration) error {
+	paths := append(dealIndexPaths(r), DealIndexPath("partners", strings.ToLower(r.Info.PartnerEmail)))
+	for _, path := range paths {
+		if err := s.appendIndex(path, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) scheduleDealExpiry(r *DealRegistration) error {
+	args, err := json.Marshal(r.ID)
+	if err != nil {
+		return err
+	}
+	return s.sch.ScheduleTask(r.ExpiresOn, TaskDealRegistrationExpiry, args)
+}
+
+// RegisterDeal stores a new pending registration and records the conflict on both the new
+// and the conflicting registrations.
+func (s *Server) RegisterDeal(info DealRegistrationInfo) (*DealRegistration, error) {
+	dealMu.Lock()
+	defer dealMu.Unlock()
+
+	now := time.Now()
+	r := NewDealRegistration(info, now)
+	r.Info.RegistrationId = r.ID
+
+	related, err := s.relatedDealRegistrations(r)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := DealConflicts(r, related, now)
+	for _, o := range conflicts {
+		r.Conflicts = append(r.Conflicts, o.ID)
+	}
+
+	if err := s.saveDealRegistration(r); err != nil {
+		return nil, err
+	}
+	// the reviewers of the earlier registrations must see the clash too
+	for _, o := range conflicts {
+		o.Conflicts = append(o.Conflicts, r.ID)
+		if err := s.saveDealRegistration(o); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.indexDealRegistration(r); err != nil {
+		return nil, err
+	}
+	if err := s.scheduleDealExpiry(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DecideDealRegistration approves or rejects a pending registration and notifies the partner.
+// A registration can't be approved while another partner holds an approved registration
+// for the same customer.
+func (s *Server) DecideDealRegistration(id string, status DealStatus, note string) (*DealRegistration, error) {
+	if status != DealApproved && status != DealRejected {
+		return nil, fmt.Errorf("unsupported decision %s", status)
+	}
+
+	dealMu.Lock()
+	defer dealMu.Unlock()
+
+	r, err := s.GetDealRegistration(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if r.Status == DealPending && !r.Active(now) {
+		return nil, fmt.Errorf("deal registration %s has expired", r.ID)
+	}
+
+	if status == DealApproved {
+		related, err := s.relatedDealRegistrations(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range DealConflicts(r, related, now) {
+			if o.Status == DealApproved {
+				return nil, fmt.Errorf("customer %s is protected by deal registration %s of %s until %s",
+					r.Info.CustomerCompany, o.ID, o.Info.PartnerCompany, o.ExpiresOn.Format("Jan 2, 2006"))
+			}
+		}
+	}
+
+	if err := r.SetStatus(status, note, now); err != nil {
+		return nil, err
+	}
+	if err := s.saveDealRegistration(r); err != nil {
+		return nil, err
+	}
+	if status == DealApproved {
+		if err := s.scheduleDealExpiry(r); err != nil {
+			return nil, err
+		}
+	}
+
+	go s.notifyDealPartner(r)
+	return r, nil
+}
+
+func (s *Server) ExpireDealRegistration(args []byte) error {
+	var id string
+	if err := json.Unmarshal(args, &id); err != nil {
+		return err
+	}
+
+	dealMu.Lock()
+	defer dealMu.Unlock()
+
+	r, err := s.GetDealRegistration(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if r.Active(now) || (r.Status != DealPending && r.Status != DealApproved) {
+		// approval extends the window and schedules another expiry task
+		return nil
+	}
+	if err := r.SetStatus(DealExpired, "", now); err != nil {
+		return err
+	}
+	if err := s.saveDealRegistration(r); err != nil {
+		return err
+	}
+
+	go s.notifyDealPartner(r)
+	return nil
+}
+
+func (s *Server) notifyDealPartner(r *DealRegistration) {
+	mailer := NewDealRegistrationStatusMailer(r)
+	fmt.Println("sending deal registration", r.Status, "notice to", r.Info.PartnerEmail)
+	if err := s.sendMail(mailer, r.Info.PartnerEmail, ""); err != nil {
+		klog.Warningln(err)
+	}
+}
+
+func (s *Server) DealRegistrationReviewLink(id string) string {
+	return fmt.Sprintf("%s/_/deal_registrations/%s", strings.TrimSuffix(s.opts.BaseURL, "/"), url.PathEscape(id))
+}
+
+type DealDecisionForm struct {
+	Decision string `form:"decision" binding:"Required"`
+	Note     string `form:"note"`
+}
+
+func (s *Server) RegisterDealRegistrationAPI(m *macaron.Macaron) {
+	salesAuth := auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD"))
+
+	m.Get("/_/deal_registrations/:id", salesAuth, func(ctx *macaron.Context) {
+		r, err := s.GetDealRegistration(ctx.Params("id"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		if ctx.Query("format") == "json" {
+			ctx.JSON(http.StatusOK, r)
+			return
+		}
+
+		conflicts := make([]*DealRegistration, 0, len(r.Conflicts))
+		for _, id := range r.Conflicts {
+			o, err := s.GetDealRegistration(id)
+			if err != nil {
+				klog.Warningln(err)
+				continue
+			}
+			conflicts = append(conflicts, o)
+		}
+		sort.Slice(conflicts, func(i, j int) bool {
+			return conflicts[i].RegisteredAt.Before(conflicts[j].RegisteredAt)
+		})
+		ctx.Data["Deal"] = r
+		ctx.Data["Conflicts"] = conflicts
+		ctx.Data["Pending"] = r.Status == DealPending
+		ctx.HTML(http.StatusOK, "deal_registration_review")
+	})
+
+	m.Post("/_/deal_registrations/:id", salesAuth, binding.Bind(DealDecisionForm{}), func(ctx *macaron.Context, form DealDecisionForm) {
+		r, err := s.DecideDealRegistration(ctx.Params("id"), DealStatus(form.Decision), form.Note)
+		if err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Redirect(fmt.Sprintf("/_/deal_registrations/%s", r.ID))
+	})
+}
@@ -0,0 +1,72 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestNormalizeCompanyName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Acme, Inc.":       "acme",
+		"ACME Inc":         "acme",
+		"Foo Bar Pvt. Ltd": "foo bar",
+		"Co":               "co",
+	} {
+		if got := server.NormalizeCompanyName(in); got != want {
+			t.Errorf("NormalizeCompanyName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDealConflicts(t *testing.T) {
+	now := time.Now()
+	deal := func(partnerEmail, customerEmail, company string) *server.DealRegistration {
+		return server.NewDealRegistration(server.DealRegistrationInfo{
+			PartnerEmail:    partnerEmail,
+			CustomerEmail:   customerEmail,
+			CustomerCompany: company,
+		}, now)
+	}
+
+	first := deal("jane@partner-a.com", "ops@acme.com", "Acme, Inc.")
+	sameDomain := deal("john@partner-b.com", "dba@acme.com", "Acme Holdings")
+	sameCompany := deal("john@partner-b.com", "acme.ops@gmail.com", "ACME Inc")
+	samePartner := deal("joe@partner-a.com", "dba@acme.com", "Acme")
+	other := deal("john@partner-b.com", "ops@example.com", "Example")
+
+	for _, r := range []*server.DealRegistration{sameDomain, sameCompany} {
+		if c := server.DealConflicts(r, []*server.DealRegistration{first}, now); len(c) != 1 {
+			t.Errorf("expected %s to conflict with the first registration", r.Info.CustomerCompany)
+		}
+	}
+	for _, r := range []*server.DealRegistration{samePartner, other} {
+		if c := server.DealConflicts(r, []*server.DealRegistration{first}, now); len(c) != 0 {
+			t.Errorf("expected %s not to conflict", r.Info.CustomerCompany)
+		}
+	}
+
+	if err := first.SetStatus(server.DealRejected, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if c := server.DealConflicts(sameDomain, []*server.DealRegistration{first}, now); len(c) != 0 {
+		t.Error("rejected registrations must not conflict")
+	}
+}
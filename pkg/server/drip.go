@@ -0,0 +1,208 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	"gomodules.xyz/email"
+	gdrive "gomodules.xyz/gdrive-utils"
+	"gomodules.xyz/mailer"
+	"k8s.io/klog/v2"
+)
+
+// dripFooter is appended to every drip campaign step. Links are filled in per recipient.
+const dripFooter = `
+
+---
+You are receiving this email because you downloaded an AppsCode license. [Manage your email preferences]({{ .PreferencesLink }}) or [unsubscribe]({{ .UnsubscribeLink }}).
+`
+
+// RunDripCampaigns processes the drip campaigns every hour, like mailer.RunCampaigns.
+// Unlike mailer.RunCampaigns, the suppression list is checked before every step and
+// every step carries unsubscribe links and an RFC 8058 List-Unsubscribe header.
+func (s *Server) RunDripCampaigns(ctx context.Context, dcs ...*mailer.DripCampaign) error {
+	for _, dc := range dcs {
+		si, err := gdrive.NewSpreadsheet(dc.SheetService, dc.SpreadsheetId)
+		if err != nil {
+			return err
+		}
+		if _, err = si.EnsureSheet(dc.SheetName, nil); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		for _, dc := range dcs {
+			if err := s.processDripCampaign(dc); err != nil {
+				klog.ErrorS(err, "failed processing drip campaign", "name", dc.Name)
+			} else {
+				klog.InfoS("completed processing drip campaign", "name", dc.Name)
+			}
+		}
+		time.Sleep(1 * time.Hour)
+	}
+}
+
+// DripStep returns the schedule of step i of the contact.
+func DripStep(c *mailer.Contact, i int) (at time.Time, waitForCondition, done bool) {
+	switch i {
+	case 0:
+		return c.Step_0_Timestamp.Time, c.Step_0_WaitForCondition, c.Step_0_Done
+	case 1:
+		return c.Step_1_Timestamp.Time, c.Step_1_WaitForCondition, c.Step_1_Done
+	case 2:
+		return c.Step_2_Timestamp.Time, c.Step_2_WaitForCondition, c.Step_2_Done
+	case 3:
+		return c.Step_3_Timestamp.Time, c.Step_3_WaitForCondition, c.Step_3_Done
+	case 4:
+		return c.Step_4_Timestamp.Time, c.Step_4_WaitForCondition, c.Step_4_Done
+	}
+	return time.Time{}, false, false
+}
+
+func setDripStepDone(c *mailer.Contact, i int) {
+	switch i {
+	case 0:
+		c.Step_0_Done = true
+	case 1:
+		c.Step_1_Done = true
+	case 2:
+		c.Step_2_Done = true
+	case 3:
+		c.Step_3_Done = true
+	case 4:
+		c.Step_4_Done = true
+	}
+}
+
+// NextDripStep returns the index of the step that is due for the contact, or -1.
+// Steps are sent one at a time, so a contact gets at most one step per run.
+func NextDripStep(dc *mailer.DripCampaign, c *mailer.Contact, now time.Time) int {
+	if c.Stop {
+		return -1
+	}
+	for i := range dc.Steps {
+		at, wait, done := DripStep(c, i)
+		if !at.IsZero() && !wait && now.After(at) && !done {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) processDripCampaign(dc *mailer.DripCampaign) error {
+	now := time.Now()
+	reader, err := gdrive.NewReader(dc.SheetService, dc.SpreadsheetId, dc.SheetName, 1)
+	if err != nil {
+		return err
+	}
+	var contacts []*mailer.Contact
+	if err := gocsv.UnmarshalCSV(reader, &contacts); err != nil {
+		return err
+	}
+	for _, c := range contacts {
+		i := NextDripStep(dc, c, now)
+		if i < 0 {
+			continue
+		}
+		if s.isDripSuppressed(c.Email) {
+			c.Stop = true
+			if err := writeDripContact(dc, c); err != nil {
+				klog.ErrorS(err, "failed to stop drip campaign", "email", c.Email)
+			}
+			continue
+		}
+		if err := s.sendDripStep(dc, i, c); err != nil {
+			klog.ErrorS(err, "failed to process campaign step", "email", c.Email, "step", i)
+		}
+	}
+	return nil
+}
+
+func (s *Server) sendDripStep(dc *mailer.DripCampaign, i int, c *mailer.Contact) error {
+	params := map[string]any{}
+	if err := json.Unmarshal([]byte(c.Data), &params); err != nil {
+		return err
+	}
+	msg, err := newDripEmail(localizedDripStep(dc, i, params), c.Email, params, s.EmailPreferencesLink(c.Email), s.UnsubscribeLink(c.Email))
+	if err != nil {
+		return err
+	}
+	if err := s.mt.Send(msg); err != nil {
+		return err
+	}
+
+	setDripStepDone(c, i)
+	return writeDripContact(dc, c)
+}
+
+// localizedDripStep returns the mailer of step i in the locale of the contact.
+func localizedDripStep(dc *mailer.DripCampaign, i int, params map[string]any) mailer.Mailer {
+	m := dc.Steps[i].Mailer
+	if locale, _ := params["Locale"].(string); locale != "" {
+		if tr, ok := CurrentDripCampaigns().Translation(dc.SheetName, i, locale); ok {
+			m.Subject = tr.Subject
+			m.Body = tr.Body
+		}
+	}
+	return m
+}
+
+// newDripEmail renders a drip step for the recipient with the preference footer and
+// the RFC 8058 List-Unsubscribe headers.
+func newDripEmail(m mailer.Mailer, to string, params map[string]any, preferencesLink, unsubscribeLink string) (*email.Email, error) {
+	params["PreferencesLink"] = preferencesLink
+	params["UnsubscribeLink"] = unsubscribeLink
+
+	m.Body += dripFooter
+	m.Params = params
+	msg, err := newMailerEmail(m, to)
+	if err != nil {
+		return nil, err
+	}
+	// ref: https://www.rfc-editor.org/rfc/rfc8058
+	msg.Headers.Set("List-Unsubscribe", fmt.Sprintf("<%s>", unsubscribeLink))
+	msg.Headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	return msg, nil
+}
+
+// writeDripContact updates the row of the contact in the campaign sheet.
+func writeDripContact(dc *mailer.DripCampaign, c *mailer.Contact) error {
+	w := gdrive.NewRowWriter(dc.SheetService, dc.SpreadsheetId, dc.SheetName, &gdrive.Predicate{
+		Header: "email",
+		By: func(v []any) (int, error) {
+			for idx, entry := range v {
+				if entry.(string) == c.Email {
+					return idx, nil
+				}
+			}
+			return -1, fmt.Errorf("missing email %s", c.Email)
+		},
+	})
+	return gocsv.MarshalCSV([]*mailer.Contact{c}, w)
+}
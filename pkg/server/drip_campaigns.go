@@ -0,0 +1,404 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	catalogfs "go.bytebuilders.dev/offline-license-server/catalog"
+
+	"golang.org/x/text/language"
+	"gomodules.xyz/mailer"
+	timex "gomodules.xyz/x/time"
+	"google.golang.org/api/sheets/v4"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+const DripCampaignsVersion = "v1"
+
+// MaxDripSteps is the number of steps a campaign sheet can track, see mailer.Contact.
+const MaxDripSteps = 5
+
+const (
+	DripEditionCommunity  = "community"
+	DripEditionEnterprise = "enterprise"
+
+	DripAudienceNew       = "new"
+	DripAudienceReturning = "returning"
+)
+
+// SignupCampaignData is the data drip campaign templates are rendered with.
+type SignupCampaignData struct {
+	Name                string
+	Cluster             string
+	Product             string
+	ProductDisplayName  string
+	IsEnterpriseProduct bool
+	TwitterHandle       string
+	QuickstartLink      string
+	// Locale selects the translations of the steps.
+	Locale string `json:",omitempty"`
+}
+
+// DripCampaigns are the campaigns defined in catalog/drip_campaigns.yaml.
+type DripCampaigns struct {
+	Version   string               `json:"version"`
+	Campaigns []DripCampaignConfig `json:"campaigns"`
+}
+
+type DripCampaignConfig struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Sheet is the sheet of the drip spreadsheet that tracks the campaign.
+	Sheet      string         `json:"sheet"`
+	Conditions DripConditions `json:"conditions"`
+
+	Sender  string `json:"sender"`
+	BCC     string `json:"bcc,omitempty"`
+	ReplyTo string `json:"replyTo,omitempty"`
+
+	Steps []DripStepConfig `json:"steps"`
+	// IncludeSteps appends the steps of another campaign.
+	IncludeSteps string `json:"includeSteps,omitempty"`
+}
+
+// DripConditions decide which license downloads enter a campaign. Empty
+// conditions match everything.
+type DripConditions struct {
+	Edition      string   `json:"edition,omitempty"`
+	Audience     string   `json:"audience,omitempty"`
+	ProductLines []string `json:"productLines,omitempty"`
+}
+
+type DripStepConfig struct {
+	WaitDays          int    `json:"waitDays"`
+	WeekendAdjustment string `json:"weekendAdjustment,omitempty"`
+	Subject           string `json:"subject"`
+	Body              string `json:"body"`
+	// Translations are keyed by locale, like "de". Contacts whose locale has no
+	// translation get the subject and body above.
+	Translations map[string]DripStepTranslation `json:"translations,omitempty"`
+}
+
+type DripStepTranslation struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+var weekendAdjustments = map[string]timex.WeekendAdjustment{
+	"":       timex.NoChange,
+	"none":   timex.NoChange,
+	"before": timex.Before,
+	"after":  timex.After,
+}
+
+// dripCampaigns is replaced by UseDripCampaignsFile when the server starts.
+var dripCampaigns = MustLoadDefaultDripCampaigns()
+
+func CurrentDripCampaigns() *DripCampaigns {
+	return dripCampaigns
+}
+
+// UseDripCampaignsFile loads and validates filename against the current catalog and
+// makes it the current drip campaigns. An empty filename uses the embedded campaigns.
+func UseDripCampaignsFile(filename string) error {
+	d, err := LoadDripCampaigns(filename, CurrentCatalog())
+	if err != nil {
+		return err
+	}
+	dripCampaigns = d
+	return nil
+}
+
+func ParseDripCampaigns(data []byte, c *Catalog) (*DripCampaigns, error) {
+	var d DripCampaigns
+	if err := yaml.UnmarshalStrict(data, &d); err != nil {
+		return nil, err
+	}
+	if err := d.Validate(c); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func LoadDripCampaigns(filename string, c *Catalog) (*DripCampaigns, error) {
+	if filename == "" {
+		data, err := catalogfs.FS.ReadFile("drip_campaigns.yaml")
+		if err != nil {
+			return nil, err
+		}
+		return ParseDripCampaigns(data, c)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ParseDripCampaigns(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid drip campaigns %s: %w", filename, err)
+	}
+	return d, nil
+}
+
+func MustLoadDefaultDripCampaigns() *DripCampaigns {
+	d, err := LoadDripCampaigns("", catalog)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d *DripCampaigns) Validate(c *Catalog) error {
+	var errs []error
+
+	if d.Version != DripCampaignsVersion {
+		errs = append(errs, fmt.Errorf("unsupported drip campaigns version %q, expected %q", d.Version, DripCampaignsVersion))
+	}
+
+	productLines := sets.NewString()
+	for _, plan := range c.Plans {
+		productLines.Insert(plan.ProductLine)
+	}
+	names := sets.NewString()
+	sheets := sets.NewString()
+	for _, dc := range d.Campaigns {
+		if dc.Name == "" || dc.Title == "" || dc.Sheet == "" || dc.Sender == "" {
+			errs = append(errs, fmt.Errorf("campaign %q: missing name, title, sheet or sender", dc.Name))
+		}
+		if names.Has(dc.Name) {
+			errs = append(errs, fmt.Errorf("campaign %s: duplicate name", dc.Name))
+		}
+		names.Insert(dc.Name)
+		if sheets.Has(dc.Sheet) {
+			errs = append(errs, fmt.Errorf("campaign %s: sheet %s is used by another campaign", dc.Name, dc.Sheet))
+		}
+		sheets.Insert(dc.Sheet)
+
+		switch dc.Conditions.Edition {
+		case "", DripEditionCommunity, DripEditionEnterprise:
+		default:
+			errs = append(errs, fmt.Errorf("campaign %s: unknown edition %q", dc.Name, dc.Conditions.Edition))
+		}
+		switch dc.Conditions.Audience {
+		case "", DripAudienceNew, DripAudienceReturning:
+		default:
+			errs = append(errs, fmt.Errorf("campaign %s: unknown audience %q", dc.Name, dc.Conditions.Audience))
+		}
+		for _, pl := range dc.Conditions.ProductLines {
+			if !productLines.Has(pl) {
+				errs = append(errs, fmt.Errorf("campaign %s: unknown product line %s", dc.Name, pl))
+			}
+		}
+
+		if len(dc.Steps) == 0 {
+			errs = append(errs, fmt.Errorf("campaign %s: missing steps", dc.Name))
+		}
+		for i, step := range dc.Steps {
+			if step.WaitDays < 0 {
+				errs = append(errs, fmt.Errorf("campaign %s: step %d: negative waitDays", dc.Name, i+1))
+			}
+			if _, ok := weekendAdjustments[step.WeekendAdjustment]; !ok {
+				errs = append(errs, fmt.Errorf("campaign %s: step %d: unknown weekendAdjustment %q", dc.Name, i+1, step.WeekendAdjustment))
+			}
+			if step.Subject == "" || step.Body == "" {
+				errs = append(errs, fmt.Errorf("campaign %s: step %d: missing subject or body", dc.Name, i+1))
+			} else if err := validateDripTemplate(step.Subject, step.Body); err != nil {
+				errs = append(errs, fmt.Errorf("campaign %s: step %d: %w", dc.Name, i+1, err))
+			}
+			for locale, tr := range step.Translations {
+				if base, err := language.ParseBase(locale); err != nil || base.String() != locale {
+					errs = append(errs, fmt.Errorf("campaign %s: step %d: unknown locale %q", dc.Name, i+1, locale))
+				}
+				if tr.Subject == "" || tr.Body == "" {
+					errs = append(errs, fmt.Errorf("campaign %s: step %d: %s translation: missing subject or body", dc.Name, i+1, locale))
+				} else if err := validateDripTemplate(tr.Subject, tr.Body); err != nil {
+					errs = append(errs, fmt.Errorf("campaign %s: step %d: %s translation: %w", dc.Name, i+1, locale, err))
+				}
+			}
+		}
+	}
+
+	for _, dc := range d.Campaigns {
+		if dc.IncludeSteps == "" {
+			if len(dc.Steps) > MaxDripSteps {
+				errs = append(errs, fmt.Errorf("campaign %s: has %d steps, at most %d are supported", dc.Name, len(dc.Steps), MaxDripSteps))
+			}
+			continue
+		}
+		inc := d.campaign(dc.IncludeSteps)
+		switch {
+		case inc == nil:
+			errs = append(errs, fmt.Errorf("campaign %s: includes unknown campaign %s", dc.Name, dc.IncludeSteps))
+		case inc.IncludeSteps != "":
+			errs = append(errs, fmt.Errorf("campaign %s: included campaign %s must not include steps itself", dc.Name, inc.Name))
+		case len(dc.Steps)+len(inc.Steps) > MaxDripSteps:
+			errs = append(errs, fmt.Errorf("campaign %s: has %d steps, at most %d are supported", dc.Name, len(dc.Steps)+len(inc.Steps), MaxDripSteps))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateDripTemplate renders the step for a community and an enterprise signup, so
+// unknown fields are reported before a campaign is sent.
+func validateDripTemplate(subject, body string) (err error) {
+	// mailer.Mailer panics on template syntax errors
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid template: %v", r)
+		}
+	}()
+
+	for _, enterprise := range []bool{false, true} {
+		m := mailer.Mailer{
+			Subject: subject,
+			Body:    body,
+			Params:  sampleSignupCampaignData(enterprise),
+		}
+		if _, _, _, err := m.Render(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sampleSignupCampaignData is used to validate and preview drip campaign steps.
+func sampleSignupCampaignData(enterprise bool) *SignupCampaignData {
+	return &SignupCampaignData{
+		Name:                "Jane Doe",
+		Cluster:             "00000000-0000-0000-0000-000000000000",
+		Product:             "kubedb-enterprise",
+		ProductDisplayName:  "KubeDB",
+		IsEnterpriseProduct: enterprise,
+		TwitterHandle:       "KubeDB",
+		QuickstartLink:      "https://kubedb.com/docs/latest/",
+	}
+}
+
+// Translation returns the translation of step i of the campaign tracked in sheet.
+func (d *DripCampaigns) Translation(sheet string, i int, locale string) (DripStepTranslation, bool) {
+	for j := range d.Campaigns {
+		dc := &d.Campaigns[j]
+		if dc.Sheet != sheet {
+			continue
+		}
+		steps := d.Steps(dc)
+		if i < 0 || i >= len(steps) {
+			return DripStepTranslation{}, false
+		}
+		tr, ok := steps[i].Translations[locale]
+		return tr, ok
+	}
+	return DripStepTranslation{}, false
+}
+
+func (d *DripCampaigns) campaign(name string) *DripCampaignConfig {
+	for i := range d.Campaigns {
+		if d.Campaigns[i].Name == name {
+			return &d.Campaigns[i]
+		}
+	}
+	return nil
+}
+
+// Steps returns the steps of the campaign, including the included steps.
+func (d *DripCampaigns) Steps(dc *DripCampaignConfig) []DripStepConfig {
+	steps := append([]DripStepConfig{}, dc.Steps...)
+	if inc := d.campaign(dc.IncludeSteps); inc != nil {
+		steps = append(steps, inc.Steps...)
+	}
+	return steps
+}
+
+// Select returns the first campaign matching a license download, or nil.
+// returning is true if the email is already in a campaign with audience new.
+func (d *DripCampaigns) Select(productLine string, enterprise, returning bool) *DripCampaignConfig {
+	edition := DripEditionCommunity
+	if enterprise {
+		edition = DripEditionEnterprise
+	}
+	audience := DripAudienceNew
+	if returning {
+		audience = DripAudienceReturning
+	}
+	for i, dc := range d.Campaigns {
+		cond := dc.Conditions
+		if cond.Edition != "" && cond.Edition != edition {
+			continue
+		}
+		if cond.Audience != "" && cond.Audience != audience {
+			continue
+		}
+		if len(cond.ProductLines) > 0 && !sets.NewString(cond.ProductLines...).Has(productLine) {
+			continue
+		}
+		return &d.Campaigns[i]
+	}
+	return nil
+}
+
+// AudienceSheets returns the sheets of the campaigns for new users. Emails in any of
+// them are returning users.
+func (d *DripCampaigns) AudienceSheets() []string {
+	var out []string
+	for _, dc := range d.Campaigns {
+		if dc.Conditions.Audience == DripAudienceNew {
+			out = append(out, dc.Sheet)
+		}
+	}
+	return out
+}
+
+// DripCampaign returns the runnable campaign. Steps are sent by Server.RunDripCampaigns
+// through the mail transport, so the campaign has no SMTP service.
+func (d *DripCampaigns) DripCampaign(dc *DripCampaignConfig, srv *sheets.Service) *mailer.DripCampaign {
+	steps := d.Steps(dc)
+	out := &mailer.DripCampaign{
+		Name:          dc.Title,
+		Steps:         make([]mailer.CampaignStep, 0, len(steps)),
+		SheetService:  srv,
+		SpreadsheetId: DripSpreadsheetId,
+		SheetName:     dc.Sheet,
+	}
+	for _, step := range steps {
+		out.Steps = append(out.Steps, mailer.CampaignStep{
+			WaitTime:          time.Duration(step.WaitDays) * 24 * time.Hour,
+			WeekendAdjustment: weekendAdjustments[step.WeekendAdjustment],
+			Mailer: mailer.Mailer{
+				Sender:  dc.Sender,
+				BCC:     dc.BCC,
+				ReplyTo: dc.ReplyTo,
+				Subject: step.Subject,
+				Body:    step.Body,
+			},
+		})
+	}
+	return out
+}
+
+// DripCampaigns returns all runnable campaigns.
+func (d *DripCampaigns) DripCampaigns(srv *sheets.Service) []*mailer.DripCampaign {
+	out := make([]*mailer.DripCampaign, 0, len(d.Campaigns))
+	for i := range d.Campaigns {
+		out = append(out, d.DripCampaign(&d.Campaigns[i], srv))
+	}
+	return out
+}
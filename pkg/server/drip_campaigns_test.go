@@ -0,0 +1,114 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestDefaultDripCampaigns(t *testing.T) {
+	d := server.CurrentDripCampaigns()
+	cases := []struct {
+		enterprise, returning bool
+		expected              string
+	}{
+		{false, false, "community-signup"},
+		{false, true, ""},
+		{true, false, "enterprise-signup"},
+		{true, true, "enterprise-first-time"},
+	}
+	for _, tc := range cases {
+		found := ""
+		if dc := d.Select("kubedb", tc.enterprise, tc.returning); dc != nil {
+			found = dc.Name
+		}
+		if found != tc.expected {
+			t.Errorf("enterprise=%v returning=%v: expected %q, found %q", tc.enterprise, tc.returning, tc.expected, found)
+		}
+	}
+
+	ent := d.DripCampaign(d.Select("kubedb", true, false), nil)
+	if len(ent.Steps) != 5 {
+		t.Errorf("expected enterprise signup to include the first time steps, found %d steps", len(ent.Steps))
+	}
+}
+
+func TestParseDripCampaignsInvalid(t *testing.T) {
+	const campaign = `version: v1
+campaigns:
+  - name: trial
+    title: Trial
+    sheet: TRIAL
+    sender: hello@appscode.com
+    conditions:
+      productLines: [%s]
+    steps:
+      - waitDays: 0
+        subject: Hi {{.Name}}
+        body: "%s"
+`
+	cases := map[string]string{
+		"unknown field":        strings.Replace(strings.Replace(campaign, "%s", "kubedb", 1), "%s", "{{.Plan}}", 1),
+		"template syntax":      strings.Replace(strings.Replace(campaign, "%s", "kubedb", 1), "%s", "{{ if .Name }}", 1),
+		"unknown product line": strings.Replace(strings.Replace(campaign, "%s", "kubedbx", 1), "%s", "hello", 1),
+	}
+	for name, data := range cases {
+		if _, err := server.ParseDripCampaigns([]byte(data), server.CurrentCatalog()); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	valid := strings.Replace(strings.Replace(campaign, "%s", "kubedb", 1), "%s", "Hi {{.ProductDisplayName}}", 1)
+	if _, err := server.ParseDripCampaigns([]byte(valid), server.CurrentCatalog()); err != nil {
+		t.Errorf("expected valid campaign, found %v", err)
+	}
+}
+
+func TestDripStepTranslation(t *testing.T) {
+	const campaign = `version: v1
+campaigns:
+  - name: trial
+    title: Trial
+    sheet: TRIAL
+    sender: hello@appscode.com
+    steps:
+      - waitDays: 0
+        subject: Hi {{.Name}}
+        body: Welcome to {{.ProductDisplayName}}
+        translations:
+          %s:
+            subject: Hallo {{.Name}}
+            body: Willkommen bei {{.ProductDisplayName}}
+`
+	d, err := server.ParseDripCampaigns([]byte(strings.Replace(campaign, "%s", "de", 1)), server.CurrentCatalog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, ok := d.Translation("TRIAL", 0, "de"); !ok || tr.Subject != "Hallo {{.Name}}" {
+		t.Errorf("expected german translation, found %+v", tr)
+	}
+	if _, ok := d.Translation("TRIAL", 0, "es"); ok {
+		t.Errorf("expected no spanish translation")
+	}
+
+	if _, err := server.ParseDripCampaigns([]byte(strings.Replace(campaign, "%s", "german", 1)), server.CurrentCatalog()); err == nil {
+		t.Errorf("expected error for unknown locale")
+	}
+}
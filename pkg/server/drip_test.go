@@ -0,0 +1,63 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"gomodules.xyz/mailer"
+)
+
+func TestNextDripStep(t *testing.T) {
+	campaigns := server.CurrentDripCampaigns()
+	dc := campaigns.DripCampaign(campaigns.Select("kubedb", true, false), nil)
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	var c mailer.Contact
+	dc.Prepare(&c, start)
+	if i := server.NextDripStep(dc, &c, start.Add(time.Minute)); i != 0 {
+		t.Errorf("expected step 0 to be due, found %d", i)
+	}
+
+	c.Step_0_Done = true
+	if i := server.NextDripStep(dc, &c, start.Add(time.Minute)); i != -1 {
+		t.Errorf("expected no step to be due, found %d", i)
+	}
+	if i := server.NextDripStep(dc, &c, start.Add(365*24*time.Hour)); i != 1 {
+		t.Errorf("expected step 1 to be due, found %d", i)
+	}
+
+	c.Stop = true
+	if i := server.NextDripStep(dc, &c, start.Add(365*24*time.Hour)); i != -1 {
+		t.Errorf("expected stopped contact to get no step, found %d", i)
+	}
+}
+
+func TestPlanMailingLists(t *testing.T) {
+	lists := server.CurrentCatalog().PlanMailingLists()
+	if len(lists) == 0 {
+		t.Fatal("expected plans to have mailing lists")
+	}
+	for i := 1; i < len(lists); i++ {
+		if lists[i-1] >= lists[i] {
+			t.Errorf("expected sorted unique lists, found %v", lists)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	ep "gomodules.xyz/email-providers"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+// EmailPreferences are the kinds of marketing email a recipient wants. Addresses
+// without stored preferences get everything.
+type EmailPreferences struct {
+	Email string `json:"email"`
+	// Drip is false if the recipient unsubscribed from the drip campaigns.
+	Drip bool `json:"drip"`
+	// Newsletters is false if the recipient unsubscribed from the product mailing lists.
+	Newsletters bool `json:"newsletters"`
+	// Locale is the language of the emails, like "de". Empty selects the language
+	// from the country of the recipient.
+	Locale    string    `json:"locale,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
+
+func DefaultEmailPreferences(email string) *EmailPreferences {
+	return &EmailPreferences{
+		Email:       email,
+		Drip:        true,
+		Newsletters: true,
+	}
+}
+
+func emailPreferencesPath(email string) string {
+	key := NormalizeEmail(email)
+	return EmailPreferencesPath(ep.Domain(key), key)
+}
+
+func (s *Server) GetEmailPreferences(email string) (*EmailPreferences, error) {
+	path := emailPreferencesPath(email)
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil {
+		return nil, err
+	} else if !ok {
+		return DefaultEmailPreferences(email), nil
+	}
+	data, err := s.fs.ReadFile(context.TODO(), path)
+	if err != nil {
+		return nil, err
+	}
+	var prefs EmailPreferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SaveEmailPreferences stores the preferences and propagates opt-outs: the address is
+// stopped in the drip campaign sheets and unsubscribed from the mailing lists of all
+// plans in listmonk.
+func (s *Server) SaveEmailPreferences(prefs EmailPreferences) error {
+	old, err := s.GetEmailPreferences(prefs.Email)
+	if err != nil {
+		return err
+	}
+
+	prefs.UpdatedAt = time.Now()
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.WriteFile(context.TODO(), emailPreferencesPath(prefs.Email), data); err != nil {
+		return err
+	}
+
+	if old.Drip && !prefs.Drip {
+		if err := s.enqueueOutbox(OutboxDripStop, "stop drip campaigns for "+prefs.Email, prefs.Email); err != nil {
+			return err
+		}
+	}
+	if old.Newsletters && !prefs.Newsletters {
+		lists := catalog.PlanMailingLists()
+		if len(lists) > 0 {
+			err := s.enqueueOutbox(OutboxListmonkUnsubscribe, "listmonk unsubscription for "+prefs.Email, ListmonkUnsubscribeArgs{
+				Email:        prefs.Email,
+				MailingLists: lists,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unsubscribe opts the address out of all marketing email.
+func (s *Server) Unsubscribe(email string) error {
+	prefs, err := s.GetEmailPreferences(email)
+	if err != nil {
+		return err
+	}
+	prefs.Drip = false
+	prefs.Newsletters = false
+	return s.SaveEmailPreferences(*prefs)
+}
+
+// isDripSuppressed returns true if drip campaign steps must not be sent to the address.
+func (s *Server) isDripSuppressed(email string) bool {
+	if s.isEmailSuppressed(email) {
+		return true
+	}
+	prefs, err := s.GetEmailPreferences(email)
+	if err != nil {
+		klog.Warningln(err)
+		return false
+	}
+	return !prefs.Drip
+}
+
+// isListmonkSuppressed returns true if the address must not be subscribed to mailing lists.
+func (s *Server) isListmonkSuppressed(email string) bool {
+	if s.isEmailSuppressed(email) {
+		return true
+	}
+	prefs, err := s.GetEmailPreferences(email)
+	if err != nil {
+		klog.Warningln(err)
+		return false
+	}
+	return !prefs.Newsletters
+}
+
+type ListmonkUnsubscribeArgs struct {
+	Email string `json:"email"`
+	// MailingLists are listmonk list uuids.
+	MailingLists []string `json:"mailingLists"`
+}
+
+// unsubscribeListmonkSubscriber removes the subscriber from the mailing lists.
+// ref: https://listmonk.app/docs/apis/subscribers/#put-apisubscriberslists
+func (s *Server) unsubscribeListmonkSubscriber(args ListmonkUnsubscribeArgs) error {
+	id, err := s.findListmonkSubscriber(args.Email)
+	if err != nil || id == 0 {
+		return err
+	}
+
+	lists, err := s.listmonk.GetAllLists()
+	if err != nil {
+		return err
+	}
+	wanted := map[string]bool{}
+	for _, uuid := range args.MailingLists {
+		wanted[uuid] = true
+	}
+	var listIDs []int
+	for _, l := range lists {
+		if wanted[l.UUID] {
+			listIDs = append(listIDs, l.ID)
+		}
+	}
+	if len(listIDs) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"ids":             []int{id},
+		"action":          "unsubscribe",
+		"target_list_ids": listIDs,
+	})
+	if err != nil {
+		return err
+	}
+	return s.listmonkAPI(http.MethodPut, "/api/subscribers/lists", body, nil)
+}
+
+func (s *Server) emailPreferencesSig(email string) string {
+	return SignLink(s.linkKey, "email-preferences", strings.ToLower(email))
+}
+
+func (s *Server) verifyEmailPreferencesSig(email, sig string) bool {
+	return VerifyLink(s.linkKey, sig, "email-preferences", strings.ToLower(email))
+}
+
+// EmailPreferencesLink returns the signed link to the preference page of the address.
+func (s *Server) EmailPreferencesLink(email string) string {
+	return fmt.Sprintf("%s/_/email/preferences/%s?sig=%s",
+		strings.TrimSuffix(s.opts.BaseURL, "/"),
+		url.PathEscape(strings.ToLower(email)),
+		s.emailPreferencesSig(email))
+}
+
+// UnsubscribeLink returns the signed RFC 8058 one-click unsubscribe link of the address.
+// A POST to the link unsubscribes, a GET shows the preference page.
+func (s *Server) UnsubscribeLink(email string) string {
+	return fmt.Sprintf("%s/_/email/unsubscribe/%s?sig=%s",
+		strings.TrimSuffix(s.opts.BaseURL, "/"),
+		url.PathEscape(strings.ToLower(email)),
+		s.emailPreferencesSig(email))
+}
+
+// PlanMailingLists returns the listmonk uuids of the mailing lists used by any plan.
+func (c *Catalog) PlanMailingLists() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, plan := range c.Plans {
+		for _, l := range plan.MailingLists {
+			if !seen[l] {
+				seen[l] = true
+				out = append(out, l)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Server) RegisterEmailPreferencesAPI(m *macaron.Macaron) {
+	m.Get("/_/email/preferences/:email", func(ctx *macaron.Context) {
+		email := ctx.Params("email")
+		ctx.Data["Email"] = email
+		if !s.verifyEmailPreferencesSig(email, ctx.Query("sig")) {
+			ctx.Data["Err"] = "This link is invalid. Please use the link from our latest email."
+			ctx.HTML(http.StatusForbidden, "email_preferences")
+			return
+		}
+		prefs, err := s.GetEmailPreferences(email)
+		if err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusInternalServerError, "email_preferences")
+			return
+		}
+		ctx.Data["Sig"] = ctx.Query("sig")
+		ctx.Data["Prefs"] = prefs
+		ctx.Data["Locales"] = MailLocaleOptions()
+		ctx.HTML(http.StatusOK, "email_preferences")
+	})
+
+	m.Post("/_/email/preferences/:email", func(ctx *macaron.Context) {
+		email := ctx.Params("email")
+		ctx.Data["Email"] = email
+		if !s.verifyEmailPreferencesSig(email, ctx.Query("sig")) {
+			ctx.Data["Err"] = "This link is invalid. Please use the link from our latest email."
+			ctx.HTML(http.StatusForbidden, "email_preferences")
+			return
+		}
+		prefs := DefaultEmailPreferences(email)
+		prefs.Locale = ctx.Query("locale")
+		if prefs.Locale != "" && CurrentMailTemplates().SelectLocale(prefs.Locale, "") != prefs.Locale {
+			ctx.Data["Err"] = fmt.Sprintf("unsupported language %q", prefs.Locale)
+			ctx.HTML(http.StatusBadRequest, "email_preferences")
+			return
+		}
+		if ctx.Query("action") == "unsubscribe" {
+			prefs.Drip = false
+			prefs.Newsletters = false
+		} else {
+			prefs.Drip = ctx.Query("drip") == "on"
+			prefs.Newsletters = ctx.Query("newsletters") == "on"
+		}
+		if err := s.SaveEmailPreferences(*prefs); err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusInternalServerError, "email_preferences")
+			return
+		}
+		ctx.Data["Sig"] = ctx.Query("sig")
+		ctx.Data["Prefs"] = prefs
+		ctx.Data["Locales"] = MailLocaleOptions()
+		ctx.Data["Saved"] = true
+		ctx.HTML(http.StatusOK, "email_preferences")
+	})
+
+	// mail clients and link scanners may open the link, so a GET never unsubscribes
+	m.Get("/_/email/unsubscribe/:email", func(ctx *macaron.Context) {
+		email := ctx.Params("email")
+		if !s.verifyEmailPreferencesSig(email, ctx.Query("sig")) {
+			ctx.Data["Email"] = email
+			ctx.Data["Err"] = "This link is invalid. Please use the link from our latest email."
+			ctx.HTML(http.StatusForbidden, "email_preferences")
+			return
+		}
+		ctx.Redirect(s.EmailPreferencesLink(email))
+	})
+
+	// RFC 8058 one-click unsubscribe
+	m.Post("/_/email/unsubscribe/:email", func(ctx *macaron.Context) {
+		email := ctx.Params("email")
+		if !s.verifyEmailPreferencesSig(email, ctx.Query("sig")) {
+			ctx.WriteHeader(http.StatusForbidden)
+			respond(ctx, []byte("invalid link"))
+			return
+		}
+		if err := s.Unsubscribe(email); err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		respond(ctx, []byte("You have been unsubscribed."))
+	})
+}
@@ -0,0 +1,268 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-macaron/auth"
+	"github.com/gocarina/gocsv"
+	ep "gomodules.xyz/email-providers"
+	gdrive "gomodules.xyz/gdrive-utils"
+	"gomodules.xyz/mailer"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+// Addresses that hard bounce or complain are marked undeliverable. They are taken out
+// of the drip campaigns and blocklisted in listmonk, and are not subscribed again.
+
+// EmailSuppression records why an address is undeliverable.
+type EmailSuppression struct {
+	Email string `json:"email"`
+	// Reason is the email event type that caused the suppression, bounced or complained.
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	MessageID string    `json:"messageID,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SuppressesEmail returns true if the event makes the recipient undeliverable.
+func (e EmailEvent) SuppressesEmail() bool {
+	return e.Type == EmailBounced || e.Type == EmailComplained
+}
+
+func emailSuppressionPath(email string) string {
+	key := NormalizeEmail(email)
+	return EmailUndeliverablePath(ep.Domain(key), key)
+}
+
+// GetEmailSuppression returns nil if the address is deliverable.
+func (s *Server) GetEmailSuppression(email string) (*EmailSuppression, error) {
+	path := emailSuppressionPath(email)
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil || !ok {
+		return nil, err
+	}
+	data, err := s.fs.ReadFile(context.TODO(), path)
+	if err != nil {
+		return nil, err
+	}
+	var sup EmailSuppression
+	if err := json.Unmarshal(data, &sup); err != nil {
+		return nil, err
+	}
+	return &sup, nil
+}
+
+func (s *Server) isEmailSuppressed(email string) bool {
+	sup, err := s.GetEmailSuppression(email)
+	if err != nil {
+		klog.Warningln(err)
+		return false
+	}
+	return sup != nil
+}
+
+// SuppressEmail marks the recipient of the event undeliverable. The address loses its
+// verified status and is removed from drip campaigns and listmonk through the outbox.
+func (s *Server) SuppressEmail(e EmailEvent) error {
+	if sup, err := s.GetEmailSuppression(e.Recipient); err != nil {
+		return err
+	} else if sup != nil {
+		return nil
+	}
+
+	sup := EmailSuppression{
+		Email:     e.Recipient,
+		Reason:    e.Type,
+		Detail:    e.Reason,
+		Provider:  e.Provider,
+		MessageID: e.MessageID,
+		CreatedAt: time.Now(),
+	}
+	data, err := json.Marshal(sup)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.WriteFile(context.TODO(), emailSuppressionPath(e.Recipient), data); err != nil {
+		return err
+	}
+
+	verified := EmailVerifiedPath(ep.Domain(e.Recipient), e.Recipient)
+	if ok, err := s.fs.Exists(context.TODO(), verified); err != nil {
+		return err
+	} else if ok {
+		if err := s.fs.DeleteFile(context.TODO(), verified); err != nil {
+			return err
+		}
+	}
+
+	if err := s.enqueueOutbox(OutboxDripStop, "stop drip campaigns for "+e.Recipient, e.Recipient); err != nil {
+		return err
+	}
+	return s.enqueueOutbox(OutboxListmonkBlocklist, "listmonk blocklist for "+e.Recipient, e.Recipient)
+}
+
+// UnsuppressEmail makes the address deliverable again. Drip campaigns and listmonk are
+// not changed, the address has to sign up again.
+func (s *Server) UnsuppressEmail(email string) error {
+	path := emailSuppressionPath(email)
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil || !ok {
+		return err
+	}
+	return s.fs.DeleteFile(context.TODO(), path)
+}
+
+func (s *Server) dripCampaigns() []*mailer.DripCampaign {
+	return CurrentDripCampaigns().DripCampaigns(s.srvSheets)
+}
+
+// stopDripCampaigns sets the stop flag of the address in every drip campaign sheet.
+func (s *Server) stopDripCampaigns(email string) error {
+	for _, dc := range s.dripCampaigns() {
+		predicate := &gdrive.Predicate{
+			Header: "email",
+			By: func(column []any) (int, error) {
+				for i, v := range column {
+					if strings.EqualFold(v.(string), email) {
+						return i, nil
+					}
+				}
+				return -1, io.EOF
+			},
+		}
+		r, err := gdrive.NewRowReader(dc.SheetService, dc.SpreadsheetId, dc.SheetName, predicate)
+		if err == io.EOF {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var contacts []*mailer.Contact
+		if err := gocsv.UnmarshalCSV(r, &contacts); err != nil {
+			return err
+		}
+		if len(contacts) == 0 || contacts[0].Stop {
+			continue
+		}
+		contacts[0].Stop = true
+		w := gdrive.NewRowWriter(dc.SheetService, dc.SpreadsheetId, dc.SheetName, predicate)
+		if err := gocsv.MarshalCSV(contacts[:1], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blocklistListmonkSubscriber blocklists the subscriber, which unsubscribes it from
+// all lists. The listmonk client has no call for this, so the API is used directly.
+// ref: https://listmonk.app/docs/apis/subscribers/
+func (s *Server) blocklistListmonkSubscriber(email string) error {
+	id, err := s.findListmonkSubscriber(email)
+	if err != nil || id == 0 {
+		return err
+	}
+	body, err := json.Marshal(map[string][]int{"ids": {id}})
+	if err != nil {
+		return err
+	}
+	return s.listmonkAPI(http.MethodPut, "/api/subscribers/blocklist", body, nil)
+}
+
+// findListmonkSubscriber returns the subscriber id of the email, or 0 if it is not
+// subscribed.
+func (s *Server) findListmonkSubscriber(email string) (int, error) {
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("subscribers.email = '%s'", strings.ReplaceAll(strings.ToLower(email), "'", "''")))
+	query.Set("per_page", "1")
+	var found struct {
+		Data struct {
+			Results []struct {
+				ID int `json:"id"`
+			} `json:"results"`
+		} `json:"data"`
+	}
+	if err := s.listmonkAPI(http.MethodGet, "/api/subscribers?"+query.Encode(), nil, &found); err != nil {
+		return 0, err
+	}
+	if len(found.Data.Results) == 0 {
+		return 0, nil
+	}
+	return found.Data.Results[0].ID, nil
+}
+
+func (s *Server) listmonkAPI(method, path string, body []byte, out any) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.opts.listmonkHost, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.opts.listmonkUsername, s.opts.listmonkPassword)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("listmonk %s %s failed with status code = %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (s *Server) RegisterEmailSuppressionAPI(m *macaron.Macaron) {
+	salesAuth := auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD"))
+
+	m.Get("/_/suppressions/:email", salesAuth, func(ctx *macaron.Context) {
+		sup, err := s.GetEmailSuppression(ctx.Params("email"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		if sup == nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte("email is deliverable"))
+			return
+		}
+		ctx.JSON(http.StatusOK, sup)
+	})
+
+	m.Delete("/_/suppressions/:email", salesAuth, func(ctx *macaron.Context) {
+		if err := s.UnsuppressEmail(ctx.Params("email")); err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.WriteHeader(http.StatusNoContent)
+	})
+}
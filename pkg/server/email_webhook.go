@@ -0,0 +1,269 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/auth"
+	freshsalesclient "gomodules.xyz/freshsales-client-go"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+// Email event types, normalized across providers.
+const (
+	EmailDelivered    = "delivered"
+	EmailDeferred     = "deferred"
+	EmailBounced      = "bounced"
+	EmailComplained   = "complained"
+	EmailOpened       = "opened"
+	EmailClicked      = "clicked"
+	EmailUnsubscribed = "unsubscribed"
+)
+
+const (
+	maxEmailWebhookBody = 1 << 20
+	maxEmailEvents      = 200
+)
+
+// EmailEvent is a delivery or engagement event reported by an email provider for
+// a single recipient.
+type EmailEvent struct {
+	// ID is the provider's event id. It is used to drop redelivered webhooks.
+	ID        string    `json:"id,omitempty"`
+	Provider  string    `json:"provider"`
+	Type      string    `json:"type"`
+	Recipient string    `json:"recipient"`
+	Timestamp time.Time `json:"timestamp"`
+
+	MessageID string `json:"messageID,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	URL       string `json:"url,omitempty"`
+	// Reason explains bounces, deferrals and complaints.
+	Reason string `json:"reason,omitempty"`
+
+	OS      string `json:"os,omitempty"`
+	Device  string `json:"device,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	City    string `json:"city,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// EmailWebhook authenticates and parses the webhook payloads of an email provider.
+type EmailWebhook interface {
+	// Verify returns an error if the request was not sent by the provider.
+	Verify(r *http.Request, body []byte) error
+	// Parse converts the payload to one event per recipient. Payloads that carry
+	// no events, like subscription confirmations, return no events.
+	Parse(body []byte) ([]EmailEvent, error)
+}
+
+// emailWebhookConfirmer is implemented by webhooks that must confirm a subscription
+// before the provider sends events, like SNS.
+type emailWebhookConfirmer interface {
+	Confirm(body []byte) (bool, error)
+}
+
+// emailWebhooks returns the webhooks of the providers configured in opts.
+func emailWebhooks(opts *Options) map[string]EmailWebhook {
+	hooks := map[string]EmailWebhook{}
+	if opts.MailgunWebhookSigningKey != "" {
+		hooks["mailgun"] = NewMailgunWebhook(opts.MailgunWebhookSigningKey)
+	}
+	if len(opts.SNSTopicARNs) > 0 {
+		hooks["ses"] = NewSNSWebhook(opts.SNSTopicARNs)
+	}
+	if opts.PostmarkWebhookUsername != "" {
+		hooks["postmark"] = NewPostmarkWebhook(opts.PostmarkWebhookUsername, opts.PostmarkWebhookPassword)
+	}
+	return hooks
+}
+
+func (s *Server) HandleEmailWebhook(ctx *macaron.Context) {
+	provider := ctx.Params("provider")
+	hook, ok := s.emailWebhooks[provider]
+	if !ok {
+		ctx.WriteHeader(http.StatusNotFound)
+		respond(ctx, []byte(fmt.Sprintf("email provider %q is not configured", provider)))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(ctx.Req.Request.Body, maxEmailWebhookBody))
+	if err != nil {
+		ctx.WriteHeader(http.StatusBadRequest)
+		respond(ctx, []byte(err.Error()))
+		return
+	}
+	if err := hook.Verify(ctx.Req.Request, body); err != nil {
+		klog.Warningf("rejected %s webhook: %v", provider, err)
+		ctx.WriteHeader(http.StatusNotAcceptable)
+		respond(ctx, []byte(err.Error()))
+		return
+	}
+
+	if c, ok := hook.(emailWebhookConfirmer); ok {
+		confirmed, err := c.Confirm(body)
+		if err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		if confirmed {
+			ctx.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	events, err := hook.Parse(body)
+	if err != nil {
+		ctx.WriteHeader(http.StatusBadRequest)
+		respond(ctx, []byte(err.Error()))
+		return
+	}
+	for _, e := range events {
+		if err := s.RecordEmailEvent(e); err != nil {
+			// the provider retries on errors, which is only useful if storage failed
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+	}
+	ctx.WriteHeader(http.StatusOK)
+}
+
+var emailEventMu sync.Mutex
+
+// EmailEvents returns the recorded events of a recipient, oldest first.
+func (s *Server) EmailEvents(email string) ([]EmailEvent, error) {
+	path := EmailEventsPath(NormalizeEmail(email))
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil || !ok {
+		return nil, err
+	}
+	data, err := s.fs.ReadFile(context.TODO(), path)
+	if err != nil {
+		return nil, err
+	}
+	var events []EmailEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// RecordEmailEvent appends the event to the recipient's history and notes engagement
+// and delivery failures on the CRM contact. Hard bounces and complaints suppress the
+// address. Redelivered events are ignored.
+func (s *Server) RecordEmailEvent(e EmailEvent) error {
+	if !strings.Contains(e.Recipient, "@") {
+		return fmt.Errorf("invalid recipient %q", e.Recipient)
+	}
+
+	emailEventMu.Lock()
+	defer emailEventMu.Unlock()
+
+	events, err := s.EmailEvents(e.Recipient)
+	if err != nil {
+		return err
+	}
+	if e.ID != "" {
+		for _, existing := range events {
+			if existing.Provider == e.Provider && existing.ID == e.ID {
+				return nil
+			}
+		}
+	}
+	events = append(events, e)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	if len(events) > maxEmailEvents {
+		events = events[len(events)-maxEmailEvents:]
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.WriteFile(context.TODO(), EmailEventsPath(NormalizeEmail(e.Recipient)), data); err != nil {
+		return err
+	}
+
+	if e.SuppressesEmail() {
+		if err := s.SuppressEmail(e); err != nil {
+			return err
+		}
+	}
+
+	// delivered and deferred mails are too noisy for the CRM
+	if e.Type == EmailDelivered || e.Type == EmailDeferred {
+		return nil
+	}
+	return s.noteEventMailgun(e.Recipient, e.NoteEvent())
+}
+
+// NoteEvent converts the event to the CRM note recorded for email events.
+func (e EmailEvent) NoteEvent() EventMailgun {
+	return EventMailgun{
+		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+			Event: e.Type,
+			Client: freshsalesclient.ClientInfo{
+				OS:     e.OS,
+				Device: e.Device,
+				Location: freshsalesclient.GeoLocation{
+					IP:      e.IP,
+					City:    e.City,
+					Country: e.Country,
+				},
+			},
+		},
+		Provider: e.Provider,
+		Reason:   e.Reason,
+		Message: Message{
+			MessageID: e.MessageID,
+			Subject:   e.Subject,
+			Url:       e.URL,
+		},
+	}
+}
+
+func (s *Server) RegisterEmailWebhookAPI(m *macaron.Macaron) {
+	m.Post("/_/webhooks/email/:provider", s.HandleEmailWebhook)
+	// kept for the webhook url already configured in Mailgun
+	m.Post("/_/webhooks/mailgun/", func(ctx *macaron.Context) {
+		ctx.SetParams("provider", "mailgun")
+	}, s.HandleEmailWebhook)
+
+	m.Get("/_/email-events/:email", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		events, err := s.EmailEvents(ctx.Params("email"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, events)
+	})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestMailgunWebhook(t *testing.T) {
+	w := server.NewMailgunWebhook("key-secret")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	body := fmt.Sprintf(`{
+  "signature": {"timestamp": %q, "token": "tok", "signature": %q},
+  "event-data": {
+    "id": "ev-1",
+    "event": "failed",
+    "severity": "permanent",
+    "timestamp": 1529006854.5,
+    "recipient": "jane@acme.com",
+    "message": {"headers": {"message-id": "m-1", "subject": "Your license"}},
+    "delivery-status": {"description": "mailbox does not exist"}
+  }
+}`, ts, w.Sign(ts, "tok"))
+
+	if err := w.Verify(nil, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.NewMailgunWebhook("other").Verify(nil, []byte(body)); err == nil {
+		t.Error("expected signature from another key to be rejected")
+	}
+
+	events, err := w.Parse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, found %d", len(events))
+	}
+	e := events[0]
+	if e.Type != server.EmailBounced || e.Recipient != "jane@acme.com" || e.Reason != "mailbox does not exist" || e.Subject != "Your license" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if !e.Timestamp.Equal(time.Unix(1529006854, 5e8)) {
+		t.Errorf("unexpected timestamp %v", e.Timestamp)
+	}
+}
+
+func TestPostmarkWebhook(t *testing.T) {
+	w := server.NewPostmarkWebhook("user", "pass")
+	r := httptest.NewRequest("POST", "/_/webhooks/email/postmark", nil)
+	if err := w.Verify(r, nil); err == nil {
+		t.Error("expected request without credentials to be rejected")
+	}
+	r.SetBasicAuth("user", "pass")
+	if err := w.Verify(r, nil); err != nil {
+		t.Error(err)
+	}
+
+	events, err := w.Parse([]byte(`{
+  "RecordType": "Bounce",
+  "ID": 42,
+  "Type": "SoftBounce",
+  "Email": "jane@acme.com",
+  "BouncedAt": "2026-01-02T03:04:05Z",
+  "Description": "mailbox full",
+  "MessageID": "m-1"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != server.EmailDeferred || events[0].Recipient != "jane@acme.com" || events[0].ID != "Bounce/42" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestSNSWebhookParse(t *testing.T) {
+	msg, _ := json.Marshal(map[string]any{
+		"eventType": "Open",
+		"mail": map[string]any{
+			"messageId":     "m-1",
+			"destination":   []string{"jane@acme.com", "joe@acme.com"},
+			"commonHeaders": map[string]any{"subject": "Quotation"},
+		},
+		"open": map[string]any{
+			"ipAddress": "192.0.2.1",
+			"timestamp": "2026-01-02T03:04:05Z",
+			"userAgent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+		},
+	})
+	body, _ := json.Marshal(server.SNSMessage{
+		Type:      "Notification",
+		MessageId: "sns-1",
+		TopicArn:  "arn:aws:sns:us-east-1:123456789012:ses-events",
+		Message:   string(msg),
+	})
+
+	events, err := server.NewSNSWebhook(nil).Parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, found %d", len(events))
+	}
+	for _, e := range events {
+		if e.Type != server.EmailOpened || e.Subject != "Quotation" || e.IP != "192.0.2.1" || e.OS != "Windows" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+	if events[0].ID == events[1].ID {
+		t.Error("expected a distinct id per recipient")
+	}
+}
+
+func TestSNSMessageStringToSign(t *testing.T) {
+	m := server.SNSMessage{
+		Type:      "Notification",
+		MessageId: "id",
+		TopicArn:  "arn",
+		Message:   "hello",
+		Timestamp: "ts",
+	}
+	expected := "Message\nhello\nMessageId\nid\nTimestamp\nts\nTopicArn\narn\nType\nNotification\n"
+	if found := m.StringToSign(); found != expected {
+		t.Errorf("expected %q, found %q", expected, found)
+	}
+}
+
+func TestEmailEventSuppressesEmail(t *testing.T) {
+	cases := map[string]bool{
+		server.EmailDelivered:    false,
+		server.EmailDeferred:     false,
+		server.EmailBounced:      true,
+		server.EmailComplained:   true,
+		server.EmailOpened:       false,
+		server.EmailUnsubscribed: false,
+	}
+	for typ, expected := range cases {
+		if found := (server.EmailEvent{Type: typ}).SuppressesEmail(); found != expected {
+			t.Errorf("%s: expected %v, found %v", typ, expected, found)
+		}
+	}
+}
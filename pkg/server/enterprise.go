@@ -44,9 +44,9 @@ func (s *Server) IssueEnterpriseLicense(info LicenseForm, extendBy time.Duration
 			License:     string(crtLicense),
 		})
 		mailer.AttachmentBytes = map[string][]byte{
-			fmt.Sprintf("%s-license-%s.txt", strings.ToLower(SupportedProducts[info.Product()].DisplayName), info.Cluster): crtLicense,
+			fmt.Sprintf("%s-license-%s.txt", strings.ToLower(catalog.Plan(info.Product()).DisplayName), info.Cluster): crtLicense,
 		}
-		err = mailer.SendMail(s.mg, info.Email, info.CC, nil)
+		err = SendMail(s.mt, mailer, info.Email, info.CC, nil)
 		if err != nil {
 			return err
 		}
@@ -49,30 +49,75 @@ type EULAInfo struct {
 	PaymentTerm string `form:"payment-term" binding:"Required" json:"payment-term" csv:"payment-term"`
 	SupportPlan string `form:"support-plan" binding:"Required" json:"support-plan" csv:"support-plan"`
 
-	TermYears   int       `form:"-" json:"-" csv:"term-years"`
+	TermYears   int       `form:"term-years" json:"term-years" csv:"term-years"`
 	EULADocLink string    `form:"-" json:"-" csv:"eula"`
 	PreparedOn  OfferDate `form:"-" json:"-" csv:"prepared-on"`
+
+	BillingFrequency string `form:"billing-frequency" json:"billing-frequency" csv:"billing-frequency"`
+	// Clauses are custom clauses negotiated by sales, one per line.
+	Clauses string `form:"clauses" json:"clauses,omitempty" csv:"clauses"`
+
+	// If set, the generated EULA is sent to the signer for e-signature.
+	SignerName  string `form:"signer-name" json:"signer-name,omitempty" csv:"-"`
+	SignerEmail string `form:"signer-email" json:"signer-email,omitempty" csv:"-"`
 }
 
 func (form EULAInfo) Data() map[string]string {
 	return map[string]string{
-		"{{company}}":      form.Company,
-		"{{domain}}":       form.Domain,
-		"{{address}}":      form.Address,
-		"{{quotation}}":    form.Quotation,
-		"{{product}}":      form.Product,
-		"{{payment-term}}": form.PaymentTerm,
-		"{{support-plan}}": form.SupportPlan,
-		"{{term-years}}":   numfmt.Sprintf("%d", form.TermYears),
+		"{{company}}":           form.Company,
+		"{{domain}}":            form.Domain,
+		"{{address}}":           form.Address,
+		"{{quotation}}":         form.Quotation,
+		"{{product}}":           form.Product,
+		"{{payment-term}}":      form.PaymentTerm,
+		"{{support-plan}}":      form.SupportPlan,
+		"{{term-years}}":        numfmt.Sprintf("%d", form.TermYears),
+		"{{term}}":              pluralize(form.TermYears, "year"),
+		"{{billing-frequency}}": form.BillingFrequency,
+		"{{clauses}}":           form.clauses(),
 		// "{{prepared-on}}":  string(form.PreparedOn),
 		// "{{eula}}":         form.EULADocLink,
 	}
 }
 
+// clauses returns the custom clauses as a numbered list.
+func (form EULAInfo) clauses() string {
+	var lines []string
+	for _, line := range strings.Split(form.Clauses, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, fmt.Sprintf("%d. %s", len(lines)+1, line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (form EULAInfo) Terms() EULATerms {
+	return EULATerms{
+		PaymentTerm:      form.PaymentTerm,
+		SupportPlan:      form.SupportPlan,
+		TermYears:        form.TermYears,
+		BillingFrequency: form.BillingFrequency,
+	}
+}
+
+func (form EULAInfo) DocName() string {
+	date, _ := form.PreparedOn.Parse()
+	return fmt.Sprintf("%s EULA %s - %s", form.Domain, form.Quotation, date.Format("2006-01-02"))
+}
+
 func (form *EULAInfo) Complete() error {
 	now := time.Now()
 	form.PreparedOn = NewOfferOfferDate(now)
-	form.TermYears = 1 // for now only support 1 year
+	if form.TermYears == 0 {
+		form.TermYears = 1
+	}
+	if form.BillingFrequency == "" {
+		if form.PaymentTerm == PaymentTermPAYG {
+			form.BillingFrequency = BillingFrequencyMonthly
+		} else {
+			form.BillingFrequency = BillingFrequencyAnnual
+		}
+	}
 
 	if !strings.Contains(form.Domain, "://") {
 		form.Domain = "http://" + form.Domain
@@ -89,104 +134,105 @@ func (form EULAInfo) Validate() error {
 	if form.PaymentTerm == PaymentTermPAYG && form.SupportPlan == SupportPlanPremium {
 		return errors.New("support plan Premium is not offered with PAYG contract")
 	}
+	if _, err := catalog.EULATemplate(form.Terms()); err != nil {
+		return err
+	}
 	return nil
 }
 
-type EULATemplateKey struct {
-	PaymentTerm string
-	SupportPlan string
-}
+// GenerateEULA returns the customer folder and generates the EULA doc in the background.
+func (s *Server) GenerateEULA(info *EULAInfo) (string, error) {
+	if err := s.checkEULATemplate(info); err != nil {
+		return "", err
+	}
+	domainFolderId, err := s.eulaFolder(info.Domain)
+	if err != nil {
+		return "", err
+	}
 
-var eulaTemplates = map[EULATemplateKey]string{
-	{
-		PaymentTerm: "annual",
-		SupportPlan: "standard",
-	}: "16LawcDIbeNNIGJeS0pKmXYFukMQMw0olqL5gVWlmD3c",
-	{
-		PaymentTerm: "annual",
-		SupportPlan: "premium",
-	}: "1bcMuWQBdDT8I4XMAdHyyYJSMjlEHjxuIWclvvF5vajQ",
-	{
-		PaymentTerm: "payg",
-		SupportPlan: "standard",
-	}: "10_tM2wUTxWRKhyGIOLWK1TuZ2ivRFdCM69iRFU5FgNI",
-}
+	go func() {
+		docId, err := s.generateEULADoc(info, domainFolderId)
+		if err != nil {
+			klog.Warningln(err)
+			return
+		}
+		s.publishEULA(info, docId)
+	}()
 
-func (s *Server) GenerateEULA(info *EULAInfo) (string, error) {
-	var domainFolderId string
+	return domainFolderId, nil
+}
 
+// eulaFolder returns the id of the account folder for the domain, creating it if needed.
+func (s *Server) eulaFolder(domain string) (string, error) {
 	// https://developers.google.com/drive/api/v3/search-files
-	q := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents", info.Domain, AccountFolderId)
+	q := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents", domain, AccountFolderId)
 	files, err := s.srvDrive.Files.List().Q(q).Spaces("drive").Do()
 	if err != nil {
 		return "", err
 	}
 	if len(files.Files) > 0 {
-		domainFolderId = files.Files[0].Id
-	} else {
-		// https://developers.google.com/drive/api/v3/folder#java
-		folderMetadata := &drive.File{
-			Name:     info.Domain,
-			MimeType: "application/vnd.google-apps.folder",
-			Parents:  []string{AccountFolderId},
-		}
-		folder, err := s.srvDrive.Files.Create(folderMetadata).Fields("id").Do()
-		if err != nil {
-			return "", err
-		}
-		domainFolderId = folder.Id
+		fmt.Println("Using domain folder id:", files.Files[0].Id)
+		return files.Files[0].Id, nil
 	}
-	fmt.Println("Using domain folder id:", domainFolderId)
 
-	go func() {
-		docId, err := s.generateEULADoc(info, domainFolderId)
+	// https://developers.google.com/drive/api/v3/folder#java
+	folderMetadata := &drive.File{
+		Name:     domain,
+		MimeType: "application/vnd.google-apps.folder",
+		Parents:  []string{AccountFolderId},
+	}
+	folder, err := s.srvDrive.Files.Create(folderMetadata).Fields("id").Do()
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("Using domain folder id:", folder.Id)
+	return folder.Id, nil
+}
+
+// publishEULA records a generated EULA in the EULA log, requests the signature and
+// notifies sales.
+func (s *Server) publishEULA(info *EULAInfo, docId string) {
+	info.EULADocLink = GoogleDocLink(docId)
+	fmt.Println("EULA docId:", docId)
+
+	// record in spreadsheet unless generated for appscode.com domain
+	if !skipEmailDomains.Has(info.Domain) {
+		clients := []*EULAInfo{
+			info,
+		}
+		writer := gdrive.NewWriter(s.srvSheets, LicenseSpreadsheetId, "EULA Log")
+		err := gocsv.MarshalCSV(clients, writer)
 		if err != nil {
 			klog.Warningln(err)
 			return
 		}
-		info.EULADocLink = fmt.Sprintf("https://docs.google.com/document/d/%s/edit", docId)
-		fmt.Println("EULA docId:", docId)
-
-		// record in spreadsheet unless generated for appscode.com domain
-		if !skipEmailDomains.Has(info.Domain) {
-			clients := []*EULAInfo{
-				info,
-			}
-			writer := gdrive.NewWriter(s.srvSheets, LicenseSpreadsheetId, "EULA Log")
-			err = gocsv.MarshalCSV(clients, writer)
-			if err != nil {
-				klog.Warningln(err)
-				return
-			}
-		}
+	}
 
-		// mail HR
-		mailer := NewEULAMailer(info)
-		fmt.Println("sending email for generated EULA", info.Domain)
-		err = mailer.SendMail(s.mg, MailSales, "", nil)
-		if err != nil {
+	if info.SignerEmail != "" {
+		signer := Signer{Name: info.SignerName, Email: info.SignerEmail}
+		if _, err := s.RequestSignature(SignatureEULA, info.Quotation, docId, info.DocName(), signer, MailSales); err != nil {
 			klog.Warningln(err)
-			return
 		}
-	}()
+	}
 
-	return domainFolderId, nil
+	// mail sales
+	mailer := NewEULAMailer(info)
+	fmt.Println("sending email for generated EULA", info.Domain)
+	err := s.sendMail(mailer, MailSales, "")
+	if err != nil {
+		klog.Warningln(err)
+	}
 }
 
 func (s *Server) generateEULADoc(info *EULAInfo, domainFolderId string) (string, error) {
-	date, err := info.PreparedOn.Parse()
-	if err != nil {
+	if _, err := info.PreparedOn.Parse(); err != nil {
 		return "", err
 	}
-	docName := fmt.Sprintf("%s EULA %s - %s", info.Domain, info.Quotation, date.Format("2006-01-02"))
+	docName := info.DocName()
 
-	docKey := EULATemplateKey{
-		PaymentTerm: info.PaymentTerm,
-		SupportPlan: info.SupportPlan,
-	}
-	templateDocId, ok := eulaTemplates[docKey]
-	if !ok {
-		return "", fmt.Errorf("no template doc founder for %+v", docKey)
+	templateDocId, err := catalog.EULATemplate(info.Terms())
+	if err != nil {
+		return "", err
 	}
 
 	// https://developers.google.com/docs/api/how-tos/documents#copying_an_existing_document
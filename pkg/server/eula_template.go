@@ -0,0 +1,203 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"gomodules.xyz/sets"
+	"google.golang.org/api/docs/v1"
+)
+
+const (
+	BillingFrequencyMonthly   = "monthly"
+	BillingFrequencyQuarterly = "quarterly"
+	BillingFrequencyAnnual    = "annual"
+	BillingFrequencyUpfront   = "upfront" // whole term billed in advance
+)
+
+var (
+	paymentTerms       = sets.NewString(PaymentTermAnnual, PaymentTermPAYG)
+	supportPlans       = sets.NewString(SupportPlanStandard, SupportPlanPremium)
+	billingFrequencies = sets.NewString(BillingFrequencyMonthly, BillingFrequencyQuarterly, BillingFrequencyAnnual, BillingFrequencyUpfront)
+)
+
+// EULATemplate maps the contract terms it covers to a template doc.
+type EULATemplate struct {
+	PaymentTerm        string   `json:"paymentTerm"`
+	SupportPlan        string   `json:"supportPlan"`
+	TermYears          []int    `json:"termYears"`
+	BillingFrequencies []string `json:"billingFrequencies"`
+	TemplateDocId      string   `json:"templateDocId"`
+}
+
+type EULATerms struct {
+	PaymentTerm      string
+	SupportPlan      string
+	TermYears        int
+	BillingFrequency string
+}
+
+func (t EULATerms) String() string {
+	return fmt.Sprintf("%s payment, %s support, %d year term billed %s", t.PaymentTerm, t.SupportPlan, t.TermYears, t.BillingFrequency)
+}
+
+func (t EULATemplate) covers(terms EULATerms) bool {
+	if t.PaymentTerm != terms.PaymentTerm || t.SupportPlan != terms.SupportPlan {
+		return false
+	}
+	var years bool
+	for _, y := range t.TermYears {
+		if y == terms.TermYears {
+			years = true
+			break
+		}
+	}
+	return years && sets.NewString(t.BillingFrequencies...).Has(terms.BillingFrequency)
+}
+
+func (t EULATemplate) expand() []EULATerms {
+	var out []EULATerms
+	for _, y := range t.TermYears {
+		for _, f := range t.BillingFrequencies {
+			out = append(out, EULATerms{
+				PaymentTerm:      t.PaymentTerm,
+				SupportPlan:      t.SupportPlan,
+				TermYears:        y,
+				BillingFrequency: f,
+			})
+		}
+	}
+	return out
+}
+
+func validateEULATemplates(templates []EULATemplate) []error {
+	var errs []error
+	seen := map[EULATerms]int{}
+	for i, t := range templates {
+		owner := fmt.Sprintf("eula template %d", i)
+		if !paymentTerms.Has(t.PaymentTerm) {
+			errs = append(errs, fmt.Errorf("%s: unknown payment term %q", owner, t.PaymentTerm))
+		}
+		if !supportPlans.Has(t.SupportPlan) {
+			errs = append(errs, fmt.Errorf("%s: unknown support plan %q", owner, t.SupportPlan))
+		}
+		if t.TemplateDocId == "" {
+			errs = append(errs, fmt.Errorf("%s: missing templateDocId", owner))
+		}
+		if len(t.TermYears) == 0 || len(t.BillingFrequencies) == 0 {
+			errs = append(errs, fmt.Errorf("%s: termYears and billingFrequencies are required", owner))
+		}
+		for _, y := range t.TermYears {
+			if y < 1 {
+				errs = append(errs, fmt.Errorf("%s: invalid term of %d years", owner, y))
+			}
+		}
+		for _, f := range t.BillingFrequencies {
+			if !billingFrequencies.Has(f) {
+				errs = append(errs, fmt.Errorf("%s: unknown billing frequency %q", owner, f))
+			}
+		}
+		for _, terms := range t.expand() {
+			if j, ok := seen[terms]; ok {
+				errs = append(errs, fmt.Errorf("%s: %s is already covered by eula template %d", owner, terms, j))
+			}
+			seen[terms] = i
+		}
+	}
+	return errs
+}
+
+// EULATemplate returns the template doc id for the given contract terms.
+func (c *Catalog) EULATemplate(terms EULATerms) (string, error) {
+	for _, t := range c.EULATemplates {
+		if t.covers(terms) {
+			return t.TemplateDocId, nil
+		}
+	}
+	return "", fmt.Errorf("no EULA template offers %s", terms)
+}
+
+// MissingPlaceholders returns the placeholders for the terms that vary within the
+// template that its text lacks. A template that covers one term length and one billing
+// frequency can spell them out instead.
+func (t EULATemplate) MissingPlaceholders(text string) []string {
+	var missing []string
+	if len(t.TermYears) > 1 && !strings.Contains(text, "{{term}}") && !strings.Contains(text, "{{term-years}}") {
+		missing = append(missing, "{{term}}")
+	}
+	if len(t.BillingFrequencies) > 1 && !strings.Contains(text, "{{billing-frequency}}") {
+		missing = append(missing, "{{billing-frequency}}")
+	}
+	return missing
+}
+
+// loadEULATemplates checks the template docs of the catalog's EULA templates and records
+// the ones that can take custom clauses. It is called once at startup, so a template
+// that can't produce the terms it is mapped to fails the server instead of a request.
+func (s *Server) loadEULATemplates() error {
+	s.eulaClauses = sets.NewString()
+	for i, t := range catalog.EULATemplates {
+		doc, err := s.srvDoc.Documents.Get(t.TemplateDocId).Do()
+		if err != nil {
+			return fmt.Errorf("eula template %d: %w", i, err)
+		}
+		text := docText(doc.Body.Content)
+		if missing := t.MissingPlaceholders(text); len(missing) > 0 {
+			return fmt.Errorf("eula template %d: template doc %s covers several terms but lacks %s", i, t.TemplateDocId, strings.Join(missing, ", "))
+		}
+		if strings.Contains(text, "{{clauses}}") {
+			s.eulaClauses.Insert(t.TemplateDocId)
+		}
+	}
+	return nil
+}
+
+// checkEULATemplate returns an error if the template doc for the EULA can't hold its
+// custom clauses. It is checked before anything is copied to the customer folder.
+func (s *Server) checkEULATemplate(info *EULAInfo) error {
+	templateDocId, err := catalog.EULATemplate(info.Terms())
+	if err != nil {
+		return err
+	}
+	if info.clauses() != "" && !s.eulaClauses.Has(templateDocId) {
+		return fmt.Errorf("the EULA template for %s does not support custom clauses", info.Terms())
+	}
+	return nil
+}
+
+func docText(content []*docs.StructuralElement) string {
+	var buf strings.Builder
+	for _, e := range content {
+		switch {
+		case e.Paragraph != nil:
+			for _, pe := range e.Paragraph.Elements {
+				if pe.TextRun != nil {
+					buf.WriteString(pe.TextRun.Content)
+				}
+			}
+		case e.Table != nil:
+			for _, row := range e.Table.TableRows {
+				for _, cell := range row.TableCells {
+					buf.WriteString(docText(cell.Content))
+				}
+			}
+		}
+	}
+	return buf.String()
+}
@@ -29,6 +29,13 @@ type EventQuotationGenerated struct {
 	TemplateDocId string `json:"template_doc_id"`
 }
 
+type EventQuotationStatus struct {
+	freshsalesclient.BaseNoteDescription `json:",inline"`
+
+	Quotation string `json:"quotation"`
+	Status    string `json:"status"`
+}
+
 type EventLicenseIssued struct {
 	freshsalesclient.BaseNoteDescription `json:",inline"`
 
@@ -43,7 +50,9 @@ type LicenseRef struct {
 type EventMailgun struct {
 	freshsalesclient.BaseNoteDescription `json:",inline"`
 
-	Message Message `json:"message"`
+	Provider string  `json:"provider,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	Message  Message `json:"message"`
 }
 
 type Message struct {
@@ -66,4 +75,9 @@ type WebinarRecord struct {
 	ClusterProvider []string `json:"cluster_provider,omitempty" csv:"Cluster Provider" form:"cluster_provider"`
 	ExperienceLevel string   `json:"experience_level,omitempty" csv:"Experience Level" form:"experience_level"`
 	MarketingReach  string   `json:"marketing_reach,omitempty" csv:"Marketing Reach" form:"marketing_reach"`
+
+	// Attendance is recorded by the follow-up job after the webinar.
+	Attended        *bool  `json:"attended,omitempty" csv:"-" form:"-"`
+	AttendedMinutes int    `json:"attended_minutes,omitempty" csv:"-" form:"-"`
+	RecordingLink   string `json:"recording_link,omitempty" csv:"-" form:"-"`
 }
@@ -0,0 +1,121 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// CalendarEvent is exported as an iCalendar file, so invites work in any calendar
+// app and not just Google Calendar.
+// ref: https://www.rfc-editor.org/rfc/rfc5545
+type CalendarEvent struct {
+	// UID must stay the same for every copy of the event, so calendar apps update
+	// the event instead of adding a duplicate.
+	UID            string
+	Summary        string
+	Description    string
+	Location       string
+	URL            string
+	OrganizerName  string
+	OrganizerEmail string
+	Start          time.Time
+	End            time.Time
+	// Alarm is how long before the start calendar apps show a reminder. Zero adds no alarm.
+	Alarm time.Duration
+}
+
+// ICS returns the event as a VCALENDAR published by AppsCode. now is the DTSTAMP.
+func (e CalendarEvent) ICS(now time.Time) []byte {
+	var buf bytes.Buffer
+	w := func(name, value string) {
+		writeICSLine(&buf, name+":"+value)
+	}
+
+	w("BEGIN", "VCALENDAR")
+	w("VERSION", "2.0")
+	w("PRODID", "-//AppsCode Inc.//License Server//EN")
+	w("CALSCALE", "GREGORIAN")
+	w("METHOD", "PUBLISH")
+	w("BEGIN", "VEVENT")
+	w("UID", e.UID)
+	w("DTSTAMP", now.UTC().Format(icsTimeFormat))
+	w("DTSTART", e.Start.UTC().Format(icsTimeFormat))
+	w("DTEND", e.End.UTC().Format(icsTimeFormat))
+	w("SUMMARY", escapeICSText(e.Summary))
+	if e.Description != "" {
+		w("DESCRIPTION", escapeICSText(e.Description))
+	}
+	if e.Location != "" {
+		w("LOCATION", escapeICSText(e.Location))
+	}
+	if e.URL != "" {
+		w("URL", e.URL)
+	}
+	if e.OrganizerEmail != "" {
+		// quoted parameter values can't contain DQUOTE
+		writeICSLine(&buf, fmt.Sprintf(`ORGANIZER;CN="%s":mailto:%s`, strings.ReplaceAll(e.OrganizerName, `"`, ""), e.OrganizerEmail))
+	}
+	w("STATUS", "CONFIRMED")
+	w("TRANSP", "OPAQUE")
+	if e.Alarm > 0 {
+		w("BEGIN", "VALARM")
+		w("ACTION", "DISPLAY")
+		w("DESCRIPTION", escapeICSText(e.Summary))
+		w("TRIGGER", fmt.Sprintf("-PT%dM", int(e.Alarm.Minutes())))
+		w("END", "VALARM")
+	}
+	w("END", "VEVENT")
+	w("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+var icsTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escapeICSText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// writeICSLine folds the content line into lines of at most 75 octets, without
+// splitting UTF-8 characters, and terminates it with CRLF.
+func writeICSLine(buf *bytes.Buffer, line string) {
+	const limit = 75
+
+	n := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if n+size > limit {
+			buf.WriteString("\r\n ")
+			n = 1
+		}
+		buf.WriteRune(r)
+		n += size
+	}
+	buf.WriteString("\r\n")
+}
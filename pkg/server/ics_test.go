@@ -0,0 +1,107 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestCalendarEventICS(t *testing.T) {
+	start := time.Date(2026, 10, 26, 15, 0, 0, 0, time.UTC)
+	e := server.CalendarEvent{
+		UID:            "webinar-test@appscode.com",
+		Summary:        "AppsCode Webinar: Backup, Restore; Repeat",
+		Description:    strings.Repeat("Déjà vu with KubeDB and Stash. ", 8) + "\nJoin: https://zoom.us/j/1",
+		Location:       "https://zoom.us/j/1",
+		OrganizerName:  "AppsCode",
+		OrganizerEmail: "hello@appscode.com",
+		Start:          start,
+		End:            start.Add(time.Hour),
+		Alarm:          15 * time.Minute,
+	}
+	data := string(e.ICS(start.Add(-24 * time.Hour)))
+
+	if !strings.HasSuffix(data, "END:VCALENDAR\r\n") {
+		t.Errorf("expected CRLF terminated calendar, found %q", data)
+	}
+	lines := strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n")
+	for _, line := range lines {
+		if len(line) > 75 {
+			t.Errorf("line exceeds 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a UTF-8 character: %q", line)
+		}
+	}
+
+	// unfold
+	unfolded := strings.ReplaceAll(data, "\r\n ", "")
+	for _, expected := range []string{
+		"DTSTART:20261026T150000Z\r\n",
+		"DTEND:20261026T160000Z\r\n",
+		"DTSTAMP:20261025T150000Z\r\n",
+		`SUMMARY:AppsCode Webinar: Backup\, Restore\; Repeat` + "\r\n",
+		`Stash. \nJoin: https://zoom.us/j/1` + "\r\n",
+		`ORGANIZER;CN="AppsCode":mailto:hello@appscode.com` + "\r\n",
+		"TRIGGER:-PT15M\r\n",
+	} {
+		if !strings.Contains(unfolded, expected) {
+			t.Errorf("expected %q in %s", expected, unfolded)
+		}
+	}
+}
+
+func TestWebinarRegistrationCalendarEvent(t *testing.T) {
+	r := server.WebinarRegistration{
+		Email:    "jane@example.com",
+		Name:     "Jane Doe",
+		Title:    "KubeDB",
+		Summary:  "<p>Databases on <b>Kubernetes</b></p>",
+		Schedule: time.Date(2026, 10, 26, 15, 0, 0, 0, time.UTC),
+		Timezone: "Europe/Berlin",
+		Meeting: server.WebinarMeetingID{
+			ZoomMeetingID:       81234567890,
+			ZoomMeetingPassword: "secret",
+		},
+	}
+	e := r.CalendarEvent()
+	if e.UID != "webinar-20261026T150000Z@appscode.com" {
+		t.Errorf("unexpected uid %s", e.UID)
+	}
+	if !strings.Contains(e.Description, "Join Zoom Meeting: https://zoom.us/j/81234567890") || !strings.Contains(e.Description, "Passcode: secret") {
+		t.Errorf("expected zoom join details, found %q", e.Description)
+	}
+	if s := r.LocalSchedule(); s != "Mon, 26 Oct 2026 16:00:00 CET" {
+		t.Errorf("expected schedule in the registrant's timezone, found %s", s)
+	}
+
+	r.Meeting = server.WebinarMeetingID{}
+	if e := r.CalendarEvent(); e.Location != "" || strings.Contains(e.Description, "Zoom") {
+		t.Errorf("expected no join details without a zoom meeting, found %+v", e)
+	}
+
+	// the invite is sent even if the webinar info couldn't be read
+	r.Title = ""
+	if e := r.CalendarEvent(); e.Summary != "AppsCode Webinar" {
+		t.Errorf("expected a generic summary without a title, found %q", e.Summary)
+	}
+}
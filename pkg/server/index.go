@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"gomodules.xyz/blobfs"
+)
+
+// blobfs can't list files, so records that need to be looked up by a key other than
+// their id are indexed in json files holding the list of matching ids.
+
+var indexMu sync.Mutex
+
+func (s *Server) readIndex(path string) ([]string, error) {
+	return readIndex(s.fs, path)
+}
+
+func (s *Server) appendIndex(path, id string) error {
+	return appendIndex(s.fs, path, id)
+}
+
+func (s *Server) removeIndex(path, id string) error {
+	return removeIndex(s.fs, path, id)
+}
+
+func readIndex(fs blobfs.Interface, path string) ([]string, error) {
+	if ok, err := fs.Exists(context.TODO(), path); err != nil || !ok {
+		return nil, err
+	}
+	data, err := fs.ReadFile(context.TODO(), path)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func appendIndex(fs blobfs.Interface, path, id string) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	ids, err := readIndex(fs, path)
+	if err != nil {
+		return err
+	}
+	for _, existing := range ids {
+		if existing == id {
+			return nil
+		}
+	}
+	data, err := json.Marshal(append(ids, id))
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(context.TODO(), path, data)
+}
+
+func removeIndex(fs blobfs.Interface, path, id string) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	ids, err := readIndex(fs, path)
+	if err != nil {
+		return err
+	}
+	out := ids[:0]
+	for _, existing := range ids {
+		if existing != id {
+			out = append(out, existing)
+		}
+	}
+	if len(out) == len(ids) {
+		return nil
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(context.TODO(), path, data)
+}
@@ -164,9 +164,9 @@ func CreateLicense(fs blobfs.Interface, certs *certstore.CertStore, info License
 	}
 	cfg := Config{
 		CommonName:         getCN(sans),
-		Country:            SupportedProducts[license.Product].ProductLine,
-		Province:           SupportedProducts[license.Product].TierName,
-		Organization:       SupportedProducts[license.Product].Features,
+		Country:            catalog.Plan(license.Product).ProductLine,
+		Province:           catalog.Plan(license.Product).TierName,
+		Organization:       catalog.Plan(license.Product).Features,
 		OrganizationalUnit: license.Product, // plan
 		Locality:           ff.ToSlice(),
 		AltNames:           sans,
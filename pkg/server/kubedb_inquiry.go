@@ -17,16 +17,25 @@ limitations under the License.
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+
+	"github.com/go-macaron/auth"
 	"github.com/gocarina/gocsv"
+	"github.com/rs/xid"
 	freshsalesclient "gomodules.xyz/freshsales-client-go"
 	gdrive "gomodules.xyz/gdrive-utils"
+	"gopkg.in/macaron.v1"
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/yaml"
 )
 
 type KubeDBInquiryInfo struct {
@@ -66,8 +75,89 @@ func (form KubeDBInquiryInfo) Validate() error {
 	return nil
 }
 
+// KubeDBInquiry is a submitted inquiry with its sizing estimate. The estimate is a
+// draft: the quotation is only numbered, logged and generated once sales approves it.
+type KubeDBInquiry struct {
+	ID           string            `json:"id"`
+	Info         KubeDBInquiryInfo `json:"info"`
+	Estimate     *SizingEstimate   `json:"estimate,omitempty"`
+	QuotationJob string            `json:"quotationJob,omitempty"`
+	ApprovedAt   *time.Time        `json:"approvedAt,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+}
+
+// QuotationForm returns the quotation request for the draft estimate.
+func (r KubeDBInquiry) QuotationForm() QuotationForm {
+	return QuotationForm{
+		Name:      r.Info.CustomerName,
+		Email:     r.Info.CustomerEmail,
+		Telephone: r.Info.CustomerPhone,
+		Product:   []string{r.Estimate.QuotationTemplate},
+		Company:   r.Info.CustomerCompany,
+		Clusters:  r.Estimate.Clusters,
+		MemoryGB:  r.Estimate.MemoryGB,
+		Support:   r.Estimate.Support,
+	}
+}
+
+var kubedbInquiryMu sync.Mutex
+
+func (s *Server) GetKubeDBInquiry(id string) (*KubeDBInquiry, error) {
+	data, err := s.fs.ReadFile(context.TODO(), KubeDBInquiryPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var r KubeDBInquiry
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Server) saveKubeDBInquiry(r *KubeDBInquiry) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), KubeDBInquiryPath(r.ID), data)
+}
+
+func (s *Server) KubeDBInquiryReviewLink(id string) string {
+	return fmt.Sprintf("%s/_/kubedb_inquiries/%s", strings.TrimSuffix(s.opts.BaseURL, "/"), url.PathEscape(id))
+}
+
 func (s *Server) HandleKubeDBInquiry(info *KubeDBInquiryInfo) error {
+	r := &KubeDBInquiry{
+		ID:        xid.New().String(),
+		Info:      *info,
+		CreatedAt: time.Now(),
+	}
+	// The sizing estimate is a convenience for sales. The inquiry is still recorded
+	// and mailed if it can't be prepared.
+	est, err := catalog.EstimateKubeDBInquiry(*info)
+	if err != nil {
+		klog.Warningln(err)
+	} else {
+		r.Estimate = est
+	}
+	if err := s.saveKubeDBInquiry(r); err != nil {
+		return err
+	}
+
 	go func() {
+		s.recordContact(ContactUpdate{
+			Email:   info.CustomerEmail,
+			Name:    info.CustomerName,
+			Company: info.CustomerCompany,
+			Phone:   info.CustomerPhone,
+			Country: info.CustomerCountry,
+			Address: info.CustomerAddress,
+			Source:  ContactSourceKubeDBInquiry,
+			Event:   "kubedb_inquiry",
+			Summary: fmt.Sprintf("%s database memory, %s support", info.EstimatedDatabaseMemory, info.SupportPlan),
+			Ref:     r.ID,
+		})
+
 		clients := []*KubeDBInquiryInfo{info}
 		writer := gdrive.NewWriter(s.srvSheets, DealSpreadsheetId, "KubeDB Inquiry")
 		err := gocsv.MarshalCSV(clients, writer)
@@ -76,15 +166,16 @@ func (s *Server) HandleKubeDBInquiry(info *KubeDBInquiryInfo) error {
 			return
 		}
 
-		err = s.noteEventKubeDBInquiry(info)
+		reviewLink := s.KubeDBInquiryReviewLink(r.ID)
+		err = s.noteEventKubeDBInquiry(info, r.Estimate, reviewLink)
 		if err != nil {
 			klog.Warningln(err)
 			return
 		}
 
-		mailer := NewKubeDBInquiryMailer(info)
+		mailer := NewKubeDBInquiryMailer(info, r.Estimate, reviewLink)
 		fmt.Println("sending email for kubedb inquiry", info.CustomerCompany)
-		err = mailer.SendMail(s.mg, MailIncomingDeals, "", nil)
+		err = s.sendMail(mailer, MailIncomingDeals, "")
 		if err != nil {
 			klog.Warningln(err)
 			return
@@ -94,98 +185,99 @@ func (s *Server) HandleKubeDBInquiry(info *KubeDBInquiryInfo) error {
 	return nil
 }
 
+// ApproveKubeDBInquiry queues the quotation for the draft estimate of an inquiry. The
+// quotation job numbers, logs and generates it as a draft that is not sent to the
+// customer. Approving an inquiry again returns the existing job.
+func (s *Server) ApproveKubeDBInquiry(id string) (*KubeDBInquiry, error) {
+	kubedbInquiryMu.Lock()
+	defer kubedbInquiryMu.Unlock()
+
+	r, err := s.GetKubeDBInquiry(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.QuotationJob != "" {
+		return r, nil
+	}
+	if r.Estimate == nil {
+		return nil, fmt.Errorf("inquiry %s has no sizing estimate", id)
+	}
+
+	job, err := s.EnqueueQuotationJob(r.QuotationForm(), false, "", GeoLocation{Country: r.Info.CustomerCountry})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r.QuotationJob = job.ID
+	r.ApprovedAt = &now
+	if err := s.saveKubeDBInquiry(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 type EventKubeDBInquiry struct {
 	freshsalesclient.BaseNoteDescription `json:",inline"`
 	KubeDBInquiryInfo                    `json:",inline"`
+
+	Estimate   *SizingEstimate `json:"estimate,omitempty"`
+	ReviewLink string          `json:"review_link,omitempty"`
 }
 
-func (s *Server) noteEventKubeDBInquiry(info *KubeDBInquiryInfo) error {
-	fields := strings.Fields(info.CustomerName)
-	var firstName, lastName string
-	if len(fields) > 0 {
-		firstName = strings.Join(fields[0:len(fields)-1], " ")
-		lastName = fields[len(fields)-1]
-	}
+func (s *Server) noteEventKubeDBInquiry(info *KubeDBInquiryInfo, est *SizingEstimate, reviewLink string) error {
+	accountID := s.ensureCRMAccount(&crm.Account{
+		Name:    info.CustomerCompany,
+		Address: info.CustomerAddress,
+		Country: info.CustomerCountry,
+		Phone:   info.CustomerPhone,
+	})
 
-	var companyID int64
-	companyResults, err := s.freshsales.Search(info.CustomerCompany, freshsalesclient.EntitySalesAccount)
-	if err == nil && len(companyResults) > 0 {
-		id, _ := strconv.ParseInt(companyResults[0].ID, 10, 64)
-		companyID = id
-	} else {
-		account := &freshsalesclient.SalesAccount{
-			Name:    info.CustomerCompany,
-			Address: info.CustomerAddress,
-			Country: info.CustomerCountry,
-			Phone:   info.CustomerPhone,
-		}
-		newAccount, err := s.freshsales.CreateAccount(account)
-		if err != nil {
-			klog.Warningln(err)
-		} else if newAccount != nil {
-			companyID = newAccount.ID
-		}
+	e := EventKubeDBInquiry{
+		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+			Event: "kubedb_inquiry",
+		},
+		KubeDBInquiryInfo: *info,
+		Estimate:          est,
+		ReviewLink:        reviewLink,
 	}
+	return s.noteEventUpsert(&crm.Contact{
+		Email:     info.CustomerEmail,
+		Name:      info.CustomerName,
+		Phone:     info.CustomerPhone,
+		Address:   info.CustomerAddress,
+		Country:   info.CustomerCountry,
+		AccountID: accountID,
+	}, e)
+}
 
-	var contactID int64
-	contactResult, err := s.freshsales.LookupByEmail(info.CustomerEmail, freshsalesclient.EntityContact)
-	if err == nil && len(contactResult.Contacts.Contacts) > 0 {
-		contact := contactResult.Contacts.Contacts[0]
-		contactID = contact.ID
+func (s *Server) RegisterKubeDBInquiryAPI(m *macaron.Macaron) {
+	salesAuth := auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD"))
 
-		var changed bool
-		if contact.DisplayName != info.CustomerName {
-			contact.DisplayName = info.CustomerName
-			changed = true
-		}
-		if contact.WorkNumber != info.CustomerPhone {
-			contact.WorkNumber = info.CustomerPhone
-			changed = true
+	m.Get("/_/kubedb_inquiries/:id", salesAuth, func(ctx *macaron.Context) {
+		r, err := s.GetKubeDBInquiry(ctx.Params("id"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
 		}
-		if contact.Address != info.CustomerAddress {
-			contact.Address = info.CustomerAddress
-			changed = true
+		if ctx.Query("format") == "json" {
+			ctx.JSON(http.StatusOK, r)
+			return
 		}
-		if contact.Country != info.CustomerCountry {
-			contact.Country = info.CustomerCountry
-			changed = true
+		ctx.Data["Inquiry"] = r
+		if r.Estimate != nil {
+			ctx.Data["Summary"] = r.Estimate.Summary()
 		}
+		ctx.HTML(http.StatusOK, "kubedb_inquiry_review")
+	})
 
-		if changed {
-			_, err = s.freshsales.UpdateContact(&contact)
-			if err != nil {
-				klog.Warningln(err)
-			}
-		}
-	} else {
-		contact := &freshsalesclient.Contact{
-			Email:          info.CustomerEmail,
-			DisplayName:    info.CustomerName,
-			FirstName:      firstName,
-			LastName:       lastName,
-			WorkNumber:     info.CustomerPhone,
-			Address:        info.CustomerAddress,
-			Country:        info.CustomerCountry,
-			SalesAccountID: companyID,
-		}
-		newContact, err := s.freshsales.CreateContact(contact)
+	m.Post("/_/kubedb_inquiries/:id", salesAuth, func(ctx *macaron.Context) {
+		r, err := s.ApproveKubeDBInquiry(ctx.Params("id"))
 		if err != nil {
-			klog.Warningln(err)
-		} else if newContact != nil {
-			contactID = newContact.ID
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
 		}
-	}
-
-	e := EventKubeDBInquiry{
-		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
-			Event: "kubedb_inquiry",
-		},
-		KubeDBInquiryInfo: *info,
-	}
-	desc, err := yaml.Marshal(e)
-	if err != nil {
-		return err
-	}
-	_, err = s.freshsales.AddNote(contactID, freshsalesclient.EntityContact, string(desc))
-	return err
+		ctx.Redirect(fmt.Sprintf("/_/quotation-jobs/%s", r.QuotationJob), http.StatusSeeOther)
+	})
 }
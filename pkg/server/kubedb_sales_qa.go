@@ -17,11 +17,17 @@ limitations under the License.
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+
 	"github.com/gocarina/gocsv"
+	"github.com/rs/xid"
+	freshsalesclient "gomodules.xyz/freshsales-client-go"
 	gdrive "gomodules.xyz/gdrive-utils"
 	"k8s.io/klog/v2"
 )
@@ -39,6 +45,10 @@ type KubeDBSalesQAInfo struct {
 	ContactAddress string `json:"contactAddress" csv:"contact-address"`
 	ContactNotes   string `json:"contactNotes" csv:"contact-notes"`
 
+	// Answers are the raw answers posted by the browser. The fields below up to
+	// NotesJSON are computed from them by SalesQAQuestionnaire.Score.
+	Answers []SalesQAAnswer `json:"answers" csv:"-"`
+
 	HotCount  int `json:"hotCount" csv:"hot-count"`
 	WarmCount int `json:"warmCount" csv:"warm-count"`
 	ColdCount int `json:"coldCount" csv:"cold-count"`
@@ -48,6 +58,9 @@ type KubeDBSalesQAInfo struct {
 	NotesJSON   string `json:"notesJson" csv:"notes-json"`
 
 	SubmittedOn OfferDate `json:"-" csv:"submitted-on"`
+
+	ID        string `json:"id" csv:"id"`
+	LeadScore int    `json:"leadScore" csv:"lead-score"`
 }
 
 func (form *KubeDBSalesQAInfo) Complete() {
@@ -67,6 +80,10 @@ func (form *KubeDBSalesQAInfo) Complete() {
 	form.Verdict = strings.TrimSpace(form.Verdict)
 	form.VerdictText = strings.TrimSpace(form.VerdictText)
 	form.NotesJSON = strings.TrimSpace(form.NotesJSON)
+	for i := range form.Answers {
+		form.Answers[i].Signal = strings.ToLower(strings.TrimSpace(form.Answers[i].Signal))
+		form.Answers[i].Note = strings.TrimSpace(form.Answers[i].Note)
+	}
 }
 
 func (form KubeDBSalesQAInfo) Validate() error {
@@ -88,8 +105,33 @@ func (form KubeDBSalesQAInfo) Validate() error {
 	return nil
 }
 
+// HandleKubeDBSalesQA stores the scored result and records it in the sheet and the
+// CRM. info must already be scored by SalesQAQuestionnaire.Score.
 func (s *Server) HandleKubeDBSalesQA(info *KubeDBSalesQAInfo) error {
+	info.ID = xid.New().String()
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.WriteFile(context.TODO(), KubeDBSalesQAPath(info.ID), data); err != nil {
+		return err
+	}
+
 	go func() {
+		s.recordContact(ContactUpdate{
+			Email:   info.ContactEmail,
+			Name:    info.ContactName,
+			Company: info.ContactCompany,
+			Title:   info.ContactTitle,
+			Phone:   info.ContactPhone,
+			Country: info.ContactCountry,
+			Address: info.ContactAddress,
+			Source:  ContactSourceKubeDBSalesQA,
+			Event:   "kubedb_sales_qa",
+			Summary: fmt.Sprintf("%s (lead score %d)", info.VerdictText, info.LeadScore),
+			Ref:     info.ID,
+		})
+
 		entries := []*KubeDBSalesQAInfo{info}
 		writer := gdrive.NewWriter(s.srvSheets, DealSpreadsheetId, "KubeDB Sales QA")
 		err := gocsv.MarshalCSV(entries, writer)
@@ -98,9 +140,14 @@ func (s *Server) HandleKubeDBSalesQA(info *KubeDBSalesQAInfo) error {
 			return
 		}
 
+		err = s.noteEventKubeDBSalesQA(info)
+		if err != nil {
+			klog.Warningln(err)
+		}
+
 		mailer := NewKubeDBSalesQAMailer(info)
 		fmt.Println("sending email for kubedb sales qa", info.ContactCompany)
-		err = mailer.SendMail(s.mg, MailIncomingDeals, "", nil)
+		err = s.sendMail(mailer, MailIncomingDeals, "")
 		if err != nil {
 			klog.Warningln(err)
 			return
@@ -109,3 +156,57 @@ func (s *Server) HandleKubeDBSalesQA(info *KubeDBSalesQAInfo) error {
 
 	return nil
 }
+
+type EventKubeDBSalesQA struct {
+	freshsalesclient.BaseNoteDescription `json:",inline"`
+
+	SalesQA SalesQAResult `json:"sales_qa"`
+}
+
+type SalesQAResult struct {
+	ID          string `json:"id"`
+	Distro      string `json:"distro"`
+	Verdict     string `json:"verdict"`
+	VerdictText string `json:"verdict_text"`
+	LeadScore   int    `json:"lead_score"`
+	HotCount    int    `json:"hot_count"`
+	WarmCount   int    `json:"warm_count"`
+	ColdCount   int    `json:"cold_count"`
+}
+
+// noteEventKubeDBSalesQA sets the lead score of the contact and records the result as a note.
+func (s *Server) noteEventKubeDBSalesQA(info *KubeDBSalesQAInfo) error {
+	accountID := s.ensureCRMAccount(&crm.Account{
+		Name:    info.ContactCompany,
+		Address: info.ContactAddress,
+		Country: info.ContactCountry,
+		Phone:   info.ContactPhone,
+	})
+
+	e := EventKubeDBSalesQA{
+		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+			Event: "kubedb_sales_qa",
+		},
+		SalesQA: SalesQAResult{
+			ID:          info.ID,
+			Distro:      info.DistroLabel,
+			Verdict:     info.Verdict,
+			VerdictText: info.VerdictText,
+			LeadScore:   info.LeadScore,
+			HotCount:    info.HotCount,
+			WarmCount:   info.WarmCount,
+			ColdCount:   info.ColdCount,
+		},
+	}
+	score := info.LeadScore
+	return s.noteEventUpsert(&crm.Contact{
+		Email:     info.ContactEmail,
+		Name:      info.ContactName,
+		JobTitle:  info.ContactTitle,
+		Phone:     info.ContactPhone,
+		Address:   info.ContactAddress,
+		Country:   info.ContactCountry,
+		AccountID: accountID,
+		LeadScore: &score,
+	}, e)
+}
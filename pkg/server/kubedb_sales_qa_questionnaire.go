@@ -0,0 +1,282 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	catalogfs "go.bytebuilders.dev/offline-license-server/catalog"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const SalesQAVersion = "v1"
+
+const (
+	SalesQASignalHot  = "hot"
+	SalesQASignalWarm = "warm"
+	SalesQASignalCold = "cold"
+)
+
+// MaxLeadScore caps the lead score pushed to the CRM.
+const MaxLeadScore = 100
+
+type SalesQAQuestion struct {
+	Prompt string `json:"q"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+type SalesQASection struct {
+	Title     string            `json:"title"`
+	Subtitle  string            `json:"subtitle,omitempty"`
+	Questions []SalesQAQuestion `json:"questions"`
+}
+
+// SalesQAScoring lists the buying signals shown to the sales rep as a guide.
+type SalesQAScoring struct {
+	Hot  []string `json:"hot"`
+	Warm []string `json:"warm"`
+	Cold []string `json:"cold"`
+}
+
+type SalesQADistro struct {
+	Label    string           `json:"label"`
+	Sections []SalesQASection `json:"sections"`
+	Scoring  SalesQAScoring   `json:"scoring"`
+}
+
+// SalesQAThreshold is met when there are at least Hot hot and Warm warm answers.
+type SalesQAThreshold struct {
+	Hot  int `json:"hot,omitempty"`
+	Warm int `json:"warm,omitempty"`
+}
+
+type SalesQAVerdict struct {
+	Name       string             `json:"name"`
+	Text       string             `json:"text"`
+	Rating     string             `json:"rating"`
+	Guidance   string             `json:"guidance"`
+	Color      string             `json:"color,omitempty"`
+	Thresholds []SalesQAThreshold `json:"thresholds,omitempty"`
+}
+
+func (v SalesQAVerdict) Matches(hot, warm int) bool {
+	if len(v.Thresholds) == 0 {
+		return true
+	}
+	for _, t := range v.Thresholds {
+		if hot >= t.Hot && warm >= t.Warm {
+			return true
+		}
+	}
+	return false
+}
+
+// SalesQAQuestionnaire is the KubeDB sales QA questionnaire and the rules used to
+// score a submitted call.
+type SalesQAQuestionnaire struct {
+	Version  string                   `json:"version"`
+	Weights  map[string]int           `json:"weights"`
+	Verdicts []SalesQAVerdict         `json:"verdicts"`
+	Distros  map[string]SalesQADistro `json:"distros"`
+}
+
+// SalesQAAnswer is the raw answer to a question. Section and Question are 1-based.
+type SalesQAAnswer struct {
+	Section  int    `json:"section"`
+	Question int    `json:"question"`
+	Signal   string `json:"signal,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+var salesQA = MustLoadSalesQAQuestionnaire()
+
+func CurrentSalesQAQuestionnaire() *SalesQAQuestionnaire {
+	return salesQA
+}
+
+func ParseSalesQAQuestionnaire(data []byte) (*SalesQAQuestionnaire, error) {
+	var q SalesQAQuestionnaire
+	if err := yaml.UnmarshalStrict(data, &q); err != nil {
+		return nil, err
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func LoadSalesQAQuestionnaire() (*SalesQAQuestionnaire, error) {
+	data, err := catalogfs.FS.ReadFile("kubedb_sales_qa.yaml")
+	if err != nil {
+		return nil, err
+	}
+	return ParseSalesQAQuestionnaire(data)
+}
+
+func MustLoadSalesQAQuestionnaire() *SalesQAQuestionnaire {
+	q, err := LoadSalesQAQuestionnaire()
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *SalesQAQuestionnaire) Validate() error {
+	var errs []error
+
+	if q.Version != SalesQAVersion {
+		errs = append(errs, fmt.Errorf("unsupported sales qa version %q, expected %q", q.Version, SalesQAVersion))
+	}
+	for signal := range q.Weights {
+		if !validSalesQASignal(signal) {
+			errs = append(errs, fmt.Errorf("weights: unknown signal %s", signal))
+		}
+	}
+
+	if len(q.Verdicts) == 0 {
+		errs = append(errs, fmt.Errorf("missing verdicts"))
+	} else if len(q.Verdicts[len(q.Verdicts)-1].Thresholds) > 0 {
+		errs = append(errs, fmt.Errorf("verdict %s: the last verdict must not have thresholds", q.Verdicts[len(q.Verdicts)-1].Name))
+	}
+	for _, v := range q.Verdicts {
+		if v.Name == "" || v.Text == "" {
+			errs = append(errs, fmt.Errorf("verdict %q: missing name or text", v.Name))
+		}
+	}
+
+	if len(q.Distros) == 0 {
+		errs = append(errs, fmt.Errorf("missing distros"))
+	}
+	for _, name := range sortedKeys(q.Distros) {
+		d := q.Distros[name]
+		if d.Label == "" {
+			errs = append(errs, fmt.Errorf("distro %s: missing label", name))
+		}
+		if len(d.Sections) == 0 {
+			errs = append(errs, fmt.Errorf("distro %s: missing sections", name))
+		}
+		for i, s := range d.Sections {
+			if len(s.Questions) == 0 {
+				errs = append(errs, fmt.Errorf("distro %s: section %d has no questions", name, i+1))
+			}
+			for j, question := range s.Questions {
+				if question.Prompt == "" {
+					errs = append(errs, fmt.Errorf("distro %s: S%dQ%d: missing prompt", name, i+1, j+1))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func validSalesQASignal(signal string) bool {
+	switch signal {
+	case SalesQASignalHot, SalesQASignalWarm, SalesQASignalCold:
+		return true
+	}
+	return false
+}
+
+// Verdict returns the first verdict matching the hot and warm counts.
+func (q *SalesQAQuestionnaire) Verdict(hot, warm int) SalesQAVerdict {
+	for _, v := range q.Verdicts {
+		if v.Matches(hot, warm) {
+			return v
+		}
+	}
+	return q.Verdicts[len(q.Verdicts)-1]
+}
+
+// Score recomputes the signal counts, verdict, lead score and notes of info from
+// its raw answers. Whatever the browser computed for these fields is overwritten.
+func (q *SalesQAQuestionnaire) Score(info *KubeDBSalesQAInfo) error {
+	d, ok := q.Distros[info.Distro]
+	if !ok {
+		return fmt.Errorf("unknown kubernetes distribution %q", info.Distro)
+	}
+
+	var errs []error
+	var hot, warm, cold, score int
+	notes := make([]salesQANote, 0, len(info.Answers))
+	seen := map[[2]int]bool{}
+	for _, a := range info.Answers {
+		if a.Section < 1 || a.Section > len(d.Sections) ||
+			a.Question < 1 || a.Question > len(d.Sections[a.Section-1].Questions) {
+			errs = append(errs, fmt.Errorf("unknown question S%dQ%d", a.Section, a.Question))
+			continue
+		}
+		if a.Signal != "" && !validSalesQASignal(a.Signal) {
+			errs = append(errs, fmt.Errorf("S%dQ%d: unknown signal %q", a.Section, a.Question, a.Signal))
+			continue
+		}
+		key := [2]int{a.Section, a.Question}
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("S%dQ%d: answered more than once", a.Section, a.Question))
+			continue
+		}
+		seen[key] = true
+
+		switch a.Signal {
+		case SalesQASignalHot:
+			hot++
+		case SalesQASignalWarm:
+			warm++
+		case SalesQASignalCold:
+			cold++
+		}
+		score += q.Weights[a.Signal]
+
+		if a.Signal != "" || a.Note != "" {
+			notes = append(notes, salesQANote{
+				Section:  a.Section,
+				Question: a.Question,
+				Prompt:   d.Sections[a.Section-1].Questions[a.Question-1].Prompt,
+				Signal:   a.Signal,
+				Note:     a.Note,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Section != notes[j].Section {
+			return notes[i].Section < notes[j].Section
+		}
+		return notes[i].Question < notes[j].Question
+	})
+
+	notesJSON, err := json.Marshal(notes)
+	if err != nil {
+		return err
+	}
+
+	v := q.Verdict(hot, warm)
+	info.DistroLabel = d.Label
+	info.HotCount = hot
+	info.WarmCount = warm
+	info.ColdCount = cold
+	info.Verdict = v.Name
+	info.VerdictText = v.Text
+	info.LeadScore = min(score, MaxLeadScore)
+	info.NotesJSON = string(notesJSON)
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestDefaultSalesQAQuestionnaire(t *testing.T) {
+	q, err := server.LoadSalesQAQuestionnaire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, distro := range []string{"any", "nutanix", "rh", "suse", "vmware"} {
+		if _, ok := q.Distros[distro]; !ok {
+			t.Errorf("missing distro %s", distro)
+		}
+	}
+}
+
+func TestSalesQAScore(t *testing.T) {
+	q := server.CurrentSalesQAQuestionnaire()
+
+	cases := []struct {
+		name      string
+		answers   []server.SalesQAAnswer
+		verdict   string
+		leadScore int
+	}{
+		{
+			name:      "no answers",
+			verdict:   "cool",
+			leadScore: 0,
+		},
+		{
+			name: "three hot",
+			answers: []server.SalesQAAnswer{
+				{Section: 1, Question: 1, Signal: "hot"},
+				{Section: 2, Question: 2, Signal: "hot"},
+				{Section: 5, Question: 1, Signal: "hot"},
+			},
+			verdict:   "hot",
+			leadScore: 30,
+		},
+		{
+			name: "three warm",
+			answers: []server.SalesQAAnswer{
+				{Section: 1, Question: 1, Signal: "warm"},
+				{Section: 1, Question: 2, Signal: "warm"},
+				{Section: 1, Question: 3, Signal: "warm", Note: "two clusters"},
+				{Section: 1, Question: 4, Signal: "cold"},
+			},
+			verdict:   "warm",
+			leadScore: 12,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// counts posted by the browser are ignored
+			info := server.KubeDBSalesQAInfo{
+				Distro:   "any",
+				Answers:  c.answers,
+				HotCount: 10,
+				Verdict:  "hot",
+			}
+			if err := q.Score(&info); err != nil {
+				t.Fatal(err)
+			}
+			if info.Verdict != c.verdict || info.LeadScore != c.leadScore {
+				t.Errorf("expected verdict %s and lead score %d, found %s and %d", c.verdict, c.leadScore, info.Verdict, info.LeadScore)
+			}
+			if info.DistroLabel != q.Distros["any"].Label {
+				t.Errorf("unexpected distro label %q", info.DistroLabel)
+			}
+			var notes []map[string]any
+			if err := json.Unmarshal([]byte(info.NotesJSON), &notes); err != nil {
+				t.Fatal(err)
+			}
+			if len(notes) != len(c.answers) {
+				t.Errorf("expected %d notes, found %d", len(c.answers), len(notes))
+			}
+		})
+	}
+}
+
+func TestSalesQAScoreInvalid(t *testing.T) {
+	q := server.CurrentSalesQAQuestionnaire()
+
+	cases := map[string]server.KubeDBSalesQAInfo{
+		"unknown distro": {Distro: "eks"},
+		"unknown question": {Distro: "any", Answers: []server.SalesQAAnswer{
+			{Section: 1, Question: 99, Signal: "hot"},
+		}},
+		"unknown signal": {Distro: "any", Answers: []server.SalesQAAnswer{
+			{Section: 1, Question: 1, Signal: "lukewarm"},
+		}},
+		"duplicate answer": {Distro: "any", Answers: []server.SalesQAAnswer{
+			{Section: 1, Question: 1, Signal: "hot"},
+			{Section: 1, Question: 1, Signal: "hot"},
+		}},
+	}
+	for name, info := range cases {
+		if err := q.Score(&info); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
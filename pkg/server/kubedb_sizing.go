@@ -0,0 +1,213 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Billable units of the price list used for KubeDB inquiry estimates.
+const (
+	UnitMemoryGB = "memory-gb"
+	UnitCluster  = "cluster"
+)
+
+// InquirySizing holds the rules used to size a KubeDB inquiry.
+type InquirySizing struct {
+	QuotationTemplate string            `json:"quotationTemplate"`
+	Plans             map[string]string `json:"plans,omitempty"` // kubernetes setup => quotation template
+	HeadroomPercent   float64           `json:"headroomPercent"`
+	MemoryStepGB      int               `json:"memoryStepGB"`
+	MinMemoryGB       int               `json:"minMemoryGB"`
+	Clusters          int               `json:"clusters"`
+	Support           map[string]string `json:"support"`
+	DefaultSupport    string            `json:"defaultSupport"`
+}
+
+// SizingEstimate is the license sizing derived from a KubeDB inquiry.
+type SizingEstimate struct {
+	QuotationTemplate    string          `json:"quotation_template"`
+	RequestedMemory      string          `json:"requested_memory,omitempty"`
+	MemoryGB             int             `json:"memory_gb"`
+	Clusters             int             `json:"clusters"`
+	Support              string          `json:"support"`
+	ProfessionalServices bool            `json:"professional_services,omitempty"`
+	Notes                []string        `json:"notes,omitempty"`
+	Price                *PriceBreakdown `json:"price,omitempty"`
+	Total                string          `json:"total"`
+}
+
+func (c *Catalog) validateInquirySizing() []error {
+	z := c.InquirySizing
+	if z == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, setup := range append(sortedKeys(z.Plans), "") {
+		template := z.QuotationTemplate
+		if setup != "" {
+			template = z.Plans[setup]
+		}
+		t, ok := c.QuotationTemplate(template)
+		if !ok {
+			errs = append(errs, fmt.Errorf("inquiry sizing: unknown quotation template %q", template))
+		} else if pl, ok := c.Pricing.PriceLists[t.PriceList]; !ok {
+			errs = append(errs, fmt.Errorf("inquiry sizing: quotation template %s has no price list", template))
+		} else {
+			for _, unit := range []string{UnitMemoryGB, UnitCluster} {
+				if _, ok := pl.Units[unit]; !ok {
+					errs = append(errs, fmt.Errorf("inquiry sizing: price list %s has no %s unit", t.PriceList, unit))
+				}
+			}
+		}
+	}
+	if z.HeadroomPercent < 0 {
+		errs = append(errs, fmt.Errorf("inquiry sizing: headroomPercent can't be negative"))
+	}
+	if z.MemoryStepGB < 1 || z.MinMemoryGB < 1 || z.Clusters < 1 {
+		errs = append(errs, fmt.Errorf("inquiry sizing: memoryStepGB, minMemoryGB and clusters must be positive"))
+	}
+	for _, name := range append(sortedKeys(z.Support), "") {
+		plan := z.DefaultSupport
+		if name != "" {
+			plan = z.Support[name]
+		}
+		if _, ok := c.Pricing.Support[plan]; !ok {
+			errs = append(errs, fmt.Errorf("inquiry sizing: unknown support plan %q", plan))
+		}
+	}
+	return errs
+}
+
+var memoryRegex = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(tib|tb|t|gib|gb|g|mib|mb|m)?\b`)
+
+// ParseMemoryGB parses the database memory entered on the inquiry form, eg, "64",
+// "64 GB", "1.5TB", "64-128 GB" or "500 MB - 2 GB". For ranges, the upper bound is
+// used. A number without a unit takes the unit of the number after it, or GB.
+func ParseMemoryGB(s string) (float64, error) {
+	matches := memoryRegex.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("can't parse database memory %q", s)
+	}
+
+	unit := "g"
+	var size float64
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		v, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		if m[2] != "" {
+			unit = strings.ToLower(m[2][:1])
+		}
+		switch unit {
+		case "t":
+			v *= 1024
+		case "m":
+			v /= 1024
+		}
+		size = math.Max(size, v)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("can't parse database memory %q", s)
+	}
+	return size, nil
+}
+
+// QuotationTemplateFor returns the quotation template for a kubernetes setup.
+func (z InquirySizing) QuotationTemplateFor(setup string) string {
+	if t, ok := z.Plans[setup]; ok {
+		return t
+	}
+	return z.QuotationTemplate
+}
+
+// EstimateKubeDBInquiry sizes the license for a KubeDB inquiry and prices it with
+// the quotation template of the inquiry's kubernetes setup.
+func (c *Catalog) EstimateKubeDBInquiry(info KubeDBInquiryInfo) (*SizingEstimate, error) {
+	z := c.InquirySizing
+	if z == nil {
+		return nil, fmt.Errorf("inquiry sizing is not configured")
+	}
+
+	est := SizingEstimate{
+		QuotationTemplate: z.QuotationTemplateFor(info.KubernetesSetup),
+		RequestedMemory:   info.EstimatedDatabaseMemory,
+		Clusters:          z.Clusters,
+		Support:           z.DefaultSupport,
+	}
+
+	memory, err := ParseMemoryGB(info.EstimatedDatabaseMemory)
+	if err != nil {
+		est.Notes = append(est.Notes, fmt.Sprintf("Database memory %q not understood, quoted the minimum of %d GB.", info.EstimatedDatabaseMemory, z.MinMemoryGB))
+	}
+	memory *= 1 + z.HeadroomPercent/100
+	steps := int(math.Ceil(memory / float64(z.MemoryStepGB)))
+	est.MemoryGB = max(steps*z.MemoryStepGB, z.MinMemoryGB)
+
+	if info.SupportPlan != "" {
+		if plan, ok := z.Support[info.SupportPlan]; ok {
+			est.Support = plan
+		} else {
+			est.Notes = append(est.Notes, fmt.Sprintf("Unknown support plan %q, quoted %s support.", info.SupportPlan, z.DefaultSupport))
+		}
+	}
+	if strings.EqualFold(info.ProfessionalServices, "Yes") {
+		est.ProfessionalServices = true
+		est.Notes = append(est.Notes, "Professional services requested; they are not included in the estimate.")
+	}
+
+	price, err := c.PriceQuotation(est.QuotationTemplate, PricingRequest{
+		Quantities: map[string]int{
+			UnitMemoryGB: est.MemoryGB,
+			UnitCluster:  est.Clusters,
+		},
+		Support: est.Support,
+	})
+	if err != nil {
+		return nil, err
+	}
+	est.Price = price
+	est.Total = formatMoney(price.Total, price.Currency)
+	return &est, nil
+}
+
+// Summary returns the estimate as markdown list items.
+func (est SizingEstimate) Summary() string {
+	lines := []string{
+		fmt.Sprintf("- Plan: %s", est.QuotationTemplate),
+		fmt.Sprintf("- Database Memory: %d GB", est.MemoryGB),
+		fmt.Sprintf("- Clusters: %d", est.Clusters),
+		fmt.Sprintf("- Support: %s", est.Support),
+	}
+	if est.Price != nil {
+		for _, item := range est.Price.LineItems {
+			lines = append(lines, fmt.Sprintf("  - %s x %d = %s", item.Description, item.Quantity, formatMoney(item.Amount, est.Price.Currency)))
+		}
+		lines = append(lines, fmt.Sprintf("- Total (%s): %s", pluralize(est.Price.TermYears, "year"), est.Total))
+	}
+	for _, note := range est.Notes {
+		lines = append(lines, "- Note: "+note)
+	}
+	return strings.Join(lines, "\n")
+}
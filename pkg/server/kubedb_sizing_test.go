@@ -0,0 +1,160 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestParseMemoryGB(t *testing.T) {
+	cases := map[string]float64{
+		"64":                    64,
+		"64 GB":                 64,
+		"64GiB":                 64,
+		"1.5TB":                 1536,
+		"512 MB":                0.5,
+		"64-128 GB":             128,
+		"500 MB - 2 GB":         2,
+		"1 TB or 512 GB":        1024,
+		"about 32 more or less": 32,
+	}
+	for in, expected := range cases {
+		found, err := server.ParseMemoryGB(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		} else if found != expected {
+			t.Errorf("%q: expected %v GB, found %v GB", in, expected, found)
+		}
+	}
+	if _, err := server.ParseMemoryGB("not sure"); err == nil {
+		t.Error("expected error for memory without a number")
+	}
+}
+
+func TestEstimateKubeDBInquiry(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	est, err := c.EstimateKubeDBInquiry(server.KubeDBInquiryInfo{
+		EstimatedDatabaseMemory: "64 GB",
+		SupportPlan:             "Platinum",
+		ProfessionalServices:    "Yes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 64 GB + 25% headroom = 80 GB; 80 * $50 * 12 + $100 * 12 = $49,200; +20% premium support
+	if est.MemoryGB != 80 || est.Clusters != 1 || est.Support != "premium" {
+		t.Errorf("unexpected sizing %+v", est)
+	}
+	if est.Total != "$59,040.00" {
+		t.Errorf("expected total $59,040.00, found %s", est.Total)
+	}
+	if !est.ProfessionalServices || len(est.Notes) != 1 {
+		t.Errorf("expected a professional services note, found %v", est.Notes)
+	}
+
+	if est.QuotationTemplate != "kubedb-ent" {
+		t.Errorf("expected inquiries without a kubernetes setup to use kubedb-ent, found %s", est.QuotationTemplate)
+	}
+
+	est, err = c.EstimateKubeDBInquiry(server.KubeDBInquiryInfo{EstimatedDatabaseMemory: "don't know"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.MemoryGB != 16 || est.Support != "standard" || len(est.Notes) != 1 {
+		t.Errorf("expected the minimum size with standard support, found %+v", est)
+	}
+
+	for setup, expected := range map[string]string{
+		"Amazon EKS":                    "kubedb-cloud",
+		"Red Hat OpenShift":             "kubedb-onprem",
+		"Other Kubernetes Distribution": "kubedb-ent",
+	} {
+		est, err = c.EstimateKubeDBInquiry(server.KubeDBInquiryInfo{
+			EstimatedDatabaseMemory: "64 GB",
+			KubernetesSetup:         setup,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if est.QuotationTemplate != expected {
+			t.Errorf("%s: expected %s, found %s", setup, expected, est.QuotationTemplate)
+		}
+	}
+}
+
+func TestKubeDBInquiryQuotationForm(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err := c.EstimateKubeDBInquiry(server.KubeDBInquiryInfo{
+		EstimatedDatabaseMemory: "500 MB - 100 GB",
+		KubernetesSetup:         "Google GKE",
+		SupportPlan:             "Platinum",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := server.KubeDBInquiry{
+		Info: server.KubeDBInquiryInfo{
+			CustomerName:    "Jane Doe",
+			CustomerEmail:   "jane@example.com",
+			CustomerCompany: "Example Inc",
+		},
+		Estimate: est,
+	}
+	job := server.NewQuotationJob(r.QuotationForm(), false, "", server.GeoLocation{}, time.Now())
+	gen, err := server.NewJobQuotationGenerator(http.DefaultClient, job, job.Results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Contact.Product != "kubedb-cloud" || gen.Contact.Price == nil {
+		t.Fatalf("expected a priced kubedb-cloud quotation, found %+v", gen.Contact)
+	}
+	// the approved quotation must match the draft sales reviewed
+	if gen.Contact.Price.Total != est.Price.Total {
+		t.Errorf("expected total %d, found %d", est.Price.Total, gen.Contact.Price.Total)
+	}
+}
+
+func TestInquirySizingValidation(t *testing.T) {
+	c, err := server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.InquirySizing.QuotationTemplate = "kubedb-50" // no price list
+	if err := c.Validate(); err == nil {
+		t.Error("expected inquiry sizing without a price list to fail validation")
+	}
+
+	c, err = server.LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.InquirySizing.Plans["Azure AKS"] = "kubedb-84" // no price list
+	if err := c.Validate(); err == nil {
+		t.Error("expected an inquiry plan without a price list to fail validation")
+	}
+}
@@ -18,14 +18,22 @@ package server
 
 import (
 	"fmt"
+	"strings"
 
 	"gomodules.xyz/mailer"
 )
 
-func NewDealRegistrationMailer(info *DealRegistrationInfo) mailer.Mailer {
+func NewDealRegistrationMailer(r *DealRegistration, reviewLink string) mailer.Mailer {
+	info := &r.Info
+
+	var conflicts string
+	if len(r.Conflicts) > 0 {
+		conflicts = fmt.Sprintf("\n**This customer has active registrations by other partners: %s**\n", strings.Join(r.Conflicts, ", "))
+	}
+
 	src := fmt.Sprintf(`Hi,
 A new deal has been registered with the following details:
-
+%s
 ## Partner
 - Name: %s
 - Email: %s
@@ -51,9 +59,12 @@ A new deal has been registered with the following details:
 - Competitor Product: %s
 - Notes: %s
 
+Approve or reject the registration here: %s
+
 Regards,
 Deal Registration System
 `,
+		conflicts,
 		info.PartnerName,
 		info.PartnerEmail,
 		info.PartnerCompany,
@@ -73,6 +84,7 @@ Deal Registration System
 		info.ProjectTimeline,
 		info.CompetitorProduct,
 		info.Notes,
+		reviewLink,
 	)
 	return mailer.Mailer{
 		Sender:          MailSales,
@@ -85,3 +97,40 @@ Deal Registration System
 		GDriveFiles:     nil,
 	}
 }
+
+func NewDealRegistrationStatusMailer(r *DealRegistration) mailer.Mailer {
+	var msg string
+	switch r.Status {
+	case DealApproved:
+		msg = fmt.Sprintf("has been approved. Your deal is protected until %s.", r.ExpiresOn.Format("Jan 2, 2006"))
+	case DealRejected:
+		msg = "has been rejected."
+	case DealExpired:
+		msg = "has expired."
+	default:
+		msg = fmt.Sprintf("is %s.", r.Status)
+	}
+	var note string
+	if n := len(r.History); n > 0 && r.History[n-1].Note != "" {
+		note = fmt.Sprintf("\nNote from AppsCode: %s\n", r.History[n-1].Note)
+	}
+
+	src := fmt.Sprintf(`Hi %s,
+Your deal registration %s for %s (%s) %s
+%s
+If you have any questions, please reply to this email.
+
+Regards,
+AppsCode Partner Team
+`, r.Info.PartnerName, r.ID, r.Info.CustomerCompany, r.Info.Product, msg, note)
+	return mailer.Mailer{
+		Sender:          MailSales,
+		BCC:             MailIncomingDeals,
+		ReplyTo:         MailSales,
+		Subject:         fmt.Sprintf("Deal Registration %s: %s - %s", r.Status, r.Info.CustomerCompany, r.Info.Product),
+		Body:            src,
+		Params:          nil,
+		AttachmentBytes: nil,
+		GDriveFiles:     nil,
+	}
+}
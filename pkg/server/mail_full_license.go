@@ -17,52 +17,13 @@ limitations under the License.
 package server
 
 import (
-	"fmt"
-
-	"gomodules.xyz/cert"
 	"gomodules.xyz/mailer"
 )
 
 func NewEnterpriseLicenseMailer(info LicenseMailData) mailer.Mailer {
-	var fromTimestamp, toTimeStamp string
-	crts, err := cert.ParseCertsPEM([]byte(info.License))
-	if err != nil {
-		fromTimestamp = err.Error()
-		toTimeStamp = err.Error()
-	} else {
-		for _, crt := range crts {
-			fromTimestamp = crt.NotBefore.UTC().Format("02 Jan, 2006")
-			toTimeStamp = crt.NotAfter.UTC().Format("02 Jan, 2006")
-			break
-		}
-	}
-	displayName := SupportedProducts[info.Product()].DisplayName
-
-	src := fmt.Sprintf(`Hi {{.Name}},
-Thanks for purchasing license for %s. The full license for Kubernetes cluster {{.Cluster}} is attached with this email.
-
-Valid From: %s
-Valid To: %s
-
-%s
-{{ .License | trim }}
-%s
-
-Please let us know if you have any questions.
-
-Regards,
-Team AppsCode
-
-[![Website](https://cdn.appscode.com/images/website.png)](https://appscode.com) [![Linkedin](https://cdn.appscode.com/images/ln.png)](https://www.linkedin.com/company/appscode/) [![X](https://cdn.appscode.com/images/tt.png)](https://x.com/AppsCodeHQ) [![Youtube](https://cdn.appscode.com/images/yt.png)](https://www.youtube.com/@appscode)
-`, displayName, fromTimestamp, toTimeStamp, "```", "```")
-
-	return mailer.Mailer{
-		Sender:          MailLicenseSender,
-		BCC:             MailLicenseTracker,
-		ReplyTo:         MailSupport,
-		Subject:         fmt.Sprintf("%s License for cluster %s", displayName, info.Cluster),
-		Body:            src,
-		Params:          info,
-		AttachmentBytes: nil,
-	}
+	m := localizedMailer(MailTemplateEnterpriseLicense, info.Locale, newLicenseMailParams(info))
+	m.Sender = MailLicenseSender
+	m.BCC = MailLicenseTracker
+	m.ReplyTo = MailSupport
+	return m
 }
@@ -22,7 +22,12 @@ import (
 	"gomodules.xyz/mailer"
 )
 
-func NewKubeDBInquiryMailer(info *KubeDBInquiryInfo) mailer.Mailer {
+func NewKubeDBInquiryMailer(info *KubeDBInquiryInfo, est *SizingEstimate, reviewLink string) mailer.Mailer {
+	estimate := "- Sizing estimate is not available."
+	if est != nil {
+		estimate = est.Summary() + "\n- Review and approve the draft quotation: " + reviewLink
+	}
+
 	src := fmt.Sprintf(`Hi,
 A new KubeDB inquiry has been submitted with the following details:
 
@@ -42,6 +47,9 @@ A new KubeDB inquiry has been submitted with the following details:
 - Professional Services: %s
 - Notes: %s
 
+## Sizing Estimate
+%s
+
 Regards,
 KubeDB Inquiry System
 `,
@@ -57,6 +65,7 @@ KubeDB Inquiry System
 		info.ProjectTimeline,
 		info.ProfessionalServices,
 		info.Notes,
+		estimate,
 	)
 	return mailer.Mailer{
 		Sender:          MailSales,
@@ -75,6 +75,7 @@ A new KubeDB sales QA result has been submitted with the following details:
 - Distro: %s (%s)
 - Verdict: %s
 - Verdict Text: %s
+- Lead Score: %d
 - Hot: %d
 - Warm: %d
 - Cold: %d
@@ -97,6 +98,7 @@ KubeDB Sales QA System
 		info.Distro,
 		info.Verdict,
 		info.VerdictText,
+		info.LeadScore,
 		info.HotCount,
 		info.WarmCount,
 		info.ColdCount,
@@ -17,52 +17,41 @@ limitations under the License.
 package server
 
 import (
-	"fmt"
-
 	"gomodules.xyz/cert"
 	"gomodules.xyz/mailer"
 )
 
-func NewLicenseMailer(info LicenseMailData) mailer.Mailer {
-	var fromTimestamp, toTimeStamp string
+// licenseMailParams are the params of the license and enterprise-license templates.
+type licenseMailParams struct {
+	LicenseMailData
+	ProductDisplayName string
+	ValidFrom          string
+	ValidTo            string
+}
+
+func newLicenseMailParams(info LicenseMailData) licenseMailParams {
+	params := licenseMailParams{
+		LicenseMailData:    info,
+		ProductDisplayName: catalog.Plan(info.Product()).DisplayName,
+	}
 	crts, err := cert.ParseCertsPEM([]byte(info.License))
 	if err != nil {
-		fromTimestamp = err.Error()
-		toTimeStamp = err.Error()
+		params.ValidFrom = err.Error()
+		params.ValidTo = err.Error()
 	} else {
 		for _, crt := range crts {
-			fromTimestamp = crt.NotBefore.UTC().Format("02 Jan, 2006")
-			toTimeStamp = crt.NotAfter.UTC().Format("02 Jan, 2006")
+			params.ValidFrom = crt.NotBefore.UTC().Format("02 Jan, 2006")
+			params.ValidTo = crt.NotAfter.UTC().Format("02 Jan, 2006")
 			break
 		}
 	}
-	displayName := SupportedProducts[info.Product()].DisplayName
-
-	src := fmt.Sprintf(`Hi {{.Name}},
-Thanks for your interest in %s. The license for Kubernetes cluster {{.Cluster}} is attached with this email.
-
-Valid From: %s
-Valid To: %s
-
-%s
-{{ .License | trim }}
-%s
-
-Please let us know if you have any questions.
-
-Regards,
-Team AppsCode
-
-[![Website](https://cdn.appscode.com/images/website.png)](https://appscode.com) [![Linkedin](https://cdn.appscode.com/images/ln.png)](https://www.linkedin.com/company/appscode/) [![X](https://cdn.appscode.com/images/tt.png)](https://x.com/AppsCodeHQ) [![Youtube](https://cdn.appscode.com/images/yt.png)](https://www.youtube.com/@appscode)
-`, displayName, fromTimestamp, toTimeStamp, "```", "```")
+	return params
+}
 
-	return mailer.Mailer{
-		Sender:          MailLicenseSender,
-		BCC:             MailLicenseTracker,
-		ReplyTo:         MailSupport,
-		Subject:         fmt.Sprintf("%s License for cluster %s", displayName, info.Cluster),
-		Body:            src,
-		Params:          info,
-		AttachmentBytes: nil,
-	}
+func NewLicenseMailer(info LicenseMailData) mailer.Mailer {
+	m := localizedMailer(MailTemplateLicense, info.Locale, newLicenseMailParams(info))
+	m.Sender = MailLicenseSender
+	m.BCC = MailLicenseTracker
+	m.ReplyTo = MailSupport
+	return m
 }
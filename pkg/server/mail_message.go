@@ -0,0 +1,191 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+
+	"gomodules.xyz/email"
+	"gomodules.xyz/mailer"
+	"google.golang.org/api/drive/v3"
+	"k8s.io/klog/v2"
+)
+
+// EmailArgs is a rendered message waiting in the outbox. Google Drive files are
+// exported when the message is delivered.
+type EmailArgs struct {
+	To           string            `json:"to"`
+	CC           string            `json:"cc,omitempty"`
+	From         string            `json:"from"`
+	BCC          string            `json:"bcc,omitempty"`
+	ReplyTo      string            `json:"replyTo,omitempty"`
+	Subject      string            `json:"subject"`
+	Text         string            `json:"text"`
+	HTML         string            `json:"html"`
+	Attachments  map[string][]byte `json:"attachments,omitempty"`
+	GoogleDocIds map[string]string `json:"googleDocIds,omitempty"`
+	GDriveFiles  map[string]string `json:"gdriveFiles,omitempty"`
+}
+
+// NewEmailArgs renders m for the recipient, like mailer.SendMail does before sending.
+// The HTML part is wrapped in the layout of the mail templates.
+func NewEmailArgs(m mailer.Mailer, to, cc string) (*EmailArgs, error) {
+	subject, bodyText, bodyHtml, err := m.Render()
+	if err != nil {
+		return nil, err
+	}
+	if bodyHtml != "" {
+		bodyHtml, err = CurrentMailTemplates().Layout(subject, bodyHtml)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &EmailArgs{
+		To:           to,
+		CC:           cc,
+		From:         m.Sender,
+		BCC:          m.BCC,
+		ReplyTo:      m.ReplyTo,
+		Subject:      subject,
+		Text:         bodyText,
+		HTML:         bodyHtml,
+		Attachments:  m.AttachmentBytes,
+		GoogleDocIds: m.GoogleDocIds,
+		GDriveFiles:  m.GDriveFiles,
+	}, nil
+}
+
+// Message returns the message with the attached bytes. Google Drive files are not
+// attached, since exporting them requires a Drive client.
+func (a *EmailArgs) Message() (*email.Email, error) {
+	msg := email.NewEmail()
+	msg.From = a.From
+	msg.To = []string{a.To}
+	msg.Subject = a.Subject
+	msg.Text = []byte(a.Text)
+	msg.HTML = []byte(a.HTML)
+	msg.Cc = splitEmails(a.CC)
+	msg.Bcc = splitEmails(a.BCC)
+	if a.ReplyTo != "" {
+		msg.ReplyTo = []string{a.ReplyTo}
+	}
+	for filename, data := range a.Attachments {
+		if _, err := msg.Attach(bytes.NewReader(data), filename, attachmentContentType(filename, data)); err != nil {
+			return nil, fmt.Errorf("failed to attach file %q: %w", filename, err)
+		}
+	}
+	return msg, nil
+}
+
+func splitEmails(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// attachmentContentType sniffs the content type, except for calendar files, which
+// mail clients only offer to import as text/calendar.
+func attachmentContentType(filename string, data []byte) string {
+	if strings.EqualFold(filepath.Ext(filename), ".ics") {
+		return "text/calendar; charset=utf-8; method=PUBLISH"
+	}
+	return http.DetectContentType(data)
+}
+
+// newMailerEmail renders m for the recipient without the Google Drive files.
+func newMailerEmail(m mailer.Mailer, to string) (*email.Email, error) {
+	args, err := NewEmailArgs(m, to, "")
+	if err != nil {
+		return nil, err
+	}
+	return args.Message()
+}
+
+// sendMail renders m and queues it in the outbox, so an SMTP outage delays the email
+// instead of failing the request. Template errors are returned right away.
+func (s *Server) sendMail(m mailer.Mailer, to, cc string) error {
+	args, err := NewEmailArgs(m, to, cc)
+	if err != nil {
+		return err
+	}
+	return s.enqueueOutbox(OutboxEmail, fmt.Sprintf("email %q to %s", args.Subject, to), args)
+}
+
+// SendMail renders m and sends it right away, like mailer.SendMail. Google Drive
+// files are exported with srvDrive.
+func SendMail(t mailtransport.Interface, m mailer.Mailer, to, cc string, srvDrive *drive.Service) error {
+	args, err := NewEmailArgs(m, to, cc)
+	if err != nil {
+		return err
+	}
+	return DeliverEmail(t, *args, srvDrive)
+}
+
+// DeliverEmail sends a rendered email. Google Drive files are exported with srvDrive
+// on every attempt.
+func DeliverEmail(t mailtransport.Interface, args EmailArgs, srvDrive *drive.Service) error {
+	msg, err := args.Message()
+	if err != nil {
+		return err
+	}
+
+	if len(args.GoogleDocIds) > 0 || len(args.GDriveFiles) > 0 {
+		if srvDrive == nil {
+			return fmt.Errorf("email %q has Google Drive attachments, but no Drive client is configured", args.Subject)
+		}
+		dir, err := os.MkdirTemp("", "outbox-email-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				klog.Warningln(err)
+			}
+		}()
+
+		attach := func(files map[string]string, fetch func(*drive.Service, string, string) error) error {
+			for f, id := range files {
+				filename := filepath.Join(dir, f)
+				if err := fetch(srvDrive, id, filename); err != nil {
+					return err
+				}
+				if _, err := msg.AttachFile(filename); err != nil {
+					return fmt.Errorf("failed to attach file %q: %w", filename, err)
+				}
+			}
+			return nil
+		}
+		if err := attach(args.GoogleDocIds, mailer.ExportPDF); err != nil {
+			return err
+		}
+		if err := attach(args.GDriveFiles, mailer.DownloadFile); err != nil {
+			return err
+		}
+	}
+	return t.Send(msg)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"gomodules.xyz/mailer"
+)
+
+func TestEmailArgs(t *testing.T) {
+	m := mailer.Mailer{
+		Sender:  "license-issuer@appscode.com",
+		BCC:     "tracker@appscode.com",
+		ReplyTo: "support@appscode.com",
+		Subject: "License for {{.Name}}",
+		Body:    "Hi {{.Name}},",
+		Params: struct {
+			Name string
+		}{"Jane"},
+		AttachmentBytes: map[string][]byte{"license.txt": []byte("-----BEGIN CERTIFICATE-----")},
+		GoogleDocIds:    map[string]string{"quote.pdf": "doc-id"},
+	}
+	args, err := server.NewEmailArgs(m, "jane@example.com", "a@example.com, b@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Subject != "License for Jane" || !strings.Contains(args.Text, "Hi Jane,") {
+		t.Errorf("expected rendered subject and body, found %q and %q", args.Subject, args.Text)
+	}
+
+	// queued emails are stored as json in the outbox
+	data, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued server.EmailArgs
+	if err := json.Unmarshal(data, &queued); err != nil {
+		t.Fatal(err)
+	}
+	if string(queued.Attachments["license.txt"]) != "-----BEGIN CERTIFICATE-----" || queued.GoogleDocIds["quote.pdf"] != "doc-id" {
+		t.Errorf("expected attachments to survive the outbox, found %+v", queued)
+	}
+
+	msg, err := queued.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Cc) != 2 || msg.Cc[1] != "b@example.com" {
+		t.Errorf("expected 2 cc recipients, found %v", msg.Cc)
+	}
+	if len(msg.Bcc) != 1 || len(msg.ReplyTo) != 1 || len(msg.Attachments) != 1 {
+		t.Errorf("expected bcc, reply-to and 1 attachment, found %v, %v and %d attachments", msg.Bcc, msg.ReplyTo, len(msg.Attachments))
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	dir := t.TempDir()
+	mt, err := mailtransport.NewMaildir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := server.NewRegistrationMailer(struct {
+		Token string
+	}{"token"})
+	if err := server.SendMail(mt, m, "jane@example.com", "john@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := mailtransport.ReadMaildir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || len(msgs[0].Cc) != 1 || !strings.Contains(string(msgs[0].Text), "token") {
+		t.Fatalf("expected the rendered registration email, found %d messages", len(msgs))
+	}
+
+	m.GoogleDocIds = map[string]string{"quote.pdf": "doc-id"}
+	if err := server.SendMail(mt, m, "jane@example.com", "", nil); err == nil {
+		t.Error("expected Google Drive attachments to require a Drive client")
+	}
+}
@@ -50,3 +50,23 @@ Offer Letter Generator
 		GDriveFiles:     nil,
 	}
 }
+
+func NewOfferLetterBatchMailer(results []OfferLetterResult) mailer.Mailer {
+	src := fmt.Sprintf(`Hi,
+Offer letters have been generated from the uploaded candidate list:
+
+%s
+Regards,
+Offer Letter Generator
+`, "```\n"+FormatOfferLetterReport(results)+"```\n")
+	return mailer.Mailer{
+		Sender:          MailHR,
+		BCC:             "",
+		ReplyTo:         MailHR,
+		Subject:         fmt.Sprintf("Offer letters generated for %d candidates", len(results)),
+		Body:            src,
+		Params:          nil,
+		AttachmentBytes: nil,
+		GDriveFiles:     nil,
+	}
+}
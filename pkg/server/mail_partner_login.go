@@ -0,0 +1,46 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+
+	"gomodules.xyz/mailer"
+)
+
+func NewPartnerLoginMailer(link string) mailer.Mailer {
+	src := fmt.Sprintf(`Hi,
+Use the link below to sign in to the AppsCode partner portal. The link is valid for %d minutes.
+
+%s
+
+If you did not request this email, you can safely ignore it.
+
+Regards,
+AppsCode Partner Team
+`, int(PartnerLoginLinkValidity.Minutes()), link)
+	return mailer.Mailer{
+		Sender:          MailSales,
+		BCC:             "",
+		ReplyTo:         MailSales,
+		Subject:         "Sign in to the AppsCode partner portal",
+		Body:            src,
+		Params:          nil,
+		AttachmentBytes: nil,
+		GDriveFiles:     nil,
+	}
+}
@@ -0,0 +1,569 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+
+	"github.com/go-macaron/auth"
+	"gomodules.xyz/cert"
+	"gomodules.xyz/email"
+	"gomodules.xyz/mailer"
+	"gopkg.in/macaron.v1"
+)
+
+// Mail previews render mailers with fixture data, so templates can be reviewed
+// without issuing a license, generating a quotation or waiting for a drip campaign.
+// Fixture links carry an invalid signature and never act on a real address.
+const (
+	MailPreviewRecipient = "jane.doe@example.com"
+	mailPreviewBaseURL   = "https://license-issuer.appscode.com"
+	mailPreviewDripRoot  = "drip"
+)
+
+type mailPreviewFixture struct {
+	Description string
+	New         func(locale string) (mailer.Mailer, error)
+}
+
+var mailPreviews = map[string]mailPreviewFixture{
+	"license": {
+		Description: "Community license issued from the license form",
+		New: func(locale string) (mailer.Mailer, error) {
+			info, err := previewLicenseMailData("kubedb-community", locale)
+			if err != nil {
+				return mailer.Mailer{}, err
+			}
+			return NewLicenseMailer(info), nil
+		},
+	},
+	"enterprise-license": {
+		Description: "Enterprise license issued by the sales team",
+		New: func(locale string) (mailer.Mailer, error) {
+			info, err := previewLicenseMailData("kubedb-enterprise", locale)
+			if err != nil {
+				return mailer.Mailer{}, err
+			}
+			return NewEnterpriseLicenseMailer(info), nil
+		},
+	},
+	"blocked-license": {
+		Description: "Notice to sales about a blocked license request",
+		New: func(locale string) (mailer.Mailer, error) {
+			info, err := previewLicenseMailData("kubedb-enterprise", locale)
+			if err != nil {
+				return mailer.Mailer{}, err
+			}
+			return NewBlockedLicenseMailer(info), nil
+		},
+	},
+	"welcome": {
+		Description: "Welcome email sent with the first license",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewWelcomeMailer(previewLicenseForm("kubedb-community", locale)), nil
+		},
+	},
+	"registration": {
+		Description: "License server token sent after registration",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewRegistrationMailer(struct {
+				Token string
+			}{
+				"00000000-0000-0000-0000-000000000000",
+			}), nil
+		},
+	},
+	"quotation": {
+		Description: "Quotation sent from the quotation form",
+		New: func(locale string) (mailer.Mailer, error) {
+			info, err := CurrentCatalog().QuotationMailer("kubedb-ent")
+			if err != nil {
+				return mailer.Mailer{}, err
+			}
+			return NewQuotationMailer(QuotationEmailData{
+				ProductQuotation: previewProductQuotation("kubedb-ent"),
+				Offer:            info.Offer,
+				FullPlan:         info.FullPlan,
+				Plan:             info.Plan,
+				AcceptLink:       previewLink("/_/quotations/AC-PREVIEW/accept"),
+			}), nil
+		},
+	},
+	"quotation-process-failed": {
+		Description: "Notice to sales about a failed quotation job",
+		New: func(locale string) (mailer.Mailer, error) {
+			now := time.Now()
+			return NewQuotationProcessFailedMailer(&QuotationJob{
+				ID:     "preview",
+				Status: JobFailed,
+				Form: QuotationForm{
+					Name:      "Jane Doe",
+					Email:     MailPreviewRecipient,
+					Title:     "CTO",
+					Telephone: "+1 555 0100",
+					Product:   []string{"kubedb-ent"},
+					Company:   "Example Inc.",
+					Tos:       "true",
+				},
+				UserAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+				Attempts:  quotationJobMaxAttempts,
+				LastError: "googleapi: Error 503: The service is currently unavailable.",
+				CreatedAt: now,
+				UpdatedAt: now,
+			}), nil
+		},
+	},
+	"deal-registration": {
+		Description: "Notice to sales about a new partner deal registration",
+		New: func(locale string) (mailer.Mailer, error) {
+			r := NewDealRegistration(previewDealRegistrationInfo(), time.Now())
+			return NewDealRegistrationMailer(r, previewLink("/_/deal_registrations/"+r.ID)), nil
+		},
+	},
+	"deal-registration-status": {
+		Description: "Approval of a deal registration sent to the partner",
+		New: func(locale string) (mailer.Mailer, error) {
+			r := NewDealRegistration(previewDealRegistrationInfo(), time.Now())
+			r.Status = DealApproved
+			return NewDealRegistrationStatusMailer(r), nil
+		},
+	},
+	"eula": {
+		Description: "Notice to sales about a generated EULA",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewEULAMailer(&EULAInfo{
+				Company:     "Example Inc.",
+				Domain:      "example.com",
+				Address:     "1 Example Way, Springfield",
+				Quotation:   "AC-PREVIEW",
+				Product:     "KubeDB",
+				PaymentTerm: "Net 30",
+				SupportPlan: "Standard",
+				TermYears:   1,
+				EULADocLink: "https://docs.google.com/document/d/preview/edit",
+				PreparedOn:  NewOfferOfferDate(time.Now()),
+			}), nil
+		},
+	},
+	"kubedb-inquiry": {
+		Description: "Notice to sales about a KubeDB inquiry",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewKubeDBInquiryMailer(&KubeDBInquiryInfo{
+				CustomerName:            "Jane Doe",
+				CustomerEmail:           MailPreviewRecipient,
+				CustomerCompany:         "Example Inc.",
+				CustomerPhone:           "+1 555 0100",
+				CustomerAddress:         "1 Example Way, Springfield",
+				CustomerCountry:         "United States",
+				EstimatedDatabaseMemory: "64GB",
+				KubernetesSetup:         "EKS",
+				SupportPlan:             "Standard",
+				ProjectTimeline:         "This quarter",
+				ProfessionalServices:    "No",
+				RegisteredOn:            NewOfferOfferDate(time.Now()),
+			}, nil, previewLink("/_/kubedb_inquiries/preview")), nil
+		},
+	},
+	"partner-login": {
+		Description: "Partner portal login link",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewPartnerLoginMailer(previewLink("/_/partners/login")), nil
+		},
+	},
+	"signature-request": {
+		Description: "Request to sign a quotation or offer letter",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewSignatureRequestMailer(&SignatureRequest{
+				ID:        "preview",
+				Kind:      SignatureEULA,
+				Reference: "AC-PREVIEW",
+				DocName:   "Example Inc. EULA",
+				Signer:    Signer{Name: "Jane Doe", Email: MailPreviewRecipient},
+				Sender:    MailSales,
+				Status:    SignaturePending,
+				CreatedAt: time.Now(),
+			}, previewLink("/_/signatures/preview")), nil
+		},
+	},
+	"webinar-confirmation": {
+		Description: "Webinar registration confirmation with the calendar invite",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewWebinarConfirmationMailer(previewWebinarRegistration()), nil
+		},
+	},
+	"webinar-reminder": {
+		Description: "Webinar reminder sent 1 hour before the session",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewWebinarReminderMailer(previewWebinarRegistration(), time.Hour), nil
+		},
+	},
+	"webinar-recording": {
+		Description: "Recording and slides sent to webinar attendees",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewWebinarRecordingMailer(previewWebinarFollowUpMailData()), nil
+		},
+	},
+	"webinar-missed": {
+		Description: "Recording sent to webinar registrants who did not attend",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewWebinarMissedMailer(previewWebinarFollowUpMailData()), nil
+		},
+	},
+	"test-started": {
+		Description: "Notice to HR that a candidate started a test",
+		New: func(locale string) (mailer.Mailer, error) {
+			return NewTestStartedMailer("Go Developer", &TestAnswer{
+				Email: MailPreviewRecipient,
+				DocId: "preview",
+			}), nil
+		},
+	},
+}
+
+// MailPreview is a rendered preview of a mailer or a drip campaign step.
+type MailPreview struct {
+	Name    string
+	Subject string
+	Text    string
+	HTML    string
+	// Attachments lists the attached files. Files exported from Google Drive
+	// when the mail is sent are listed but not attached.
+	Attachments []string
+
+	msg *email.Email
+}
+
+type MailPreviewInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// MailPreviews lists the mailers and the steps of the current drip campaigns
+// that can be previewed. Drip steps are named drip/<campaign>/<step>.
+func MailPreviews() []MailPreviewInfo {
+	out := make([]MailPreviewInfo, 0, len(mailPreviews))
+	for name, p := range mailPreviews {
+		out = append(out, MailPreviewInfo{Name: name, Description: p.Description})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	d := CurrentDripCampaigns()
+	for i := range d.Campaigns {
+		dc := &d.Campaigns[i]
+		for j, step := range d.Steps(dc) {
+			out = append(out, MailPreviewInfo{
+				Name:        fmt.Sprintf("%s/%s/%d", mailPreviewDripRoot, dc.Name, j+1),
+				Description: fmt.Sprintf("%s step %d: %s", dc.Title, j+1, step.Subject),
+			})
+		}
+	}
+	return out
+}
+
+// PreviewMail renders the named mailer or drip campaign step with fixture data in
+// the locale. Mailers without a translation for the locale are rendered in English.
+func PreviewMail(name, locale string) (*MailPreview, error) {
+	var attachments []string
+	var msg *email.Email
+	if strings.HasPrefix(name, mailPreviewDripRoot+"/") {
+		var err error
+		msg, err = previewDripStep(name, locale)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p, ok := mailPreviews[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown mail preview %q", name)
+		}
+		m, err := p.New(locale)
+		if err != nil {
+			return nil, err
+		}
+		msg, err = previewMailerEmail(m)
+		if err != nil {
+			return nil, err
+		}
+		for f := range m.GoogleDocIds {
+			attachments = append(attachments, f)
+		}
+		for f := range m.GDriveFiles {
+			attachments = append(attachments, f)
+		}
+	}
+	for _, a := range msg.Attachments {
+		attachments = append(attachments, a.Filename)
+	}
+	sort.Strings(attachments)
+
+	return &MailPreview{
+		Name:        name,
+		Subject:     msg.Subject,
+		Text:        string(msg.Text),
+		HTML:        string(msg.HTML),
+		Attachments: attachments,
+		msg:         msg,
+	}, nil
+}
+
+// previewMailerEmail recovers from template syntax errors, since mailer.Mailer panics on them.
+func previewMailerEmail(m mailer.Mailer) (msg *email.Email, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid template: %v", r)
+		}
+	}()
+	return newMailerEmail(m, MailPreviewRecipient)
+}
+
+func previewDripStep(name, locale string) (msg *email.Email, err error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("drip campaign step must be named %s/<campaign>/<step>, found %q", mailPreviewDripRoot, name)
+	}
+	d := CurrentDripCampaigns()
+	cfg := d.campaign(parts[1])
+	if cfg == nil {
+		return nil, fmt.Errorf("unknown drip campaign %q", parts[1])
+	}
+	dc := d.DripCampaign(cfg, nil)
+	i, err := strconv.Atoi(parts[2])
+	if err != nil || i < 1 || i > len(dc.Steps) {
+		return nil, fmt.Errorf("drip campaign %s has no step %q", cfg.Name, parts[2])
+	}
+
+	sample := sampleSignupCampaignData(cfg.Conditions.Edition == DripEditionEnterprise)
+	sample.Locale = locale
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]any{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid template: %v", r)
+		}
+	}()
+	return newDripEmail(localizedDripStep(dc, i-1, params), MailPreviewRecipient, params,
+		previewLink("/_/email/preferences/"+MailPreviewRecipient),
+		previewLink("/_/email/unsubscribe/"+MailPreviewRecipient))
+}
+
+// EML returns the message in RFC 5322 format, as it would be sent to MailPreviewRecipient.
+func (p *MailPreview) EML() ([]byte, error) {
+	return p.msg.Bytes()
+}
+
+// Send sends the preview to a test address. The subject is marked as a preview and
+// the BCC recipients of the mailer are dropped, so trackers are not notified.
+func (p *MailPreview) Send(t mailtransport.Interface, to string) error {
+	msg := *p.msg
+	msg.To = []string{to}
+	msg.Cc = nil
+	msg.Bcc = nil
+	msg.Subject = "[Preview] " + p.msg.Subject
+	return t.Send(&msg)
+}
+
+func previewLink(path string) string {
+	return mailPreviewBaseURL + path + "?sig=preview"
+}
+
+func previewLicenseForm(alias, locale string) LicenseForm {
+	return LicenseForm{
+		Name:         "Jane Doe",
+		Email:        MailPreviewRecipient,
+		ProductAlias: alias,
+		Cluster:      "00000000-0000-0000-0000-000000000000",
+		Tos:          "true",
+		Locale:       locale,
+	}
+}
+
+// previewLicenseMailData signs a throwaway certificate, so the validity shown in
+// the license mailers is realistic.
+func previewLicenseMailData(alias, locale string) (LicenseMailData, error) {
+	key, err := cert.NewPrivateKey()
+	if err != nil {
+		return LicenseMailData{}, err
+	}
+	crt, err := cert.NewSelfSignedCACert(cert.Config{
+		CommonName:   CurrentCatalog().PlanForAlias(alias),
+		Organization: []string{"AppsCode"},
+	}, key)
+	if err != nil {
+		return LicenseMailData{}, err
+	}
+	return LicenseMailData{
+		LicenseForm: previewLicenseForm(alias, locale),
+		License:     string(cert.EncodeCertPEM(crt)),
+	}, nil
+}
+
+func previewProductQuotation(product string) ProductQuotation {
+	return ProductQuotation{
+		Name:      "Jane Doe",
+		Email:     MailPreviewRecipient,
+		Title:     "CTO",
+		Telephone: "+1 555 0100",
+		Product:   product,
+		Company:   "Example Inc.",
+	}
+}
+
+func previewDealRegistrationInfo() DealRegistrationInfo {
+	return DealRegistrationInfo{
+		PartnerName:     "John Roe",
+		PartnerEmail:    "john.roe@partner.example.com",
+		PartnerCompany:  "Partner LLC",
+		Region:          "North America",
+		CustomerName:    "Jane Doe",
+		CustomerEmail:   MailPreviewRecipient,
+		CustomerCompany: "Example Inc.",
+		CustomerPhone:   "+1 555 0100",
+		CustomerAddress: "1 Example Way, Springfield",
+		CustomerCountry: "United States",
+		Product:         "KubeDB",
+		KubernetesSetup: "EKS",
+		ProjectTimeline: "This quarter",
+	}
+}
+
+func previewWebinarRegistration() WebinarRegistration {
+	return WebinarRegistration{
+		Email:    MailPreviewRecipient,
+		Name:     "Jane Doe",
+		Title:    "Run Production-Grade Databases on Kubernetes",
+		Summary:  "<p>Learn how KubeDB provisions, backs up and upgrades databases on Kubernetes.</p>",
+		Schedule: time.Now().Add(7 * 24 * time.Hour).Truncate(time.Hour),
+		Timezone: "America/New_York",
+		Meeting: WebinarMeetingID{
+			ZoomMeetingID:       81234567890,
+			ZoomMeetingPassword: "preview",
+		},
+	}
+}
+
+func previewWebinarFollowUpMailData() WebinarFollowUpMailData {
+	return WebinarFollowUpMailData{
+		Name:          "Jane Doe",
+		Title:         "Run Production-Grade Databases on Kubernetes",
+		RecordingLink: "https://www.youtube.com/watch?v=preview",
+		SlidesLink:    "https://docs.google.com/presentation/d/preview",
+	}
+}
+
+func (s *Server) RegisterMailPreviewAPI(m *macaron.Macaron) {
+	salesAuth := auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD"))
+
+	index := func(ctx *macaron.Context) {
+		ctx.Data["Recipient"] = MailPreviewRecipient
+		ctx.Data["Previews"] = MailPreviews()
+		ctx.Data["Locales"] = MailLocaleOptions()
+		ctx.Data["Locale"] = mailPreviewLocale(ctx)
+		ctx.HTML(http.StatusOK, "mail_preview")
+	}
+	m.Get("/_/mail-preview", salesAuth, index)
+
+	m.Get("/_/mail-preview/*", salesAuth, func(ctx *macaron.Context) {
+		name := ctx.Params("*")
+		if name == "" {
+			index(ctx)
+			return
+		}
+		p, err := PreviewMail(name, mailPreviewLocale(ctx))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		switch format := ctx.Query("format"); format {
+		case "", "html":
+			ctx.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+			respond(ctx, []byte(p.HTML))
+		case "text":
+			ctx.Resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			respond(ctx, []byte(p.Text))
+		case "eml":
+			data, err := p.EML()
+			if err != nil {
+				ctx.WriteHeader(http.StatusInternalServerError)
+				respond(ctx, []byte(err.Error()))
+				return
+			}
+			ctx.Resp.Header().Set("Content-Type", "message/rfc822")
+			ctx.Resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", MailPreviewFilename(name, "eml")))
+			respond(ctx, data)
+		default:
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(fmt.Sprintf("unknown format %q, use html, text or eml", format)))
+		}
+	})
+
+	m.Post("/_/mail-preview/*", salesAuth, func(ctx *macaron.Context) {
+		name := ctx.Params("*")
+		to := strings.TrimSpace(ctx.Query("to"))
+		ctx.Data["Recipient"] = MailPreviewRecipient
+		ctx.Data["Previews"] = MailPreviews()
+		ctx.Data["Locales"] = MailLocaleOptions()
+		ctx.Data["Locale"] = mailPreviewLocale(ctx)
+		if to == "" {
+			ctx.Data["Err"] = "missing test address"
+			ctx.HTML(http.StatusBadRequest, "mail_preview")
+			return
+		}
+		p, err := PreviewMail(name, mailPreviewLocale(ctx))
+		if err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusNotFound, "mail_preview")
+			return
+		}
+		if err := p.Send(s.mt, to); err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusInternalServerError, "mail_preview")
+			return
+		}
+		ctx.Data["Sent"] = name
+		ctx.Data["To"] = to
+		ctx.HTML(http.StatusOK, "mail_preview")
+	})
+}
+
+func mailPreviewLocale(ctx *macaron.Context) string {
+	if locale := ctx.Query("locale"); locale != "" {
+		return locale
+	}
+	return DefaultMailLocale
+}
+
+// MailPreviewFilename returns the file name used to store a rendered preview.
+func MailPreviewFilename(name, ext string) string {
+	return strings.ReplaceAll(name, "/", "-") + "." + ext
+}
@@ -0,0 +1,76 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestPreviewMail(t *testing.T) {
+	for _, info := range server.MailPreviews() {
+		p, err := server.PreviewMail(info.Name, server.DefaultMailLocale)
+		if err != nil {
+			t.Errorf("%s: %v", info.Name, err)
+			continue
+		}
+		if p.Subject == "" || p.Text == "" || p.HTML == "" {
+			t.Errorf("%s: expected subject, text and html to be rendered", info.Name)
+		}
+		eml, err := p.EML()
+		if err != nil {
+			t.Errorf("%s: %v", info.Name, err)
+			continue
+		}
+		if !strings.Contains(string(eml), server.MailPreviewRecipient) {
+			t.Errorf("%s: expected eml to be addressed to %s", info.Name, server.MailPreviewRecipient)
+		}
+	}
+}
+
+func TestPreviewMailDripStep(t *testing.T) {
+	p, err := server.PreviewMail("drip/community-signup/1", server.DefaultMailLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(p.Text, "unsubscribe") {
+		t.Error("expected drip step to include the preference footer")
+	}
+	eml, err := p.EML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(eml), "List-Unsubscribe-Post: List-Unsubscribe=One-Click") {
+		t.Error("expected drip step to carry the one-click unsubscribe header")
+	}
+}
+
+func TestPreviewMailUnknown(t *testing.T) {
+	for _, name := range []string{"unknown", "drip/unknown/1", "drip/community-signup/0", "drip/community-signup/99", "drip/community-signup"} {
+		if _, err := server.PreviewMail(name, server.DefaultMailLocale); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestMailPreviewFilename(t *testing.T) {
+	if f := server.MailPreviewFilename("drip/community-signup/1", "eml"); f != "drip-community-signup-1.eml" {
+		t.Errorf("unexpected filename %s", f)
+	}
+}
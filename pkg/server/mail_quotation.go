@@ -27,6 +27,8 @@ type QuotationEmailData struct {
 	Offer    string // KubeDB, Stash
 	FullPlan string // Pay-As-You-Go (PAYG), Enterprise
 	Plan     string // PAYG, Enterprise
+
+	AcceptLink string
 }
 
 func NewQuotationMailer(info QuotationEmailData) mailer.Mailer {
@@ -39,6 +41,10 @@ Thanks for your interest in licensing {{.Offer}}.
 2. {{.Offer}} {{.Plan}} comes with a 30 day free trial. So, you don't need to purchase a license for ephemeral Kubernetes clusters (typically found in Dev or CI/CD environments).
 
 3. The various support options are detailed in the attached quotation. We offer Standard and Premium support plans with our {{.Plan}} license.
+{{- if .AcceptLink }}
+
+4. Once you are ready to move forward, please [accept this quotation]({{ .AcceptLink }}). We will prepare the license agreement for your review right away.
+{{- end }}
 
 If you have any questions or concerns, please do not hesitate to contact us. If you have any technical questions, someone from our product team will get back to you.
 
@@ -24,19 +24,25 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
-func NewQuotationProcessFailedMailer(gen *QuotationGenerator, err error) mailer.Mailer {
+func NewQuotationProcessFailedMailer(job *QuotationJob) mailer.Mailer {
 	var src string
 
 	info := struct {
-		Contact  ProductQuotation    `json:"contact"`
-		UA       *uasurfer.UserAgent `json:"ua"`
-		Location GeoLocation         `json:"location"`
-		Err      string              `json:"error"`
+		Job      string               `json:"job"`
+		Contact  QuotationForm        `json:"contact"`
+		UA       *uasurfer.UserAgent  `json:"ua"`
+		Location GeoLocation          `json:"location"`
+		Attempts int                  `json:"attempts"`
+		Results  []QuotationJobResult `json:"results"`
+		Err      string               `json:"error"`
 	}{
-		Contact:  gen.Contact,
-		UA:       gen.UA,
-		Location: gen.Location,
-		Err:      err.Error(),
+		Job:      job.ID,
+		Contact:  job.Form,
+		UA:       uasurfer.Parse(job.UserAgent),
+		Location: job.Location,
+		Attempts: job.Attempts,
+		Results:  job.Results,
+		Err:      job.LastError,
 	}
 	data, err := yaml.Marshal(info)
 	if err != nil {
@@ -0,0 +1,77 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+
+	"gomodules.xyz/mailer"
+	"sigs.k8s.io/yaml"
+)
+
+func NewSignatureRequestMailer(r *SignatureRequest, link string) mailer.Mailer {
+	src := fmt.Sprintf(`Hi %s,
+Please review and sign %s using the link below:
+
+%s
+
+Once signed, you will receive a finalized copy by email.
+
+Regards,
+AppsCode
+`, r.Signer.Name, r.DocName, link)
+	return mailer.Mailer{
+		Sender:          r.Sender,
+		BCC:             r.Sender,
+		ReplyTo:         r.Sender,
+		Subject:         fmt.Sprintf("Signature requested: %s", r.DocName),
+		Body:            src,
+		Params:          nil,
+		AttachmentBytes: nil,
+		GDriveFiles:     nil,
+	}
+}
+
+func NewSignedDocumentMailer(r *SignatureRequest, doc []byte) mailer.Mailer {
+	data, err := yaml.Marshal(r.Evidence)
+	if err != nil {
+		data = []byte("Error: " + err.Error()) // nolint:goconst
+	}
+
+	src := fmt.Sprintf(`Hi,
+%s has been signed by %s <%s>. The finalized copy is attached.
+
+Signature record:
+
+%s
+
+Regards,
+AppsCode
+`, r.DocName, r.Evidence.TypedName, r.Evidence.Email, string(data))
+	return mailer.Mailer{
+		Sender:  r.Sender,
+		BCC:     "",
+		ReplyTo: r.Sender,
+		Subject: fmt.Sprintf("Signed: %s", r.DocName),
+		Body:    src,
+		Params:  nil,
+		AttachmentBytes: map[string][]byte{
+			r.Filename(): doc,
+		},
+		GDriveFiles: nil,
+	}
+}
@@ -0,0 +1,349 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	mailtemplatesfs "go.bytebuilders.dev/offline-license-server/mailtemplates"
+
+	"github.com/Masterminds/sprig/v3"
+	"golang.org/x/text/language"
+	"gomodules.xyz/mailer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultMailLocale is used when no template exists for the locale of a recipient.
+// Every mail template must have a DefaultMailLocale version.
+const DefaultMailLocale = "en"
+
+const (
+	MailTemplateLicense           = "license"
+	MailTemplateEnterpriseLicense = "enterprise-license"
+	MailTemplateWelcome           = "welcome"
+
+	mailTemplateExt    = ".md"
+	mailTemplateLayout = "layout.html"
+)
+
+// requiredMailTemplates are used by the mailers, so an override directory can't drop them.
+var requiredMailTemplates = []string{
+	MailTemplateLicense,
+	MailTemplateEnterpriseLicense,
+	MailTemplateWelcome,
+}
+
+// MailTemplate is a localized mailer read from <name>.<locale>.md. The file starts
+// with a YAML front matter holding the subject, followed by the markdown body.
+// Both are Go templates.
+type MailTemplate struct {
+	Name    string `json:"-"`
+	Locale  string `json:"-"`
+	Subject string `json:"subject"`
+	Body    string `json:"-"`
+}
+
+// MailTemplates are the embedded mail templates, optionally overridden by the files
+// of a directory. The HTML part of every email is wrapped in the layout.
+type MailTemplates struct {
+	templates map[string]map[string]*MailTemplate
+	layout    *htmltemplate.Template
+}
+
+// mailTemplates is replaced by UseMailTemplatesDir when the server starts.
+var mailTemplates = MustLoadDefaultMailTemplates()
+
+func CurrentMailTemplates() *MailTemplates {
+	return mailTemplates
+}
+
+// UseMailTemplatesDir loads the embedded templates overridden by the files in dir and
+// makes them the current mail templates. An empty dir keeps the embedded templates.
+func UseMailTemplatesDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	t, err := LoadMailTemplates(dir)
+	if err != nil {
+		return err
+	}
+	mailTemplates = t
+	return nil
+}
+
+func MustLoadDefaultMailTemplates() *MailTemplates {
+	t, err := LoadMailTemplates("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// LoadMailTemplates reads the embedded templates and the files in dir. A file in dir
+// replaces the embedded file with the same name.
+func LoadMailTemplates(dir string) (*MailTemplates, error) {
+	files := map[string][]byte{}
+	if err := readMailTemplateFiles(mailtemplatesfs.FS, files); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := readMailTemplateFiles(os.DirFS(dir), files); err != nil {
+			return nil, err
+		}
+	}
+	t, err := ParseMailTemplates(files)
+	if err != nil && dir != "" {
+		return nil, fmt.Errorf("invalid mail templates %s: %w", dir, err)
+	}
+	return t, err
+}
+
+func readMailTemplateFiles(fsys fs.FS, files map[string][]byte) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || (path.Ext(entry.Name()) != mailTemplateExt && entry.Name() != mailTemplateLayout) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+		files[entry.Name()] = data
+	}
+	return nil
+}
+
+// ParseMailTemplates parses the templates and the layout keyed by filename.
+func ParseMailTemplates(files map[string][]byte) (*MailTemplates, error) {
+	var errs []error
+
+	t := &MailTemplates{
+		templates: map[string]map[string]*MailTemplate{},
+	}
+	for filename, data := range files {
+		if filename == mailTemplateLayout {
+			layout, err := htmltemplate.New(mailTemplateLayout).Parse(string(data))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			t.layout = layout
+			continue
+		}
+
+		tpl, err := ParseMailTemplate(filename, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if t.templates[tpl.Name] == nil {
+			t.templates[tpl.Name] = map[string]*MailTemplate{}
+		}
+		t.templates[tpl.Name][tpl.Locale] = tpl
+	}
+
+	if t.layout == nil {
+		errs = append(errs, fmt.Errorf("missing %s", mailTemplateLayout))
+	}
+	for _, name := range requiredMailTemplates {
+		if t.templates[name] == nil {
+			errs = append(errs, fmt.Errorf("missing mail template %s", name))
+		}
+	}
+	for name, locales := range t.templates {
+		if locales[DefaultMailLocale] == nil {
+			errs = append(errs, fmt.Errorf("mail template %s: missing %s%s", name, name+"."+DefaultMailLocale, mailTemplateExt))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return t, nil
+}
+
+// ParseMailTemplate parses a <name>.<locale>.md file. Template syntax is checked
+// here, since mailer.Mailer panics on it.
+func ParseMailTemplate(filename string, data []byte) (*MailTemplate, error) {
+	parts := strings.Split(strings.TrimSuffix(filename, mailTemplateExt), ".")
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("mail template %s must be named <name>.<locale>%s", filename, mailTemplateExt)
+	}
+	locale, err := language.ParseBase(parts[1])
+	if err != nil || locale.String() != parts[1] {
+		return nil, fmt.Errorf("mail template %s: unknown locale %q", filename, parts[1])
+	}
+
+	src := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(src, "---\n") {
+		return nil, fmt.Errorf("mail template %s: missing front matter", filename)
+	}
+	header, body, ok := strings.Cut(strings.TrimPrefix(src, "---\n"), "\n---\n")
+	if !ok {
+		return nil, fmt.Errorf("mail template %s: unterminated front matter", filename)
+	}
+
+	var tpl MailTemplate
+	if err := yaml.UnmarshalStrict([]byte(header), &tpl); err != nil {
+		return nil, fmt.Errorf("mail template %s: %w", filename, err)
+	}
+	tpl.Name = parts[0]
+	tpl.Locale = parts[1]
+	tpl.Body = body
+	if tpl.Subject == "" || strings.TrimSpace(tpl.Body) == "" {
+		return nil, fmt.Errorf("mail template %s: missing subject or body", filename)
+	}
+	for _, s := range []string{tpl.Subject, tpl.Body} {
+		if _, err := template.New("").Funcs(sprig.TxtFuncMap()).Parse(s); err != nil {
+			return nil, fmt.Errorf("mail template %s: %w", filename, err)
+		}
+	}
+	return &tpl, nil
+}
+
+// Lookup returns the template for the locale, or the DefaultMailLocale version.
+// It panics if the template does not exist, like template.Must.
+func (t *MailTemplates) Lookup(name, locale string) *MailTemplate {
+	locales, ok := t.templates[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown mail template %s", name))
+	}
+	if tpl, ok := locales[locale]; ok {
+		return tpl
+	}
+	return locales[DefaultMailLocale]
+}
+
+// Locales returns the locales any template is available in.
+func (t *MailTemplates) Locales() []string {
+	locales := sets.NewString()
+	for _, m := range t.templates {
+		for locale := range m {
+			locales.Insert(locale)
+		}
+	}
+	out := locales.List()
+	sort.Strings(out)
+	return out
+}
+
+// SelectLocale picks the mail locale of a recipient. An explicit preference like
+// "de" or "de-AT" wins; otherwise the most likely language of the ISO country code
+// is used. Locales without templates fall back to DefaultMailLocale.
+func (t *MailTemplates) SelectLocale(preferred, country string) string {
+	locales := sets.NewString(t.Locales()...)
+	if preferred != "" {
+		if tag, err := language.Parse(preferred); err == nil {
+			if base, _ := tag.Base(); locales.Has(base.String()) {
+				return base.String()
+			}
+		}
+	}
+	if country != "" {
+		if region, err := language.ParseRegion(country); err == nil {
+			tag, err := language.Compose(language.Und, region)
+			if err == nil {
+				if base, conf := tag.Base(); conf != language.No && locales.Has(base.String()) {
+					return base.String()
+				}
+			}
+		}
+	}
+	return DefaultMailLocale
+}
+
+// Layout wraps the HTML part of an email in the layout.
+func (t *MailTemplates) Layout(subject, body string) (string, error) {
+	var buf bytes.Buffer
+	err := t.layout.Execute(&buf, struct {
+		Subject string
+		Body    htmltemplate.HTML
+	}{
+		Subject: subject,
+		Body:    htmltemplate.HTML(body), // nolint:gosec
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// mailLocaleNames are the native names of the locales shown on the email preference page.
+var mailLocaleNames = map[string]string{
+	"de": "Deutsch",
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"ja": "日本語",
+	"pt": "Português",
+	"zh": "中文",
+}
+
+type MailLocaleOption struct {
+	Code string
+	Name string
+}
+
+// MailLocaleOptions returns the locales of the current mail templates.
+func MailLocaleOptions() []MailLocaleOption {
+	locales := CurrentMailTemplates().Locales()
+	out := make([]MailLocaleOption, 0, len(locales))
+	for _, locale := range locales {
+		name, ok := mailLocaleNames[locale]
+		if !ok {
+			name = locale
+		}
+		out = append(out, MailLocaleOption{Code: locale, Name: name})
+	}
+	return out
+}
+
+// localizedMailer returns a mailer for the named template in the locale.
+func localizedMailer(name, locale string, params any) mailer.Mailer {
+	tpl := CurrentMailTemplates().Lookup(name, locale)
+	return mailer.Mailer{
+		Subject: tpl.Subject,
+		Body:    tpl.Body,
+		Params:  params,
+	}
+}
+
+// mailLocale selects the locale of the emails to an address. preferred is the locale
+// chosen on a form; without one, the locale of the email preferences is used.
+func (s *Server) mailLocale(email, preferred, country string) string {
+	if preferred == "" {
+		if prefs, err := s.GetEmailPreferences(email); err != nil {
+			klog.Warningln(err)
+		} else {
+			preferred = prefs.Locale
+		}
+	}
+	return CurrentMailTemplates().SelectLocale(preferred, country)
+}
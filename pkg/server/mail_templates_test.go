@@ -0,0 +1,115 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestSelectMailLocale(t *testing.T) {
+	tpls := server.CurrentMailTemplates()
+	cases := []struct {
+		preferred, country string
+		expected           string
+	}{
+		{"", "", "en"},
+		{"", "US", "en"},
+		{"", "DE", "de"},
+		{"", "AT", "de"},
+		{"", "MX", "es"},
+		{"", "JP", "en"},
+		{"es", "DE", "es"},
+		{"de-CH", "", "de"},
+		{"ja", "DE", "de"},
+		{"not a locale", "", "en"},
+	}
+	for _, tc := range cases {
+		if found := tpls.SelectLocale(tc.preferred, tc.country); found != tc.expected {
+			t.Errorf("preferred=%q country=%q: expected %s, found %s", tc.preferred, tc.country, tc.expected, found)
+		}
+	}
+}
+
+func TestLocalizedLicenseMailer(t *testing.T) {
+	p, err := server.PreviewMail("license", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(p.Subject, "Lizenz") || !strings.Contains(p.Text, "Gültig bis") {
+		t.Errorf("expected german license email, found %q", p.Subject)
+	}
+	if !strings.HasPrefix(p.HTML, "<!DOCTYPE html>") || !strings.Contains(p.HTML, "BEGIN CERTIFICATE") {
+		t.Errorf("expected license in the html layout, found %s", p.HTML)
+	}
+
+	// no french templates
+	p, err = server.PreviewMail("welcome", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "Welcome to KubeDB" {
+		t.Errorf("expected english fallback, found %q", p.Subject)
+	}
+}
+
+func TestLoadMailTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"welcome.en.md": "---\nsubject: Hello {{ .Name }}\n---\nWelcome to {{ .ProductDisplayName }}.\n",
+		"welcome.fr.md": "---\nsubject: Bonjour {{ .Name }}\n---\nBienvenue sur {{ .ProductDisplayName }}.\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tpls, err := server.LoadMailTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := tpls.Lookup(server.MailTemplateWelcome, "en").Subject; s != "Hello {{ .Name }}" {
+		t.Errorf("expected overridden english template, found %q", s)
+	}
+	if s := tpls.Lookup(server.MailTemplateWelcome, "fr").Subject; s != "Bonjour {{ .Name }}" {
+		t.Errorf("expected added french template, found %q", s)
+	}
+	if s := tpls.Lookup(server.MailTemplateLicense, "fr").Locale; s != "en" {
+		t.Errorf("expected embedded english license template, found %s", s)
+	}
+}
+
+func TestParseMailTemplateInvalid(t *testing.T) {
+	cases := map[string]struct {
+		filename, data string
+	}{
+		"missing locale":       {"welcome.md", "---\nsubject: Hi\n---\nHello\n"},
+		"unknown locale":       {"welcome.xx-yy.md", "---\nsubject: Hi\n---\nHello\n"},
+		"missing front matter": {"welcome.en.md", "Hello\n"},
+		"missing subject":      {"welcome.en.md", "---\nfrom: hello@appscode.com\n---\nHello\n"},
+		"template syntax":      {"welcome.en.md", "---\nsubject: Hi\n---\n{{ if .Name }}\n"},
+	}
+	for name, tc := range cases {
+		if _, err := server.ParseMailTemplate(tc.filename, []byte(tc.data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"gomodules.xyz/mailer"
+)
+
+const webinarJoinDetails = `When: {{ .LocalSchedule }}
+{{- with .Meeting.ZoomJoinURL }}
+Join Zoom Meeting: {{ . }}
+{{- end }}
+{{- if .Meeting.ZoomMeetingID }}
+Meeting ID: {{ .Meeting.ZoomMeetingID }}
+{{- end }}
+{{- with .Meeting.ZoomMeetingPassword }}
+Passcode: {{ . }}
+{{- end }}`
+
+// NewWebinarConfirmationMailer attaches the calendar invite, since registrants
+// without a Google account often never see the Google Calendar invitation.
+func NewWebinarConfirmationMailer(r WebinarRegistration) mailer.Mailer {
+	src := fmt.Sprintf(`Hi {{.Name}},
+
+Thanks for registering for the AppsCode webinar{{ with .Title }} **{{ . }}**{{ end }}.
+
+%s
+
+Open the attached invite to add the webinar to Outlook, Apple Calendar, Google Calendar or any other calendar app. We will send you a reminder before the webinar starts.
+
+Regards,
+Team AppsCode
+`, webinarJoinDetails)
+
+	return mailer.Mailer{
+		Sender:  MailHello,
+		BCC:     "",
+		ReplyTo: MailHello,
+		Subject: `Registration confirmed: {{ or .Title "AppsCode webinar" }}`,
+		Body:    src,
+		Params:  r,
+		AttachmentBytes: map[string][]byte{
+			WebinarICSFilename: r.CalendarEvent().ICS(time.Now()),
+		},
+	}
+}
+
+func NewWebinarReminderMailer(r WebinarRegistration, before time.Duration) mailer.Mailer {
+	src := fmt.Sprintf(`Hi {{.Name}},
+
+The AppsCode webinar{{ with .Title }} **{{ . }}**{{ end }} starts in %s.
+
+%s
+
+See you there!
+
+Regards,
+Team AppsCode
+`, webinarLeadTime(before), webinarJoinDetails)
+
+	return mailer.Mailer{
+		Sender:          MailHello,
+		BCC:             "",
+		ReplyTo:         MailHello,
+		Subject:         fmt.Sprintf(`Reminder: {{ or .Title "AppsCode webinar" }} starts in %s`, webinarLeadTime(before)),
+		Body:            src,
+		Params:          r,
+		AttachmentBytes: nil,
+	}
+}
+
+func webinarLeadTime(d time.Duration) string {
+	switch h := int(d.Hours()); {
+	case h == 1:
+		return "1 hour"
+	case h > 1:
+		return fmt.Sprintf("%d hours", h)
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
+
+// WebinarFollowUpMailData is rendered by the follow-up mailers sent after a webinar.
+type WebinarFollowUpMailData struct {
+	Name          string
+	Title         string
+	RecordingLink string
+	SlidesLink    string
+}
+
+const webinarFollowUpLinks = `{{- with .RecordingLink }}
+Recording: {{ . }}
+{{- end }}
+{{- with .SlidesLink }}
+Slides: {{ . }}
+{{- end }}`
+
+func NewWebinarRecordingMailer(data WebinarFollowUpMailData) mailer.Mailer {
+	src := fmt.Sprintf(`Hi {{.Name}},
+
+Thanks for joining the AppsCode webinar **{{.Title}}**.
+{{ if or .RecordingLink .SlidesLink }}
+Here are the slides and the recording of the session, in case you want to revisit anything we covered:
+%s
+{{ end }}
+If you have any questions about the session, just reply to this email and our engineers will get back to you.
+
+Regards,
+Team AppsCode
+`, webinarFollowUpLinks)
+
+	return mailer.Mailer{
+		Sender:          MailHello,
+		BCC:             "",
+		ReplyTo:         MailHello,
+		Subject:         "Thanks for joining: {{.Title}}",
+		Body:            src,
+		Params:          data,
+		AttachmentBytes: nil,
+	}
+}
+
+func NewWebinarMissedMailer(data WebinarFollowUpMailData) mailer.Mailer {
+	src := fmt.Sprintf(`Hi {{.Name}},
+
+Sorry we missed you at the AppsCode webinar **{{.Title}}**.
+{{ if or .RecordingLink .SlidesLink }}
+You can catch up on the session whenever it suits you:
+%s
+{{ end }}
+If you have any questions about the topic, just reply to this email and our engineers will get back to you.
+
+Regards,
+Team AppsCode
+`, webinarFollowUpLinks)
+
+	return mailer.Mailer{
+		Sender:          MailHello,
+		BCC:             "",
+		ReplyTo:         MailHello,
+		Subject:         "Sorry we missed you: {{.Title}}",
+		Body:            src,
+		Params:          data,
+		AttachmentBytes: nil,
+	}
+}
@@ -17,8 +17,6 @@ limitations under the License.
 package server
 
 import (
-	"fmt"
-
 	"gomodules.xyz/mailer"
 )
 
@@ -27,35 +25,17 @@ func NewWelcomeMailer(info LicenseForm) mailer.Mailer {
 		LicenseForm
 		ProductDisplayName  string
 		IsEnterpriseProduct bool
+		SupportEmail        string
 	}{
 		LicenseForm:         info,
-		ProductDisplayName:  SupportedProducts[info.Product()].DisplayName,
+		ProductDisplayName:  catalog.Plan(info.Product()).DisplayName,
 		IsEnterpriseProduct: IsEnterpriseProduct(info.Product()),
+		SupportEmail:        MailSupport,
 	}
 
-	src := fmt.Sprintf(`Hi {{.Name}},
-
-Thanks for trying {{.ProductDisplayName}}. Our engineers can help you with any issues during the evaluation process. Please email %s with any questions regarding {{.ProductDisplayName}}.
-
-{{ if not .IsEnterpriseProduct }}
-We noticed that you are trying the Community Edition. We offer a 30 day FREE evaluation license for our {{.ProductDisplayName}} Enterprise product. The Enterprise version offers important features for Day-2 operations. If you need more time for evaluation, we should be able to extend the trial period.
-{{ end }}
-
-We look forward to hearing from you.
-
-Regards,
-Team AppsCode
-
-[![Website](https://cdn.appscode.com/images/website.png)](https://appscode.com) [![Linkedin](https://cdn.appscode.com/images/ln.png)](https://www.linkedin.com/company/appscode/) [![X](https://cdn.appscode.com/images/tt.png)](https://x.com/AppsCodeHQ) [![Youtube](https://cdn.appscode.com/images/yt.png)](https://www.youtube.com/@appscode)
-`, MailSupport)
-
-	return mailer.Mailer{
-		Sender:          MailLicenseSender,
-		BCC:             MailLicenseTracker,
-		ReplyTo:         MailSupport,
-		Subject:         fmt.Sprintf("Welcome to %s", SupportedProducts[info.Product()].DisplayName),
-		Body:            src,
-		Params:          params,
-		AttachmentBytes: nil,
-	}
+	m := localizedMailer(MailTemplateWelcome, info.Locale, params)
+	m.Sender = MailLicenseSender
+	m.BCC = MailLicenseTracker
+	m.ReplyTo = MailSupport
+	return m
 }
@@ -16,89 +16,159 @@ limitations under the License.
 
 package server
 
-/*
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+)
 
+// mailgunWebhookTolerance limits how old a signed Mailgun payload can be, so captured
+// payloads can't be replayed later.
+const mailgunWebhookTolerance = 15 * time.Minute
 
-	"github.com/mailgun/mailgun-go/v4"
-	"github.com/mailgun/mailgun-go/v4/events"
-	freshsalesclient "gomodules.xyz/freshsales-client-go"
-)
+// MailgunWebhook handles Mailgun webhooks. Payloads are signed with the webhook
+// signing key of the Mailgun account.
+// ref: https://documentation.mailgun.com/docs/mailgun/user-manual/tracking-messages/#securing-webhooks
+type MailgunWebhook struct {
+	signingKey []byte
+}
 
-func (s *Server) HandleMailgunWebhook(w http.ResponseWriter, r *http.Request) {
-	var payload mailgun.WebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		fmt.Printf("decode JSON error: %s", err)
-		w.WriteHeader(http.StatusNotAcceptable)
-		return
-	}
+var _ EmailWebhook = &MailgunWebhook{}
 
-	verified, err := s.mg.VerifyWebhookSignature(payload.Signature)
-	if err != nil {
-		fmt.Printf("verify error: %s\n", err)
-		w.WriteHeader(http.StatusNotAcceptable)
-		return
-	}
+func NewMailgunWebhook(signingKey string) *MailgunWebhook {
+	return &MailgunWebhook{signingKey: []byte(signingKey)}
+}
 
-	if !verified {
-		w.WriteHeader(http.StatusNotAcceptable)
-		fmt.Printf("failed verification %+v\n", payload.Signature)
-		return
-	}
+type MailgunSignature struct {
+	Timestamp string `json:"timestamp"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
+
+type mailgunPayload struct {
+	Signature MailgunSignature `json:"signature"`
+	EventData mailgunEventData `json:"event-data"`
+}
 
-	fmt.Printf("Verified Signature\n")
+type mailgunEventData struct {
+	ID        string  `json:"id"`
+	Event     string  `json:"event"`
+	Timestamp float64 `json:"timestamp"`
+	Recipient string  `json:"recipient"`
+	Severity  string  `json:"severity"`
+	Reason    string  `json:"reason"`
+	URL       string  `json:"url"`
+	IP        string  `json:"ip"`
+	Message   struct {
+		Headers struct {
+			MessageID string `json:"message-id"`
+			Subject   string `json:"subject"`
+		} `json:"headers"`
+	} `json:"message"`
+	DeliveryStatus struct {
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	} `json:"delivery-status"`
+	ClientInfo struct {
+		ClientOS   string `json:"client-os"`
+		DeviceType string `json:"device-type"`
+	} `json:"client-info"`
+	Geolocation struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	} `json:"geolocation"`
+}
 
-	// Parse the raw event to extract the
+// Sign returns the signature Mailgun sends for the timestamp and token.
+func (w *MailgunWebhook) Sign(timestamp, token string) string {
+	mac := hmac.New(sha256.New, w.signingKey)
+	mac.Write([]byte(timestamp + token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	e, err := mailgun.ParseEvent(payload.EventData)
+func (w *MailgunWebhook) Verify(_ *http.Request, body []byte) error {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	sig := payload.Signature
+	ts, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", sig.Timestamp)
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > mailgunWebhookTolerance || age < -mailgunWebhookTolerance {
+		return fmt.Errorf("signature timestamp %s is too old", sig.Timestamp)
+	}
+	expected, err := hex.DecodeString(w.Sign(sig.Timestamp, sig.Token))
 	if err != nil {
-		fmt.Printf("parse event error: %s\n", err)
-		return
+		return err
 	}
+	found, err := hex.DecodeString(sig.Signature)
+	if err != nil || !hmac.Equal(expected, found) {
+		return errors.New("invalid mailgun signature")
+	}
+	return nil
+}
+
+func (w *MailgunWebhook) Parse(body []byte) ([]EmailEvent, error) {
+	var payload mailgunPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	d := payload.EventData
 
-	switch event := e.(type) {
-	case *events.Opened:
-		_ = s.noteEventMailgun(event.Recipient, EventMailgun{
-			BaseNoteDescription: freshsalesclient.BaseNoteDescription{
-				Event: event.Name,
-				Client: freshsalesclient.ClientInfo{
-					OS:     event.ClientInfo.ClientOS,
-					Device: event.ClientInfo.DeviceType,
-					Location: freshsalesclient.GeoLocation{
-						City:    event.GeoLocation.City,
-						Country: event.GeoLocation.Country,
-					},
-				},
-			},
-			Message: Message{
-				MessageID: event.Message.Headers.MessageID,
-				Subject:   event.Message.Headers.Subject,
-			},
-		})
-		fmt.Printf("Email opened: %s\n", event.Message.Headers.MessageID)
-	case *events.Clicked:
-		_ = s.noteEventMailgun(event.Recipient, EventMailgun{
-			BaseNoteDescription: freshsalesclient.BaseNoteDescription{
-				Event: event.Name,
-				Client: freshsalesclient.ClientInfo{
-					OS:     event.ClientInfo.ClientOS,
-					Device: event.ClientInfo.DeviceType,
-					Location: freshsalesclient.GeoLocation{
-						City:    event.GeoLocation.City,
-						Country: event.GeoLocation.Country,
-					},
-				},
-			},
-			Message: Message{
-				MessageID: event.Message.Headers.MessageID,
-				Subject:   event.Message.Headers.Subject,
-				Url:       event.Url,
-			},
-		})
-		fmt.Printf("Link clicked: %s\n", event.Url)
+	var typ string
+	reason := d.Reason
+	switch d.Event {
+	case "delivered":
+		typ = EmailDelivered
+	case "failed":
+		typ = EmailDeferred
+		if d.Severity == "permanent" {
+			typ = EmailBounced
+		}
+		if d.DeliveryStatus.Description != "" {
+			reason = d.DeliveryStatus.Description
+		} else if d.DeliveryStatus.Message != "" {
+			reason = d.DeliveryStatus.Message
+		}
+	case "complained":
+		typ = EmailComplained
+	case "opened":
+		typ = EmailOpened
+	case "clicked":
+		typ = EmailClicked
+	case "unsubscribed":
+		typ = EmailUnsubscribed
+	default:
+		// accepted, rejected and stored events are not about the recipient
+		return nil, nil
 	}
+
+	sec, frac := math.Modf(d.Timestamp)
+	return []EmailEvent{
+		{
+			ID:        d.ID,
+			Provider:  "mailgun",
+			Type:      typ,
+			Recipient: d.Recipient,
+			Timestamp: time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+			MessageID: d.Message.Headers.MessageID,
+			Subject:   d.Message.Headers.Subject,
+			URL:       d.URL,
+			Reason:    reason,
+			OS:        d.ClientInfo.ClientOS,
+			Device:    d.ClientInfo.DeviceType,
+			IP:        d.IP,
+			City:      d.Geolocation.City,
+			Country:   d.Geolocation.Country,
+		},
+	}, nil
 }
-*/
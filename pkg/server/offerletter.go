@@ -17,16 +17,26 @@ limitations under the License.
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/mail"
 	"strconv"
+	"strings"
 	"time"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+
 	"github.com/gocarina/gocsv"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	gdrive "gomodules.xyz/gdrive-utils"
 	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
@@ -65,6 +75,9 @@ type CandidateInfo struct {
 
 	OfferStartDate OfferDate `form:"-" csv:"offer-start-date"`
 	OfferEndDate   OfferDate `form:"-" csv:"offer-end-date"`
+
+	// RequestSignature sends the offer letter and NDA to the candidate for e-signature.
+	RequestSignature bool `form:"request-signature" csv:"-"`
 }
 
 func (form CandidateInfo) Data() map[string]string {
@@ -91,119 +104,202 @@ func (form *CandidateInfo) Complete() {
 	form.OfferEndDate = NewOfferOfferDate(now.Add(3 * 24 * time.Hour)) // 3 days
 }
 
+// Validate checks the fields the form binding enforces too, since bulk rows
+// are read from CSV instead.
 func (form CandidateInfo) Validate() error {
-	_, err := form.StartDate.Parse()
-	return err
+	var errs []error
+	for field, v := range map[string]string{
+		"email": form.Email,
+		"name":  form.Name,
+		"tel":   form.Tel,
+		"title": form.Title,
+	} {
+		if strings.TrimSpace(v) == "" {
+			errs = append(errs, fmt.Errorf("missing %s", field))
+		}
+	}
+	if form.Email != "" {
+		if _, err := mail.ParseAddress(form.Email); err != nil {
+			errs = append(errs, fmt.Errorf("invalid email %q", form.Email))
+		}
+	}
+	if form.Salary <= 0 || form.PermanentSalary <= 0 {
+		errs = append(errs, errors.New("salary and perm-salary must be positive"))
+	}
+	if _, err := form.StartDate.Parse(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid start-date %q, expected format %q", form.StartDate, offerDateLayout))
+	}
+	if _, err := form.PermanentDate.Parse(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid perm-date %q, expected format %q", form.PermanentDate, offerDateLayout))
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
 type OfferDate string
 
+const offerDateLayout = "Jan 2, 2006"
+
 func NewOfferOfferDate(t time.Time) OfferDate {
-	return OfferDate(t.Format("Jan 2, 2006"))
+	return OfferDate(t.Format(offerDateLayout))
 }
 
 func (date OfferDate) Parse() (time.Time, error) {
-	return time.Parse("Jan 2, 2006", string(date))
+	return time.Parse(offerDateLayout, string(date))
 }
 
-func (s *Server) GenerateOfferLetter(info *CandidateInfo) (string, error) {
-	var candidateFolderId string
+// OfferLetterGenerator generates the offer letter, NDA and handbook for candidates.
+type OfferLetterGenerator struct {
+	DriveService *drive.Service
+	DocService   *docs.Service
+	SheetService *sheets.Service
+	Transport    mailtransport.Interface
+}
 
-	// https://developers.google.com/drive/api/v3/search-files
-	q := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents", info.Email, offerLetterFolderId)
-	files, err := s.srvDrive.Files.List().Q(q).Spaces("drive").Do()
+func NewOfferLetterGenerator(client *http.Client, mt mailtransport.Interface) (*OfferLetterGenerator, error) {
+	srvDrive, err := drive.NewService(context.TODO(), option.WithHTTPClient(client))
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("unable to retrieve Drive client: %v", err)
 	}
-	if len(files.Files) > 0 {
-		candidateFolderId = files.Files[0].Id
-	} else {
-		// https://developers.google.com/drive/api/v3/folder#java
-		folderMetadata := &drive.File{
-			Name:     info.Email,
-			MimeType: "application/vnd.google-apps.folder",
-			Parents:  []string{offerLetterFolderId},
-		}
-		folder, err := s.srvDrive.Files.Create(folderMetadata).Fields("id").Do()
-		if err != nil {
-			return "", err
-		}
-		candidateFolderId = folder.Id
+	srvDoc, err := docs.NewService(context.TODO(), option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Docs client: %v", err)
 	}
+	srvSheets, err := sheets.NewService(context.TODO(), option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %v", err)
+	}
+	return &OfferLetterGenerator{
+		DriveService: srvDrive,
+		DocService:   srvDoc,
+		SheetService: srvSheets,
+		Transport:    mt,
+	}, nil
+}
 
-	go func() {
-		fmt.Println("Employee:", info.Name)
-		fmt.Println("Email:", info.Email)
-		fmt.Println("Using folder id:", candidateFolderId)
+func (s *Server) offerLetterGenerator() *OfferLetterGenerator {
+	return &OfferLetterGenerator{
+		DriveService: s.srvDrive,
+		DocService:   s.srvDoc,
+		SheetService: s.srvSheets,
+		Transport:    s.mt,
+	}
+}
 
-		docId, err := s.generateOfferDoc(info, candidateFolderId, "offer")
-		if err != nil {
-			klog.Warningln(err)
-			return
-		}
-		fmt.Println("Offer docId:", docId)
+func (s *Server) GenerateOfferLetter(info *CandidateInfo) (string, error) {
+	gen := s.offerLetterGenerator()
+	candidateFolderId, err := gen.CandidateFolder(info)
+	if err != nil {
+		return "", err
+	}
 
-		docId, err = s.generateOfferDoc(info, candidateFolderId, "nda")
+	go func() {
+		docIds, err := gen.Generate(info, candidateFolderId)
 		if err != nil {
 			klog.Warningln(err)
 			return
 		}
-		fmt.Println("NDA docId:", docId)
 
-		docId, err = s.generateOfferDoc(info, candidateFolderId, "handbook")
-		if err != nil {
-			klog.Warningln(err)
-			return
+		if info.RequestSignature {
+			signer := Signer{Name: info.Name, Email: info.Email}
+			for _, key := range []string{"offer", "nda"} {
+				if _, err := s.RequestSignature(SignatureOfferLetter, info.Email, docIds[key], offerDocName(info, key), signer, MailHR); err != nil {
+					klog.Warningln(err)
+				}
+			}
 		}
-		fmt.Println("Handbook docId:", docId)
+	}()
 
-		// record in spreadsheet
-		startDate, err := info.StartDate.Parse()
-		if err != nil {
-			klog.Warningln(err)
-			return
-		}
-		sheetName := strconv.Itoa(startDate.Year())
-		clients := []*CandidateInfo{
-			info,
-		}
-		writer := gdrive.NewWriter(s.srvSheets, offerLetterSpreadsheetId, sheetName)
-		err = gocsv.MarshalCSV(clients, writer)
-		if err != nil {
-			klog.Warningln(err)
-			return
-		}
+	return candidateFolderId, nil
+}
+
+// CandidateFolder returns the id of the drive folder for the candidate, creating it if needed.
+func (gen *OfferLetterGenerator) CandidateFolder(info *CandidateInfo) (string, error) {
+	// https://developers.google.com/drive/api/v3/search-files
+	q := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents", info.Email, offerLetterFolderId)
+	files, err := gen.DriveService.Files.List().Q(q).Spaces("drive").Do()
+	if err != nil {
+		return "", err
+	}
+	if len(files.Files) > 0 {
+		return files.Files[0].Id, nil
+	}
+
+	// https://developers.google.com/drive/api/v3/folder#java
+	folderMetadata := &drive.File{
+		Name:     info.Email,
+		MimeType: "application/vnd.google-apps.folder",
+		Parents:  []string{offerLetterFolderId},
+	}
+	folder, err := gen.DriveService.Files.Create(folderMetadata).Fields("id").Do()
+	if err != nil {
+		return "", err
+	}
+	return folder.Id, nil
+}
+
+// Generate generates the candidate docs, records them in the offer letter sheet and
+// emails HR. It returns the generated doc ids keyed by template.
+func (gen *OfferLetterGenerator) Generate(info *CandidateInfo, candidateFolderId string) (map[string]string, error) {
+	fmt.Println("Employee:", info.Name)
+	fmt.Println("Email:", info.Email)
+	fmt.Println("Using folder id:", candidateFolderId)
 
-		// mail HR
-		mailer := NewOfferLetterMailer(info, candidateFolderId)
-		fmt.Println("sending email for generated offer letter", info.Email)
-		err = mailer.SendMail(s.mg, MailHR, "", nil)
+	docIds := map[string]string{}
+	for _, key := range []string{"offer", "nda", "handbook"} {
+		docId, err := gen.generateOfferDoc(info, candidateFolderId, key)
 		if err != nil {
-			klog.Warningln(err)
-			return
+			return nil, err
 		}
-	}()
+		fmt.Printf("%s docId: %s\n", offerDocName(info, key), docId)
+		docIds[key] = docId
+	}
 
-	return candidateFolderId, nil
+	// record in spreadsheet
+	startDate, err := info.StartDate.Parse()
+	if err != nil {
+		return nil, err
+	}
+	sheetName := strconv.Itoa(startDate.Year())
+	clients := []*CandidateInfo{
+		info,
+	}
+	writer := gdrive.NewWriter(gen.SheetService, offerLetterSpreadsheetId, sheetName)
+	err = gocsv.MarshalCSV(clients, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	// mail HR
+	mailer := NewOfferLetterMailer(info, candidateFolderId)
+	fmt.Println("sending email for generated offer letter", info.Email)
+	err = SendMail(gen.Transport, mailer, MailHR, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return docIds, nil
 }
 
-func (s *Server) generateOfferDoc(info *CandidateInfo, candidateFolderId string, templateKey string) (string, error) {
-	var docName string
+func offerDocName(info *CandidateInfo, templateKey string) string {
 	switch templateKey {
 	case "offer":
-		docName = fmt.Sprintf("Offer - %s", info.Email)
+		return fmt.Sprintf("Offer - %s", info.Email)
 	case "nda":
-		docName = fmt.Sprintf("NDA - %s", info.Email)
+		return fmt.Sprintf("NDA - %s", info.Email)
 	case "handbook":
-		docName = fmt.Sprintf("Handbook - %s", info.Email)
+		return fmt.Sprintf("Handbook - %s", info.Email)
 	}
+	return ""
+}
+
+func (gen *OfferLetterGenerator) generateOfferDoc(info *CandidateInfo, candidateFolderId string, templateKey string) (string, error) {
+	docName := offerDocName(info, templateKey)
 
 	// https://developers.google.com/docs/api/how-tos/documents#copying_an_existing_document
 	copyMetadata := &drive.File{
 		Name:    docName,
 		Parents: []string{candidateFolderId},
 	}
-	copyFile, err := s.srvDrive.Files.Copy(offerLetterTemplateDocIds[templateKey], copyMetadata).Fields("id", "parents").Do()
+	copyFile, err := gen.DriveService.Files.Copy(offerLetterTemplateDocIds[templateKey], copyMetadata).Fields("id", "parents").Do()
 	if err != nil {
 		return "", err
 	}
@@ -224,7 +320,7 @@ func (s *Server) generateOfferDoc(info *CandidateInfo, candidateFolderId string,
 			},
 		})
 	}
-	doc, err := s.srvDoc.Documents.BatchUpdate(copyFile.Id, req).Do()
+	doc, err := gen.DocService.Documents.BatchUpdate(copyFile.Id, req).Do()
 	if err != nil {
 		return "", err
 	}
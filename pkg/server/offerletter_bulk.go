@@ -0,0 +1,175 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-macaron/auth"
+	"github.com/gocarina/gocsv"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+// OfferLetterResult is the outcome of generating the offer letter for one CSV row.
+type OfferLetterResult struct {
+	Row      int    `json:"row"`
+	Email    string `json:"email"`
+	FolderId string `json:"folderId,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r OfferLetterResult) Succeeded() bool {
+	return r.Error == ""
+}
+
+func (r OfferLetterResult) String() string {
+	if !r.Succeeded() {
+		return fmt.Sprintf("row %d %s: FAILED: %s", r.Row, r.Email, r.Error)
+	}
+	if r.FolderId == "" {
+		return fmt.Sprintf("row %d %s: ok", r.Row, r.Email)
+	}
+	return fmt.Sprintf("row %d %s: ok https://drive.google.com/drive/folders/%s", r.Row, r.Email, r.FolderId)
+}
+
+func FormatOfferLetterReport(results []OfferLetterResult) string {
+	var sb strings.Builder
+	var failed int
+	for _, r := range results {
+		if !r.Succeeded() {
+			failed++
+		}
+		sb.WriteString(r.String())
+		sb.WriteString("\n")
+	}
+	_, _ = fmt.Fprintf(&sb, "%d succeeded, %d failed\n", len(results)-failed, failed)
+	return sb.String()
+}
+
+const (
+	// MaxOfferLetterUploadBytes limits the size of a CSV file uploaded to the bulk form.
+	MaxOfferLetterUploadBytes = 4 << 20
+	// MaxOfferLetterCandidates limits the number of candidates in one uploaded batch.
+	MaxOfferLetterCandidates = 200
+)
+
+// ReadCandidates reads candidates from a CSV file with the same columns as the offer letter sheet.
+func ReadCandidates(r io.Reader) ([]*CandidateInfo, error) {
+	var candidates []*CandidateInfo
+	if err := gocsv.Unmarshal(r, &candidates); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// ValidateCandidates completes and validates each candidate. Rows are numbered as
+// lines in the CSV file, so the first candidate is row 2.
+func ValidateCandidates(candidates []*CandidateInfo) []OfferLetterResult {
+	results := make([]OfferLetterResult, 0, len(candidates))
+	for i, c := range candidates {
+		c.Complete()
+		r := OfferLetterResult{
+			Row:   i + 2,
+			Email: c.Email,
+		}
+		if err := c.Validate(); err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// GenerateAll generates offer letters for the candidates that passed ValidateCandidates,
+// and records the outcome in their results. A failed row does not stop the rest of the batch.
+func (gen *OfferLetterGenerator) GenerateAll(candidates []*CandidateInfo, results []OfferLetterResult) []OfferLetterResult {
+	for i, c := range candidates {
+		if !results[i].Succeeded() {
+			continue
+		}
+		folderId, err := gen.CandidateFolder(c)
+		if err == nil {
+			_, err = gen.Generate(c, folderId)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].FolderId = folderId
+	}
+	return results
+}
+
+// GenerateOfferLetters validates the uploaded candidates and generates their offer letters
+// in the background. The final report is emailed to HR.
+func (s *Server) GenerateOfferLetters(r io.Reader) ([]OfferLetterResult, error) {
+	candidates, err := ReadCandidates(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > MaxOfferLetterCandidates {
+		return nil, fmt.Errorf("found %d candidates, upload at most %d per batch", len(candidates), MaxOfferLetterCandidates)
+	}
+	results := ValidateCandidates(candidates)
+
+	go func() {
+		results := s.offerLetterGenerator().GenerateAll(candidates, slices.Clone(results))
+		mailer := NewOfferLetterBatchMailer(results)
+		if err := s.sendMail(mailer, MailHR, ""); err != nil {
+			klog.Warningln(err)
+		}
+	}()
+	return results, nil
+}
+
+func (s *Server) RegisterOfferLetterBulkAPI(m *macaron.Macaron) {
+	m.Get("/_/offerletter/bulk", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		ctx.HTML(http.StatusOK, "offerletter_bulk")
+	})
+	m.Post("/_/offerletter/bulk", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		ctx.Req.Request.Body = http.MaxBytesReader(ctx.Resp, ctx.Req.Request.Body, MaxOfferLetterUploadBytes)
+		f, _, err := ctx.Req.FormFile("candidates")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				ctx.WriteHeader(http.StatusRequestEntityTooLarge)
+				respond(ctx, []byte(fmt.Sprintf("upload is larger than %d MB", MaxOfferLetterUploadBytes>>20)))
+				return
+			}
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		defer f.Close()
+
+		results, err := s.GenerateOfferLetters(f)
+		if err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Data["Results"] = results
+		ctx.HTML(http.StatusAccepted, "offerletter_bulk")
+	})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestValidateCandidates(t *testing.T) {
+	in := `email,name,tel,title,salary,start-date,perm-salary,perm-date
+jane@example.com,Jane Doe,+1-555-0100,Engineer,1000,"Nov 1, 2026",1200,"Feb 1, 2027"
+john@example.com,,+1-555-0101,Engineer,1000,11/01/2026,1200,"Feb 1, 2027"
+`
+	candidates, err := server.ReadCandidates(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := server.ValidateCandidates(candidates)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, found %d", len(results))
+	}
+	if !results[0].Succeeded() {
+		t.Errorf("expected row 2 to be valid, found %s", results[0])
+	}
+	if results[1].Succeeded() || results[1].Row != 3 {
+		t.Errorf("expected row 3 to be invalid, found %s", results[1])
+	}
+	for _, want := range []string{"missing name", "invalid start-date"} {
+		if !strings.Contains(results[1].Error, want) {
+			t.Errorf("expected %q in %q", want, results[1].Error)
+		}
+	}
+}
+
+func TestGenerateOfferLettersLimit(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("email,name,tel,title,salary,start-date,perm-salary,perm-date\n")
+	for i := 0; i <= server.MaxOfferLetterCandidates; i++ {
+		fmt.Fprintf(&sb, "c%d@example.com,Candidate %d,+1-555-0100,Engineer,1000,\"Nov 1, 2026\",1200,\"Feb 1, 2027\"\n", i, i)
+	}
+	var s server.Server
+	if _, err := s.GenerateOfferLetters(strings.NewReader(sb.String())); err == nil {
+		t.Errorf("expected more than %d candidates to be rejected", server.MaxOfferLetterCandidates)
+	}
+}
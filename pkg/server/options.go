@@ -19,6 +19,9 @@ package server
 import (
 	"os"
 
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
+
 	"github.com/spf13/pflag"
 	listmonkclient "gomodules.xyz/listmonk-client-go"
 )
@@ -36,12 +39,17 @@ type Options struct {
 
 	TaskDir string
 
+	CatalogFile       string
+	DripCampaignsFile string
+	MailTemplatesDir  string
+
 	LicenseBucket        string
 	LicenseSpreadsheetId string
 
-	SMTPAddress  string
-	SMTPUsername string
-	SMTPPassword string
+	Mail mailtransport.Config
+
+	CRMProvider  string
+	CRMLocalFile string
 
 	listmonkHost     string
 	listmonkUsername string
@@ -58,6 +66,14 @@ type Options struct {
 	Coupons string
 
 	RecaptchaSiteKey string
+
+	BaseURL        string
+	LinkSigningKey string
+
+	MailgunWebhookSigningKey string
+	SNSTopicARNs             []string
+	PostmarkWebhookUsername  string
+	PostmarkWebhookPassword  string
 }
 
 func NewOptions() *Options {
@@ -72,9 +88,9 @@ func NewOptions() *Options {
 		TaskDir:              "tasks",
 		LicenseBucket:        LicenseBucket,
 		LicenseSpreadsheetId: LicenseSpreadsheetId,
-		SMTPAddress:          os.Getenv("SMTP_ADDRESS"),
-		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
-		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		Mail:                 mailtransport.ConfigFromEnv(),
+		CRMProvider:          crm.ProviderFreshsales,
+		CRMLocalFile:         "crm.json",
 		listmonkHost:         listmonkclient.ListmonkProd,
 		listmonkUsername:     os.Getenv("LISTMONK_USERNAME"),
 		listmonkPassword:     os.Getenv("LISTMONK_PASSWORD"),
@@ -82,6 +98,12 @@ func NewOptions() *Options {
 		EnableDripCampaign:   true,
 		Coupons:              os.Getenv("COUPONS"),
 		RecaptchaSiteKey:     os.Getenv("RECAPTCHA_SITE_KEY"),
+		BaseURL:              "https://license-issuer.appscode.com",
+		LinkSigningKey:       os.Getenv("LINK_SIGNING_KEY"),
+
+		MailgunWebhookSigningKey: os.Getenv("MAILGUN_WEBHOOK_SIGNING_KEY"),
+		PostmarkWebhookUsername:  os.Getenv("POSTMARK_WEBHOOK_USERNAME"),
+		PostmarkWebhookPassword:  os.Getenv("POSTMARK_WEBHOOK_PASSWORD"),
 	}
 }
 
@@ -98,12 +120,27 @@ func (s *Options) AddFlags(fs *pflag.FlagSet) {
 
 	fs.StringVar(&s.TaskDir, "scheduler.db-dir", s.TaskDir, "Directory where task db files are stored")
 
+	fs.StringVar(&s.CatalogFile, "catalog-file", s.CatalogFile, "Path to plan catalog file. If empty, the embedded catalog is used")
+	fs.StringVar(&s.DripCampaignsFile, "drip-campaigns-file", s.DripCampaignsFile, "Path to drip campaigns file. If empty, the embedded campaigns are used")
+	fs.StringVar(&s.MailTemplatesDir, "mail-templates-dir", s.MailTemplatesDir, "Path to a directory of mail templates that override the embedded templates")
+
 	fs.StringVar(&s.LicenseBucket, "bucket", s.LicenseBucket, "URL of S3/GCS bucket used to store licenses")
 	fs.StringVar(&s.LicenseSpreadsheetId, "spreadsheet-id", s.LicenseSpreadsheetId, "Google Spreadsheet Id used to store license issue log")
 
-	fs.StringVar(&s.SMTPAddress, "smtp.address", s.SMTPAddress, "SMTP server host:port")
-	fs.StringVar(&s.SMTPUsername, "smtp.username", s.SMTPUsername, "SMTP username")
-	fs.StringVar(&s.SMTPPassword, "smtp.password", s.SMTPPassword, "SMTP password")
+	fs.StringVar(&s.Mail.Transport, "mail.transport", s.Mail.Transport, "Transport used to send email. One of smtp, mailgun or maildir")
+	fs.StringVar(&s.Mail.SMTPAddress, "smtp.address", s.Mail.SMTPAddress, "SMTP server host:port")
+	fs.StringVar(&s.Mail.SMTPUsername, "smtp.username", s.Mail.SMTPUsername, "SMTP username")
+	fs.StringVar(&s.Mail.SMTPPassword, "smtp.password", s.Mail.SMTPPassword, "SMTP password")
+	fs.StringVar(&s.Mail.SMTPSecurity, "smtp.security", s.Mail.SMTPSecurity, "SMTP connection security. One of auto, starttls or tls (implicit TLS)")
+	fs.StringVar(&s.Mail.SMTPAuth, "smtp.auth", s.Mail.SMTPAuth, "SMTP authentication. One of plain, xoauth2 or none")
+	fs.StringVar(&s.Mail.SMTPOAuth2TokenFile, "smtp.oauth2-token-file", s.Mail.SMTPOAuth2TokenFile, "File with the OAuth2 access token used by xoauth2. It is read before every connection")
+	fs.StringVar(&s.Mail.MailgunDomain, "mailgun.domain", s.Mail.MailgunDomain, "Mailgun sending domain")
+	fs.StringVar(&s.Mail.MailgunAPIKey, "mailgun.api-key", s.Mail.MailgunAPIKey, "Mailgun API key")
+	fs.StringVar(&s.Mail.MailgunAPIBase, "mailgun.api-base", s.Mail.MailgunAPIBase, "Mailgun API base url. Use https://api.eu.mailgun.net for EU domains")
+	fs.StringVar(&s.Mail.MaildirPath, "maildir", s.Mail.MaildirPath, "Maildir where the maildir transport writes every email")
+
+	fs.StringVar(&s.CRMProvider, "crm.provider", s.CRMProvider, "CRM used to record sales events. One of freshsales, hubspot or local")
+	fs.StringVar(&s.CRMLocalFile, "crm.local-file", s.CRMLocalFile, "Path to JSON file used by the local CRM")
 
 	fs.StringVar(&s.listmonkHost, "listmonk.host", s.listmonkHost, "Listmonk host url")
 	fs.StringVar(&s.listmonkUsername, "listmonk.username", s.listmonkUsername, "Listmonk username")
@@ -120,4 +157,12 @@ func (s *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.Coupons, "coupons", s.Coupons, "Coupon codes")
 
 	fs.StringVar(&s.RecaptchaSiteKey, "recaptcha.site-key", s.RecaptchaSiteKey, "Google reCAPTCHA v2 site key")
+
+	fs.StringVar(&s.BaseURL, "base-url", s.BaseURL, "Public URL of this server used in links sent to customers")
+	fs.StringVar(&s.LinkSigningKey, "link-signing-key", s.LinkSigningKey, "Key used to sign links sent to customers. If empty, a key derived from the license issuer CA key is used")
+
+	fs.StringVar(&s.MailgunWebhookSigningKey, "webhook.mailgun-signing-key", s.MailgunWebhookSigningKey, "Mailgun webhook signing key. If empty, Mailgun webhooks are rejected")
+	fs.StringSliceVar(&s.SNSTopicARNs, "webhook.sns-topic-arns", s.SNSTopicARNs, "ARNs of SNS topics allowed to deliver SES events")
+	fs.StringVar(&s.PostmarkWebhookUsername, "webhook.postmark-username", s.PostmarkWebhookUsername, "Basic auth username set in the Postmark webhook url. If empty, Postmark webhooks are rejected")
+	fs.StringVar(&s.PostmarkWebhookPassword, "webhook.postmark-password", s.PostmarkWebhookPassword, "Basic auth password set in the Postmark webhook url")
 }
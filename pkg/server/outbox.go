@@ -0,0 +1,546 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+
+	"github.com/avct/uasurfer"
+	"github.com/rs/xid"
+	"gomodules.xyz/blobfs"
+	listmonkclient "gomodules.xyz/listmonk-client-go"
+	"gomodules.xyz/sets"
+	"k8s.io/klog/v2"
+)
+
+// The outbox persists side effects of form submissions, like emails, CRM notes and
+// listmonk subscriptions, as separate records and retries each of them with backoff.
+// Undelivered entries are kept in the open index, and the sweep schedules the ones whose
+// task was lost. Entries that keep failing are moved to the dead letter index, where
+// they can be inspected and retried with the `outbox` command. Delivered entries are
+// deleted after OutboxRetention.
+
+type OutboxStatus string
+
+const (
+	OutboxPending  OutboxStatus = "pending"
+	OutboxRetrying OutboxStatus = "retrying"
+	OutboxDone     OutboxStatus = "done"
+	OutboxDead     OutboxStatus = "dead"
+)
+
+// Kinds of outbox entries.
+const (
+	OutboxCRMNote             = "crm-note"
+	OutboxListmonkSubscribe   = "listmonk-subscribe"
+	OutboxLicenseLog          = "license-log"
+	OutboxListmonkBlocklist   = "listmonk-blocklist"
+	OutboxDripStop            = "drip-stop"
+	OutboxListmonkUnsubscribe = "listmonk-unsubscribe"
+	OutboxEmail               = "email"
+)
+
+const (
+	TaskOutbox = "outbox"
+
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = time.Minute
+
+	// OutboxRetention is how long delivered entries are kept.
+	OutboxRetention = 14 * 24 * time.Hour
+	// OutboxSweepInterval is how often the server schedules requeued entries and
+	// entries whose attempt is overdue, and deletes expired ones.
+	OutboxSweepInterval = 5 * time.Minute
+	// outboxOpenIndex lists the pending and retrying entries.
+	outboxOpenIndex = "open"
+	// outboxSweepDays is how many days past the retention are swept, so days missed
+	// while the server was down are still deleted.
+	outboxSweepDays = 7
+)
+
+type OutboxEntry struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Description string          `json:"description"`
+	Args        json.RawMessage `json:"args"`
+	Status      OutboxStatus    `json:"status"`
+
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError,omitempty"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Overdue reports whether the entry should have been attempted a sweep interval ago.
+func (e *OutboxEntry) Overdue(now time.Time) bool {
+	due := e.UpdatedAt
+	if e.NextAttemptAt != nil {
+		due = *e.NextAttemptAt
+	}
+	return now.Sub(due) >= OutboxSweepInterval
+}
+
+// OutboxBackoff returns the delay before the next attempt. Delays double after every
+// failed attempt, starting at one minute.
+func OutboxBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return outboxBaseBackoff << (attempts - 1)
+}
+
+type CRMNoteArgs struct {
+	Contact crm.Contact `json:"contact"`
+	// Upsert updates the details of an existing contact, instead of only creating
+	// missing contacts.
+	Upsert bool   `json:"upsert,omitempty"`
+	Body   string `json:"body"`
+}
+
+type LicenseLogArgs struct {
+	Entry       LogEntry `json:"entry"`
+	UserAgent   string   `json:"userAgent,omitempty"`
+	CouponEvent string   `json:"couponEvent,omitempty"`
+}
+
+// outboxHandlers returns the function that performs each kind of side effect.
+func (s *Server) outboxHandlers() map[string]func(json.RawMessage) error {
+	return map[string]func(json.RawMessage) error{
+		OutboxCRMNote: func(data json.RawMessage) error {
+			var args CRMNoteArgs
+			if err := json.Unmarshal(data, &args); err != nil {
+				return err
+			}
+			ensure := crm.EnsureContact
+			if args.Upsert {
+				ensure = crm.UpsertContact
+			}
+			c, err := ensure(s.crm, &args.Contact)
+			if err != nil {
+				return err
+			}
+			return s.crm.AddNote(c.ID, args.Body)
+		},
+		OutboxListmonkSubscribe: func(data json.RawMessage) error {
+			var req listmonkclient.SubscribeRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				return err
+			}
+			return s.listmonk.SubscribeToList(req)
+		},
+		OutboxLicenseLog: func(data json.RawMessage) error {
+			var args LicenseLogArgs
+			if err := json.Unmarshal(data, &args); err != nil {
+				return err
+			}
+			args.Entry.UA = uasurfer.Parse(args.UserAgent)
+			return LogLicense(s.sheet, &args.Entry, args.CouponEvent)
+		},
+		OutboxListmonkBlocklist: func(data json.RawMessage) error {
+			var email string
+			if err := json.Unmarshal(data, &email); err != nil {
+				return err
+			}
+			return s.blocklistListmonkSubscriber(email)
+		},
+		OutboxListmonkUnsubscribe: func(data json.RawMessage) error {
+			var args ListmonkUnsubscribeArgs
+			if err := json.Unmarshal(data, &args); err != nil {
+				return err
+			}
+			return s.unsubscribeListmonkSubscriber(args)
+		},
+		OutboxDripStop: func(data json.RawMessage) error {
+			var email string
+			if err := json.Unmarshal(data, &email); err != nil {
+				return err
+			}
+			return s.stopDripCampaigns(email)
+		},
+		OutboxEmail: func(data json.RawMessage) error {
+			var args EmailArgs
+			if err := json.Unmarshal(data, &args); err != nil {
+				return err
+			}
+			return DeliverEmail(s.mt, args, s.srvDrive)
+		},
+	}
+}
+
+// OutboxStore reads and updates outbox entries in the license bucket. It needs neither
+// the scheduler nor any API credentials, so the outbox command can use it while the
+// server is running.
+type OutboxStore struct {
+	fs blobfs.Interface
+}
+
+func NewOutboxStore(fs blobfs.Interface) *OutboxStore {
+	return &OutboxStore{fs: fs}
+}
+
+func (o *OutboxStore) Get(id string) (*OutboxEntry, error) {
+	data, err := o.fs.ReadFile(context.TODO(), OutboxPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var e OutboxEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (o *OutboxStore) Save(e *OutboxEntry) error {
+	e.UpdatedAt = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return o.fs.WriteFile(context.TODO(), OutboxPath(e.ID), data)
+}
+
+// DeadEntries returns the entries that ran out of attempts.
+func (o *OutboxStore) DeadEntries() ([]*OutboxEntry, error) {
+	return o.indexedEntries(string(OutboxDead), OutboxDead)
+}
+
+// OpenEntries returns the entries that are not delivered yet.
+func (o *OutboxStore) OpenEntries() ([]*OutboxEntry, error) {
+	return o.indexedEntries(outboxOpenIndex, OutboxPending, OutboxRetrying)
+}
+
+func (o *OutboxStore) indexedEntries(index string, statuses ...OutboxStatus) ([]*OutboxEntry, error) {
+	ids, err := readIndex(o.fs, OutboxIndexPath(index))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*OutboxEntry, 0, len(ids))
+	for _, id := range ids {
+		e, err := o.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(statuses, e.Status) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Requeue asks the running server to retry a dead entry with a fresh set of attempts.
+// Only a marker for the entry is written, because the indexes are updated by the
+// server alone. The server picks it up on its next outbox sweep.
+func (o *OutboxStore) Requeue(id string) (*OutboxEntry, error) {
+	e, err := o.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != OutboxDead {
+		return nil, fmt.Errorf("outbox entry %s is %s, only dead entries can be retried", id, e.Status)
+	}
+	return e, o.fs.WriteFile(context.TODO(), OutboxRequeuePath(id), []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+// markDone records a delivered entry in the index of the day it was delivered on.
+func (o *OutboxStore) markDone(e *OutboxEntry) error {
+	return appendIndex(o.fs, OutboxDoneIndexPath(e.UpdatedAt.UTC().Format(time.DateOnly)), e.ID)
+}
+
+// Prune deletes the entries delivered on the days that are past OutboxRetention.
+func (o *OutboxStore) Prune(now time.Time) (int, error) {
+	var n int
+	last := now.Add(-OutboxRetention).UTC()
+	for i := 0; i < outboxSweepDays; i++ {
+		path := OutboxDoneIndexPath(last.AddDate(0, 0, -i).Format(time.DateOnly))
+		ids, err := readIndex(o.fs, path)
+		if err != nil {
+			return n, err
+		}
+		if ids == nil {
+			continue
+		}
+		for _, id := range ids {
+			if err := o.fs.DeleteFile(context.TODO(), OutboxPath(id)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := o.fs.DeleteFile(context.TODO(), path); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *Server) outbox() *OutboxStore {
+	return NewOutboxStore(s.fs)
+}
+
+func (s *Server) GetOutboxEntry(id string) (*OutboxEntry, error) {
+	return s.outbox().Get(id)
+}
+
+func (s *Server) saveOutboxEntry(e *OutboxEntry) error {
+	return s.outbox().Save(e)
+}
+
+// enqueueOutbox persists the side effect and schedules its first attempt. An error
+// means the side effect may not have been recorded.
+func (s *Server) enqueueOutbox(kind, description string, args any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	e := &OutboxEntry{
+		ID:          xid.New().String(),
+		Kind:        kind,
+		Description: description,
+		Args:        data,
+		Status:      OutboxPending,
+		CreatedAt:   now,
+	}
+	if err := s.saveOutboxEntry(e); err != nil {
+		return err
+	}
+	if err := s.appendIndex(OutboxIndexPath(outboxOpenIndex), e.ID); err != nil {
+		return err
+	}
+	if err := s.scheduleOutboxEntry(e.ID, now); err != nil {
+		// the entry is recorded, so the sweep schedules it later
+		klog.ErrorS(err, "failed to schedule outbox entry", "id", e.ID)
+	}
+	return nil
+}
+
+func (s *Server) scheduleOutboxEntry(id string, at time.Time) error {
+	args, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	return s.sch.ScheduleTask(at, TaskOutbox, args)
+}
+
+// attemptOutboxEntry runs the side effect once and records the outcome.
+func (s *Server) attemptOutboxEntry(e *OutboxEntry) error {
+	fn, ok := s.outboxHandlers()[e.Kind]
+	if !ok {
+		return fmt.Errorf("unknown outbox entry kind %s", e.Kind)
+	}
+	e.Attempts++
+	e.NextAttemptAt = nil
+	if err := fn(e.Args); err != nil {
+		e.LastError = err.Error()
+		return err
+	}
+	e.Status = OutboxDone
+	e.LastError = ""
+	return nil
+}
+
+// outboxRunning holds the entries being attempted, so an entry scheduled again by the
+// sweep is never run twice at the same time.
+var (
+	outboxRunningMu sync.Mutex
+	outboxRunning   = sets.NewString()
+)
+
+func claimOutboxEntry(id string) bool {
+	outboxRunningMu.Lock()
+	defer outboxRunningMu.Unlock()
+	if outboxRunning.Has(id) {
+		return false
+	}
+	outboxRunning.Insert(id)
+	return true
+}
+
+func isOutboxEntryRunning(id string) bool {
+	outboxRunningMu.Lock()
+	defer outboxRunningMu.Unlock()
+	return outboxRunning.Has(id)
+}
+
+func releaseOutboxEntry(id string) {
+	outboxRunningMu.Lock()
+	defer outboxRunningMu.Unlock()
+	outboxRunning.Delete(id)
+}
+
+// RunOutboxEntry is the scheduler task for outbox entries. Failures are retried with
+// OutboxBackoff. If the entry can't be loaded or saved the task fails, and the sweep
+// schedules the entry again since it is still in the open index.
+func (s *Server) RunOutboxEntry(args []byte) error {
+	var id string
+	if err := json.Unmarshal(args, &id); err != nil {
+		return err
+	}
+	if !claimOutboxEntry(id) {
+		return nil
+	}
+	defer releaseOutboxEntry(id)
+
+	e, err := s.GetOutboxEntry(id)
+	if err != nil {
+		return err
+	}
+	if e.Status == OutboxDone || e.Status == OutboxDead {
+		return nil
+	}
+
+	err = s.attemptOutboxEntry(e)
+	if err == nil {
+		if err := s.saveOutboxEntry(e); err != nil {
+			return err
+		}
+		if err := s.outbox().markDone(e); err != nil {
+			return err
+		}
+		return s.removeIndex(OutboxIndexPath(outboxOpenIndex), e.ID)
+	}
+
+	klog.Warningf("outbox entry %s (%s) attempt %d failed: %v", e.ID, e.Description, e.Attempts, err)
+	if e.Attempts >= outboxMaxAttempts {
+		e.Status = OutboxDead
+		if err := s.saveOutboxEntry(e); err != nil {
+			return err
+		}
+		if err := s.appendIndex(OutboxIndexPath(string(OutboxDead)), e.ID); err != nil {
+			return err
+		}
+		return s.removeIndex(OutboxIndexPath(outboxOpenIndex), e.ID)
+	}
+
+	next := time.Now().Add(OutboxBackoff(e.Attempts))
+	e.Status = OutboxRetrying
+	e.NextAttemptAt = &next
+	if err := s.saveOutboxEntry(e); err != nil {
+		return err
+	}
+	return s.scheduleOutboxEntry(e.ID, next)
+}
+
+// SweepOutbox schedules the entries requeued by the outbox command and the open entries
+// whose attempt is overdue by more than OutboxSweepInterval, eg, because their task
+// failed or was lost. It also deletes the delivered entries that are past OutboxRetention.
+func (s *Server) SweepOutbox(now time.Time) error {
+	if err := s.requeueOutboxEntries(now); err != nil {
+		return err
+	}
+	if err := s.rescheduleOutboxEntries(now); err != nil {
+		return err
+	}
+
+	n, err := s.outbox().Prune(now)
+	if n > 0 {
+		klog.InfoS("pruned delivered outbox entries", "count", n)
+	}
+	return err
+}
+
+// requeueOutboxEntries moves the dead entries marked by OutboxStore.Requeue back to
+// the open index with a fresh set of attempts.
+func (s *Server) requeueOutboxEntries(now time.Time) error {
+	ids, err := s.readIndex(OutboxIndexPath(string(OutboxDead)))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		marker := OutboxRequeuePath(id)
+		if ok, err := s.fs.Exists(context.TODO(), marker); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		e, err := s.GetOutboxEntry(id)
+		if err != nil {
+			return err
+		}
+		if e.Status == OutboxDead {
+			e.Status = OutboxPending
+			e.Attempts = 0
+			e.NextAttemptAt = nil
+			if err := s.saveOutboxEntry(e); err != nil {
+				return err
+			}
+			if err := s.appendIndex(OutboxIndexPath(outboxOpenIndex), id); err != nil {
+				return err
+			}
+			if err := s.scheduleOutboxEntry(id, now); err != nil {
+				return err
+			}
+		}
+		if err := s.removeIndex(OutboxIndexPath(string(OutboxDead)), id); err != nil {
+			return err
+		}
+		if err := s.fs.DeleteFile(context.TODO(), marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rescheduleOutboxEntries schedules the open entries that should have been attempted
+// a sweep interval ago.
+func (s *Server) rescheduleOutboxEntries(now time.Time) error {
+	ids, err := s.readIndex(OutboxIndexPath(outboxOpenIndex))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		e, err := s.GetOutboxEntry(id)
+		if err != nil {
+			klog.ErrorS(err, "failed to read outbox entry", "id", id)
+			continue
+		}
+		if e.Status == OutboxDone || e.Status == OutboxDead {
+			// the run finished but failed to update the index
+			if err := s.removeIndex(OutboxIndexPath(outboxOpenIndex), id); err != nil {
+				return err
+			}
+			continue
+		}
+		if !e.Overdue(now) || isOutboxEntryRunning(id) {
+			continue
+		}
+		klog.InfoS("scheduling overdue outbox entry", "id", id, "status", e.Status, "attempts", e.Attempts)
+		if err := s.scheduleOutboxEntry(id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeToList subscribes the user to mailing lists through the outbox.
+// Undeliverable and unsubscribed addresses are skipped.
+func (s *Server) subscribeToList(req listmonkclient.SubscribeRequest) error {
+	if s.isListmonkSuppressed(req.Email) {
+		klog.InfoS("skipped listmonk subscription of suppressed email", "email", req.Email)
+		return nil
+	}
+	return s.enqueueOutbox(OutboxListmonkSubscribe, "listmonk subscription for "+req.Email, req)
+}
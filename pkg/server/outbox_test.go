@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"gomodules.xyz/blobfs"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		0: time.Minute,
+		1: time.Minute,
+		2: 2 * time.Minute,
+		4: 8 * time.Minute,
+	}
+	for attempts, expected := range cases {
+		if found := server.OutboxBackoff(attempts); found != expected {
+			t.Errorf("attempts %d: expected %v, found %v", attempts, expected, found)
+		}
+	}
+}
+
+func TestOutboxEntryOverdue(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	next := now.Add(-time.Minute)
+	e := server.OutboxEntry{Status: server.OutboxRetrying, NextAttemptAt: &next, UpdatedAt: now.Add(-time.Hour)}
+	if e.Overdue(now) {
+		t.Error("expected an attempt due a minute ago to be left to its task")
+	}
+	next = now.Add(-server.OutboxSweepInterval)
+	if !e.Overdue(now) {
+		t.Error("expected an attempt due a sweep interval ago to be overdue")
+	}
+	e = server.OutboxEntry{Status: server.OutboxPending, UpdatedAt: now.Add(-time.Hour)}
+	if !e.Overdue(now) {
+		t.Error("expected a pending entry saved an hour ago to be overdue")
+	}
+}
+
+func TestOutboxStore(t *testing.T) {
+	fs := blobfs.New("file://" + t.TempDir())
+	store := server.NewOutboxStore(fs)
+
+	dead := &server.OutboxEntry{ID: "dead", Kind: server.OutboxCRMNote, Status: server.OutboxDead, Attempts: 8}
+	if err := store.Save(dead); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Requeue("dead"); err != nil {
+		t.Fatal(err)
+	}
+	// only a marker is written; the running server moves the entry on its next sweep
+	if ok, _ := fs.Exists(context.TODO(), server.OutboxRequeuePath("dead")); !ok {
+		t.Error("expected a requeue marker for the dead entry")
+	}
+	if e, _ := store.Get("dead"); e.Status != server.OutboxDead {
+		t.Errorf("expected the entry to stay dead until the sweep, found %s", e.Status)
+	}
+	pending := &server.OutboxEntry{ID: "pending", Kind: server.OutboxCRMNote, Status: server.OutboxPending}
+	if err := store.Save(pending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Requeue("pending"); err == nil {
+		t.Error("expected requeueing a pending entry to fail")
+	}
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	done := &server.OutboxEntry{ID: "done", Kind: server.OutboxEmail, Status: server.OutboxDone}
+	if err := store.Save(done); err != nil {
+		t.Fatal(err)
+	}
+	day := now.Add(-server.OutboxRetention).AddDate(0, 0, -1).Format(time.DateOnly)
+	if err := fs.WriteFile(context.TODO(), server.OutboxDoneIndexPath(day), []byte(`["done"]`)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.Prune(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 pruned entry, found %d", n)
+	}
+	if ok, _ := fs.Exists(context.TODO(), server.OutboxPath("done")); ok {
+		t.Error("expected the delivered entry to be deleted")
+	}
+	if ok, _ := fs.Exists(context.TODO(), server.OutboxPath("dead")); !ok {
+		t.Error("expected the requeued entry to be kept")
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/binding"
+	ep "gomodules.xyz/email-providers"
+	"gopkg.in/macaron.v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// PartnerLoginLinkValidity is how long a magic link emailed to a partner can be used.
+	PartnerLoginLinkValidity = time.Hour
+	// PartnerSessionValidity is how long a partner stays signed in to the portal.
+	PartnerSessionValidity = 7 * 24 * time.Hour
+
+	// LicenseIssueLogCacheTTL is how long the portal reuses the license issue log
+	// before reading it from the spreadsheet again.
+	LicenseIssueLogCacheTTL = 15 * time.Minute
+
+	partnerSessionCookie   = "partner_session"
+	resellerTemplatePrefix = "kubedb-reseller-"
+)
+
+// Partner tokens are signed with a different context for magic links and the portal
+// session cookie, so that neither can be used as the other.
+const (
+	PartnerTokenLogin   = "partner-login"
+	PartnerTokenSession = "partner-session"
+)
+
+// NewPartnerToken returns a token of the given kind that authenticates the partner
+// email until expires.
+func NewPartnerToken(key []byte, kind, email string, expires time.Time) string {
+	email = strings.ToLower(email)
+	ts := strconv.FormatInt(expires.Unix(), 10)
+	return strings.Join([]string{email, ts, SignLink(key, kind, email, ts)}, "|")
+}
+
+// VerifyPartnerToken returns the partner email authenticated by a token of the given kind.
+func VerifyPartnerToken(key []byte, kind, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, "|")
+	if len(parts) != 3 {
+		return "", errors.New("invalid partner token")
+	}
+	email, ts, sig := parts[0], parts[1], parts[2]
+	if !VerifyLink(key, sig, kind, email, ts) {
+		return "", errors.New("invalid partner token")
+	}
+	expires, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return "", errors.New("partner token has expired")
+	}
+	return email, nil
+}
+
+func (s *Server) PartnerLoginLink(email string) string {
+	token := NewPartnerToken(s.linkKey, PartnerTokenLogin, email, time.Now().Add(PartnerLoginLinkValidity))
+	return fmt.Sprintf("%s/_/partners/login?token=%s", strings.TrimSuffix(s.opts.BaseURL, "/"), url.QueryEscape(token))
+}
+
+// PartnerLicense is a license issued for a customer of a partner.
+type PartnerLicense struct {
+	Domain    string
+	Email     string
+	Product   string
+	Cluster   string
+	Timestamp string
+}
+
+type PartnerPortal struct {
+	Email      string
+	Deals      []*DealRegistration
+	Quotations []*QuotationRecord
+	Licenses   []PartnerLicense
+}
+
+// CustomerDomains returns the customer domains of the partner's approved and active deals.
+// Pending, rejected and expired registrations don't count, because anyone can register
+// a deal for a domain they don't own.
+func (p *PartnerPortal) CustomerDomains(now time.Time) sets.String {
+	domains := sets.NewString()
+	for _, r := range p.Deals {
+		if r.Status != DealApproved || !r.Active(now) {
+			continue
+		}
+		if d := r.CustomerDomain(); d != "" {
+			domains.Insert(d)
+		}
+	}
+	return domains
+}
+
+func IsResellerQuotation(r *QuotationRecord) bool {
+	templates := r.Products
+	if len(templates) == 0 {
+		templates = []string{r.TemplateDoc}
+	}
+	for _, t := range templates {
+		if strings.HasPrefix(t, resellerTemplatePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) partnerDeals(email string) ([]*DealRegistration, error) {
+	ids, err := s.readIndex(DealIndexPath("partners", strings.ToLower(email)))
+	if err != nil {
+		return nil, err
+	}
+	deals := make([]*DealRegistration, 0, len(ids))
+	for _, id := range ids {
+		r, err := s.GetDealRegistration(id)
+		if err != nil {
+			return nil, err
+		}
+		deals = append(deals, r)
+	}
+	sort.Slice(deals, func(i, j int) bool {
+		return deals[i].RegisteredAt.After(deals[j].RegisteredAt)
+	})
+	return deals, nil
+}
+
+// resellerQuotations returns the reseller quotations for the given domains.
+func (s *Server) resellerQuotations(domains sets.String) ([]*QuotationRecord, error) {
+	var quotations []*QuotationRecord
+	for _, domain := range domains.List() {
+		quotes, err := s.readIndex(QuotationIndexPath(domain))
+		if err != nil {
+			return nil, err
+		}
+		for _, quote := range quotes {
+			r, err := s.GetQuotationRecord(quote)
+			if err != nil {
+				return nil, err
+			}
+			if IsResellerQuotation(r) {
+				quotations = append(quotations, r)
+			}
+		}
+	}
+	sort.Slice(quotations, func(i, j int) bool {
+		return quotations[i].PreparedOn.After(quotations[j].PreparedOn)
+	})
+	return quotations, nil
+}
+
+// licenseIssueLog caches the license issue log indexed by domain.
+type licenseIssueLog struct {
+	mu        sync.Mutex
+	byDomain  map[string][]PartnerLicense
+	fetchedAt time.Time
+}
+
+// IndexLicenseIssueLog indexes the rows of the license issue log by domain, newest first.
+func IndexLicenseIssueLog(rows [][]interface{}) map[string][]PartnerLicense {
+	byDomain := map[string][]PartnerLicense{}
+	for _, row := range rows {
+		if len(row) < 6 {
+			continue
+		}
+		domain := strings.ToLower(fmt.Sprint(row[0]))
+		byDomain[domain] = append(byDomain[domain], PartnerLicense{
+			Domain:    domain,
+			Email:     fmt.Sprint(row[2]),
+			Product:   fmt.Sprint(row[3]),
+			Cluster:   fmt.Sprint(row[4]),
+			Timestamp: fmt.Sprint(row[5]),
+		})
+	}
+	for _, licenses := range byDomain {
+		sort.SliceStable(licenses, func(i, j int) bool {
+			return licenses[i].Timestamp > licenses[j].Timestamp
+		})
+	}
+	return byDomain
+}
+
+// licensesByDomain returns the license issue log indexed by domain. The log is read
+// at most once per LicenseIssueLogCacheTTL.
+func (s *Server) licensesByDomain() (map[string][]PartnerLicense, error) {
+	s.licenseLog.mu.Lock()
+	defer s.licenseLog.mu.Unlock()
+
+	if s.licenseLog.byDomain != nil && time.Since(s.licenseLog.fetchedAt) < LicenseIssueLogCacheTTL {
+		return s.licenseLog.byDomain, nil
+	}
+	// Domain, Name, Email, Product, Cluster, Timestamp
+	resp, err := s.srvSheets.Spreadsheets.Values.Get(s.opts.LicenseSpreadsheetId, "License Issue Log!A2:F").Do()
+	if err != nil {
+		return nil, err
+	}
+	s.licenseLog.byDomain = IndexLicenseIssueLog(resp.Values)
+	s.licenseLog.fetchedAt = time.Now()
+	return s.licenseLog.byDomain, nil
+}
+
+// issuedLicenses returns the licenses recorded in the license issue log for the given domains.
+func (s *Server) issuedLicenses(domains sets.String) ([]PartnerLicense, error) {
+	if domains.Len() == 0 {
+		return nil, nil
+	}
+	byDomain, err := s.licensesByDomain()
+	if err != nil {
+		return nil, err
+	}
+	var licenses []PartnerLicense
+	for _, domain := range domains.List() {
+		licenses = append(licenses, byDomain[domain]...)
+	}
+	sort.SliceStable(licenses, func(i, j int) bool {
+		return licenses[i].Timestamp > licenses[j].Timestamp
+	})
+	return licenses, nil
+}
+
+func (s *Server) GetPartnerPortal(email string) (*PartnerPortal, error) {
+	deals, err := s.partnerDeals(email)
+	if err != nil {
+		return nil, err
+	}
+	p := &PartnerPortal{
+		Email: email,
+		Deals: deals,
+	}
+
+	customers := p.CustomerDomains(time.Now())
+	quoteDomains := sets.NewString(customers.List()...)
+	if !ep.IsPublicEmail(email) {
+		// resellers usually request quotations for their customers themselves
+		quoteDomains.Insert(strings.ToLower(ep.Domain(email)))
+	}
+	if p.Quotations, err = s.resellerQuotations(quoteDomains); err != nil {
+		return nil, err
+	}
+	if p.Licenses, err = s.issuedLicenses(customers); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type PartnerLoginForm struct {
+	Email string `form:"email" binding:"Required;Email"`
+}
+
+func (s *Server) partnerEmail(ctx *macaron.Context) (string, bool) {
+	email, err := VerifyPartnerToken(s.linkKey, PartnerTokenSession, ctx.GetCookie(partnerSessionCookie), time.Now())
+	if err != nil {
+		return "", false
+	}
+	return email, true
+}
+
+func (s *Server) RegisterPartnerPortalAPI(m *macaron.Macaron) {
+	secure := strings.HasPrefix(s.opts.BaseURL, "https://")
+
+	m.Get("/_/partners/", func(ctx *macaron.Context) {
+		if _, ok := s.partnerEmail(ctx); ok {
+			ctx.Redirect("/_/partners/portal")
+			return
+		}
+		ctx.HTML(http.StatusOK, "partner_login")
+	})
+
+	m.Post("/_/partners/", binding.Bind(PartnerLoginForm{}), func(ctx *macaron.Context, form PartnerLoginForm) {
+		email := strings.ToLower(strings.TrimSpace(form.Email))
+		deals, err := s.readIndex(DealIndexPath("partners", email))
+		if err != nil {
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		// Don't reveal whether the email belongs to a partner.
+		if len(deals) > 0 {
+			mailer := NewPartnerLoginMailer(s.PartnerLoginLink(email))
+			if err := s.sendMail(mailer, email, ""); err != nil {
+				klog.Warningln(err)
+			}
+		}
+		ctx.Data["Sent"] = true
+		ctx.HTML(http.StatusOK, "partner_login")
+	})
+
+	m.Get("/_/partners/login", func(ctx *macaron.Context) {
+		email, err := VerifyPartnerToken(s.linkKey, PartnerTokenLogin, ctx.Query("token"), time.Now())
+		if err != nil {
+			ctx.Data["Err"] = "This link is invalid or has expired. Please request a new one."
+			ctx.HTML(http.StatusForbidden, "partner_login")
+			return
+		}
+		session := NewPartnerToken(s.linkKey, PartnerTokenSession, email, time.Now().Add(PartnerSessionValidity))
+		ctx.SetCookie(partnerSessionCookie, session, int(PartnerSessionValidity.Seconds()), "/_/partners/", "", secure, true)
+		ctx.Redirect("/_/partners/portal")
+	})
+
+	m.Get("/_/partners/logout", func(ctx *macaron.Context) {
+		ctx.SetCookie(partnerSessionCookie, "", -1, "/_/partners/", "", secure, true)
+		ctx.Redirect("/_/partners/")
+	})
+
+	m.Get("/_/partners/portal", func(ctx *macaron.Context) {
+		email, ok := s.partnerEmail(ctx)
+		if !ok {
+			ctx.Redirect("/_/partners/")
+			return
+		}
+		p, err := s.GetPartnerPortal(email)
+		if err != nil {
+			klog.Warningln(err)
+			ctx.WriteHeader(http.StatusInternalServerError)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Data["Portal"] = p
+		ctx.HTML(http.StatusOK, "partner_portal")
+	})
+}
@@ -0,0 +1,94 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestPartnerToken(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	token := server.NewPartnerToken(key, server.PartnerTokenLogin, "Jane@Partner.com", now.Add(time.Hour))
+
+	email, err := server.VerifyPartnerToken(key, server.PartnerTokenLogin, token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email != "jane@partner.com" {
+		t.Errorf("expected jane@partner.com, found %s", email)
+	}
+	if _, err := server.VerifyPartnerToken(key, server.PartnerTokenLogin, token, now.Add(2*time.Hour)); err == nil {
+		t.Error("expected expired token to be rejected")
+	}
+	if _, err := server.VerifyPartnerToken([]byte("other"), server.PartnerTokenLogin, token, now); err == nil {
+		t.Error("expected token signed with a different key to be rejected")
+	}
+	if _, err := server.VerifyPartnerToken(key, server.PartnerTokenSession, token, now); err == nil {
+		t.Error("expected login link to be rejected as a session")
+	}
+}
+
+func TestIsResellerQuotation(t *testing.T) {
+	if !server.IsResellerQuotation(&server.QuotationRecord{TemplateDoc: "kubedb-reseller-4_2"}) {
+		t.Error("expected reseller template to match")
+	}
+	if server.IsResellerQuotation(&server.QuotationRecord{TemplateDoc: "kubedb-ent"}) {
+		t.Error("expected enterprise template not to match")
+	}
+}
+
+func TestPartnerCustomerDomains(t *testing.T) {
+	now := time.Now()
+	deal := func(email string, status server.DealStatus, expiresOn time.Time) *server.DealRegistration {
+		r := server.NewDealRegistration(server.DealRegistrationInfo{CustomerEmail: email}, now.Add(-time.Hour))
+		r.Status = status
+		r.ExpiresOn = expiresOn
+		return r
+	}
+	p := server.PartnerPortal{
+		Deals: []*server.DealRegistration{
+			deal("jane@approved.com", server.DealApproved, now.Add(time.Hour)),
+			deal("jane@pending.com", server.DealPending, now.Add(time.Hour)),
+			deal("jane@rejected.com", server.DealRejected, now.Add(time.Hour)),
+			deal("jane@lapsed.com", server.DealApproved, now.Add(-time.Minute)),
+			deal("jane@gmail.com", server.DealApproved, now.Add(time.Hour)),
+		},
+	}
+	if domains := p.CustomerDomains(now).List(); len(domains) != 1 || domains[0] != "approved.com" {
+		t.Errorf("expected only approved.com, found %v", domains)
+	}
+}
+
+func TestIndexLicenseIssueLog(t *testing.T) {
+	byDomain := server.IndexLicenseIssueLog([][]interface{}{
+		{"Example.com", "Jane", "jane@example.com", "kubedb-enterprise", "c1", "2026-01-02"},
+		{"other.com", "John", "john@other.com", "stash-enterprise", "c2", "2026-01-03"},
+		{"example.com", "Jane", "jane@example.com", "kubedb-enterprise", "c3", "2026-02-01"},
+		{"short.com", "row"},
+	})
+	licenses := byDomain["example.com"]
+	if len(licenses) != 2 || licenses[0].Cluster != "c3" {
+		t.Errorf("expected 2 example.com licenses, newest first, found %+v", licenses)
+	}
+	if _, ok := byDomain["short.com"]; ok {
+		t.Error("expected incomplete rows to be skipped")
+	}
+}
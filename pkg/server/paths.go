@@ -63,3 +63,85 @@ func FullLicenseIssueLogPath(domain, product, cluster, timestamp string) string
 func EmailAccessLogPath(domain, email, product, timestamp string) string {
 	return fmt.Sprintf("domains/%s/emails/%s/products/%s/accesslog/%s", domain, email, product, timestamp)
 }
+
+func QuotationRecordPath(quote string) string {
+	return fmt.Sprintf("quotations/%s.json", quote)
+}
+
+func QuotationJobPath(id string) string {
+	return fmt.Sprintf("jobs/quotations/%s.json", id)
+}
+
+func SignatureRequestPath(id string) string {
+	return fmt.Sprintf("signatures/%s/request.json", id)
+}
+
+func SignatureDocumentPath(id string) string {
+	return fmt.Sprintf("signatures/%s/document.pdf", id)
+}
+
+func DealRegistrationPath(id string) string {
+	return fmt.Sprintf("deals/registrations/%s.json", id)
+}
+
+// DealIndexPath returns the path of the list of registrations for a customer
+// domain or normalized company name.
+func DealIndexPath(kind, key string) string {
+	return fmt.Sprintf("deals/index/%s/%s.json", kind, key)
+}
+
+func QuotationIndexPath(domain string) string {
+	return fmt.Sprintf("quotations/index/domains/%s.json", domain)
+}
+
+func KubeDBInquiryPath(id string) string {
+	return fmt.Sprintf("kubedb-inquiries/%s.json", id)
+}
+
+func KubeDBSalesQAPath(id string) string {
+	return fmt.Sprintf("kubedb-sales-qa/%s.json", id)
+}
+
+func ContactPath(email string) string {
+	return fmt.Sprintf("contacts/%s.json", email)
+}
+
+func ContactIndexPath(kind, key string) string {
+	return fmt.Sprintf("contacts/index/%s/%s.json", kind, key)
+}
+
+func OutboxPath(id string) string {
+	return fmt.Sprintf("outbox/%s.json", id)
+}
+
+func OutboxIndexPath(status string) string {
+	return fmt.Sprintf("outbox/index/%s.json", status)
+}
+
+func OutboxDoneIndexPath(day string) string {
+	return fmt.Sprintf("outbox/index/done/%s.json", day)
+}
+
+func OutboxRequeuePath(id string) string {
+	return fmt.Sprintf("outbox/requeue/%s", id)
+}
+
+func WebinarFollowUpPath(sheetName string) string {
+	return fmt.Sprintf("webinars/%s/follow-up.json", sheetName)
+}
+
+func WebinarFollowUpScheduledPath(sheetName string) string {
+	return fmt.Sprintf("webinars/%s/follow-up-scheduled", sheetName)
+}
+
+func EmailEventsPath(email string) string {
+	return fmt.Sprintf("email-events/%s.json", email)
+}
+
+func EmailUndeliverablePath(domain, email string) string {
+	return fmt.Sprintf("domains/%s/emails/%s/undeliverable.json", domain, email)
+}
+
+func EmailPreferencesPath(domain, email string) string {
+	return fmt.Sprintf("domains/%s/emails/%s/preferences.json", domain, email)
+}
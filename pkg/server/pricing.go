@@ -0,0 +1,289 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+type Pricing struct {
+	Currency        string                 `json:"currency"`
+	PriceLists      map[string]PriceList   `json:"priceLists"`
+	Support         map[string]SupportPlan `json:"support"`
+	ResellerMargins map[string]float64     `json:"resellerMargins,omitempty"`
+	TermDiscounts   map[int]float64        `json:"termDiscounts,omitempty"`
+}
+
+type PriceList struct {
+	Plan  string               `json:"plan"`
+	Units map[string]UnitPrice `json:"units"`
+}
+
+type UnitPrice struct {
+	Description  string  `json:"description"`
+	MonthlyPrice float64 `json:"monthlyPrice"`
+}
+
+type SupportPlan struct {
+	Description string  `json:"description"`
+	Uplift      float64 `json:"uplift"` // % of license subtotal
+}
+
+// PricingRequest describes what a customer wants to buy. Quantities are keyed by unit name,
+// eg, memory-gb=64 or cluster=3.
+type PricingRequest struct {
+	Quantities      map[string]int
+	Support         string
+	Reseller        string
+	DiscountPercent float64
+	TermYears       int
+}
+
+func (req *PricingRequest) AddFlags(fs *pflag.FlagSet) {
+	fs.StringToIntVar(&req.Quantities, "pricing.quantity", req.Quantities, "Quantity per billable unit, eg, memory-gb=64,cluster=2. If empty, prices baked into the template doc are used")
+	fs.StringVar(&req.Support, "pricing.support", req.Support, "Support plan")
+	fs.StringVar(&req.Reseller, "pricing.reseller", req.Reseller, "Reseller program whose margin is deducted")
+	fs.Float64Var(&req.DiscountPercent, "pricing.discount", req.DiscountPercent, "Additional discount in percent")
+	fs.IntVar(&req.TermYears, "pricing.term-years", req.TermYears, "Term length in years")
+}
+
+func (req PricingRequest) IsEmpty() bool {
+	return len(req.Quantities) == 0
+}
+
+type LineItem struct {
+	Description string
+	Quantity    int
+	UnitPrice   int64 // cents per unit for the whole term
+	Amount      int64 // cents
+}
+
+type PriceBreakdown struct {
+	Currency  string
+	TermYears int
+	Support   string
+	LineItems []LineItem
+	Subtotal  int64
+	Total     int64
+}
+
+// Validate checks pricing against the plans of the enclosing catalog.
+func (p Pricing) Validate(plans map[string]PlanInfo) []error {
+	var errs []error
+	if len(p.PriceLists) > 0 && p.Currency == "" {
+		errs = append(errs, fmt.Errorf("pricing: missing currency"))
+	}
+	for _, name := range sortedKeys(p.PriceLists) {
+		pl := p.PriceLists[name]
+		owner := "price list " + name
+		if _, ok := plans[pl.Plan]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown plan %s", owner, pl.Plan))
+		}
+		if len(pl.Units) == 0 {
+			errs = append(errs, fmt.Errorf("%s: missing units", owner))
+		}
+		for _, unit := range sortedKeys(pl.Units) {
+			if pl.Units[unit].MonthlyPrice <= 0 {
+				errs = append(errs, fmt.Errorf("%s: unit %s must have a positive monthlyPrice", owner, unit))
+			}
+		}
+	}
+	for _, name := range sortedKeys(p.Support) {
+		if u := p.Support[name].Uplift; u < 0 {
+			errs = append(errs, fmt.Errorf("support plan %s: uplift can't be negative", name))
+		}
+	}
+	for _, name := range sortedKeys(p.ResellerMargins) {
+		if m := p.ResellerMargins[name]; m < 0 || m >= 100 {
+			errs = append(errs, fmt.Errorf("reseller %s: margin must be in [0, 100)", name))
+		}
+	}
+	for years, d := range p.TermDiscounts {
+		if years <= 0 || d < 0 || d >= 100 {
+			errs = append(errs, fmt.Errorf("term discount for %d years: invalid", years))
+		}
+	}
+	return errs
+}
+
+// Price computes the line items for a price list. Amounts are rounded to the nearest cent.
+func (p Pricing) Price(priceList string, req PricingRequest) (*PriceBreakdown, error) {
+	pl, ok := p.PriceLists[priceList]
+	if !ok {
+		return nil, fmt.Errorf("unknown price list %s", priceList)
+	}
+	if req.IsEmpty() {
+		return nil, fmt.Errorf("price list %s: no quantities requested", priceList)
+	}
+	if req.TermYears == 0 {
+		req.TermYears = 1
+	}
+	if req.TermYears < 0 {
+		return nil, fmt.Errorf("invalid term %d years", req.TermYears)
+	}
+	if req.DiscountPercent < 0 || req.DiscountPercent >= 100 {
+		return nil, fmt.Errorf("discount must be in [0, 100), found %v", req.DiscountPercent)
+	}
+
+	months := int64(12 * req.TermYears)
+	out := PriceBreakdown{
+		Currency:  p.Currency,
+		TermYears: req.TermYears,
+		Support:   req.Support,
+	}
+
+	units := make([]string, 0, len(req.Quantities))
+	for unit := range req.Quantities {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		qty := req.Quantities[unit]
+		price, ok := pl.Units[unit]
+		if !ok {
+			return nil, fmt.Errorf("price list %s: unknown unit %s", priceList, unit)
+		}
+		if qty <= 0 {
+			return nil, fmt.Errorf("price list %s: quantity for %s must be positive", priceList, unit)
+		}
+		unitPrice := toCents(price.MonthlyPrice) * months
+		out.LineItems = append(out.LineItems, LineItem{
+			Description: price.Description,
+			Quantity:    qty,
+			UnitPrice:   unitPrice,
+			Amount:      unitPrice * int64(qty),
+		})
+	}
+	licenseSubtotal := out.sum()
+
+	if req.Support != "" {
+		sp, ok := p.Support[req.Support]
+		if !ok {
+			return nil, fmt.Errorf("unknown support plan %s", req.Support)
+		}
+		if sp.Uplift > 0 {
+			out.addAdjustment(fmt.Sprintf("%s (+%s%%)", sp.Description, formatPercent(sp.Uplift)), percentOf(licenseSubtotal, sp.Uplift))
+		}
+	}
+	out.Subtotal = out.sum()
+
+	if d := p.TermDiscounts[req.TermYears]; d > 0 {
+		out.addAdjustment(fmt.Sprintf("%d year prepaid term discount (-%s%%)", req.TermYears, formatPercent(d)), -percentOf(out.sum(), d))
+	}
+	if req.Reseller != "" {
+		m, ok := p.ResellerMargins[req.Reseller]
+		if !ok {
+			return nil, fmt.Errorf("unknown reseller program %s", req.Reseller)
+		}
+		if m > 0 {
+			out.addAdjustment(fmt.Sprintf("Reseller margin (-%s%%)", formatPercent(m)), -percentOf(out.sum(), m))
+		}
+	}
+	if req.DiscountPercent > 0 {
+		out.addAdjustment(fmt.Sprintf("Discount (-%s%%)", formatPercent(req.DiscountPercent)), -percentOf(out.sum(), req.DiscountPercent))
+	}
+	out.Total = out.sum()
+
+	return &out, nil
+}
+
+func (b *PriceBreakdown) addAdjustment(desc string, amount int64) {
+	b.LineItems = append(b.LineItems, LineItem{
+		Description: desc,
+		Quantity:    1,
+		UnitPrice:   amount,
+		Amount:      amount,
+	})
+}
+
+func (b PriceBreakdown) sum() int64 {
+	var total int64
+	for _, item := range b.LineItems {
+		total += item.Amount
+	}
+	return total
+}
+
+// Replacements returns the placeholders filled into priced quotation templates.
+// Line items are available both individually ({{item-1-description}} etc.) and
+// as a single block of text ({{line-items}}).
+func (b PriceBreakdown) Replacements() map[string]string {
+	replacements := map[string]string{
+		"{{currency}}": b.Currency,
+		"{{term}}":     pluralize(b.TermYears, "year"),
+		"{{subtotal}}": formatMoney(b.Subtotal, b.Currency),
+		"{{total}}":    formatMoney(b.Total, b.Currency),
+	}
+
+	var lines []string
+	for i, item := range b.LineItems {
+		prefix := fmt.Sprintf("{{item-%d-", i+1)
+		replacements[prefix+"description}}"] = item.Description
+		replacements[prefix+"quantity}}"] = strconv.Itoa(item.Quantity)
+		replacements[prefix+"unit-price}}"] = formatMoney(item.UnitPrice, b.Currency)
+		replacements[prefix+"amount}}"] = formatMoney(item.Amount, b.Currency)
+		lines = append(lines, fmt.Sprintf("%s x %d = %s", item.Description, item.Quantity, formatMoney(item.Amount, b.Currency)))
+	}
+	replacements["{{line-items}}"] = strings.Join(lines, "\n")
+	return replacements
+}
+
+func toCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func percentOf(cents int64, percent float64) int64 {
+	return int64(math.Round(float64(cents) * percent / 100))
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	whole := strconv.FormatInt(cents/100, 10)
+	var buf strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteRune(r)
+	}
+	amount := fmt.Sprintf("%s.%02d", buf.String(), cents%100)
+	if currency == "USD" {
+		return sign + "$" + amount
+	}
+	return sign + currency + " " + amount
+}
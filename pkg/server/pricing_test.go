@@ -0,0 +1,71 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestPricing(t *testing.T) {
+	p := server.Pricing{
+		Currency: "USD",
+		PriceLists: map[string]server.PriceList{
+			"db": {
+				Plan: "db-enterprise",
+				Units: map[string]server.UnitPrice{
+					"memory-gb": {Description: "DB", MonthlyPrice: 50},
+				},
+			},
+		},
+		Support: map[string]server.SupportPlan{
+			"premium": {Description: "Premium", Uplift: 20},
+		},
+		ResellerMargins: map[string]float64{"partner": 25},
+		TermDiscounts:   map[int]float64{2: 10},
+	}
+
+	price, err := p.Price("db", server.PricingRequest{
+		Quantities: map[string]int{"memory-gb": 10},
+		Support:    "premium",
+		Reseller:   "partner",
+		TermYears:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 GB x $50 x 24 months = $12,000; +20% support = $14,400; -10% term = $12,960; -25% reseller = $9,720
+	if price.Subtotal != 1440000 {
+		t.Errorf("expected subtotal 1440000 cents, found %d", price.Subtotal)
+	}
+	if price.Total != 972000 {
+		t.Errorf("expected total 972000 cents, found %d", price.Total)
+	}
+
+	r := price.Replacements()
+	if r["{{total}}"] != "$9,720.00" {
+		t.Errorf("unexpected {{total}} %q", r["{{total}}"])
+	}
+	if r["{{item-1-quantity}}"] != "10" || r["{{item-1-unit-price}}"] != "$1,200.00" {
+		t.Errorf("unexpected first line item %q x %q", r["{{item-1-quantity}}"], r["{{item-1-unit-price}}"])
+	}
+
+	if _, err := p.Price("db", server.PricingRequest{Quantities: map[string]int{"cluster": 1}}); err == nil {
+		t.Error("expected error for unknown unit")
+	}
+}
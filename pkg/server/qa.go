@@ -270,7 +270,7 @@ func (s *Server) startTest(c cache.Cache, ip string, configDocId, email string)
 	// mail career
 	mailer := NewTestStartedMailer(cfg.TestName, ans)
 	fmt.Println("sending email for generated offer letter", ans.Email)
-	return mailer.SendMail(s.mg, MailCareer, "", nil)
+	return s.sendMail(mailer, MailCareer, "")
 }
 
 func (s *Server) RevokePermission(args []byte) error {
@@ -23,9 +23,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/avct/uasurfer"
@@ -35,6 +35,7 @@ import (
 	gdrive "gomodules.xyz/gdrive-utils"
 	listmonkclient "gomodules.xyz/listmonk-client-go"
 	"gomodules.xyz/mailer"
+	"gomodules.xyz/sets"
 	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
@@ -43,134 +44,6 @@ import (
 	"k8s.io/klog/v2"
 )
 
-type QuoteInfo struct {
-	TemplateDocId string
-	MailingLists  []string
-}
-
-var templateIds = map[string]QuoteInfo{
-	"ace": {
-		TemplateDocId: "1eCiJXFRpQ5j_PZVNPHQiYmSAktQYtk1oF4m-e4Bja3o",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-50": {
-		TemplateDocId: "1GOf0NsagFclOM2fbHtXtkfGbdBrAc4odi80eCLz5GzQ",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-60": {
-		TemplateDocId: "1Okc3gIF71vCh5uSyRtcM0oUf9sJX39jWYMsd_X7l_aA",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-69": {
-		TemplateDocId: "1L4cz-jKbpGR14P-o6UHma6oXgluLK62vFzbGOJOfnkQ",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-72": {
-		TemplateDocId: "1FvQYdKWo7Zl79DdEL59VV3RYu_WuT1tbKPiTOvyewS8",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-84": {
-		TemplateDocId: "1xV7EaBnrRQRhnSBn0mteZ74eqshq0c7x3esiqr1s3us",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-cloud": {
-		TemplateDocId: "1oD9_jpzRL5djK7i9jQ74PvzFx2xN3O867DrWSiAZrSg",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-onprem": {
-		TemplateDocId: "1XLgH6JFA2CAk-lQwZYbv921x1Izpjq7yMza8tNYwxiU",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-ent": {
-		TemplateDocId: "1O7jaucpPSt1x9KedTsWHgOBGZ5wjZ3sUQJ_LcwpA-28",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-enterprise-36": {
-		TemplateDocId: "1iyvqM_AW3uGb0TLFQgG8HwXJQNNcfxv6EhVPFVBb58w",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-enterprise-40": {
-		TemplateDocId: "18ilLa_vk163S6aaJhEQwmmYsLUr_rzH_1-9BGB6q4hw",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-enterprise-50": {
-		TemplateDocId: "1oD9_jpzRL5djK7i9jQ74PvzFx2xN3O867DrWSiAZrSg",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-enterprise-60": {
-		TemplateDocId: "1Li9ERfgYEXL80_kE-Mg1PKCQXt2cs6aK-xzhP9j45Q4",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-reseller-3_2": {
-		TemplateDocId: "1sfEYcRZHKwquoW2Bitf3P05YxZPSMkSGUF87dt1jHjs",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-reseller-4_2": {
-		TemplateDocId: "1S2GQdvfn_z2n3S0_eR8CCeDc6VAW2IzLHRaWWsGz0MQ",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-reseller-5_2": {
-		TemplateDocId: "1IglX4nkIeHal74zCTgy4Y8-772laDzhKZW5WYp-23Ns",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-payg": {
-		TemplateDocId: "1w0EeXotjL6PWNbFdlGH4cnPb_tckf_uZeWp14UwALRA",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-reseller": {
-		TemplateDocId: "1w46SFq9kA8ciibINOv7a4frzoogt-yQxmFegr9BWMcc",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"kubedb-unlimited": {
-		TemplateDocId: "13_Z2EGGdS8WASXqjMusojum0Do3U4nXytXxgZmQkxRU",
-		MailingLists:  []string{listmonkclient.MailingList_KubeDB, listmonkclient.MailingList_Stash},
-	},
-	"stash-enterprise": {
-		TemplateDocId: "1PDwas0A119L232ZyLi4reg3-sOXVagB5bhIz8acwaKY",
-		MailingLists:  []string{listmonkclient.MailingList_Stash},
-	},
-	"stash-payg": {
-		TemplateDocId: "1ao-gnhco2KY6ETvgLEZBEjLDtA_O5t7yM-WKiT1--kM",
-		MailingLists:  []string{listmonkclient.MailingList_Stash},
-	},
-	"stash-unlimited": {
-		TemplateDocId: "1iqaj1GOzo4Bj_kb3y4eondlqD7PfTmVQx4l_ECczILM",
-		MailingLists:  []string{listmonkclient.MailingList_Stash},
-	},
-	"kubeform-enterprise": {
-		TemplateDocId: "1ERPvo8KrTL6Cmk067guyqPYyrGuKTQsZUUJAakeMYa4",
-		MailingLists:  []string{listmonkclient.MailingList_Kubeform},
-	},
-	"kubeform-payg": {
-		TemplateDocId: "1w0KkMno6HIe33iefjTfijCKGBQZ3LIrVRAJRAdGYhVo",
-		MailingLists:  []string{listmonkclient.MailingList_Kubeform},
-	},
-	"kubevault-enterprise": {
-		TemplateDocId: "1iDocKQPUDADVMj3cBcReW6fE-1RD6usS9MjjS8RF0EY",
-		MailingLists:  []string{listmonkclient.MailingList_KubeVault},
-	},
-	"kubevault-payg": {
-		TemplateDocId: "1Z_z3VxxiBDHF4aB9UkbjvH74P6PGGJSzhZuMsOGxJ1o",
-		MailingLists:  []string{listmonkclient.MailingList_KubeVault},
-	},
-	"voyager-enterprise": {
-		TemplateDocId: "1GQ8UocSIgYhWRD-Zulnz4USOP9yg0K4pTRAp1fWjg8E",
-		MailingLists:  []string{listmonkclient.MailingList_Voyager},
-	},
-	"voyager-payg": {
-		TemplateDocId: "1NuOO2cpH89GKFNBNxvayLXcXOcbfcH6eIMJF2t-JCeo",
-		MailingLists:  []string{listmonkclient.MailingList_Voyager},
-	},
-	"guard-enterprise": {
-		TemplateDocId: "12a3NFvdgbfVbmmNEMt0IFbotiUfGsDX8_-NIEsbKS5w",
-		MailingLists:  []string{listmonkclient.MailingList_Console},
-	},
-	"config-syncer-enterprise": {
-		TemplateDocId: "1091KacS4i6fO8m11i8rrL825uFJpKZwHeP8uXQfukbM",
-		MailingLists:  []string{listmonkclient.MailingList_Console},
-	},
-}
-
 type QuotationForm struct {
 	Name      string   `form:"name" binding:"Required" json:"name"`
 	Email     string   `form:"email" binding:"Required" json:"email"`
@@ -180,6 +53,23 @@ type QuotationForm struct {
 	Product   []string `form:"product" binding:"Required" json:"product"`
 	Company   string   `form:"company" binding:"Required" json:"company"`
 	Tos       string   `form:"tos" binding:"Required" json:"tos"`
+	Combined  bool     `form:"combined" json:"combined,omitempty"`
+
+	// Quantities and terms used to price templates that have a price list. Templates
+	// without a price list keep the prices baked into the document.
+	Clusters  int    `form:"clusters" json:"clusters,omitempty"`
+	MemoryGB  int    `form:"memory-gb" json:"memory-gb,omitempty"`
+	Nodes     int    `form:"nodes" json:"nodes,omitempty"`
+	Support   string `form:"support" json:"support,omitempty"`
+	TermYears int    `form:"term-years" json:"term-years,omitempty"`
+}
+
+// CombinedQuotationTemplate is used as the template name of quotations that cover several plans.
+const CombinedQuotationTemplate = "combined"
+
+// IsCombined reports whether all products should be quoted in a single document.
+func (form QuotationForm) IsCombined() bool {
+	return form.Combined && len(form.Product) > 1
 }
 
 type ProductQuotation struct {
@@ -190,20 +80,66 @@ type ProductQuotation struct {
 	Telephone string `form:"telephone" binding:"Required" json:"telephone"`
 	Product   string `form:"product" binding:"Required" json:"product"`
 	Company   string `form:"company" binding:"Required" json:"company"`
+
+	Price *PriceBreakdown `form:"-" json:"-"`
 }
 
 func (form QuotationForm) Validate() error {
 	for _, product := range form.Product {
-		if _, ok := templateIds[product]; !ok {
+		if _, ok := catalog.QuotationTemplate(product); !ok {
 			return fmt.Errorf("unknown plan: %s", form.Product)
 		}
 	}
+	if form.IsCombined() && catalog.CombinedQuotation.TemplateDocId == "" {
+		return fmt.Errorf("combined quotations are not configured")
+	}
+	if form.Clusters < 0 || form.MemoryGB < 0 || form.Nodes < 0 {
+		return fmt.Errorf("quantities can't be negative")
+	}
+	if form.TermYears < 0 {
+		return fmt.Errorf("invalid term %d years", form.TermYears)
+	}
+	if _, ok := catalog.Pricing.Support[form.Support]; form.Support != "" && !ok {
+		return fmt.Errorf("unknown support plan: %s", form.Support)
+	}
 	if agree, _ := strconv.ParseBool(form.Tos); !agree {
 		return fmt.Errorf("user must agree to terms and services")
 	}
 	return nil
 }
 
+// PricingRequest returns the pricing request for a quotation template. Only the units in
+// the template's price list are requested, so one form can price several plans. The
+// request is empty for templates without a price list.
+func (form QuotationForm) PricingRequest(template string) PricingRequest {
+	req := PricingRequest{
+		Support:   form.Support,
+		TermYears: form.TermYears,
+	}
+	t, ok := catalog.QuotationTemplate(template)
+	if !ok {
+		return req
+	}
+	pl, ok := catalog.Pricing.PriceLists[t.PriceList]
+	if !ok {
+		return req
+	}
+	quantities := map[string]int{
+		"cluster":   form.Clusters,
+		"memory-gb": form.MemoryGB,
+		"node":      form.Nodes,
+	}
+	for unit, qty := range quantities {
+		if _, ok := pl.Units[unit]; ok && qty > 0 {
+			if req.Quantities == nil {
+				req.Quantities = map[string]int{}
+			}
+			req.Quantities[unit] = qty
+		}
+	}
+	return req
+}
+
 func (form ProductQuotation) Replacements() map[string]string {
 	data, err := json.Marshal(form)
 	if err != nil {
@@ -227,7 +163,13 @@ func (form ProductQuotation) Replacements() map[string]string {
 
 	now := time.Now()
 	replacements["{{prep-date}}"] = now.Format("Jan 2, 2006")
-	replacements["{{expiry-date}}"] = now.Add(3 * 30 * 24 * time.Hour).Format("Jan 2, 2006")
+	replacements["{{expiry-date}}"] = now.Add(QuotationValidity).Format("Jan 2, 2006")
+
+	if form.Price != nil {
+		for k, v := range form.Price.Replacements() {
+			replacements[k] = v
+		}
+	}
 
 	return replacements
 }
@@ -239,12 +181,24 @@ type QuotationGeneratorOptions struct {
 	LicenseSpreadsheetId string
 
 	Contact QuotationForm
+	Pricing PricingRequest
 }
 
 func (opts QuotationGeneratorOptions) Validate() error {
 	if opts.AccountsFolderId == "" {
 		return errors.New("missing parent folder id")
 	}
+	if opts.Contact.IsCombined() {
+		for _, product := range opts.Contact.Product {
+			if _, ok := catalog.QuotationTemplate(product); !ok {
+				return fmt.Errorf("unknown plan: %s", product)
+			}
+		}
+		if catalog.CombinedQuotation.TemplateDocId == "" {
+			return errors.New("combined quotations are not configured")
+		}
+		return nil
+	}
 	if opts.TemplateDocId == "" {
 		return errors.New("missing template doc id")
 	}
@@ -259,8 +213,11 @@ func (opts QuotationGeneratorOptions) Complete() QuotationGeneratorConfig {
 		LicenseSpreadsheetId: opts.LicenseSpreadsheetId,
 	}
 
-	if id, ok := templateIds[cfg.TemplateDocId]; ok {
-		cfg.TemplateDocId = id.TemplateDocId
+	if opts.Contact.IsCombined() {
+		cfg.TemplateDocId = catalog.CombinedQuotation.TemplateDocId
+		cfg.TemplateDoc = CombinedQuotationTemplate
+	} else if t, ok := catalog.QuotationTemplate(cfg.TemplateDocId); ok {
+		cfg.TemplateDocId = t.TemplateDocId
 	}
 
 	return cfg
@@ -283,8 +240,21 @@ type QuotationGenerator struct {
 	DriveService *drive.Service
 	DocService   *docs.Service
 	SheetService *gdrive.Spreadsheet
+	srvSheets    *sheets.Service
+
+	FolderId   string
+	AcceptLink string
+
+	// RequestId identifies the request in the quotation log, so that a retried request
+	// can find the quotation number logged by an earlier attempt.
+	RequestId string
 
-	FolderChan chan<- string
+	// Products is set for combined quotations and lists the quotation templates
+	// of all plans in the document.
+	Products []string
+	// PlanPrices holds the price of each plan of a combined quotation that was
+	// priced from the requested quantities.
+	PlanPrices map[string]*PriceBreakdown
 }
 
 func NewQuotationGenerator(client *http.Client, cfg QuotationGeneratorConfig) *QuotationGenerator {
@@ -313,10 +283,41 @@ func NewQuotationGenerator(client *http.Client, cfg QuotationGeneratorConfig) *Q
 		DriveService: srvDrive,
 		DocService:   srvDoc,
 		SheetService: srvSheet,
+		srvSheets:    srvSheets,
 	}
 }
 
+// Generate logs a new quotation number and creates the quotation doc for it.
 func (gen *QuotationGenerator) Generate() (string, string, error) {
+	quote, err := gen.LogQuotation()
+	if err != nil {
+		return "", "", err
+	}
+	docId, err := gen.CreateDoc(quote)
+	if err != nil {
+		return "", "", err
+	}
+	return quote, docId, nil
+}
+
+func (gen *QuotationGenerator) replacements() (map[string]string, error) {
+	replacements := gen.Contact.Replacements()
+	if len(gen.Products) > 0 {
+		sections := make([]string, 0, len(gen.Products))
+		for _, product := range gen.Products {
+			section, err := catalog.PlanSection(product, gen.PlanPrices[product])
+			if err != nil {
+				return nil, err
+			}
+			sections = append(sections, section)
+		}
+		replacements["{{plans}}"] = strings.Join(sections, "\n\n")
+	}
+	return replacements, nil
+}
+
+// LogQuotation appends the quotation to the quotation log and returns the new quotation number.
+func (gen *QuotationGenerator) LogQuotation() (string, error) {
 	if gen.Contact.Telephone != "" && gen.Location.Country == "" {
 		tel := SanitizeTelNumber(gen.Contact.Telephone)
 		if !strings.HasPrefix(tel, "+") && len(tel) == 10 {
@@ -327,31 +328,19 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 		}
 	}
 
-	replacements := gen.Contact.Replacements()
+	replacements, err := gen.replacements()
+	if err != nil {
+		return "", err
+	}
 	var clientOS, clientDevice string
 	if gen.UA != nil {
 		clientOS = gen.UA.OS.Name.StringTrimPrefix()
 		clientDevice = gen.UA.DeviceType.StringTrimPrefix()
 	}
-	quote, err := logQuotation(gen.SheetService, []string{
-		"Quotation #",
-		"Name",
-		"Title",
-		"Email",
-		"Telephone",
-		"Company",
-		"Website",
-		"Pricing Template",
-		"Preparation Date",
-		"Expiration Date",
-		"IP",
-		"Timezone",
-		"City",
-		"Country",
-		"Coordinates",
-		"Client OS",
-		"Client Device",
-	}, []string{
+	if err := gen.ensureQuotationLogHeaders(); err != nil {
+		return "", err
+	}
+	quote, err := logQuotation(gen.SheetService, quotationLogHeaders, []string{
 		"AC_DETECT_QUOTE",
 		gen.Contact.Name,
 		gen.Contact.Title,
@@ -359,7 +348,7 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 		gen.Contact.Telephone,
 		gen.Contact.Company,
 		replacements["{{website}}"],
-		gen.cfg.TemplateDoc,
+		gen.TemplateName(),
 		replacements["{{prep-date}}"],
 		replacements["{{expiry-date}}"],
 		gen.Location.IP,
@@ -369,9 +358,41 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 		gen.Location.Coordinates,
 		clientOS,
 		clientDevice,
+		replacements["{{total}}"],
+		gen.RequestId,
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("unable to append quotation: %v", err)
+		return "", fmt.Errorf("unable to append quotation: %v", err)
+	}
+	return quote, nil
+}
+
+// FindLoggedQuotation returns the quotation number logged for the RequestId, or "" if
+// the request has not been logged.
+func (gen *QuotationGenerator) FindLoggedQuotation() (string, error) {
+	if gen.RequestId == "" {
+		return "", nil
+	}
+	// Quotation # is column A and Request ID is column S
+	resp, err := gen.srvSheets.Spreadsheets.Values.Get(gen.cfg.LicenseSpreadsheetId, quotationLogSheet+"!A2:S").Do()
+	if err != nil {
+		return "", err
+	}
+	for i := len(resp.Values) - 1; i >= 0; i-- {
+		row := resp.Values[i]
+		if len(row) >= 19 && fmt.Sprint(row[18]) == gen.RequestId {
+			return fmt.Sprint(row[0]), nil
+		}
+	}
+	return "", nil
+}
+
+// CreateDoc creates the quotation doc in the customer folder. A doc created for the same
+// quotation by an earlier attempt is reused, so retries don't leave duplicate documents.
+func (gen *QuotationGenerator) CreateDoc(quote string) (string, error) {
+	replacements, err := gen.replacements()
+	if err != nil {
+		return "", err
 	}
 	replacements["{{quote}}"] = quote
 
@@ -381,7 +402,7 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 	q := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents", FolderName(gen.Contact.Email), gen.cfg.AccountsFolderId)
 	files, err := gen.DriveService.Files.List().Q(q).Spaces("drive").Do()
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 	if len(files.Files) > 0 {
 		domainFolderId = files.Files[0].Id
@@ -394,25 +415,18 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 		}
 		folder, err := gen.DriveService.Files.Create(folderMetadata).Fields("id").Do()
 		if err != nil {
-			return "", "", err
+			return "", err
 		}
 		domainFolderId = folder.Id
 	}
 	fmt.Println("Using domain folder id:", domainFolderId)
-	if gen.FolderChan != nil {
-		gen.FolderChan <- domainFolderId
-	}
+	gen.FolderId = domainFolderId
 
-	// https://developers.google.com/docs/api/how-tos/documents#copying_an_existing_document
-	copyMetadata := &drive.File{
-		Name:    gen.DocName(quote),
-		Parents: []string{domainFolderId},
-	}
-	copyFile, err := gen.DriveService.Files.Copy(gen.cfg.TemplateDocId, copyMetadata).Fields("id", "parents").Do()
+	docId, err := gen.copyTemplate(quote, domainFolderId)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-	fmt.Println("doc id:", copyFile.Id)
+	fmt.Println("doc id:", docId)
 
 	// https://developers.google.com/docs/api/how-tos/merge
 	req := &docs.BatchUpdateDocumentRequest{
@@ -429,92 +443,154 @@ func (gen *QuotationGenerator) Generate() (string, string, error) {
 			},
 		})
 	}
-	doc, err := gen.DocService.Documents.BatchUpdate(copyFile.Id, req).Do()
+	doc, err := gen.DocService.Documents.BatchUpdate(docId, req).Do()
 	if err != nil {
-		return "", "", err
+		return "", err
+	}
+	return doc.DocumentId, nil
+}
+
+// copyTemplate returns the quotation doc in the folder, copying the template doc if
+// it does not exist yet. Placeholders are replaced again by the caller, which is a
+// no-op for docs that were already filled in.
+func (gen *QuotationGenerator) copyTemplate(quote, folderId string) (string, error) {
+	q := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", gen.DocName(quote), folderId)
+	files, err := gen.DriveService.Files.List().Q(q).Spaces("drive").Do()
+	if err != nil {
+		return "", err
+	}
+	if len(files.Files) > 0 {
+		return files.Files[0].Id, nil
+	}
+
+	// https://developers.google.com/docs/api/how-tos/documents#copying_an_existing_document
+	copyMetadata := &drive.File{
+		Name:    gen.DocName(quote),
+		Parents: []string{folderId},
+	}
+	copyFile, err := gen.DriveService.Files.Copy(gen.cfg.TemplateDocId, copyMetadata).Fields("id", "parents").Do()
+	if err != nil {
+		return "", err
+	}
+	return copyFile.Id, nil
+}
+
+// ApplyPricing computes line items for the template doc. It is a no-op for empty requests,
+// so templates with prices baked into the document keep working.
+func (gen *QuotationGenerator) ApplyPricing(req PricingRequest) error {
+	if req.IsEmpty() {
+		return nil
+	}
+	if len(gen.Products) > 0 {
+		return errors.New("combined quotations don't support line-item pricing")
 	}
-	return quote, doc.DocumentId, nil
+	price, err := catalog.PriceQuotation(gen.cfg.TemplateDoc, req)
+	if err != nil {
+		return err
+	}
+	gen.Contact.Price = price
+	return nil
+}
+
+// ApplyPlanPricing prices each plan of a combined quotation that has a price list from
+// the quantities on the form. Plans without a price list keep their list description.
+func (gen *QuotationGenerator) ApplyPlanPricing(form QuotationForm) error {
+	for _, product := range gen.Products {
+		req := form.PricingRequest(product)
+		if req.IsEmpty() {
+			continue
+		}
+		price, err := catalog.PriceQuotation(product, req)
+		if err != nil {
+			return err
+		}
+		if gen.PlanPrices == nil {
+			gen.PlanPrices = map[string]*PriceBreakdown{}
+		}
+		gen.PlanPrices[product] = price
+	}
+	return nil
 }
 
 func (gen *QuotationGenerator) DocName(quote string) string {
 	return fmt.Sprintf("%s QUOTE #%s", FolderName(gen.Contact.Email), quote)
 }
 
-func (gen *QuotationGenerator) GetMailer() mailer.Mailer {
-	switch strings.ToLower(gen.cfg.TemplateDoc) {
-	case "kubedb-payg":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "KubeDB",
-			FullPlan:         "Pay-As-You-Go (PAYG)",
-			Plan:             "PAYG",
-		})
-	case "kubedb-enterprise":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "KubeDB",
-			FullPlan:         "Enterprise",
-			Plan:             "Enterprise",
-		})
-	case "stash-payg":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Stash",
-			FullPlan:         "Pay-As-You-Go (PAYG)",
-			Plan:             "PAYG",
-		})
-	case "stash-enterprise":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Stash",
-			FullPlan:         "Enterprise",
-			Plan:             "Enterprise",
-		})
-	case "kubeform-payg":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Kubeform",
-			FullPlan:         "Pay-As-You-Go (PAYG)",
-			Plan:             "PAYG",
-		})
-	case "kubeform-enterprise":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Kubeform",
-			FullPlan:         "Enterprise",
-			Plan:             "Enterprise",
-		})
-	case "kubevault-payg":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "KubeVault",
-			FullPlan:         "Pay-As-You-Go (PAYG)",
-			Plan:             "PAYG",
-		})
-	case "kubevault-enterprise":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "KubeVault",
-			FullPlan:         "Enterprise",
-			Plan:             "Enterprise",
-		})
-	case "voyager-payg":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Voyager",
-			FullPlan:         "Pay-As-You-Go (PAYG)",
-			Plan:             "PAYG",
-		})
-	case "voyager-enterprise":
-		return NewQuotationMailer(QuotationEmailData{
-			ProductQuotation: gen.Contact,
-			Offer:            "Voyager",
-			FullPlan:         "Enterprise",
-			Plan:             "Enterprise",
-		})
-	default:
-		panic(fmt.Errorf("unknown template doc %s", gen.cfg.TemplateDoc))
+// TemplateName returns the quotation template name recorded in the quotation log.
+func (gen *QuotationGenerator) TemplateName() string {
+	if len(gen.Products) > 0 {
+		return CombinedQuotationTemplate + ": " + strings.Join(gen.Products, ", ")
+	}
+	return gen.cfg.TemplateDoc
+}
+
+// MailingLists returns the listmonk lists for every plan in the quotation.
+func (gen *QuotationGenerator) MailingLists() []string {
+	products := gen.Products
+	if len(products) == 0 {
+		products = []string{gen.Contact.Product}
+	}
+	lists := sets.NewString()
+	for _, product := range products {
+		t, _ := catalog.QuotationTemplate(product)
+		lists.Insert(t.MailingLists...)
 	}
+	return lists.List()
+}
+
+func (gen *QuotationGenerator) GetMailer() (mailer.Mailer, error) {
+	if len(gen.Products) > 0 {
+		return gen.getCombinedMailer()
+	}
+
+	info, err := catalog.QuotationMailer(gen.cfg.TemplateDoc)
+	if err != nil {
+		return mailer.Mailer{}, err
+	}
+	return NewQuotationMailer(QuotationEmailData{
+		ProductQuotation: gen.Contact,
+		Offer:            info.Offer,
+		FullPlan:         info.FullPlan,
+		Plan:             info.Plan,
+		AcceptLink:       gen.AcceptLink,
+	}), nil
+}
+
+func (gen *QuotationGenerator) getCombinedMailer() (mailer.Mailer, error) {
+	var offers, fullPlans, plans []string
+	for _, product := range gen.Products {
+		info, err := catalog.QuotationMailer(product)
+		if err != nil {
+			return mailer.Mailer{}, err
+		}
+		offers = appendUnique(offers, info.Offer)
+		fullPlans = appendUnique(fullPlans, info.FullPlan)
+		plans = appendUnique(plans, info.Plan)
+	}
+	return NewQuotationMailer(QuotationEmailData{
+		ProductQuotation: gen.Contact,
+		Offer:            joinWords(offers),
+		FullPlan:         joinWords(fullPlans),
+		Plan:             joinWords(plans),
+		AcceptLink:       gen.AcceptLink,
+	}), nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// joinWords joins words as in "KubeDB, Stash and KubeVault".
+func joinWords(words []string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
 }
 
 func SanitizeTelNumber(tel string) string {
@@ -527,8 +603,83 @@ func SanitizeTelNumber(tel string) string {
 	return buf.String()
 }
 
+const quotationLogSheet = "Quotation Log"
+
+var quotationLogHeaders = []string{
+	"Quotation #",
+	"Name",
+	"Title",
+	"Email",
+	"Telephone",
+	"Company",
+	"Website",
+	"Pricing Template",
+	"Preparation Date",
+	"Expiration Date",
+	"IP",
+	"Timezone",
+	"City",
+	"Country",
+	"Coordinates",
+	"Client OS",
+	"Client Device",
+	"Quoted Total",
+	"Request ID",
+}
+
+var (
+	quotationLogHeadersMu sync.Mutex
+	quotationLogHeadersOK bool
+)
+
+// ensureQuotationLogHeaders adds the headers of columns appended to the quotation log
+// after the sheet was created, eg, "Quoted Total" and "Request ID".
+func (gen *QuotationGenerator) ensureQuotationLogHeaders() error {
+	quotationLogHeadersMu.Lock()
+	defer quotationLogHeadersMu.Unlock()
+	if quotationLogHeadersOK {
+		return nil
+	}
+
+	if _, err := gen.SheetService.EnsureSheet(quotationLogSheet, quotationLogHeaders); err != nil {
+		return err
+	}
+	resp, err := gen.srvSheets.Spreadsheets.Values.Get(gen.cfg.LicenseSpreadsheetId, quotationLogSheet+"!1:1").Do()
+	if err != nil {
+		return err
+	}
+	var row []interface{}
+	if len(resp.Values) > 0 {
+		row = resp.Values[0]
+	}
+	if len(row) < len(quotationLogHeaders) {
+		missing := make([]interface{}, 0, len(quotationLogHeaders)-len(row))
+		for _, h := range quotationLogHeaders[len(row):] {
+			missing = append(missing, h)
+		}
+		cell := fmt.Sprintf("%s!%s1", quotationLogSheet, columnName(len(row)))
+		_, err = gen.srvSheets.Spreadsheets.Values.Update(gen.cfg.LicenseSpreadsheetId, cell, &sheets.ValueRange{
+			Values: [][]interface{}{missing},
+		}).ValueInputOption("RAW").Do()
+		if err != nil {
+			return err
+		}
+	}
+	quotationLogHeadersOK = true
+	return nil
+}
+
+// columnName returns the A1 name of the zero based column index.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
 func logQuotation(si *gdrive.Spreadsheet, headers, data []string) (string, error) {
-	const sheetName = "Quotation Log"
+	const sheetName = quotationLogSheet
 
 	sheetId, err := si.EnsureSheet(sheetName, headers)
 	if err != nil {
@@ -577,111 +728,186 @@ func FolderName(email string) string {
 	return parts[len(parts)-1]
 }
 
-func (s *Server) HandleEmailQuotation(ctx *macaron.Context, contact QuotationForm) error {
-	folderChan := make(chan string)
-
-	for idx, product := range contact.Product {
-		cfg := QuotationGeneratorConfig{
-			AccountsFolderId:     AccountFolderId,
-			TemplateDocId:        templateIds[product].TemplateDocId,
-			TemplateDoc:          product,
-			LicenseSpreadsheetId: LicenseSpreadsheetId,
-		}
-
-		gen := NewQuotationGenerator(s.driveClient, cfg)
-		gen.Contact = ProductQuotation{
-			Name:      contact.Name,
-			Email:     contact.Email,
-			CC:        contact.CC,
-			Title:     contact.Title,
-			Telephone: contact.Telephone,
-			Product:   product,
-			Company:   contact.Company,
-		}
-		gen.UA = uasurfer.Parse(ctx.Req.UserAgent())
-		location := GeoLocation{
-			IP: GetIP(ctx.Req.Request),
-		}
-		DecorateGeoData(s.geodb, &location)
-		gen.Location = location
-		if idx == 0 {
-			gen.FolderChan = folderChan
-		}
-
-		go func() {
-			sendEmail := ctx.QueryBool("send_email")
-			if err := s.processQuotationRequest(gen, sendEmail); err != nil {
-				// email support@appscode.com failed to process request
-				mailer := NewQuotationProcessFailedMailer(gen, err)
-				e2 := mailer.SendMail(s.mg, MailSupport, "", nil)
-				if e2 != nil {
-					_, _ = fmt.Fprintf(os.Stderr, "failed send email %v", e2)
-				}
-			}
-		}()
+func (s *Server) HandleEmailQuotation(ctx *macaron.Context, contact QuotationForm) (*QuotationJob, error) {
+	location := GeoLocation{
+		IP: GetIP(ctx.Req.Request),
 	}
+	DecorateGeoData(s.geodb, &location)
+	return s.EnqueueQuotationJob(contact, ctx.QueryBool("send_email"), ctx.Req.UserAgent(), location)
+}
 
-	select {
-	case folderId := <-folderChan:
-		ctx.Redirect(fmt.Sprintf("https://drive.google.com/drive/folders/%s", folderId))
-	case <-time.After(30 * time.Second):
-		// can't wait too long. Cloudflare does not like that
-		// respond(ctx, []byte("Thank you! Please check your email in a few minutes for price quotation. Don't forget to check spam folder."))
-		ctx.Redirect(ctx.Req.URL.String(), http.StatusSeeOther)
+// NewJobQuotationGenerator returns the generator for a product of a quotation job,
+// priced from the quantities on the quotation form.
+func NewJobQuotationGenerator(client *http.Client, job *QuotationJob, res QuotationJobResult) (*QuotationGenerator, error) {
+	product := res.Product
+	cfg := QuotationGeneratorConfig{
+		AccountsFolderId:     AccountFolderId,
+		TemplateDoc:          product,
+		LicenseSpreadsheetId: LicenseSpreadsheetId,
 	}
-	return nil
+	if len(res.Products) > 0 {
+		cfg.TemplateDocId = catalog.CombinedQuotation.TemplateDocId
+	} else {
+		t, _ := catalog.QuotationTemplate(product)
+		cfg.TemplateDocId = t.TemplateDocId
+	}
+
+	gen := NewQuotationGenerator(client, cfg)
+	gen.Contact = ProductQuotation{
+		Name:      job.Form.Name,
+		Email:     job.Form.Email,
+		CC:        job.Form.CC,
+		Title:     job.Form.Title,
+		Telephone: job.Form.Telephone,
+		Product:   product,
+		Company:   job.Form.Company,
+	}
+	gen.UA = uasurfer.Parse(job.UserAgent)
+	gen.Location = job.Location
+	gen.Products = res.Products
+	gen.RequestId = job.ID + "/" + res.Product
+	if len(res.Products) == 0 {
+		if err := gen.ApplyPricing(job.Form.PricingRequest(product)); err != nil {
+			return nil, err
+		}
+	} else if err := gen.ApplyPlanPricing(job.Form); err != nil {
+		return nil, err
+	}
+	return gen, nil
 }
 
-func (s *Server) processQuotationRequest(gen *QuotationGenerator, sendEmail bool) error {
-	quote, docId, err := gen.Generate()
-	if err != nil {
-		return err
+// processQuotationRequest runs the steps of a quotation request that were not completed
+// by an earlier attempt. save is called after every step, so a retry never logs a second
+// quotation number, generates a second document or sends a second email for the same product.
+func (s *Server) processQuotationRequest(gen *QuotationGenerator, res *QuotationJobResult, sendEmail bool, save func() error) error {
+	if res.Quotation == "" && res.Logging {
+		// an earlier attempt may have logged the quotation before it failed
+		quote, err := gen.FindLoggedQuotation()
+		if err != nil {
+			return err
+		}
+		res.Quotation = quote
+	}
+	if res.Quotation == "" {
+		res.Logging = true
+		if err := save(); err != nil {
+			return err
+		}
+		quote, err := gen.LogQuotation()
+		if err != nil {
+			return err
+		}
+		res.Quotation = quote
+		if err = save(); err != nil {
+			return err
+		}
 	}
 
-	mailer := gen.GetMailer()
-	mailer.GoogleDocIds = map[string]string{
-		gen.DocName(quote) + ".pdf": docId,
+	if res.DocId == "" {
+		docId, err := gen.CreateDoc(res.Quotation)
+		if err != nil {
+			return err
+		}
+		res.DocId = docId
+		res.FolderId = gen.FolderId
+		if err = save(); err != nil {
+			return err
+		}
 	}
 
-	srvDrive, err := drive.NewService(context.TODO(), option.WithHTTPClient(s.driveClient))
-	if err != nil {
-		return err
+	if !res.Tracked {
+		record := NewQuotationRecord(res.Quotation, gen.cfg.TemplateDoc, res.DocId, gen.Contact, time.Now())
+		record.Products = gen.Products
+		err := s.trackQuotation(record)
+		if err != nil {
+			return err
+		}
+		s.recordContact(ContactUpdate{
+			Email:   gen.Contact.Email,
+			Name:    gen.Contact.Name,
+			Company: gen.Contact.Company,
+			Title:   gen.Contact.Title,
+			Phone:   gen.Contact.Telephone,
+			Country: gen.Location.Country,
+			Source:  ContactSourceQuotation,
+			Event:   "quotation_generated",
+			Summary: gen.TemplateName(),
+			Ref:     res.Quotation,
+		})
+		res.Tracked = true
+		if err = save(); err != nil {
+			return err
+		}
 	}
 
-	if sendEmail {
+	if sendEmail && !res.Emailed {
+		gen.AcceptLink = s.QuotationAcceptLink(res.Quotation)
+		mailer, err := gen.GetMailer()
+		if err != nil {
+			return err
+		}
+		mailer.GoogleDocIds = map[string]string{
+			gen.DocName(res.Quotation) + ".pdf": res.DocId,
+		}
+
 		fmt.Println("sending email to", gen.Contact.Email)
-		err = mailer.SendMail(s.mg, gen.Contact.Email, gen.Contact.CC, srvDrive)
+		err = s.sendMail(mailer, gen.Contact.Email, gen.Contact.CC)
 		if err != nil {
 			return err
 		}
+		if _, err = s.setQuotationStatus(res.Quotation, QuotationSent, "emailed to "+gen.Contact.Email); err != nil {
+			return err
+		}
+		res.Emailed = true
+		if err = save(); err != nil {
+			return err
+		}
 	}
 
-	err = s.listmonk.SubscribeToList(listmonkclient.SubscribeRequest{
-		Email:        gen.Contact.Email,
-		Name:         gen.Contact.Name,
-		MailingLists: templateIds[gen.Contact.Product].MailingLists,
-	})
-	if err != nil {
-		return err
+	// The subscription and the CRM note are queued in the outbox, so a listmonk or CRM
+	// outage is retried there instead of failing the quotation job.
+	if !res.Subscribed {
+		err := s.subscribeToList(listmonkclient.SubscribeRequest{
+			Email:        gen.Contact.Email,
+			Name:         gen.Contact.Name,
+			MailingLists: gen.MailingLists(),
+		})
+		if err != nil {
+			return err
+		}
+		res.Subscribed = true
+		if err = save(); err != nil {
+			return err
+		}
 	}
 
-	return s.noteEventQuotation(gen.Contact, EventQuotationGenerated{
-		BaseNoteDescription: freshsalesclient.BaseNoteDescription{
-			Event: "quotation_generated",
-			Client: freshsalesclient.ClientInfo{
-				OS:     gen.UA.OS.Name.StringTrimPrefix(),
-				Device: gen.UA.DeviceType.StringTrimPrefix(),
-				Location: freshsalesclient.GeoLocation{
-					IP:          gen.Location.IP,
-					Timezone:    gen.Location.Timezone,
-					City:        gen.Location.City,
-					Country:     gen.Location.Country,
-					Coordinates: gen.Location.Coordinates,
+	if !res.Noted {
+		err := s.noteEventQuotation(gen.Contact, EventQuotationGenerated{
+			BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+				Event: "quotation_generated",
+				Client: freshsalesclient.ClientInfo{
+					OS:     gen.UA.OS.Name.StringTrimPrefix(),
+					Device: gen.UA.DeviceType.StringTrimPrefix(),
+					Location: freshsalesclient.GeoLocation{
+						IP:          gen.Location.IP,
+						Timezone:    gen.Location.Timezone,
+						City:        gen.Location.City,
+						Country:     gen.Location.Country,
+						Coordinates: gen.Location.Coordinates,
+					},
 				},
 			},
-		},
-		Quotation:     quote,
-		TemplateDoc:   gen.cfg.TemplateDoc,
-		TemplateDocId: gen.cfg.TemplateDocId,
-	})
+			Quotation:     res.Quotation,
+			TemplateDoc:   gen.TemplateName(),
+			TemplateDocId: gen.cfg.TemplateDocId,
+		})
+		if err != nil {
+			return err
+		}
+		res.Noted = true
+		if err = save(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
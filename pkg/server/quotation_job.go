@@ -0,0 +1,274 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-macaron/auth"
+	"github.com/rs/xid"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobRetrying  JobStatus = "retrying"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+const (
+	TaskQuotationJob = "quotation-job"
+
+	quotationJobMaxAttempts = 6
+	quotationJobBaseBackoff = time.Minute
+)
+
+// QuotationJob is a persisted quotation request. Each requested product goes through
+// the steps recorded in its QuotationJobResult.
+type QuotationJob struct {
+	ID        string        `json:"id"`
+	Status    JobStatus     `json:"status"`
+	Form      QuotationForm `json:"form"`
+	SendEmail bool          `json:"sendEmail"`
+	UserAgent string        `json:"userAgent,omitempty"`
+	Location  GeoLocation   `json:"location"`
+
+	Attempts      int                  `json:"attempts"`
+	LastError     string               `json:"lastError,omitempty"`
+	NextAttemptAt *time.Time           `json:"nextAttemptAt,omitempty"`
+	Results       []QuotationJobResult `json:"results"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type QuotationJobResult struct {
+	Product  string   `json:"product"`
+	Products []string `json:"products,omitempty"` // combined quotation
+	// Logging is set before the quotation is appended to the quotation log.
+	Logging    bool   `json:"logging,omitempty"`
+	Quotation  string `json:"quotation,omitempty"`
+	DocId      string `json:"docId,omitempty"`
+	FolderId   string `json:"folderId,omitempty"`
+	Tracked    bool   `json:"tracked,omitempty"`
+	Emailed    bool   `json:"emailed,omitempty"`
+	Subscribed bool   `json:"subscribed,omitempty"`
+	Noted      bool   `json:"noted,omitempty"`
+}
+
+func (r QuotationJobResult) Done(sendEmail bool) bool {
+	return r.Quotation != "" && r.DocId != "" && r.Tracked && (r.Emailed || !sendEmail) && r.Subscribed && r.Noted
+}
+
+// Progress reports how many of the requested products are fully processed.
+func (job *QuotationJob) Progress() string {
+	var done int
+	for _, r := range job.Results {
+		if r.Done(job.SendEmail) {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d/%d", done, len(job.Results))
+}
+
+// QuotationJobBackoff returns the delay before the next attempt. Delays double after
+// every failed attempt, starting at one minute.
+func QuotationJobBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return quotationJobBaseBackoff << (attempts - 1)
+}
+
+func (s *Server) GetQuotationJob(id string) (*QuotationJob, error) {
+	data, err := s.fs.ReadFile(context.TODO(), QuotationJobPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var job QuotationJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *Server) saveQuotationJob(job *QuotationJob) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), QuotationJobPath(job.ID), data)
+}
+
+// NewQuotationJob returns a pending job with one result per quotation document.
+func NewQuotationJob(form QuotationForm, sendEmail bool, userAgent string, location GeoLocation, now time.Time) *QuotationJob {
+	job := &QuotationJob{
+		ID:        xid.New().String(),
+		Status:    JobPending,
+		Form:      form,
+		SendEmail: sendEmail,
+		UserAgent: userAgent,
+		Location:  location,
+		CreatedAt: now,
+	}
+	if form.IsCombined() {
+		job.Results = append(job.Results, QuotationJobResult{
+			Product:  CombinedQuotationTemplate,
+			Products: form.Product,
+		})
+	} else {
+		for _, product := range form.Product {
+			job.Results = append(job.Results, QuotationJobResult{Product: product})
+		}
+	}
+	return job
+}
+
+func (s *Server) EnqueueQuotationJob(form QuotationForm, sendEmail bool, userAgent string, location GeoLocation) (*QuotationJob, error) {
+	now := time.Now()
+	job := NewQuotationJob(form, sendEmail, userAgent, location, now)
+	if err := s.saveQuotationJob(job); err != nil {
+		return nil, err
+	}
+	if err := s.scheduleQuotationJob(job.ID, now); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Server) scheduleQuotationJob(id string, at time.Time) error {
+	args, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	return s.sch.ScheduleTask(at, TaskQuotationJob, args)
+}
+
+// RunQuotationJob is the scheduler task for quotation jobs. Failures are retried with
+// QuotationJobBackoff. Errors loading or saving the job count as a failed attempt and
+// reschedule the task too, since the scheduler drops tasks that return an error.
+func (s *Server) RunQuotationJob(args []byte) error {
+	var id string
+	if err := json.Unmarshal(args, &id); err != nil {
+		return err
+	}
+	job, err := s.GetQuotationJob(id)
+	if err != nil {
+		if ok, e2 := s.fs.Exists(context.TODO(), QuotationJobPath(id)); e2 == nil && !ok {
+			return err
+		}
+		return s.retryQuotationJobTask(id, quotationJobMaxAttempts, err)
+	}
+	if job.Status == JobSucceeded || job.Status == JobFailed {
+		return nil
+	}
+
+	job.Status = JobRunning
+	job.Attempts++
+	job.NextAttemptAt = nil
+	if err := s.saveQuotationJob(job); err != nil {
+		return s.retryQuotationJobTask(job.ID, job.Attempts, err)
+	}
+
+	save := func() error { return s.saveQuotationJob(job) }
+	err = nil
+	for i := range job.Results {
+		if job.Results[i].Done(job.SendEmail) {
+			continue
+		}
+		var gen *QuotationGenerator
+		if gen, err = NewJobQuotationGenerator(s.driveClient, job, job.Results[i]); err == nil {
+			err = s.processQuotationRequest(gen, &job.Results[i], job.SendEmail, save)
+		}
+		if err != nil {
+			err = fmt.Errorf("product %s: %w", job.Results[i].Product, err)
+			break
+		}
+	}
+
+	if err == nil {
+		job.Status = JobSucceeded
+		job.LastError = ""
+		if err := s.saveQuotationJob(job); err != nil {
+			return s.retryQuotationJobTask(job.ID, job.Attempts, err)
+		}
+		return nil
+	}
+
+	klog.Warningf("quotation job %s attempt %d failed: %v", job.ID, job.Attempts, err)
+	job.LastError = err.Error()
+	if job.Attempts >= quotationJobMaxAttempts {
+		job.Status = JobFailed
+		if e2 := s.saveQuotationJob(job); e2 != nil {
+			return s.retryQuotationJobTask(job.ID, job.Attempts, e2)
+		}
+		// email support@appscode.com failed to process request
+		mailer := NewQuotationProcessFailedMailer(job)
+		if e2 := s.sendMail(mailer, MailSupport, ""); e2 != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed send email %v", e2)
+		}
+		return nil
+	}
+
+	next := time.Now().Add(QuotationJobBackoff(job.Attempts))
+	job.Status = JobRetrying
+	job.NextAttemptAt = &next
+	if err := s.saveQuotationJob(job); err != nil {
+		return s.retryQuotationJobTask(job.ID, job.Attempts, err)
+	}
+	return s.scheduleQuotationJob(job.ID, next)
+}
+
+// retryQuotationJobTask reschedules a job whose record could not be loaded or saved.
+// The job is left as it is in the bucket, and the next run picks up from there.
+func (s *Server) retryQuotationJobTask(id string, attempts int, err error) error {
+	klog.Warningf("quotation job %s could not be loaded or saved, will retry: %v", id, err)
+	return s.scheduleQuotationJob(id, time.Now().Add(QuotationJobBackoff(attempts)))
+}
+
+func (s *Server) RegisterQuotationJobAPI(m *macaron.Macaron) {
+	m.Get("/_/quotation-jobs/:id", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		job, err := s.GetQuotationJob(ctx.Params("id"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		if ctx.Query("format") == "json" {
+			ctx.JSON(http.StatusOK, map[string]any{
+				"job":      job,
+				"progress": job.Progress(),
+			})
+			return
+		}
+		ctx.Data["Job"] = job
+		ctx.Data["Progress"] = job.Progress()
+		ctx.Data["Finished"] = job.Status == JobSucceeded || job.Status == JobFailed
+		ctx.HTML(http.StatusOK, "quotation_job")
+	})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+
+	"github.com/go-macaron/binding"
+	"gopkg.in/macaron.v1"
+)
+
+func TestQuotationJobBackoff(t *testing.T) {
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, d := range expected {
+		if got := server.QuotationJobBackoff(i + 1); got != d {
+			t.Errorf("attempt %d: expected backoff %s, found %s", i+1, d, got)
+		}
+	}
+}
+
+func TestQuotationJobProgress(t *testing.T) {
+	job := server.QuotationJob{
+		SendEmail: true,
+		Results: []server.QuotationJobResult{
+			{Product: "kubedb-ent", Quotation: "AC2610001", DocId: "doc-1", Tracked: true, Emailed: true, Subscribed: true, Noted: true},
+			{Product: "stash-enterprise", Quotation: "AC2610002", DocId: "doc-2", Tracked: true, Subscribed: true, Noted: true},
+			{Product: "voyager-enterprise", Logging: true, Quotation: "AC2610003", Subscribed: true, Noted: true},
+		},
+	}
+	if p := job.Progress(); p != "1/3" {
+		t.Errorf("expected progress 1/3, found %s", p)
+	}
+	job.SendEmail = false
+	if p := job.Progress(); p != "2/3" {
+		t.Errorf("expected progress 2/3, found %s", p)
+	}
+}
+
+func TestWebQuotationPricing(t *testing.T) {
+	var form server.QuotationForm
+	m := macaron.New()
+	m.Post("/_/pricing/", binding.Bind(server.QuotationForm{}), func(f server.QuotationForm) {
+		form = f
+	})
+
+	body := url.Values{
+		"name":       {"Jane Doe"},
+		"email":      {"jane@example.com"},
+		"title":      {"CTO"},
+		"telephone":  {"+1 415 555 0100"},
+		"company":    {"Example Inc"},
+		"product":    {"kubedb-ent", "kubedb-84"},
+		"clusters":   {"2"},
+		"memory-gb":  {"64"},
+		"nodes":      {"5"},
+		"term-years": {"2"},
+		"support":    {"premium"},
+		"tos":        {"true"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/_/pricing/", strings.NewReader(body.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m.ServeHTTP(httptest.NewRecorder(), req)
+	if err := form.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	job := server.NewQuotationJob(form, true, "", server.GeoLocation{}, time.Now())
+	gen, err := server.NewJobQuotationGenerator(http.DefaultClient, job, job.Results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	price := gen.Contact.Price
+	if price == nil {
+		t.Fatal("expected kubedb-ent quotation to be priced")
+	}
+	if price.TermYears != 2 || price.Support != "premium" {
+		t.Errorf("expected 2 year premium quotation, found %d years %s", price.TermYears, price.Support)
+	}
+	// (64 GB x $50 + 2 clusters x $100) x 24 months = $81,600; +20% support = $97,920; -5% term = $93,024
+	if price.Total != 9302400 {
+		t.Errorf("expected total 9302400 cents, found %d", price.Total)
+	}
+
+	// templates without a price list keep the prices in the document
+	gen, err = server.NewJobQuotationGenerator(http.DefaultClient, job, job.Results[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Contact.Price != nil {
+		t.Errorf("expected kubedb-84 quotation to be unpriced, found %+v", gen.Contact.Price)
+	}
+
+	form.Combined = true
+	job = server.NewQuotationJob(form, true, "", server.GeoLocation{}, time.Now())
+	gen, err = server.NewJobQuotationGenerator(http.DefaultClient, job, job.Results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Contact.Product != server.CombinedQuotationTemplate || len(gen.Products) != 2 {
+		t.Errorf("unexpected combined quotation product %q for plans %v", gen.Contact.Product, gen.Products)
+	}
+	// each plan with a price list is priced from the form's quantities
+	if price := gen.PlanPrices["kubedb-ent"]; price == nil || price.Total != 9302400 {
+		t.Errorf("expected kubedb-ent plan to be priced at 9302400 cents, found %+v", price)
+	}
+	if price := gen.PlanPrices["kubedb-84"]; price != nil {
+		t.Errorf("expected kubedb-84 plan to be unpriced, found %+v", price)
+	}
+	if err := gen.ApplyPricing(form.PricingRequest("kubedb-ent")); err == nil {
+		t.Error("expected combined quotation pricing to be rejected")
+	}
+}
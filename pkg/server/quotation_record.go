@@ -0,0 +1,445 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/auth"
+	"github.com/go-macaron/binding"
+	ep "gomodules.xyz/email-providers"
+	freshsalesclient "gomodules.xyz/freshsales-client-go"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+type QuotationStatus string
+
+const (
+	QuotationDraft    QuotationStatus = "draft"
+	QuotationSent     QuotationStatus = "sent"
+	QuotationAccepted QuotationStatus = "accepted"
+	QuotationExpired  QuotationStatus = "expired"
+)
+
+// QuotationValidity is how long a quotation can be accepted after it is prepared.
+const QuotationValidity = 3 * 30 * 24 * time.Hour
+
+// quotationAcceptTimeout is how long an acceptance can take to generate the EULA. After that,
+// the acceptance is assumed to have crashed and the quotation can be accepted again.
+const quotationAcceptTimeout = 10 * time.Minute
+
+const TaskQuotationExpiry = "quotation-expiry"
+
+type QuotationEvent struct {
+	Status    QuotationStatus `json:"status"`
+	Timestamp time.Time       `json:"timestamp"`
+	Note      string          `json:"note,omitempty"`
+}
+
+type QuotationRecord struct {
+	Quotation    string           `json:"quotation"`
+	TemplateDoc  string           `json:"templateDoc"`
+	Products     []string         `json:"products,omitempty"` // combined quotation
+	DocId        string           `json:"docId"`
+	Contact      ProductQuotation `json:"contact"`
+	Price        *PriceBreakdown  `json:"price,omitempty"`
+	PreparedOn   time.Time        `json:"preparedOn"`
+	ExpiresOn    time.Time        `json:"expiresOn"`
+	Status       QuotationStatus  `json:"status"`
+	History      []QuotationEvent `json:"history"`
+	EULAFolderId string           `json:"eulaFolderId,omitempty"`
+	EULADocId    string           `json:"eulaDocId,omitempty"`
+	// AcceptingSince is set while the EULA of an accepted quotation is generated.
+	AcceptingSince *time.Time `json:"acceptingSince,omitempty"`
+}
+
+func NewQuotationRecord(quote, templateDoc, docId string, contact ProductQuotation, preparedOn time.Time) *QuotationRecord {
+	r := &QuotationRecord{
+		Quotation:   quote,
+		TemplateDoc: templateDoc,
+		DocId:       docId,
+		Contact:     contact,
+		Price:       contact.Price,
+		PreparedOn:  preparedOn,
+		ExpiresOn:   preparedOn.Add(QuotationValidity),
+		Status:      QuotationDraft,
+	}
+	r.History = append(r.History, QuotationEvent{Status: QuotationDraft, Timestamp: preparedOn})
+	return r
+}
+
+var quotationTransitions = map[QuotationStatus][]QuotationStatus{
+	QuotationDraft: {QuotationSent, QuotationAccepted, QuotationExpired},
+	QuotationSent:  {QuotationAccepted, QuotationExpired},
+}
+
+func (r *QuotationRecord) SetStatus(status QuotationStatus, note string, now time.Time) error {
+	for _, next := range quotationTransitions[r.Status] {
+		if next == status {
+			r.Status = status
+			r.History = append(r.History, QuotationEvent{Status: status, Timestamp: now, Note: note})
+			return nil
+		}
+	}
+	return fmt.Errorf("quotation %s can't be marked %s, current status is %s", r.Quotation, status, r.Status)
+}
+
+// Acceptable reports whether the customer can still accept the quotation.
+func (r *QuotationRecord) Acceptable(now time.Time) error {
+	switch r.Status {
+	case QuotationAccepted:
+		return fmt.Errorf("quotation %s has already been accepted", r.Quotation)
+	case QuotationExpired:
+		return fmt.Errorf("quotation %s has expired", r.Quotation)
+	}
+	if now.After(r.ExpiresOn) {
+		return fmt.Errorf("quotation %s has expired", r.Quotation)
+	}
+	if r.Accepting(now) {
+		return fmt.Errorf("quotation %s is being accepted", r.Quotation)
+	}
+	return nil
+}
+
+// Accepting reports whether the EULA of an acceptance is being generated.
+func (r *QuotationRecord) Accepting(now time.Time) bool {
+	return r.AcceptingSince != nil && now.Before(r.AcceptingSince.Add(quotationAcceptTimeout))
+}
+
+// EULAInfo returns the EULA form prefilled from the quotation.
+func (r *QuotationRecord) EULAInfo() (*EULAInfo, error) {
+	templates := r.Products
+	if len(templates) == 0 {
+		templates = []string{r.TemplateDoc}
+	}
+	var products []string
+	payg := true
+	for _, t := range templates {
+		m, err := catalog.QuotationMailer(t)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, m.Offer+" "+m.Plan)
+		payg = payg && IsPAYGProduct(t)
+	}
+
+	info := &EULAInfo{
+		Company:     r.Contact.Company,
+		Quotation:   r.Quotation,
+		Product:     strings.Join(products, ", "),
+		PaymentTerm: PaymentTermAnnual,
+		SupportPlan: SupportPlanStandard,
+	}
+	if !ep.IsPublicEmail(r.Contact.Email) {
+		info.Domain = ep.Domain(r.Contact.Email)
+	}
+	if payg {
+		info.PaymentTerm = PaymentTermPAYG
+	}
+	if r.Price != nil {
+		if r.Price.Support == SupportPlanPremium {
+			info.SupportPlan = SupportPlanPremium
+		}
+		info.TermYears = r.Price.TermYears
+	}
+	return info, nil
+}
+
+// quotationMu serializes status changes, so that an accept racing with the expiry task
+// can't both succeed.
+var quotationMu sync.Mutex
+
+func (s *Server) GetQuotationRecord(quote string) (*QuotationRecord, error) {
+	data, err := s.fs.ReadFile(context.TODO(), QuotationRecordPath(quote))
+	if err != nil {
+		return nil, err
+	}
+	var r QuotationRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Server) saveQuotationRecord(r *QuotationRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), QuotationRecordPath(r.Quotation), data)
+}
+
+func (s *Server) setQuotationStatus(quote string, status QuotationStatus, note string) (*QuotationRecord, error) {
+	quotationMu.Lock()
+	defer quotationMu.Unlock()
+
+	r, err := s.GetQuotationRecord(quote)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.SetStatus(status, note, time.Now()); err != nil {
+		return nil, err
+	}
+	return r, s.saveQuotationRecord(r)
+}
+
+// trackQuotation stores a new quotation record and schedules its expiry.
+func (s *Server) trackQuotation(r *QuotationRecord) error {
+	if err := s.saveQuotationRecord(r); err != nil {
+		return err
+	}
+	if !ep.IsPublicEmail(r.Contact.Email) {
+		if err := s.appendIndex(QuotationIndexPath(strings.ToLower(ep.Domain(r.Contact.Email))), r.Quotation); err != nil {
+			return err
+		}
+	}
+	args, err := json.Marshal(r.Quotation)
+	if err != nil {
+		return err
+	}
+	return s.sch.ScheduleTask(r.ExpiresOn, TaskQuotationExpiry, args)
+}
+
+func (s *Server) ExpireQuotation(args []byte) error {
+	var quote string
+	if err := json.Unmarshal(args, &quote); err != nil {
+		return err
+	}
+
+	quotationMu.Lock()
+	defer quotationMu.Unlock()
+
+	r, err := s.GetQuotationRecord(quote)
+	if err != nil {
+		return err
+	}
+	if r.Status != QuotationDraft && r.Status != QuotationSent {
+		return nil
+	}
+	now := time.Now()
+	if r.Accepting(now) {
+		// the customer accepted in time, check again once the EULA is generated
+		return s.sch.ScheduleTask(now.Add(quotationAcceptTimeout), TaskQuotationExpiry, args)
+	}
+	if err := r.SetStatus(QuotationExpired, "", now); err != nil {
+		return err
+	}
+	return s.saveQuotationRecord(r)
+}
+
+func (s *Server) QuotationAcceptLink(quote string) string {
+	return fmt.Sprintf("%s/_/quotations/%s/accept?sig=%s",
+		strings.TrimSuffix(s.opts.BaseURL, "/"),
+		url.PathEscape(quote),
+		SignLink(s.linkKey, "quotation-accept", quote))
+}
+
+// QuotationAcceptForm holds the fields the customer fills in when accepting a quotation.
+// The domain, support plan and term are taken from the quotation record.
+type QuotationAcceptForm struct {
+	Sig     string `form:"sig" binding:"Required" json:"sig"`
+	Company string `form:"company" binding:"Required" json:"company"`
+	Address string `form:"address" binding:"Required" json:"address"`
+}
+
+// AcceptQuotation generates the EULA for the quotation and then marks it accepted.
+// The Google Drive calls are made without holding quotationMu; the quotation is claimed
+// with AcceptingSince instead, so that a second accept or the expiry task waits for it.
+func (s *Server) AcceptQuotation(quote string, form QuotationAcceptForm) (*QuotationRecord, error) {
+	info, err := s.claimQuotationAccept(quote, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// the EULA is filed next to the quotation doc
+	folderId, err := s.eulaFolder(FolderName(info.SignerEmail))
+	var docId string
+	if err == nil {
+		docId, err = s.generateEULADoc(info, folderId)
+	}
+
+	r, err := s.finishQuotationAccept(quote, folderId, docId, err)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		s.publishEULA(info, docId)
+
+		s.recordContact(ContactUpdate{
+			Email:   r.Contact.Email,
+			Name:    r.Contact.Name,
+			Company: r.Contact.Company,
+			Title:   r.Contact.Title,
+			Phone:   r.Contact.Telephone,
+			Source:  ContactSourceQuotation,
+			Event:   "quotation_accepted",
+			Ref:     r.Quotation,
+		})
+
+		err := s.noteEventQuotation(r.Contact, EventQuotationStatus{
+			BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+				Event: "quotation_accepted",
+			},
+			Quotation: r.Quotation,
+			Status:    string(r.Status),
+		})
+		if err != nil {
+			klog.Warningln(err)
+		}
+	}()
+	return r, nil
+}
+
+// finishQuotationAccept releases the claim of claimQuotationAccept and marks the quotation
+// accepted if its EULA was generated.
+func (s *Server) finishQuotationAccept(quote, folderId, docId string, genErr error) (*QuotationRecord, error) {
+	quotationMu.Lock()
+	defer quotationMu.Unlock()
+
+	r, err := s.GetQuotationRecord(quote)
+	if err != nil {
+		return nil, err
+	}
+	r.AcceptingSince = nil
+	if genErr != nil {
+		if err := s.saveQuotationRecord(r); err != nil {
+			klog.Warningln(err)
+		}
+		return nil, genErr
+	}
+	r.EULAFolderId = folderId
+	r.EULADocId = docId
+	if err := r.SetStatus(QuotationAccepted, "accepted by customer", time.Now()); err != nil {
+		return nil, err
+	}
+	return r, s.saveQuotationRecord(r)
+}
+
+// claimQuotationAccept checks that the quotation can be accepted, marks the acceptance
+// in progress and returns the EULA to generate for it.
+func (s *Server) claimQuotationAccept(quote string, form QuotationAcceptForm) (*EULAInfo, error) {
+	quotationMu.Lock()
+	defer quotationMu.Unlock()
+
+	r, err := s.GetQuotationRecord(quote)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := r.Acceptable(now); err != nil {
+		return nil, err
+	}
+
+	info, err := r.EULAInfo()
+	if err != nil {
+		return nil, err
+	}
+	info.Company = form.Company
+	info.Address = form.Address
+	info.SignerName = r.Contact.Name
+	info.SignerEmail = r.Contact.Email
+	if err := info.Complete(); err != nil {
+		return nil, err
+	}
+	if err := info.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.AcceptingSince = &now
+	if err := s.saveQuotationRecord(r); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Server) RegisterQuotationAPI(m *macaron.Macaron) {
+	m.Get("/_/quotations/:quote/accept", func(ctx *macaron.Context) {
+		quote := ctx.Params("quote")
+		ctx.Data["Quotation"] = quote
+
+		if !VerifyLink(s.linkKey, ctx.Query("sig"), "quotation-accept", quote) {
+			ctx.Data["Err"] = "This link is invalid. Please contact sales@appscode.com"
+			ctx.HTML(http.StatusForbidden, "quotation_accept")
+			return
+		}
+		r, err := s.GetQuotationRecord(quote)
+		if err != nil {
+			klog.Warningln(err)
+			ctx.Data["Err"] = "Quotation not found. Please contact sales@appscode.com"
+			ctx.HTML(http.StatusNotFound, "quotation_accept")
+			return
+		}
+		if err := r.Acceptable(time.Now()); err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusOK, "quotation_accept")
+			return
+		}
+		info, err := r.EULAInfo()
+		if err != nil {
+			ctx.Data["Err"] = err.Error()
+			ctx.HTML(http.StatusInternalServerError, "quotation_accept")
+			return
+		}
+
+		ctx.Data["Sig"] = ctx.Query("sig")
+		ctx.Data["EULA"] = info
+		ctx.Data["ExpiresOn"] = r.ExpiresOn.Format("Jan 2, 2006")
+		if r.Price != nil {
+			ctx.Data["Total"] = formatMoney(r.Price.Total, r.Price.Currency)
+		}
+		ctx.HTML(http.StatusOK, "quotation_accept")
+	})
+
+	m.Post("/_/quotations/:quote/accept", binding.Bind(QuotationAcceptForm{}), func(ctx *macaron.Context, form QuotationAcceptForm) {
+		quote := ctx.Params("quote")
+		if !VerifyLink(s.linkKey, form.Sig, "quotation-accept", quote) {
+			ctx.WriteHeader(http.StatusForbidden)
+			respond(ctx, []byte("invalid link"))
+			return
+		}
+
+		_, err := s.AcceptQuotation(quote, form)
+		if err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Data["Quotation"] = quote
+		ctx.Data["Accepted"] = true
+		ctx.HTML(http.StatusOK, "quotation_accept")
+	})
+
+	m.Get("/_/quotations/:quote", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		r, err := s.GetQuotationRecord(ctx.Params("quote"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, r)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestQuotationRecordStatus(t *testing.T) {
+	now := time.Now()
+	r := server.NewQuotationRecord("AC2610001", "kubedb-ent", "doc", server.ProductQuotation{
+		Email:   "jane@example.com",
+		Company: "Example",
+	}, now)
+
+	if err := r.SetStatus(server.QuotationSent, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Acceptable(now.Add(server.QuotationValidity + time.Minute)); err == nil {
+		t.Error("expected quotation to be expired after validity period")
+	}
+	r.AcceptingSince = &now
+	if err := r.Acceptable(now.Add(time.Minute)); err == nil {
+		t.Error("expected quotation to be claimed while its EULA is generated")
+	}
+	if err := r.Acceptable(now.Add(time.Hour)); err != nil {
+		t.Errorf("expected stale acceptance to be released, found %v", err)
+	}
+	r.AcceptingSince = nil
+	if err := r.SetStatus(server.QuotationAccepted, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetStatus(server.QuotationExpired, "", now); err == nil {
+		t.Error("accepted quotation must not expire")
+	}
+	if len(r.History) != 3 {
+		t.Errorf("expected 3 history events, found %d", len(r.History))
+	}
+
+	info, err := r.EULAInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Quotation != "AC2610001" || info.Domain != "example.com" || info.Product != "KubeDB Enterprise" {
+		t.Errorf("unexpected EULA info %+v", info)
+	}
+}
+
+func TestSignLink(t *testing.T) {
+	key := []byte("secret")
+	sig := server.SignLink(key, "quotation-accept", "AC2610001")
+	if !server.VerifyLink(key, sig, "quotation-accept", "AC2610001") {
+		t.Error("expected signature to verify")
+	}
+	if server.VerifyLink(key, sig, "quotation-accept", "AC2610002") {
+		t.Error("signature must not verify for a different quotation")
+	}
+}
+
+func TestSchedulerResumesTaskKind(t *testing.T) {
+	dir := t.TempDir()
+	sch, err := server.NewScheduler(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch.Register("test", func([]byte) error { return nil })
+	if err := sch.ScheduleTask(time.Now().Add(time.Second), "test", []byte(`"x"`)); err != nil {
+		t.Fatal(err)
+	}
+	_ = sch.Close()
+
+	time.Sleep(1500 * time.Millisecond)
+
+	sch, err = server.NewScheduler(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sch.Close() // nolint:errcheck
+
+	var got string
+	sch.Register("test", func(args []byte) error {
+		got = string(args)
+		return nil
+	})
+	if err := sch.Cleanup(func([]byte) error {
+		t.Error("task must be dispatched to its registered handler")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got != `"x"` {
+		t.Errorf("expected handler to receive %q, found %q", `"x"`, got)
+	}
+}
@@ -18,6 +18,7 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -36,6 +37,15 @@ var buffers = sync.Pool{
 type Scheduler struct {
 	db *leveldb.DB
 	s  *tasks.Scheduler
+
+	handlers map[string]func([]byte) error
+}
+
+// scheduledTask is persisted by ScheduleTask so that Cleanup can find the handler
+// for a task after a restart. Tasks stored by Schedule are not wrapped.
+type scheduledTask struct {
+	Kind string          `json:"kind"`
+	Args json.RawMessage `json:"args"`
 }
 
 func NewScheduler(dir string) (*Scheduler, error) {
@@ -48,8 +58,9 @@ func NewScheduler(dir string) (*Scheduler, error) {
 		return nil, err
 	}
 	return &Scheduler{
-		s:  tasks.New(),
-		db: db,
+		s:        tasks.New(),
+		db:       db,
+		handlers: map[string]func([]byte) error{},
 	}, nil
 }
 
@@ -58,13 +69,51 @@ func (s *Scheduler) Close() error {
 	return s.db.Close() // nolint:errcheck
 }
 
+// Register sets the handler for tasks of the given kind. Handlers must be registered
+// before Cleanup is called, so that persisted tasks can be resumed.
+func (s *Scheduler) Register(kind string, fn func([]byte) error) {
+	s.handlers[kind] = fn
+}
+
+// ScheduleTask schedules a task that is handled by the handler registered for kind.
+// args must be valid json.
+func (s *Scheduler) ScheduleTask(t time.Time, kind string, args []byte) error {
+	fn, ok := s.handlers[kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for task kind %s", kind)
+	}
+	data, err := json.Marshal(scheduledTask{Kind: kind, Args: args})
+	if err != nil {
+		return err
+	}
+	return s.Schedule(t, func([]byte) error { return fn(args) }, data)
+}
+
+// dispatch returns a function that runs tasks stored by ScheduleTask with their registered
+// handler and falls back to fn for everything else.
+func (s *Scheduler) dispatch(fn func([]byte) error) func([]byte) error {
+	return func(args []byte) error {
+		var task scheduledTask
+		if err := json.Unmarshal(args, &task); err == nil && task.Kind != "" {
+			h, ok := s.handlers[task.Kind]
+			if !ok {
+				return fmt.Errorf("no handler registered for task kind %s", task.Kind)
+			}
+			return h(task.Args)
+		}
+		return fn(args)
+	}
+}
+
 func (s *Scheduler) Cleanup(fn func([]byte) error) error {
+	fn = s.dispatch(fn)
+
 	iter := s.db.NewIterator(nil, nil)
 	for iter.Next() {
 		// Remember that the contents of the returned slice should not be modified, and
 		// only valid until the next call to Next.
-		key := iter.Key()
-		val := iter.Value()
+		key := bytes.Clone(iter.Key())
+		val := bytes.Clone(iter.Value())
 
 		del := false
 		ts, args, ok := bytes.Cut(val, []byte("|"))
@@ -125,9 +174,26 @@ func (s *Scheduler) Schedule(t time.Time, fn func([]byte) error, args []byte) er
 	buf := buffers.Get().(*bytes.Buffer)
 	defer buffers.Put(buf)
 
+	buf.Reset()
+	buf.WriteString(t.Format(time.RFC3339))
+	buf.WriteRune('|')
+	buf.Write(args)
+
 	for {
 		id := xid.New()
+		if _, err := s.s.Lookup(id.String()); err == nil {
+			continue
+		}
+		// persist before scheduling, so that a task due immediately can't delete
+		// its entry before it is written.
+		if err := s.db.Put(id.Bytes(), buf.Bytes(), nil); err != nil {
+			return err
+		}
+
 		interval := time.Until(t)
+		if interval <= 0 {
+			interval = time.Millisecond
+		}
 		err := s.s.AddWithID(id.String(), &tasks.Task{
 			Interval: interval,
 			RunOnce:  true,
@@ -143,18 +209,12 @@ func (s *Scheduler) Schedule(t time.Time, fn func([]byte) error, args []byte) er
 			},
 		})
 		if err == tasks.ErrIDInUse {
+			_ = s.db.Delete(id.Bytes(), nil)
 			continue
 		} else if err != nil {
+			_ = s.db.Delete(id.Bytes(), nil)
 			return errors.Wrapf(err, "failed to schedule task")
 		}
-
-		buf.Reset()
-		buf.WriteString(t.Format(time.RFC3339))
-		buf.WriteRune('|')
-		buf.Write(args)
-		if err = s.db.Put(id.Bytes(), buf.Bytes(), nil); err != nil {
-			return err
-		}
 		_, _ = fmt.Fprintf(os.Stdout, "Task with args %s will execute in %s", string(args), interval)
 		return nil
 	}
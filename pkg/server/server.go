@@ -21,14 +21,14 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"net/smtp"
 	"os"
 	"strings"
 	"time"
 
 	"go.bytebuilders.dev/license-verifier/info"
+	"go.bytebuilders.dev/offline-license-server/pkg/crm"
+	"go.bytebuilders.dev/offline-license-server/pkg/mailtransport"
 	"go.bytebuilders.dev/offline-license-server/templates"
 
 	"github.com/avct/uasurfer"
@@ -44,7 +44,6 @@ import (
 	"gomodules.xyz/blobfs"
 	"gomodules.xyz/cert/certstore"
 	ep "gomodules.xyz/email-providers"
-	freshsalesclient "gomodules.xyz/freshsales-client-go"
 	gdrive "gomodules.xyz/gdrive-utils"
 	listmonkclient "gomodules.xyz/listmonk-client-go"
 	"gomodules.xyz/mailer"
@@ -65,13 +64,13 @@ import (
 type Server struct {
 	opts *Options
 
-	certs      *certstore.CertStore
-	fs         blobfs.Interface
-	mg         *mailer.SMTPService
-	freshsales *freshsalesclient.Client
-	listmonk   *listmonkclient.Client
-	geodb      *geoip2.Reader
-	sch        *Scheduler
+	certs    *certstore.CertStore
+	fs       blobfs.Interface
+	mt       mailtransport.Interface
+	crm      crm.Interface
+	listmonk *listmonkclient.Client
+	geodb    *geoip2.Reader
+	sch      *Scheduler
 
 	driveClient *http.Client
 	srvDrive    *drive.Service
@@ -82,6 +81,7 @@ type Server struct {
 	srvYT       *youtube.Service
 
 	zc               *zoom.Client
+	zoomReports      *ZoomReportClient
 	zoomAccountEmail string
 
 	blockedDomains  sets.String
@@ -89,9 +89,28 @@ type Server struct {
 	blockedClusters sets.String
 
 	couponCodes map[string]string
+
+	linkKey []byte
+
+	emailWebhooks map[string]EmailWebhook
+
+	licenseLog licenseIssueLog
+
+	// eulaClauses holds the EULA template docs that have a {{clauses}} placeholder.
+	eulaClauses sets.String
 }
 
 func New(opts *Options) (*Server, error) {
+	if err := UseCatalogFile(opts.CatalogFile); err != nil {
+		return nil, err
+	}
+	if err := UseDripCampaignsFile(opts.DripCampaignsFile); err != nil {
+		return nil, err
+	}
+	if err := UseMailTemplatesDir(opts.MailTemplatesDir); err != nil {
+		return nil, err
+	}
+
 	fs := blobfs.New(opts.LicenseBucket)
 
 	certs, err := GetCertStore(fs, opts.Issuer)
@@ -107,6 +126,11 @@ func New(opts *Options) (*Server, error) {
 		}
 	}
 
+	crmClient, err := crm.New(opts.CRMProvider, opts.CRMLocalFile)
+	if err != nil {
+		return nil, err
+	}
+
 	sch, err := NewScheduler(opts.TaskDir)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create scheduler")
@@ -147,21 +171,17 @@ func New(opts *Options) (*Server, error) {
 		return nil, fmt.Errorf("unable to create YouTube client: %v", err)
 	}
 
-	smtpHost, _, err := net.SplitHostPort(opts.SMTPAddress)
+	mt, err := mailtransport.New(opts.Mail)
 	if err != nil {
 		return nil, err
 	}
-	mg := &mailer.SMTPService{
-		Address: opts.SMTPAddress,
-		Auth:    smtp.PlainAuth("", opts.SMTPUsername, opts.SMTPPassword, smtpHost),
-	}
-	return &Server{
+	s := &Server{
 		opts:             opts,
 		certs:            certs,
 		fs:               fs,
-		mg:               mg,
+		mt:               mt,
 		sheet:            sheet,
-		freshsales:       freshsalesclient.DefaultFromEnv(),
+		crm:              crmClient,
 		listmonk:         listmonkclient.New(opts.listmonkHost, opts.listmonkUsername, opts.listmonkPassword),
 		geodb:            geodb,
 		sch:              sch,
@@ -172,12 +192,25 @@ func New(opts *Options) (*Server, error) {
 		srvCalendar:      srvCalendar,
 		srvYT:            srvYT,
 		zc:               zoom.NewClient(),
+		zoomReports:      NewZoomReportClient(),
 		zoomAccountEmail: os.Getenv("ZOOM_ACCOUNT_EMAIL"),
 		blockedDomains:   sets.NewString(opts.BlockedDomains...),
 		blockedEmails:    sets.NewString(opts.BlockedEmails...),
 		blockedClusters:  sets.NewString(opts.BlockedClusters...),
 		couponCodes:      ParseCouponCodes(opts.Coupons),
-	}, nil
+		linkKey:          linkSigningKey(opts, certs),
+		emailWebhooks:    emailWebhooks(opts),
+	}
+	if err := s.loadEULATemplates(); err != nil {
+		return nil, err
+	}
+	sch.Register(TaskQuotationExpiry, s.ExpireQuotation)
+	sch.Register(TaskQuotationJob, s.RunQuotationJob)
+	sch.Register(TaskDealRegistrationExpiry, s.ExpireDealRegistration)
+	sch.Register(TaskOutbox, s.RunOutboxEntry)
+	sch.Register(TaskWebinarReminder, s.SendWebinarReminder)
+	sch.Register(TaskWebinarFollowUp, s.RunWebinarFollowUp)
+	return s, nil
 }
 
 func (s *Server) Close() {
@@ -222,7 +255,7 @@ func (s *Server) Run() error {
 		ctx.Redirect("https://appscode.com/issue-license/", http.StatusPermanentRedirect)
 	})
 	m.Get("/issue-license", func(ctx *macaron.Context) {
-		ctx.Data["Product"] = productAliases[ctx.Query("p")]
+		ctx.Data["Product"] = catalog.PlanForAlias(ctx.Query("p"))
 		ctx.Data["RecaptchaSiteKey"] = s.opts.RecaptchaSiteKey
 		ctx.HTML(200, "index") // 200 is the response code.
 	})
@@ -262,6 +295,7 @@ func (s *Server) Run() error {
 			return
 		}
 		ctx.Data["Product"] = product
+		ctx.Data["Combined"] = catalog.CombinedQuotation.TemplateDocId != ""
 		ctx.HTML(200, "pricing") // 200 is the response code.
 	})
 	m.Post("/_/pricing/", binding.Bind(QuotationForm{}), func(ctx *macaron.Context, contact QuotationForm) {
@@ -271,12 +305,21 @@ func (s *Server) Run() error {
 			return
 		}
 
-		err := s.HandleEmailQuotation(ctx, contact)
+		job, err := s.HandleEmailQuotation(ctx, contact)
 		if err != nil {
 			ctx.WriteHeader(http.StatusInternalServerError)
 			respond(ctx, []byte(err.Error()))
 			return
 		}
+		status := fmt.Sprintf("/_/quotation-jobs/%s", job.ID)
+		if strings.Contains(ctx.Req.Header.Get("Accept"), "application/json") {
+			ctx.JSON(http.StatusAccepted, map[string]string{
+				"id":     job.ID,
+				"status": status + "?format=json",
+			})
+			return
+		}
+		ctx.Redirect(status, http.StatusSeeOther)
 	})
 
 	m.Get("/_/eula/", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
@@ -305,7 +348,7 @@ func (s *Server) Run() error {
 
 	m.Get("/_/deal_registration/", func(ctx *macaron.Context) {
 		ctx.Data["RecaptchaSiteKey"] = s.opts.RecaptchaSiteKey
-		ctx.Data["Product"] = productAliases[ctx.Query("p")]
+		ctx.Data["Product"] = catalog.PlanForAlias(ctx.Query("p"))
 		ctx.HTML(200, "deal_registration") // 200 is the response code.
 	})
 	m.Post("/_/deal_registration/", binding.Bind(DealRegistrationInfo{}), func(ctx *macaron.Context, form DealRegistrationInfo) {
@@ -316,13 +359,17 @@ func (s *Server) Run() error {
 			return
 		}
 
-		err := s.HandleDealRegistration(&form)
+		r, err := s.HandleDealRegistration(&form)
 		if err != nil {
 			ctx.WriteHeader(http.StatusInternalServerError)
 			respond(ctx, []byte(err.Error()))
 			return
 		}
-		respond(ctx, []byte("Thank you! Your deal has been registered successfully."))
+		if len(r.Conflicts) > 0 {
+			respond(ctx, []byte(fmt.Sprintf("Thank you! Your deal has been registered with id %s. This customer has already been registered by another partner, so our team will review your registration and notify you of the decision.", r.ID)))
+			return
+		}
+		respond(ctx, []byte(fmt.Sprintf("Thank you! Your deal has been registered with id %s. You will be notified once it is approved.", r.ID)))
 	})
 
 	m.Get("/_/kubedb_inquiry/", func(ctx *macaron.Context) {
@@ -347,6 +394,7 @@ func (s *Server) Run() error {
 	})
 
 	m.Get("/_/kubedb_sales_qa/", func(ctx *macaron.Context) {
+		ctx.Data["SalesQA"] = CurrentSalesQAQuestionnaire()
 		ctx.HTML(200, "kubedb_sales_qa")
 	})
 	m.Post("/_/kubedb_sales_qa/", func(ctx *macaron.Context) {
@@ -363,6 +411,11 @@ func (s *Server) Run() error {
 			respond(ctx, []byte(err.Error()))
 			return
 		}
+		if err := CurrentSalesQAQuestionnaire().Score(&form); err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
 
 		err := s.HandleKubeDBSalesQA(&form)
 		if err != nil {
@@ -370,7 +423,7 @@ func (s *Server) Run() error {
 			respond(ctx, []byte(err.Error()))
 			return
 		}
-		respond(ctx, []byte("Thank you! Your sales QA result has been submitted successfully."))
+		respond(ctx, []byte(fmt.Sprintf("Thank you! Your sales QA result has been submitted successfully.\n%s (lead score %d)", form.VerdictText, form.LeadScore)))
 	})
 
 	m.Get("/_/offerletter/", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
@@ -393,13 +446,38 @@ func (s *Server) Run() error {
 		ctx.Redirect(fmt.Sprintf("https://drive.google.com/drive/folders/%s", folderId))
 	})
 
+	s.RegisterQuotationAPI(m)
+	s.RegisterQuotationJobAPI(m)
+	s.RegisterSignatureAPI(m)
+	s.RegisterOfferLetterBulkAPI(m)
+	s.RegisterDealRegistrationAPI(m)
+	s.RegisterKubeDBInquiryAPI(m)
+	s.RegisterPartnerPortalAPI(m)
+	s.RegisterContactAPI(m)
 	s.RegisterWebinarAPI(m)
 	s.RegisterNewsAPI(m)
-	// m.Post("/_/webhooks/mailgun/", s.HandleMailgunWebhook)
+	s.RegisterEmailWebhookAPI(m)
+	s.RegisterEmailSuppressionAPI(m)
+	s.RegisterEmailPreferencesAPI(m)
+	s.RegisterMailPreviewAPI(m)
 
 	s.RegisterYoutubeAPI(m)
 	s.RegisterQAAPI(m)
 
+	go func() {
+		if err := s.sch.Cleanup(s.RevokePermission); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}()
+	go func() {
+		for {
+			if err := s.SweepOutbox(time.Now()); err != nil {
+				klog.Warningln(err)
+			}
+			time.Sleep(OutboxSweepInterval)
+		}
+	}()
+
 	if !s.opts.EnableSSL {
 		addr := fmt.Sprintf(":%d", s.opts.Port)
 		fmt.Println("Listening to addr", addr)
@@ -428,20 +506,11 @@ func (s *Server) Run() error {
 
 	if s.opts.EnableDripCampaign {
 		go func() {
-			if err := mailer.RunCampaigns(context.TODO(),
-				NewCommunitySignupCampaign(s.srvSheets, s.mg),
-				NewEnterpriseSignupCampaign(s.srvSheets, s.mg),
-				NewEnterpriseFirstTimeCampaign(s.srvSheets, s.mg),
-			); err != nil {
+			if err := s.RunDripCampaigns(context.TODO(), s.dripCampaigns()...); err != nil {
 				panic(err)
 			}
 		}()
 	}
-	go func() {
-		if err := s.sch.Cleanup(s.RevokePermission); err != nil {
-			_, _ = fmt.Fprintln(os.Stderr, err.Error())
-		}
-	}()
 	go func() {
 		// does automatic http to https redirects
 		err := http.ListenAndServe(":http", certManager.HTTPHandler(nil))
@@ -485,7 +554,7 @@ func (s *Server) HandleRegisterEmail(req RegisterRequest) error {
 		}
 
 		mailer := NewRegistrationMailer(params)
-		err = mailer.SendMail(s.mg, req.Email, "", nil)
+		err = s.sendMail(mailer, req.Email, "")
 		if err != nil {
 			return err
 		}
@@ -506,7 +575,7 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 		mailer := NewBlockedLicenseMailer(LicenseMailData{
 			LicenseForm: info,
 		})
-		err := mailer.SendMail(s.mg, MailSales, info.CC, nil)
+		err := s.sendMail(mailer, MailSales, info.CC)
 		if err != nil {
 			return err
 		}
@@ -544,6 +613,12 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 		return err
 	}
 
+	location := GeoLocation{
+		IP: GetIP(ctx.Req.Request),
+	}
+	DecorateGeoData(s.geodb, &location)
+	info.Locale = s.mailLocale(info.Email, info.Locale, location.Country)
+
 	if !skipEmailDomains.Has(ep.Domain(info.Email)) {
 		// nolint:errcheck
 		go func() (err error) {
@@ -553,39 +628,40 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 				}
 			}()
 
-			dcEnt := NewEnterpriseSignupCampaign(s.srvSheets, s.mg)
-			audEnt, err := dcEnt.ListAudiences()
-			if err != nil {
-				return err
-			}
-
-			dcComm := NewCommunitySignupCampaign(s.srvSheets, s.mg)
-			audCom, err := dcComm.ListAudiences()
-			if err != nil {
-				return err
+			campaigns := CurrentDripCampaigns()
+			returning := false
+			for _, dc := range campaigns.Campaigns {
+				if dc.Conditions.Audience != DripAudienceNew {
+					continue
+				}
+				aud, err := campaigns.DripCampaign(&dc, s.srvSheets).ListAudiences()
+				if err != nil {
+					return err
+				}
+				if aud.Has(info.Email) {
+					returning = true
+					break
+				}
 			}
 
 			params := SignupCampaignData{
 				Name:                info.Name,
 				Cluster:             info.Cluster,
 				Product:             info.Product(),
-				ProductDisplayName:  SupportedProducts[info.Product()].DisplayName,
+				ProductDisplayName:  catalog.Plan(info.Product()).DisplayName,
 				IsEnterpriseProduct: IsEnterpriseProduct(info.Product()),
-				TwitterHandle:       SupportedProducts[info.Product()].TwitterHandle,
-				QuickstartLink:      SupportedProducts[info.Product()].QuickstartLink,
+				TwitterHandle:       catalog.Plan(info.Product()).TwitterHandle,
+				QuickstartLink:      catalog.Plan(info.Product()).QuickstartLink,
+				Locale:              info.Locale,
 			}
 
 			var dc *mailer.DripCampaign
-			if params.IsEnterpriseProduct {
-				if !audEnt.Has(info.Email) && !audCom.Has(info.Email) {
-					dc = dcEnt
-				} else {
-					dc = NewEnterpriseFirstTimeCampaign(s.srvSheets, s.mg)
-				}
-			} else {
-				if !audCom.Has(info.Email) && !audEnt.Has(info.Email) {
-					dc = dcComm
-				}
+			if cfg := campaigns.Select(catalog.Plan(info.Product()).ProductLine, params.IsEnterpriseProduct, returning); cfg != nil {
+				dc = campaigns.DripCampaign(cfg, s.srvSheets)
+			}
+			if dc != nil && s.isDripSuppressed(info.Email) {
+				klog.InfoS("skipped drip campaign for suppressed email", "email", info.Email, "campaign", dc.Name)
+				dc = nil
 			}
 			if dc != nil {
 				fmt.Printf("New user: %s\n", info.Email)
@@ -613,6 +689,9 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 		}()
 	}
 
+	// The license email is delivered by the outbox, so an SMTP outage does not fail the
+	// request. The license is only returned in the response to verified emails, so the
+	// request fails if the email can't even be queued.
 	{
 		// avoid sending emails for know test emails
 		if !knowTestEmails.Has(info.Email) {
@@ -621,11 +700,14 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 				License:     string(crtLicense),
 			})
 			mailer.AttachmentBytes = map[string][]byte{
-				fmt.Sprintf("%s-license-%s.txt", strings.ToLower(SupportedProducts[info.Product()].DisplayName), info.Cluster): crtLicense,
+				fmt.Sprintf("%s-license-%s.txt", strings.ToLower(catalog.Plan(info.Product()).DisplayName), info.Cluster): crtLicense,
 			}
-			err = mailer.SendMail(s.mg, info.Email, info.CC, nil)
+			err = s.sendMail(mailer, info.Email, info.CC)
 			if err != nil {
-				return err
+				klog.ErrorS(err, "failed to queue license email", "email", info.Email, "cluster", info.Cluster)
+				if info.Token == "" {
+					return fmt.Errorf("failed to email the license to %s, please try again later", info.Email)
+				}
 			}
 		}
 	}
@@ -640,8 +722,10 @@ func (s *Server) HandleIssueLicense(ctx *macaron.Context, info LicenseForm) erro
 				}
 			}
 			respond(ctx, crtLicense)
-		} else {
+		} else if knowTestEmails.Has(info.Email) {
 			respond(ctx, []byte("Your license has been emailed!"))
+		} else {
+			respond(ctx, []byte(fmt.Sprintf("Your license has been issued. Email delivery to %s is pending and should complete within a few minutes.", info.Email)))
 		}
 	}
 
@@ -677,22 +761,35 @@ func (s *Server) recordLicenseEvent(ctx *macaron.Context, info LicenseForm, time
 		return err
 	}
 
-	err = LogLicense(s.sheet, &accesslog, couponEvent)
+	err = s.enqueueOutbox(OutboxLicenseLog, "license log for "+info.Email, LicenseLogArgs{
+		Entry:       accesslog,
+		UserAgent:   ctx.Req.UserAgent(),
+		CouponEvent: couponEvent,
+	})
 	if err != nil {
 		return err
 	}
 
-	if len(SupportedProducts[info.Product()].MailingLists) > 0 {
-		err = s.listmonk.SubscribeToList(listmonkclient.SubscribeRequest{
+	if len(catalog.Plan(info.Product()).MailingLists) > 0 {
+		err = s.subscribeToList(listmonkclient.SubscribeRequest{
 			Email:        info.Email,
 			Name:         info.Name,
-			MailingLists: SupportedProducts[info.Product()].MailingLists,
+			MailingLists: catalog.Plan(info.Product()).MailingLists,
 		})
 		if err != nil {
 			return err
 		}
 	}
 
+	s.recordContact(ContactUpdate{
+		Email:   info.Email,
+		Name:    info.Name,
+		Country: accesslog.Country,
+		Source:  ContactSourceLicense,
+		Event:   string(event),
+		Summary: fmt.Sprintf("%s license for cluster %s", info.Product(), info.Cluster),
+	})
+
 	return s.noteEventLicenseIssued(accesslog, event)
 }
 
@@ -0,0 +1,336 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avct/uasurfer"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// SNSWebhook handles SES events delivered by an SNS topic subscription. SNS messages
+// are signed with a certificate published by AWS, and only messages of the listed
+// topics are accepted.
+// ref: https://docs.aws.amazon.com/sns/latest/dg/sns-verify-signature-of-message.html
+type SNSWebhook struct {
+	topicARNs sets.String
+	client    *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+var _ EmailWebhook = &SNSWebhook{}
+
+func NewSNSWebhook(topicARNs []string) *SNSWebhook {
+	return &SNSWebhook{
+		topicARNs: sets.NewString(topicARNs...),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		certs:     map[string]*x509.Certificate{},
+	}
+}
+
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageId        string `json:"MessageId"`
+	Token            string `json:"Token,omitempty"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject,omitempty"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+}
+
+// StringToSign returns the canonical form of the message signed by SNS.
+func (m SNSMessage) StringToSign() string {
+	var keys []string
+	switch m.Type {
+	case "Notification":
+		keys = []string{"Message", m.Message, "MessageId", m.MessageId}
+		if m.Subject != "" {
+			keys = append(keys, "Subject", m.Subject)
+		}
+		keys = append(keys, "Timestamp", m.Timestamp, "TopicArn", m.TopicArn, "Type", m.Type)
+	default:
+		keys = []string{
+			"Message", m.Message,
+			"MessageId", m.MessageId,
+			"SubscribeURL", m.SubscribeURL,
+			"Timestamp", m.Timestamp,
+			"Token", m.Token,
+			"TopicArn", m.TopicArn,
+			"Type", m.Type,
+		}
+	}
+	return strings.Join(keys, "\n") + "\n"
+}
+
+func validSNSURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || !snsHost.MatchString(u.Host) {
+		return fmt.Errorf("%s is not an SNS url", s)
+	}
+	return nil
+}
+
+func (w *SNSWebhook) signingCert(certURL string) (*x509.Certificate, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if cert, ok := w.certs[certURL]; ok {
+		return cert, nil
+	}
+	if err := validSNSURL(certURL); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(certURL, ".pem") {
+		return nil, fmt.Errorf("%s is not a certificate url", certURL)
+	}
+	resp, err := w.client.Get(certURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", certURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no certificate found at %s", certURL)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	w.certs[certURL] = cert
+	return cert, nil
+}
+
+func (w *SNSWebhook) Verify(_ *http.Request, body []byte) error {
+	var m SNSMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return err
+	}
+	if !w.topicARNs.Has(m.TopicArn) {
+		return fmt.Errorf("topic %s is not allowed", m.TopicArn)
+	}
+
+	var algo x509.SignatureAlgorithm
+	switch m.SignatureVersion {
+	case "1":
+		algo = x509.SHA1WithRSA
+	case "2":
+		algo = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("unsupported SNS signature version %q", m.SignatureVersion)
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return err
+	}
+	cert, err := w.signingCert(m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algo, []byte(m.StringToSign()), sig); err != nil {
+		return errors.New("invalid SNS signature")
+	}
+	return nil
+}
+
+// Confirm visits the subscribe url of subscription confirmations. It returns true
+// for messages that are about the subscription instead of SES events.
+func (w *SNSWebhook) Confirm(body []byte) (bool, error) {
+	var m SNSMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return false, err
+	}
+	switch m.Type {
+	case "SubscriptionConfirmation":
+		if err := validSNSURL(m.SubscribeURL); err != nil {
+			return true, err
+		}
+		resp, err := w.client.Get(m.SubscribeURL)
+		if err != nil {
+			return true, err
+		}
+		defer resp.Body.Close() // nolint:errcheck
+		if resp.StatusCode != http.StatusOK {
+			return true, fmt.Errorf("failed to confirm subscription to %s: %s", m.TopicArn, resp.Status)
+		}
+		return true, nil
+	case "UnsubscribeConfirmation":
+		return true, nil
+	}
+	return false, nil
+}
+
+type sesRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+type sesEngagement struct {
+	IPAddress string    `json:"ipAddress"`
+	Timestamp time.Time `json:"timestamp"`
+	UserAgent string    `json:"userAgent"`
+	Link      string    `json:"link"`
+}
+
+// sesEvent is an SES event publishing record. SES notifications use the same shape,
+// with notificationType instead of eventType.
+// ref: https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-contents.html
+type sesEvent struct {
+	EventType        string `json:"eventType"`
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		Timestamp     time.Time `json:"timestamp"`
+		MessageID     string    `json:"messageId"`
+		Destination   []string  `json:"destination"`
+		CommonHeaders struct {
+			Subject string `json:"subject"`
+		} `json:"commonHeaders"`
+	} `json:"mail"`
+	Bounce *struct {
+		BounceType        string         `json:"bounceType"`
+		BounceSubType     string         `json:"bounceSubType"`
+		BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+		Timestamp         time.Time      `json:"timestamp"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+		ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+		Timestamp             time.Time      `json:"timestamp"`
+	} `json:"complaint"`
+	Delivery *struct {
+		Recipients []string  `json:"recipients"`
+		Timestamp  time.Time `json:"timestamp"`
+	} `json:"delivery"`
+	DeliveryDelay *struct {
+		DelayType         string         `json:"delayType"`
+		DelayedRecipients []sesRecipient `json:"delayedRecipients"`
+		Timestamp         time.Time      `json:"timestamp"`
+	} `json:"deliveryDelay"`
+	Open  *sesEngagement `json:"open"`
+	Click *sesEngagement `json:"click"`
+}
+
+func (w *SNSWebhook) Parse(body []byte) ([]EmailEvent, error) {
+	var m SNSMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	if m.Type != "Notification" {
+		return nil, nil
+	}
+	var se sesEvent
+	if err := json.Unmarshal([]byte(m.Message), &se); err != nil {
+		return nil, err
+	}
+
+	base := EmailEvent{
+		Provider:  "ses",
+		MessageID: se.Mail.MessageID,
+		Subject:   se.Mail.CommonHeaders.Subject,
+	}
+	var out []EmailEvent
+	add := func(typ, recipient, reason string, at time.Time) {
+		e := base
+		e.ID = m.MessageId + "/" + recipient
+		e.Type = typ
+		e.Recipient = recipient
+		e.Reason = reason
+		e.Timestamp = at.UTC()
+		out = append(out, e)
+	}
+	engaged := func(typ string, en *sesEngagement) {
+		ua := uasurfer.Parse(en.UserAgent)
+		base.IP = en.IPAddress
+		base.URL = en.Link
+		base.OS = ua.OS.Name.StringTrimPrefix()
+		base.Device = ua.DeviceType.StringTrimPrefix()
+		for _, r := range se.Mail.Destination {
+			add(typ, r, "", en.Timestamp)
+		}
+	}
+
+	typ := se.EventType
+	if typ == "" {
+		typ = se.NotificationType
+	}
+	switch {
+	case typ == "Delivery" && se.Delivery != nil:
+		for _, r := range se.Delivery.Recipients {
+			add(EmailDelivered, r, "", se.Delivery.Timestamp)
+		}
+	case typ == "Bounce" && se.Bounce != nil:
+		t := EmailDeferred
+		if se.Bounce.BounceType == "Permanent" {
+			t = EmailBounced
+		}
+		for _, r := range se.Bounce.BouncedRecipients {
+			reason := r.DiagnosticCode
+			if reason == "" {
+				reason = se.Bounce.BounceType + "/" + se.Bounce.BounceSubType
+			}
+			add(t, r.EmailAddress, reason, se.Bounce.Timestamp)
+		}
+	case typ == "DeliveryDelay" && se.DeliveryDelay != nil:
+		for _, r := range se.DeliveryDelay.DelayedRecipients {
+			reason := r.DiagnosticCode
+			if reason == "" {
+				reason = se.DeliveryDelay.DelayType
+			}
+			add(EmailDeferred, r.EmailAddress, reason, se.DeliveryDelay.Timestamp)
+		}
+	case typ == "Complaint" && se.Complaint != nil:
+		for _, r := range se.Complaint.ComplainedRecipients {
+			add(EmailComplained, r.EmailAddress, se.Complaint.ComplaintFeedbackType, se.Complaint.Timestamp)
+		}
+	case typ == "Open" && se.Open != nil:
+		engaged(EmailOpened, se.Open)
+	case typ == "Click" && se.Click != nil:
+		engaged(EmailClicked, se.Click)
+	}
+	// send, reject and rendering failures are not about the recipient
+	return out, nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-macaron/auth"
+	"github.com/go-macaron/binding"
+	"github.com/rs/xid"
+	"gopkg.in/macaron.v1"
+	"k8s.io/klog/v2"
+)
+
+type SignatureKind string
+
+const (
+	SignatureEULA        SignatureKind = "eula"
+	SignatureOfferLetter SignatureKind = "offer-letter"
+)
+
+type SignatureStatus string
+
+const (
+	SignaturePending SignatureStatus = "pending"
+	SignatureSigned  SignatureStatus = "signed"
+)
+
+// SignatureRequest asks a signer to accept a document. The document is snapshotted as a
+// PDF when the request is created, so the signer accepts exactly the bytes that are hashed.
+type SignatureRequest struct {
+	ID        string          `json:"id"`
+	Kind      SignatureKind   `json:"kind"`
+	Reference string          `json:"reference"` // quotation or candidate email
+	DocId     string          `json:"docId"`
+	DocName   string          `json:"docName"`
+	SHA256    string          `json:"sha256"`
+	Signer    Signer          `json:"signer"`
+	Sender    string          `json:"sender"` // receives the finalized copy on behalf of AppsCode
+	Status    SignatureStatus `json:"status"`
+	CreatedAt time.Time       `json:"createdAt"`
+
+	Evidence *SignatureEvidence `json:"evidence,omitempty"`
+}
+
+type Signer struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// SignatureEvidence records who accepted the document, from where and when.
+type SignatureEvidence struct {
+	DocumentSHA256 string      `json:"documentSHA256"`
+	TypedName      string      `json:"typedName"`
+	Email          string      `json:"email"`
+	UserAgent      string      `json:"userAgent"`
+	Location       GeoLocation `json:"location"`
+	SignedAt       time.Time   `json:"signedAt"`
+}
+
+type SignatureForm struct {
+	Sig    string `form:"sig" binding:"Required"`
+	Name   string `form:"name" binding:"Required"`
+	Accept bool   `form:"accept"`
+}
+
+func NewSignatureRequest(kind SignatureKind, reference, docId, docName string, signer Signer, sender string, doc []byte) *SignatureRequest {
+	sum := sha256.Sum256(doc)
+	return &SignatureRequest{
+		ID:        xid.New().String(),
+		Kind:      kind,
+		Reference: reference,
+		DocId:     docId,
+		DocName:   docName,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Signer:    signer,
+		Sender:    sender,
+		Status:    SignaturePending,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Sign records the evidence for the signed document. doc must be the stored snapshot.
+func (r *SignatureRequest) Sign(doc []byte, form SignatureForm, e SignatureEvidence) error {
+	if r.Status != SignaturePending {
+		return fmt.Errorf("%s has already been signed", r.DocName)
+	}
+	if !form.Accept {
+		return fmt.Errorf("please accept %s to sign it", r.DocName)
+	}
+	name := strings.TrimSpace(form.Name)
+	if name == "" {
+		return fmt.Errorf("please type your full name to sign %s", r.DocName)
+	}
+	sum := sha256.Sum256(doc)
+	if hex.EncodeToString(sum[:]) != r.SHA256 {
+		return fmt.Errorf("document %s has been modified since it was sent for signature", r.DocName)
+	}
+
+	e.DocumentSHA256 = r.SHA256
+	e.TypedName = name
+	e.Email = r.Signer.Email
+	r.Evidence = &e
+	r.Status = SignatureSigned
+	return nil
+}
+
+func (r *SignatureRequest) Filename() string {
+	return r.DocName + ".pdf"
+}
+
+// signatureMu serializes signing, so that a document can't be signed twice.
+var signatureMu sync.Mutex
+
+func (s *Server) GetSignatureRequest(id string) (*SignatureRequest, error) {
+	data, err := s.fs.ReadFile(context.TODO(), SignatureRequestPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var r SignatureRequest
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Server) saveSignatureRequest(r *SignatureRequest) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), SignatureRequestPath(r.ID), data)
+}
+
+func (s *Server) exportPDF(docId string) ([]byte, error) {
+	resp, err := s.srvDrive.Files.Export(docId, "application/pdf").Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, resp.Body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RequestSignature snapshots the Google Doc and emails the signer a link to sign it.
+func (s *Server) RequestSignature(kind SignatureKind, reference, docId, docName string, signer Signer, sender string) (*SignatureRequest, error) {
+	doc, err := s.exportPDF(docId)
+	if err != nil {
+		return nil, err
+	}
+	r := NewSignatureRequest(kind, reference, docId, docName, signer, sender, doc)
+	if err := s.fs.WriteFile(context.TODO(), SignatureDocumentPath(r.ID), doc); err != nil {
+		return nil, err
+	}
+	if err := s.saveSignatureRequest(r); err != nil {
+		return nil, err
+	}
+
+	mailer := NewSignatureRequestMailer(r, s.SignatureLink(r.ID))
+	fmt.Println("sending signature request", r.ID, "to", signer.Email)
+	if err := s.sendMail(mailer, signer.Email, ""); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *Server) SignatureLink(id string) string {
+	return fmt.Sprintf("%s/_/signatures/%s?sig=%s",
+		strings.TrimSuffix(s.opts.BaseURL, "/"),
+		url.PathEscape(id),
+		SignLink(s.linkKey, "signature", id))
+}
+
+// SignDocument stores the signature evidence and emails the finalized copy to both parties.
+func (s *Server) SignDocument(id string, form SignatureForm, e SignatureEvidence) (*SignatureRequest, error) {
+	signatureMu.Lock()
+	defer signatureMu.Unlock()
+
+	r, err := s.GetSignatureRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.fs.ReadFile(context.TODO(), SignatureDocumentPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Sign(doc, form, e); err != nil {
+		return nil, err
+	}
+	if err := s.saveSignatureRequest(r); err != nil {
+		return nil, err
+	}
+
+	mailer := NewSignedDocumentMailer(r, doc)
+	for _, to := range []string{r.Signer.Email, r.Sender} {
+		fmt.Println("sending signed copy of", r.DocName, "to", to)
+		if err := s.sendMail(mailer, to, ""); err != nil {
+			klog.Warningln(err)
+		}
+	}
+	return r, nil
+}
+
+func (s *Server) RegisterSignatureAPI(m *macaron.Macaron) {
+	m.Get("/_/signatures/:id", func(ctx *macaron.Context) {
+		id := ctx.Params("id")
+		if !VerifyLink(s.linkKey, ctx.Query("sig"), "signature", id) {
+			ctx.Data["Err"] = "This link is invalid. Please contact sales@appscode.com"
+			ctx.HTML(http.StatusForbidden, "signature")
+			return
+		}
+		r, err := s.GetSignatureRequest(id)
+		if err != nil {
+			klog.Warningln(err)
+			ctx.Data["Err"] = "Document not found. Please contact sales@appscode.com"
+			ctx.HTML(http.StatusNotFound, "signature")
+			return
+		}
+		ctx.Data["Request"] = r
+		ctx.Data["Sig"] = ctx.Query("sig")
+		ctx.Data["Signed"] = r.Status == SignatureSigned
+		ctx.HTML(http.StatusOK, "signature")
+	})
+
+	m.Get("/_/signatures/:id/document", func(ctx *macaron.Context) {
+		id := ctx.Params("id")
+		if !VerifyLink(s.linkKey, ctx.Query("sig"), "signature", id) {
+			ctx.WriteHeader(http.StatusForbidden)
+			respond(ctx, []byte("invalid link"))
+			return
+		}
+		doc, err := s.fs.ReadFile(context.TODO(), SignatureDocumentPath(id))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Resp.Header().Set("Content-Type", "application/pdf")
+		ctx.Resp.WriteHeader(http.StatusOK)
+		_, _ = ctx.Resp.Write(doc)
+	})
+
+	m.Post("/_/signatures/:id", binding.Bind(SignatureForm{}), func(ctx *macaron.Context, form SignatureForm) {
+		id := ctx.Params("id")
+		if !VerifyLink(s.linkKey, form.Sig, "signature", id) {
+			ctx.WriteHeader(http.StatusForbidden)
+			respond(ctx, []byte("invalid link"))
+			return
+		}
+
+		location := GeoLocation{
+			IP: GetIP(ctx.Req.Request),
+		}
+		DecorateGeoData(s.geodb, &location)
+		r, err := s.SignDocument(id, form, SignatureEvidence{
+			UserAgent: ctx.Req.UserAgent(),
+			Location:  location,
+			SignedAt:  time.Now(),
+		})
+		if err != nil {
+			ctx.WriteHeader(http.StatusBadRequest)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.Data["Request"] = r
+		ctx.Data["Signed"] = true
+		ctx.HTML(http.StatusOK, "signature")
+	})
+
+	m.Get("/_/signatures/:id/evidence", auth.Basic(os.Getenv("APPSCODE_SALES_USERNAME"), os.Getenv("APPSCODE_SALES_PASSWORD")), func(ctx *macaron.Context) {
+		r, err := s.GetSignatureRequest(ctx.Params("id"))
+		if err != nil {
+			ctx.WriteHeader(http.StatusNotFound)
+			respond(ctx, []byte(err.Error()))
+			return
+		}
+		ctx.JSON(http.StatusOK, r)
+	})
+}
@@ -0,0 +1,50 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestSignatureRequestSign(t *testing.T) {
+	doc := []byte("%PDF-1.4 eula")
+	signer := server.Signer{Name: "Jane Doe", Email: "jane@example.com"}
+	r := server.NewSignatureRequest(server.SignatureEULA, "AC2610001", "doc", "example.com EULA", signer, server.MailSales, doc)
+
+	e := server.SignatureEvidence{
+		Location: server.GeoLocation{IP: "203.0.113.7"},
+		SignedAt: time.Now(),
+	}
+	if err := r.Sign([]byte("%PDF-1.4 tampered"), server.SignatureForm{Name: "Jane Doe", Accept: true}, e); err == nil {
+		t.Error("expected modified document to be rejected")
+	}
+	if err := r.Sign(doc, server.SignatureForm{Name: "Jane Doe"}, e); err == nil {
+		t.Error("expected signature without acceptance to be rejected")
+	}
+	if err := r.Sign(doc, server.SignatureForm{Name: " Jane Doe ", Accept: true}, e); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != server.SignatureSigned || r.Evidence.TypedName != "Jane Doe" || r.Evidence.DocumentSHA256 != r.SHA256 || r.Evidence.Email != signer.Email {
+		t.Errorf("unexpected evidence %+v", r.Evidence)
+	}
+	if err := r.Sign(doc, server.SignatureForm{Name: "Jane Doe", Accept: true}, e); err == nil {
+		t.Error("expected document to be signed only once")
+	}
+}
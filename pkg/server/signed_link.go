@@ -0,0 +1,55 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"gomodules.xyz/cert/certstore"
+)
+
+// linkSigningKey returns the key used to sign customer facing links. Links must survive
+// restarts, so when no key is configured one is derived from the license issuer CA key.
+func linkSigningKey(opts *Options, certs *certstore.CertStore) []byte {
+	if opts.LinkSigningKey != "" {
+		return []byte(opts.LinkSigningKey)
+	}
+	mac := hmac.New(sha256.New, certs.CAKeyBytes())
+	mac.Write([]byte("link-signing-key"))
+	return mac.Sum(nil)
+}
+
+// SignLink returns a signature for the given link parts, eg, the action and the
+// id of the record the link points to.
+func SignLink(key []byte, parts ...string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyLink(key []byte, sig string, parts ...string) bool {
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(parts, "\x00")))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
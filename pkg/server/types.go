@@ -54,6 +54,7 @@ type LicenseForm struct {
 	Tos          string `form:"tos" binding:"Required" json:"tos"`
 	Token        string `form:"token" json:"token"`
 	Coupon       string `form:"coupon" json:"coupon"`
+	Locale       string `form:"locale" json:"locale,omitempty"` // preferred language of the license emails, like de
 }
 
 type LicenseMailData struct {
@@ -62,7 +63,7 @@ type LicenseMailData struct {
 }
 
 func (form LicenseForm) Product() string {
-	return productAliases[form.ProductAlias]
+	return catalog.PlanForAlias(form.ProductAlias)
 }
 
 func (form LicenseForm) Validate() error {
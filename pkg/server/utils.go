@@ -45,7 +45,7 @@ func IsEnterpriseProduct(product string) bool {
 }
 
 func IsPAYGProduct(product string) bool {
-	if _, ok := templateIds[strings.ToLower(product)]; !ok {
+	if _, ok := catalog.QuotationTemplate(product); !ok {
 		return false
 	}
 	return strings.HasSuffix(strings.ToLower(product), "-payg")
@@ -111,3 +111,7 @@ func ListExistingLicensees(srv *sheets.Service, spreadsheetId, sheetName, header
 	}
 	return emails
 }
+
+func GoogleDocLink(docId string) string {
+	return fmt.Sprintf("https://docs.google.com/document/d/%s/edit", docId)
+}
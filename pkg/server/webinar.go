@@ -59,6 +59,7 @@ type WebinarSchedule struct {
 	SpeakerPicture string         `json:"speaker_picture" csv:"Speaker Picture" form:"speaker_picture"`
 	Speakers       []SpeakerInfo  `json:"speakers" csv:"-" form:"-"`
 	YoutubeLink    string         `json:"-" csv:"Youtube Link" form:"-"`
+	SlidesLink     string         `json:"-" csv:"Slides Link" form:"-"`
 	YoutubeVideoID string         `json:"youtube_video_id" csv:"-" form:"-"`
 }
 
@@ -169,6 +170,37 @@ func (s *Server) RegisterWebinarAPI(m *macaron.Macaron) {
 		}
 		ctx.JSON(http.StatusOK, attendees)
 	})
+
+	// sends the follow-up of a session right away, e.g. once the recording is uploaded
+	m.Post("/_/webinars/:date/follow-up", auth.Basic(os.Getenv("APPSCODE_PRICING_USERNAME"), os.Getenv("APPSCODE_PRICING_PASSWORD")), func(ctx *macaron.Context) {
+		date := ctx.Params("date")
+		rec, err := s.followUpWebinarOn(date)
+		if err != nil {
+			klog.ErrorS(err, "error sending webinar follow-up", "date", date)
+			ctx.Error(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusOK, rec)
+	})
+}
+
+// followUpWebinarOn sends the follow-up of the session on date, formatted like the
+// registration sheet names.
+func (s *Server) followUpWebinarOn(date string) (*WebinarFollowUp, error) {
+	day, err := time.Parse("2006-1-2", date)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.findWebinarInfo(day)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range info.Schedules {
+		if t.Format("2006-1-2") == date {
+			return s.SendWebinarFollowUp(t, info)
+		}
+	}
+	return nil, fmt.Errorf("can't find webinar schedule on %s", date)
 }
 
 func (s *Server) ListWebinarAttendees(date string) ([]string, error) {
@@ -436,46 +468,55 @@ func (s *Server) RegisterForWebinar(ctx *macaron.Context, form WebinarRegistrati
 
 	// nolint:errcheck
 	go func() {
-		err := func() error {
-			yw, mw, dw := schedule.Date()
-
-			reader, err := gdrive.NewRowReader(s.srvSheets, WebinarSpreadsheetId, "Schedule", &gdrive.Predicate{
-				Header: "Schedules",
-				By: func(values []any) (int, error) {
-					for i, v := range values {
-						schedules := csvtypes.Dates{}
-						err := schedules.UnmarshalCSV(v.(string))
-						if err != nil {
-							return -1, err
-						}
-						for _, t2 := range schedules {
-							y2, m2, d2 := t2.Date()
-
-							if yw == y2 && mw == m2 && dw == d2 {
-								return i, nil
-							}
-						}
-					}
-					return -1, io.EOF
-				},
-			})
-			if err != nil {
-				return err
-			}
+		location := GeoLocation{
+			IP: GetIP(ctx.Req.Request),
+		}
+		DecorateGeoData(s.geodb, &location)
 
-			meetings := []*WebinarInfo{}
-			if err := gocsv.UnmarshalCSV(reader, &meetings); err != nil { // Load clients from file
-				return err
+		// The Zoom meeting is created first, so that the invite has its join details.
+		// The invite and the reminders are sent before the listmonk, CRM and calendar
+		// attendee steps, so registrants get them even if those fail.
+		result, err := s.findWebinarInfo(schedule)
+		if err != nil {
+			log.Printf("failed to find webinar for request: %+v, reason: %v", form, err)
+		}
+		var eventExists bool
+		if result != nil {
+			eventExists = strings.TrimSpace(result.GoogleCalendarEventID) != ""
+			if !eventExists {
+				if err := s.createWebinarMeeting(form, schedule, result); err != nil {
+					log.Printf("failed to create meeting for request: %+v, reason: %v", form, err)
+				}
 			}
+		}
+		if err := s.confirmWebinarSignup(form, sheetName, schedule, location, result); err != nil {
+			log.Printf("failed to confirm registration for request: %+v, reason: %v", form, err)
+		}
 
-			var result *WebinarInfo
-			if len(meetings) > 0 {
-				result = meetings[0]
-			}
-			if result == nil {
-				return fmt.Errorf("can't find webinar schedule")
-			}
+		var title string
+		if result != nil {
+			title = result.Title
+		}
+		s.recordContact(ContactUpdate{
+			Email:   form.WorkEmail,
+			Name:    form.FirstName + " " + form.LastName,
+			Company: form.Company,
+			Title:   form.JobTitle,
+			Phone:   form.Phone,
+			Country: location.Country,
+			Source:  ContactSourceWebinar,
+			Event:   "webinar_registration",
+			Summary: title,
+			Ref:     sheetName,
+		})
+		if result == nil {
+			return
+		}
+		if err := s.ensureWebinarFollowUp(schedule); err != nil {
+			log.Printf("failed to schedule follow-up for request: %+v, reason: %v", form, err)
+		}
 
+		err = func() error {
 			{
 				// record in listmonk
 				ml, err := s.listmonk.CreateListIfMissing(listmonkclient.MailingListRequest{
@@ -489,7 +530,7 @@ func (s *Server) RegisterForWebinar(ctx *macaron.Context, form WebinarRegistrati
 				if err != nil {
 					return err
 				}
-				err = s.listmonk.SubscribeToList(listmonkclient.SubscribeRequest{
+				err = s.subscribeToList(listmonkclient.SubscribeRequest{
 					Email:        form.WorkEmail,
 					Name:         form.FirstName + " " + form.LastName,
 					MailingLists: []string{ml.UUID},
@@ -502,10 +543,6 @@ func (s *Server) RegisterForWebinar(ctx *macaron.Context, form WebinarRegistrati
 			{
 				// record in CRM
 				ua := uasurfer.Parse(ctx.Req.UserAgent())
-				location := GeoLocation{
-					IP: GetIP(ctx.Req.Request),
-				}
-				DecorateGeoData(s.geodb, &location)
 
 				_ = s.noteEventWebinarRegistration(form, EventWebinarRegistration{
 					BaseNoteDescription: freshsalesclient.BaseNoteDescription{
@@ -533,55 +570,14 @@ func (s *Server) RegisterForWebinar(ctx *macaron.Context, form WebinarRegistrati
 				})
 			}
 
-			if strings.TrimSpace(result.GoogleCalendarEventID) != "" {
-				wats, err := gdrive.NewColumnReader(s.srvSheets, WebinarSpreadsheetId, sheetName, "Work Email")
+			if eventExists {
+				emails, err := s.webinarAttendees(sheetName)
 				if err != nil {
 					return err
 				}
-				atts := []*WebinarRegistrationEmail{}
-				if err := gocsv.UnmarshalCSV(wats, &atts); err != nil { // Load clients from file
-					return err
-				}
-
-				emails := make([]string, len(atts))
-				for i, a := range atts {
-					emails[i] = a.WorkEmail
-				}
 				return AddEventAttendants(s.srvCalendar, WebinarCalendarId, result.GoogleCalendarEventID, emails)
 			}
-
-			ww := gdrive.NewRowWriter(s.srvSheets, WebinarSpreadsheetId, "Schedule", &gdrive.Predicate{
-				Header: "Schedules",
-				By: func(values []any) (int, error) {
-					for i, v := range values {
-						schedules := csvtypes.Dates{}
-						err := schedules.UnmarshalCSV(v.(string))
-						if err != nil {
-							return -1, err
-						}
-						for _, t2 := range schedules {
-							y2, m2, d2 := t2.Date()
-
-							if yw == y2 && mw == m2 && dw == d2 {
-								return i, nil
-							}
-						}
-					}
-					return -1, io.EOF
-				},
-			})
-
-			meetinginfo, err := CreateZoomMeeting(s.srvCalendar, s.zc, WebinarCalendarId, s.zoomAccountEmail, &result.WebinarSchedule, schedule, 60*time.Minute, []string{
-				form.WorkEmail,
-			})
-			if err != nil {
-				return err
-			}
-
-			meetings2 := []*WebinarMeetingID{
-				meetinginfo,
-			}
-			return gocsv.MarshalCSV(meetings2, ww)
+			return nil
 		}()
 		if err != nil {
 			log.Printf("failed to register for request: %+v, reason: %v", form, err)
@@ -590,3 +586,137 @@ func (s *Server) RegisterForWebinar(ctx *macaron.Context, form WebinarRegistrati
 
 	return nil
 }
+
+// createWebinarMeeting creates the Zoom meeting and the calendar event of the session,
+// with the registrant as the first attendee, and records them in the Schedule sheet.
+// The new meeting is set on info.
+func (s *Server) createWebinarMeeting(form WebinarRegistrationForm, schedule time.Time, info *WebinarInfo) error {
+	yw, mw, dw := schedule.Date()
+	ww := gdrive.NewRowWriter(s.srvSheets, WebinarSpreadsheetId, "Schedule", &gdrive.Predicate{
+		Header: "Schedules",
+		By: func(values []any) (int, error) {
+			for i, v := range values {
+				schedules := csvtypes.Dates{}
+				err := schedules.UnmarshalCSV(v.(string))
+				if err != nil {
+					return -1, err
+				}
+				for _, t2 := range schedules {
+					y2, m2, d2 := t2.Date()
+
+					if yw == y2 && mw == m2 && dw == d2 {
+						return i, nil
+					}
+				}
+			}
+			return -1, io.EOF
+		},
+	})
+
+	meetinginfo, err := CreateZoomMeeting(s.srvCalendar, s.zc, WebinarCalendarId, s.zoomAccountEmail, &info.WebinarSchedule, schedule, WebinarDuration, []string{
+		form.WorkEmail,
+	})
+	if err != nil {
+		return err
+	}
+	info.WebinarMeetingID = *meetinginfo
+
+	meetings2 := []*WebinarMeetingID{
+		meetinginfo,
+	}
+	return gocsv.MarshalCSV(meetings2, ww)
+}
+
+// confirmWebinarSignup emails the calendar invite and schedules the reminders, unless
+// the email was already registered for the session. Without the webinar info, the
+// invite only has the schedule and the reminders look the webinar up again.
+func (s *Server) confirmWebinarSignup(form WebinarRegistrationForm, sheetName string, schedule time.Time, location GeoLocation, info *WebinarInfo) error {
+	r := WebinarRegistration{
+		Email:    form.WorkEmail,
+		Name:     strings.TrimSpace(form.FirstName + " " + form.LastName),
+		Schedule: schedule,
+		Timezone: location.Timezone,
+	}
+	if info != nil {
+		r.Title = info.Title
+		r.Summary = info.Summary
+		r.Meeting = info.WebinarMeetingID
+	}
+
+	emails, err := s.webinarAttendees(sheetName)
+	if err != nil {
+		// a duplicate invite is better than none
+		klog.Warningln(err)
+	}
+	registered := 0
+	for _, email := range emails {
+		if strings.EqualFold(email, form.WorkEmail) {
+			registered++
+		}
+	}
+	if registered > 1 {
+		// duplicate signup, the invite and reminders were sent the first time
+		return nil
+	}
+	return s.confirmWebinarRegistration(r)
+}
+
+// webinarAttendees returns the emails registered for a session.
+func (s *Server) webinarAttendees(sheetName string) ([]string, error) {
+	wats, err := gdrive.NewColumnReader(s.srvSheets, WebinarSpreadsheetId, sheetName, "Work Email")
+	if err != nil {
+		return nil, err
+	}
+	atts := []*WebinarRegistrationEmail{}
+	if err := gocsv.UnmarshalCSV(wats, &atts); err != nil { // Load clients from file
+		return nil, err
+	}
+	emails := make([]string, len(atts))
+	for i, a := range atts {
+		emails[i] = a.WorkEmail
+	}
+	return emails, nil
+}
+
+// findWebinarInfo returns the webinar scheduled on the day of schedule.
+func (s *Server) findWebinarInfo(schedule time.Time) (*WebinarInfo, error) {
+	yw, mw, dw := schedule.Date()
+
+	reader, err := gdrive.NewRowReader(s.srvSheets, WebinarSpreadsheetId, "Schedule", &gdrive.Predicate{
+		Header: "Schedules",
+		By: func(values []any) (int, error) {
+			for i, v := range values {
+				schedules := csvtypes.Dates{}
+				err := schedules.UnmarshalCSV(v.(string))
+				if err != nil {
+					return -1, err
+				}
+				for _, t2 := range schedules {
+					y2, m2, d2 := t2.Date()
+
+					if yw == y2 && mw == m2 && dw == d2 {
+						return i, nil
+					}
+				}
+			}
+			return -1, io.EOF
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meetings := []*WebinarInfo{}
+	if err := gocsv.UnmarshalCSV(reader, &meetings); err != nil { // Load clients from file
+		return nil, err
+	}
+
+	var result *WebinarInfo
+	if len(meetings) > 0 {
+		result = meetings[0]
+	}
+	if result == nil {
+		return nil, fmt.Errorf("can't find webinar schedule")
+	}
+	return result, nil
+}
@@ -0,0 +1,332 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	csvtypes "gomodules.xyz/encoding/csv/types"
+	freshsalesclient "gomodules.xyz/freshsales-client-go"
+	gdrive "gomodules.xyz/gdrive-utils"
+	"gomodules.xyz/pointer"
+	"k8s.io/klog/v2"
+)
+
+const (
+	TaskWebinarFollowUp = "webinar-follow-up"
+
+	// WebinarFollowUpDelay gives the team a day to upload the recording.
+	WebinarFollowUpDelay = 24 * time.Hour
+
+	// webinarFollowUpMaxAttempts is the number of days the follow-up waits for the
+	// Youtube Link of the schedule. The last attempt is sent without a recording.
+	webinarFollowUpMaxAttempts = 7
+
+	EventWebinarAttended = "webinar_attended"
+	EventWebinarMissed   = "webinar_missed"
+)
+
+type WebinarFollowUpArgs struct {
+	Schedule time.Time `json:"schedule"`
+	Attempt  int       `json:"attempt,omitempty"`
+}
+
+// WebinarFollowUp is saved after the follow-up email of each registrant is queued,
+// so a retry skips the registrants in Attended and Missed. SentAt is set once every
+// registrant is done.
+type WebinarFollowUp struct {
+	Title         string     `json:"title"`
+	Schedule      time.Time  `json:"schedule"`
+	RecordingLink string     `json:"recordingLink,omitempty"`
+	SlidesLink    string     `json:"slidesLink,omitempty"`
+	Attended      []string   `json:"attended"`
+	Missed        []string   `json:"missed"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+}
+
+// Done reports whether the follow-up of the registrant was already queued.
+func (rec *WebinarFollowUp) Done(email string) bool {
+	match := func(e string) bool { return strings.EqualFold(e, email) }
+	return slices.ContainsFunc(rec.Attended, match) || slices.ContainsFunc(rec.Missed, match)
+}
+
+// WebinarAttendance is the attendance of a registrant.
+type WebinarAttendance struct {
+	Registration *WebinarRegistrationForm
+	Attended     bool
+	Minutes      int
+}
+
+// MatchWebinarAttendance matches the registrants with the participant report.
+// Participants are matched by email, or by name if they joined without signing in
+// to Zoom. Registrants who signed up more than once are listed once.
+func MatchWebinarAttendance(registrants []*WebinarRegistrationForm, participants []ZoomParticipant) []WebinarAttendance {
+	normalizeName := func(name string) string {
+		return strings.ToLower(strings.Join(strings.Fields(name), " "))
+	}
+
+	byEmail := map[string]int{}
+	byName := map[string]int{}
+	for _, p := range participants {
+		if email := strings.ToLower(strings.TrimSpace(p.UserEmail)); email != "" {
+			byEmail[email] += p.Duration
+		} else if name := normalizeName(p.Name); name != "" {
+			byName[name] += p.Duration
+		}
+	}
+
+	seen := map[string]bool{}
+	out := make([]WebinarAttendance, 0, len(registrants))
+	for _, r := range registrants {
+		email := strings.ToLower(strings.TrimSpace(r.WorkEmail))
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+
+		seconds, ok := byEmail[email]
+		if !ok {
+			seconds, ok = byName[normalizeName(r.FirstName+" "+r.LastName)]
+		}
+		out = append(out, WebinarAttendance{
+			Registration: r,
+			Attended:     ok,
+			Minutes:      seconds / 60,
+		})
+	}
+	return out
+}
+
+var webinarFollowUpMu sync.Mutex
+
+func (s *Server) scheduleWebinarFollowUp(at time.Time, args WebinarFollowUpArgs) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return s.sch.ScheduleTask(at, TaskWebinarFollowUp, data)
+}
+
+// ensureWebinarFollowUp schedules the follow-up of a session once, whichever signup
+// comes first. The marker is written after the task is scheduled, so a failed write
+// can only schedule a second task, which finds the session already followed up.
+func (s *Server) ensureWebinarFollowUp(schedule time.Time) error {
+	webinarFollowUpMu.Lock()
+	defer webinarFollowUpMu.Unlock()
+
+	path := WebinarFollowUpScheduledPath(schedule.Format("2006-1-2"))
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil || ok {
+		return err
+	}
+	if err := s.scheduleWebinarFollowUp(schedule.Add(WebinarDuration+WebinarFollowUpDelay), WebinarFollowUpArgs{Schedule: schedule}); err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), path, []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+// RunWebinarFollowUp is the handler of TaskWebinarFollowUp. It waits for the
+// recording, and retries failures, for up to webinarFollowUpMaxAttempts days.
+func (s *Server) RunWebinarFollowUp(data []byte) error {
+	var args WebinarFollowUpArgs
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	info, err := s.findWebinarInfo(args.Schedule)
+	if err != nil {
+		if args.Attempt+1 >= webinarFollowUpMaxAttempts {
+			return err
+		}
+		args.Attempt++
+		klog.ErrorS(err, "failed to find webinar, will retry follow-up", "schedule", args.Schedule, "attempt", args.Attempt)
+		return s.scheduleWebinarFollowUp(time.Now().Add(24*time.Hour), args)
+	}
+	if info.YoutubeLink == "" && args.Attempt+1 < webinarFollowUpMaxAttempts {
+		args.Attempt++
+		klog.InfoS("webinar recording is not available yet, postponing follow-up", "title", info.Title, "schedule", args.Schedule, "attempt", args.Attempt)
+		return s.scheduleWebinarFollowUp(time.Now().Add(24*time.Hour), args)
+	}
+	if _, err := s.SendWebinarFollowUp(args.Schedule, info); err != nil {
+		if args.Attempt+1 >= webinarFollowUpMaxAttempts {
+			return err
+		}
+		args.Attempt++
+		klog.ErrorS(err, "failed to send webinar follow-up, will retry", "title", info.Title, "schedule", args.Schedule, "attempt", args.Attempt)
+		return s.scheduleWebinarFollowUp(time.Now().Add(24*time.Hour), args)
+	}
+	return nil
+}
+
+// SendWebinarFollowUp sends the recording to the attendees and a "sorry we missed you"
+// email to the no-shows, and records the attendance in the CRM. A session is
+// followed up once; later calls return the stored record, and calls after a failure
+// continue with the registrants that were not done yet.
+func (s *Server) SendWebinarFollowUp(schedule time.Time, info *WebinarInfo) (*WebinarFollowUp, error) {
+	webinarFollowUpMu.Lock()
+	defer webinarFollowUpMu.Unlock()
+
+	sheetName := schedule.Format("2006-1-2")
+	rec, err := s.getWebinarFollowUp(sheetName)
+	if err != nil || (rec != nil && rec.SentAt != nil) {
+		return rec, err
+	}
+	if time.Now().Before(schedule.Add(WebinarDuration)) {
+		return nil, fmt.Errorf("webinar %s has not ended yet", sheetName)
+	}
+	if info.ZoomMeetingID == 0 {
+		return nil, fmt.Errorf("webinar %s has no zoom meeting", sheetName)
+	}
+
+	participants, err := s.zoomReports.MeetingParticipants(info.ZoomMeetingID)
+	if err != nil {
+		return nil, err
+	}
+	registrants, err := s.listWebinarRegistrations(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		rec = &WebinarFollowUp{
+			Schedule: schedule,
+			Attended: []string{},
+			Missed:   []string{},
+		}
+	}
+	rec.Title = info.Title
+	rec.RecordingLink = info.YoutubeLink
+	rec.SlidesLink = info.SlidesLink
+	mailData := WebinarFollowUpMailData{
+		Title:         info.Title,
+		RecordingLink: info.YoutubeLink,
+		SlidesLink:    info.SlidesLink,
+	}
+	for _, a := range MatchWebinarAttendance(registrants, participants) {
+		form := a.Registration
+		if rec.Done(form.WorkEmail) {
+			continue
+		}
+		mailData.Name = strings.TrimSpace(form.FirstName + " " + form.LastName)
+
+		event := EventWebinarMissed
+		m := NewWebinarMissedMailer(mailData)
+		if a.Attended {
+			event = EventWebinarAttended
+			m = NewWebinarRecordingMailer(mailData)
+		}
+
+		if s.isEmailSuppressed(form.WorkEmail) {
+			klog.InfoS("skipped webinar follow-up for suppressed email", "email", form.WorkEmail)
+		} else if err := s.sendMail(m, form.WorkEmail, ""); err != nil {
+			return nil, err
+		}
+
+		s.recordContact(ContactUpdate{
+			Email:   form.WorkEmail,
+			Name:    mailData.Name,
+			Company: form.Company,
+			Title:   form.JobTitle,
+			Phone:   form.Phone,
+			Source:  ContactSourceWebinar,
+			Event:   event,
+			Summary: info.Title,
+			Ref:     sheetName,
+		})
+		err := s.noteEventWebinarRegistration(*form, EventWebinarRegistration{
+			BaseNoteDescription: freshsalesclient.BaseNoteDescription{
+				Event: event,
+			},
+			Webinar: WebinarRecord{
+				Title:           info.Title,
+				Schedule:        csvtypes.Timestamp{Time: schedule},
+				Speaker:         info.Speaker,
+				ClusterProvider: form.ClusterProvider,
+				ExperienceLevel: form.ExperienceLevel,
+				MarketingReach:  form.MarketingReach,
+				Attended:        pointer.BoolP(a.Attended),
+				AttendedMinutes: a.Minutes,
+				RecordingLink:   info.YoutubeLink,
+			},
+		})
+		if err != nil {
+			klog.ErrorS(err, "failed to record webinar attendance", "email", form.WorkEmail)
+		}
+
+		if a.Attended {
+			rec.Attended = append(rec.Attended, form.WorkEmail)
+		} else {
+			rec.Missed = append(rec.Missed, form.WorkEmail)
+		}
+		if err := s.saveWebinarFollowUp(sheetName, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	rec.SentAt = &now
+	if err := s.saveWebinarFollowUp(sheetName, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (s *Server) saveWebinarFollowUp(sheetName string, rec *WebinarFollowUp) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(context.TODO(), WebinarFollowUpPath(sheetName), data)
+}
+
+func (s *Server) getWebinarFollowUp(sheetName string) (*WebinarFollowUp, error) {
+	path := WebinarFollowUpPath(sheetName)
+	if ok, err := s.fs.Exists(context.TODO(), path); err != nil || !ok {
+		return nil, err
+	}
+	data, err := s.fs.ReadFile(context.TODO(), path)
+	if err != nil {
+		return nil, err
+	}
+	var rec WebinarFollowUp
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// listWebinarRegistrations returns the rows of the registration sheet of a session.
+func (s *Server) listWebinarRegistrations(sheetName string) ([]*WebinarRegistrationForm, error) {
+	reader, err := gdrive.NewReader(s.srvSheets, WebinarSpreadsheetId, sheetName, 1)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	registrants := []*WebinarRegistrationForm{}
+	if err := gocsv.UnmarshalCSV(reader, &registrants); err != nil {
+		return nil, err
+	}
+	return registrants, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.bytebuilders.dev/offline-license-server/pkg/server"
+)
+
+func TestMatchWebinarAttendance(t *testing.T) {
+	registrants := []*server.WebinarRegistrationForm{
+		{FirstName: "Jane", LastName: "Doe", WorkEmail: "jane@example.com"},
+		{FirstName: "John", LastName: "Roe", WorkEmail: "john@example.com"},
+		{FirstName: "Ann", LastName: "Lee", WorkEmail: "ann@example.com"},
+		{FirstName: "Jane", LastName: "Doe", WorkEmail: "Jane@example.com"}, // duplicate signup
+	}
+	participants := []server.ZoomParticipant{
+		{Name: "Jane D", UserEmail: "JANE@example.com", Duration: 1200},
+		{Name: "Jane D", UserEmail: "jane@example.com", Duration: 600}, // rejoined
+		{Name: "john  roe", Duration: 300},                             // guest without email
+		{Name: "Someone Else", UserEmail: "else@example.com", Duration: 3600},
+	}
+
+	found := server.MatchWebinarAttendance(registrants, participants)
+	expected := []struct {
+		email    string
+		attended bool
+		minutes  int
+	}{
+		{"jane@example.com", true, 30},
+		{"john@example.com", true, 5},
+		{"ann@example.com", false, 0},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d registrants, found %d", len(expected), len(found))
+	}
+	for i, e := range expected {
+		a := found[i]
+		if a.Registration.WorkEmail != e.email || a.Attended != e.attended || a.Minutes != e.minutes {
+			t.Errorf("expected %s attended=%v minutes=%d, found %s attended=%v minutes=%d",
+				e.email, e.attended, e.minutes, a.Registration.WorkEmail, a.Attended, a.Minutes)
+		}
+	}
+}
+
+func TestZoomReportClientMeetingParticipants(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/report/meetings/81234567890/participants" {
+			http.NotFound(w, r)
+			return
+		}
+		resp := map[string]any{
+			"participants": []map[string]any{{"name": "Jane Doe", "user_email": "jane@example.com", "duration": 60}},
+		}
+		if r.URL.Query().Get("next_page_token") == "" {
+			resp["next_page_token"] = "page-2"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	c := &server.ZoomReportClient{Endpoint: srv.URL, Client: srv.Client()}
+	participants, err := c.MeetingParticipants(81234567890)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(participants) != 2 {
+		t.Errorf("expected participants of both pages, found %d", len(participants))
+	}
+
+	if _, err := c.MeetingParticipants(1); err == nil {
+		t.Errorf("expected error for unknown meeting")
+	}
+}
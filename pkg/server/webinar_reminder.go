@@ -0,0 +1,158 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/k3a/html2text"
+	"k8s.io/klog/v2"
+)
+
+const (
+	TaskWebinarReminder = "webinar-reminder"
+
+	WebinarDuration = 60 * time.Minute
+
+	// WebinarICSFilename is the calendar invite attached to the confirmation email.
+	WebinarICSFilename = "appscode-webinar.ics"
+)
+
+// WebinarReminders are sent this long before a webinar starts. Reminders that are
+// already due when someone registers are skipped.
+var WebinarReminders = []time.Duration{
+	24 * time.Hour,
+	1 * time.Hour,
+}
+
+// ZoomJoinURL returns the join link of the Zoom meeting, or "" if there is no meeting.
+func (m WebinarMeetingID) ZoomJoinURL() string {
+	if m.ZoomMeetingID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://zoom.us/j/%d", m.ZoomMeetingID)
+}
+
+// WebinarRegistration is a registration for one session of a webinar. It is stored
+// with the reminder tasks, so reminders only read the webinar spreadsheet if the
+// meeting didn't exist yet when the registrant signed up.
+type WebinarRegistration struct {
+	Email    string           `json:"email"`
+	Name     string           `json:"name"`
+	Title    string           `json:"title"`
+	Summary  string           `json:"summary,omitempty"`
+	Schedule time.Time        `json:"schedule"`
+	Timezone string           `json:"timezone,omitempty"`
+	Meeting  WebinarMeetingID `json:"meeting"`
+}
+
+// LocalSchedule formats the start time in the timezone of the registrant, or UTC if
+// the timezone is unknown.
+func (r WebinarRegistration) LocalSchedule() string {
+	if tz, err := time.LoadLocation(r.Timezone); err == nil {
+		return r.Schedule.In(tz).Format(time.RFC1123)
+	}
+	return r.Schedule.UTC().Format(time.RFC1123)
+}
+
+// CalendarEvent returns the event attached to the confirmation email. The UID is the
+// same for every registrant of a session.
+func (r WebinarRegistration) CalendarEvent() CalendarEvent {
+	var desc strings.Builder
+	if r.Summary != "" {
+		desc.WriteString(strings.TrimSpace(html2text.HTML2Text(r.Summary)))
+		desc.WriteString("\n\n")
+	}
+	if link := r.Meeting.ZoomJoinURL(); link != "" {
+		fmt.Fprintf(&desc, "Join Zoom Meeting: %s\nMeeting ID: %d\n", link, r.Meeting.ZoomMeetingID)
+		if r.Meeting.ZoomMeetingPassword != "" {
+			fmt.Fprintf(&desc, "Passcode: %s\n", r.Meeting.ZoomMeetingPassword)
+		}
+	}
+
+	return CalendarEvent{
+		UID:            fmt.Sprintf("webinar-%s@appscode.com", r.Schedule.UTC().Format(icsTimeFormat)),
+		Summary:        strings.TrimSuffix("AppsCode Webinar: "+r.Title, ": "),
+		Description:    strings.TrimSpace(desc.String()),
+		Location:       r.Meeting.ZoomJoinURL(),
+		URL:            r.Meeting.ZoomJoinURL(),
+		OrganizerName:  "AppsCode",
+		OrganizerEmail: MailHello,
+		Start:          r.Schedule,
+		End:            r.Schedule.Add(WebinarDuration),
+		Alarm:          15 * time.Minute,
+	}
+}
+
+// confirmWebinarRegistration emails the calendar invite and schedules the reminders.
+func (s *Server) confirmWebinarRegistration(r WebinarRegistration) error {
+	if err := s.sendMail(NewWebinarConfirmationMailer(r), r.Email, ""); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, before := range WebinarReminders {
+		at := r.Schedule.Add(-before)
+		if at.Before(now) {
+			continue
+		}
+		args, err := json.Marshal(WebinarReminderArgs{
+			Registration: r,
+			Before:       before,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.sch.ScheduleTask(at, TaskWebinarReminder, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type WebinarReminderArgs struct {
+	Registration WebinarRegistration `json:"registration"`
+	Before       time.Duration       `json:"before"`
+}
+
+// SendWebinarReminder is the handler of TaskWebinarReminder. Reminders resumed after
+// the webinar has started are dropped. The webinar is looked up again if its info or
+// its meeting were missing when the reminder was scheduled.
+func (s *Server) SendWebinarReminder(data []byte) error {
+	var args WebinarReminderArgs
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	if time.Now().After(args.Registration.Schedule) {
+		klog.InfoS("skipped reminder for past webinar", "email", args.Registration.Email, "schedule", args.Registration.Schedule)
+		return nil
+	}
+	r := args.Registration
+	if r.Title == "" || r.Meeting.ZoomMeetingID == 0 {
+		if info, err := s.findWebinarInfo(r.Schedule); err != nil {
+			klog.Warningln(err)
+		} else {
+			r.Title = info.Title
+			r.Summary = info.Summary
+			r.Meeting = info.WebinarMeetingID
+		}
+	}
+	return s.sendMail(NewWebinarReminderMailer(r, args.Before), r.Email, "")
+}
@@ -0,0 +1,114 @@
+/*
+Copyright AppsCode Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// ZoomReportClient reads meeting reports, which gomodules.xyz/zoom-lib-golang does not
+// cover. It uses the same server-to-server OAuth app as zoom.NewClient.
+type ZoomReportClient struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewZoomReportClient() *ZoomReportClient {
+	params := url.Values{}
+	params.Add("grant_type", "account_credentials")
+	params.Add("account_id", os.Getenv("ZOOM_ACCOUNT_ID"))
+
+	cfg := clientcredentials.Config{
+		ClientID:       os.Getenv("ZOOM_CLIENT_ID"),
+		ClientSecret:   os.Getenv("ZOOM_CLIENT_SECRET"),
+		TokenURL:       "https://zoom.us/oauth/token",
+		EndpointParams: params,
+		AuthStyle:      oauth2.AuthStyleInHeader,
+	}
+	client := cfg.Client(context.Background())
+	client.Timeout = 30 * time.Second
+	return &ZoomReportClient{
+		Endpoint: "https://api.zoom.us/v2",
+		Client:   client,
+	}
+}
+
+// ZoomParticipant is an entry of the participant report. A participant who rejoins
+// is listed once per session.
+type ZoomParticipant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UserEmail string    `json:"user_email"`
+	JoinTime  time.Time `json:"join_time"`
+	LeaveTime time.Time `json:"leave_time"`
+	// Duration is in seconds.
+	Duration int `json:"duration"`
+}
+
+type zoomParticipantReport struct {
+	NextPageToken string            `json:"next_page_token"`
+	Participants  []ZoomParticipant `json:"participants"`
+}
+
+// MeetingParticipants returns the participant report of a past meeting. Reports are
+// available a few minutes after the meeting ends.
+// ref: https://developers.zoom.us/docs/api/rest/reference/zoom-api/methods/#operation/reportMeetingParticipants
+func (c *ZoomReportClient) MeetingParticipants(meetingID int) ([]ZoomParticipant, error) {
+	var out []ZoomParticipant
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("page_size", "300")
+		if token != "" {
+			q.Set("next_page_token", token)
+		}
+		u := fmt.Sprintf("%s/report/meetings/%d/participants?%s", c.Endpoint, meetingID, q.Encode())
+
+		resp, err := c.Client.Get(u)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get participant report of zoom meeting %d: %s: %s", meetingID, resp.Status, body)
+		}
+
+		var page zoomParticipantReport
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		out = append(out, page.Participants...)
+		if page.NextPageToken == "" {
+			return out, nil
+		}
+		token = page.NextPageToken
+	}
+}